@@ -0,0 +1,130 @@
+package vfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+// An AggregateMerger combines the results of a GROUP BY query which
+// was evaluated in parts (e.g. each node of a cluster ran the query
+// over its own data) into the result of the query over all the
+// data.
+//
+// Rows with the same group by key are merged into one row. Columns
+// which are a plain call to an aggregate function (e.g. count() or
+// max(item=X)) are combined using the function's MergeAggregate()
+// method and other columns take the value of the last row
+// added. Therefore the GROUP BY clause must only refer to output
+// columns so the key can be calculated from the partial results.
+//
+// The parts should be evaluated without HAVING, ORDER BY or LIMIT
+// clauses since these only apply to the merged result.
+type AggregateMerger struct {
+	ctx   context.Context
+	scope types.Scope
+	query *_Select
+
+	// Maps column names to the aggregate that merges them.
+	aggregates map[string]types.MergeableAggregator
+
+	// Merged rows keyed by group in first seen order.
+	bins *ordereddict.Dict
+}
+
+func NewAggregateMerger(ctx context.Context, scope types.Scope,
+	vql *VQL) (*AggregateMerger, error) {
+	query := vql.Query
+	if query == nil || query.GroupBy == nil {
+		return nil, errors.New("AggregateMerger: query has no GROUP BY clause")
+	}
+
+	result := &AggregateMerger{
+		ctx:        ctx,
+		scope:      scope,
+		query:      query,
+		aggregates: make(map[string]types.MergeableAggregator),
+		bins:       ordereddict.NewDict(),
+	}
+
+	for _, column := range query.SelectExpression.Expressions {
+		if column.Expression == nil {
+			continue
+		}
+
+		name := column.GetName(scope)
+		aggregate, ok := getMergeableAggregate(scope, column.Expression)
+		if ok {
+			result.aggregates[name] = aggregate
+			continue
+		}
+
+		if column.Expression.IsAggregate(scope) {
+			return nil, fmt.Errorf(
+				"AggregateMerger: column %v can not be merged", name)
+		}
+	}
+
+	return result, nil
+}
+
+func getMergeableAggregate(scope types.Scope,
+	expression *_AndExpression) (types.MergeableAggregator, bool) {
+	value := andSingleValue(expression)
+	if value == nil || value.SymbolRef == nil || !value.SymbolRef.Called {
+		return nil, false
+	}
+
+	function, pres := scope.GetFunction(value.SymbolRef.Symbol)
+	if !pres {
+		return nil, false
+	}
+
+	aggregate, ok := function.(types.MergeableAggregator)
+	return aggregate, ok
+}
+
+// Add merges a row of a partial result.
+func (self *AggregateMerger) Add(row Row) {
+	row_dict := dict.RowToDict(self.ctx, self.scope, row)
+
+	subscope := self.scope.Copy()
+	subscope.AppendVars(row_dict)
+	key := self.query.groupByKey(self.ctx, subscope)
+	subscope.Close()
+
+	existing_any, pres := self.bins.Get(key)
+	if !pres {
+		self.bins.Set(key, row_dict)
+		return
+	}
+
+	existing := existing_any.(*ordereddict.Dict)
+	for _, column := range row_dict.Keys() {
+		value, _ := row_dict.Get(column)
+
+		aggregate, ok := self.aggregates[column]
+		if ok {
+			old_value, pres := existing.Get(column)
+			if pres {
+				value = aggregate.MergeAggregate(self.scope, old_value, value)
+			}
+		}
+		existing.Set(column, value)
+	}
+}
+
+// Rows returns the merged rows in the order their group was first
+// seen.
+func (self *AggregateMerger) Rows() []*ordereddict.Dict {
+	result := make([]*ordereddict.Dict, 0, self.bins.Len())
+	for _, key := range self.bins.Keys() {
+		row, _ := self.bins.Get(key)
+		result = append(result, row.(*ordereddict.Dict))
+	}
+	return result
+}
@@ -35,8 +35,10 @@ type StoredQuery = types.StoredQuery
 
 type ScopeUnmarshaller = scope.ScopeUnmarshaller
 
+// NewScope creates a scope with the builtin functions and plugins,
+// including those which depend on the VQL parser.
 func NewScope() types.Scope {
-	return scope.NewScope()
+	return scope.NewScope().AppendFunctions(_AnyFunction{}, _AllFunction{})
 }
 
 func RowToDict(
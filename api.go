@@ -102,6 +102,7 @@ func GetResponseChannel(
 }
 
 // A convenience function to generate JSON output from a VQL query.
+// All rows are held in memory - use a JSONStreamer for large results.
 func OutputJSON(
 	vql *VQL,
 	ctx context.Context,
@@ -3,11 +3,17 @@ package vfilter
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter/types"
 )
 
 func marshal_indent(rows []Row) ([]byte, error) {
@@ -59,3 +65,463 @@ func TestAPIGetResponseChannel(t *testing.T) {
 	)
 	g.AssertJson(t, "api", golden)
 }
+
+func TestEvalPage(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	vql, err := Parse("SELECT value FROM range(start=1, end=7)")
+	assert.NoError(t, err)
+
+	values := func(page *Page) []string {
+		result := []string{}
+		for _, row := range page.Rows {
+			value, _ := row.Get("value")
+			result = append(result, fmt.Sprint(value))
+		}
+		return result
+	}
+
+	page, err := EvalPage(ctx, vql, scope, "", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, values(page))
+	assert.NotEqual(t, "", page.Cursor)
+
+	page, err = EvalPage(ctx, vql, scope, page.Cursor, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "5", "6"}, values(page))
+
+	// The last page has no cursor.
+	page, err = EvalPage(ctx, vql, scope, page.Cursor, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"7"}, values(page))
+	assert.Equal(t, "", page.Cursor)
+
+	// Cursors only apply to the query which made them.
+	page, err = EvalPage(ctx, vql, scope, "", 3)
+	assert.NoError(t, err)
+
+	other, err := Parse("SELECT value FROM range(start=1, end=8)")
+	assert.NoError(t, err)
+
+	_, err = EvalPage(ctx, other, scope, page.Cursor, 3)
+	assert.Error(t, err)
+
+	_, err = EvalPage(ctx, vql, scope, "garbage", 3)
+	assert.Error(t, err)
+}
+
+// Produces the numbers 1 to 100 and counts the rows it produced.
+type seekingPlugin struct {
+	mu       sync.Mutex
+	produced int
+}
+
+func (self *seekingPlugin) Call(ctx context.Context,
+	scope types.Scope, args *ordereddict.Dict) <-chan Row {
+	return self.CallWithOffset(ctx, scope, args, 0)
+}
+
+func (self *seekingPlugin) CallWithOffset(ctx context.Context,
+	scope types.Scope, args *ordereddict.Dict, offset int64) <-chan Row {
+	output_chan := make(chan Row)
+	go func() {
+		defer close(output_chan)
+
+		for i := offset + 1; i <= 100; i++ {
+			self.mu.Lock()
+			self.produced++
+			self.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().Set("value", i):
+			}
+		}
+	}()
+	return output_chan
+}
+
+func (self *seekingPlugin) Info(scope types.Scope,
+	type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{Name: "seek"}
+}
+
+func (self *seekingPlugin) reset() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	produced := self.produced
+	self.produced = 0
+	return produced
+}
+
+// Later pages do not make the source produce the earlier pages again.
+func TestEvalPageOffset(t *testing.T) {
+	ctx := context.Background()
+	plugin := &seekingPlugin{}
+	scope := makeTestScope().AppendPlugins(plugin)
+
+	// Returns the third page of 10 rows.
+	third_page := func(query string) string {
+		vql, err := Parse(query)
+		assert.NoError(t, err)
+
+		cursor := ""
+		for i := 0; i < 3; i++ {
+			plugin.reset()
+			page, err := EvalPage(ctx, vql, scope, cursor, 10)
+			assert.NoError(t, err)
+
+			if i == 2 {
+				serialized, _ := json.Marshal(page.Rows)
+				return string(serialized)
+			}
+			cursor = page.Cursor
+		}
+		return ""
+	}
+
+	assert.Equal(t, `[{"value":21},{"value":22},{"value":23},{"value":24},{"value":25},`+
+		`{"value":26},{"value":27},{"value":28},{"value":29},{"value":30}]`,
+		third_page("SELECT value FROM seek()"))
+
+	// The plugin started at the page. It reads a few rows past the
+	// page before the query is cancelled but far fewer than the 30
+	// rows up to the end of the page.
+	assert.True(t, plugin.reset() < 30)
+
+	// Stored queries pass the offset on.
+	vql, err := Parse("LET numbers = SELECT value AS X FROM seek()")
+	assert.NoError(t, err)
+	for range vql.Eval(ctx, scope) {
+	}
+
+	assert.Equal(t, `[{"X":21},{"X":22},{"X":23},{"X":24},{"X":25},`+
+		`{"X":26},{"X":27},{"X":28},{"X":29},{"X":30}]`,
+		third_page("SELECT X FROM numbers"))
+	assert.True(t, plugin.reset() < 30)
+
+	// A WHERE clause needs all the rows before the page.
+	assert.Equal(t, `[{"value":26},{"value":27},{"value":28},{"value":29},{"value":30},`+
+		`{"value":31},{"value":32},{"value":33},{"value":34},{"value":35}]`,
+		third_page("SELECT value FROM seek() WHERE value > 5"))
+	assert.True(t, plugin.reset() >= 35)
+
+	// So do aggregates.
+	assert.Equal(t, `[{"value":21,"Count":21},{"value":22,"Count":22},`+
+		`{"value":23,"Count":23},{"value":24,"Count":24},{"value":25,"Count":25},`+
+		`{"value":26,"Count":26},{"value":27,"Count":27},{"value":28,"Count":28},`+
+		`{"value":29,"Count":29},{"value":30,"Count":30}]`,
+		third_page("SELECT value, count() AS Count FROM seek()"))
+}
+
+func TestOutputTable(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	vql, err := Parse(`
+SELECT value AS Value, format(format='%v|long text', args=value) AS Text
+FROM range(start=1, end=3)`)
+	assert.NoError(t, err)
+
+	render := func(opts *TableOptions) string {
+		out := &strings.Builder{}
+		assert.NoError(t, OutputTable(ctx, scope, vql, out, opts))
+		return out.String()
+	}
+
+	assert.Equal(t, `+-------+-------------+
+| Value | Text        |
++-------+-------------+
+| 1     | 1|long text |
+| 2     | 2|long text |
+| 3     | 3|long text |
++-------+-------------+
+`, render(nil))
+
+	assert.Equal(t, `| Value | Text      |
+| ----- | --------- |
+| 1     | 1\|lon... |
+| 2     | 2\|lon... |
+Only the first 2 rows are shown.
+`, render(&TableOptions{Markdown: true, MaxWidth: 8, MaxRows: 2}))
+}
+
+var createViewRegex = regexp.MustCompile(`(?is)^\s*VIEW\s+(\w+)\s+AS\s+(.+)$`)
+
+func TestStatementHandlers(t *testing.T) {
+	// CREATE VIEW X AS SELECT ... is the same as LET X = SELECT ...
+	calls := 0
+	assert.NoError(t, RegisterStatementHandler("create",
+		func(keyword, body string) ([]*VQL, error) {
+			calls++
+			match := createViewRegex.FindStringSubmatch(body)
+			if match == nil {
+				return nil, errors.New("expected VIEW name AS query")
+			}
+			return MultiParse("LET " + match[1] + " = " + match[2])
+		}))
+	defer UnregisterStatementHandler("CREATE")
+
+	assert.Error(t, RegisterStatementHandler("SELECT", nil))
+	assert.Error(t, RegisterStatementHandler("two words", nil))
+
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	statements, err := MultiParse(`
+CREATE VIEW Numbers AS SELECT value FROM range(start=1, end=3);
+-- Statements may follow on the same line.
+create view Odd AS SELECT * FROM Numbers WHERE value = 1 OR value = 3; SELECT value AS Create
+FROM Odd;`)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(statements))
+
+	// Each custom statement is handled once.
+	assert.Equal(t, 2, calls)
+
+	rows := []Row{}
+	for _, vql := range statements {
+		for row := range vql.Eval(ctx, scope) {
+			rows = append(rows, row)
+		}
+	}
+	serialized, err := json.Marshal(rows)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Create":1},{"Create":3}]`, string(serialized))
+
+	// A single custom statement may be parsed on its own.
+	vql, err := Parse("CREATE VIEW X AS SELECT * FROM scope()")
+	assert.NoError(t, err)
+	assert.Equal(t, "LAZY_LET", vql.Type())
+
+	// Errors point at the custom statement.
+	_, err = MultiParse("SELECT * FROM scope();\nCREATE TABLE X")
+	assert.Error(t, err)
+	assert.Equal(t, `CREATE: expected VIEW name AS query
+2 | CREATE TABLE X
+  | ^`, err.Error())
+
+	// A custom statement must follow a ";".
+	_, err = MultiParse("SELECT * FROM scope() CREATE VIEW X AS SELECT * FROM scope()")
+	assert.Error(t, err)
+}
+
+// Fails once more than limit bytes are written.
+type limitedWriter struct {
+	strings.Builder
+	limit int
+}
+
+func (self *limitedWriter) Write(b []byte) (int, error) {
+	if self.Len()+len(b) > self.limit {
+		return 0, errors.New("writer is full")
+	}
+	return self.Builder.Write(b)
+}
+
+func TestJSONStreamer(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	vql, err := Parse("SELECT value FROM range(start=1, end=3)")
+	assert.NoError(t, err)
+
+	out := &strings.Builder{}
+	n, err := NewJSONStreamer(ctx, scope, vql, nil).WriteTo(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n{\"value\":1},\n{\"value\":2},\n{\"value\":3}\n]\n", out.String())
+	assert.Equal(t, int64(out.Len()), n)
+
+	out.Reset()
+	_, err = NewJSONStreamer(ctx, scope, vql, &JSONStreamOptions{Lines: true}).
+		WriteTo(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"value\":1}\n{\"value\":2}\n{\"value\":3}\n", out.String())
+
+	empty, err := Parse("SELECT * FROM range(start=1, end=3) WHERE FALSE")
+	assert.NoError(t, err)
+
+	out.Reset()
+	_, err = NewJSONStreamer(ctx, scope, empty, nil).WriteTo(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]\n", out.String())
+
+	// A write error stops the query.
+	limited := &limitedWriter{limit: 20}
+	n, err = NewJSONStreamer(ctx, scope, vql, &JSONStreamOptions{Lines: true}).
+		WriteTo(limited)
+	assert.Error(t, err)
+	assert.Equal(t, "{\"value\":1}\n", limited.String())
+	assert.Equal(t, int64(12), n)
+}
+
+func TestGetStringPredicates(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	vql, err := Parse(`
+SELECT * FROM test()
+WHERE starts_with(string=Name, prefix='svc') AND
+      (ends_with(string=` + "`Full Path`" + `, suffix='.exe', case_sensitive=TRUE)) AND
+      foo = 1 AND
+      contains(string=Name, substring=lower(string='X')) AND
+      NOT contains(string=Name, substring='x')`)
+	assert.NoError(t, err)
+
+	serialized, err := json.Marshal(GetStringPredicates(ctx, scope, vql))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Operator":"starts_with","Column":"Name","Value":"svc","CaseSensitive":false},`+
+		`{"Operator":"ends_with","Column":"Full Path","Value":".exe","CaseSensitive":true}]`,
+		string(serialized))
+
+	// Predicates are not required when they are ORed.
+	vql, err = Parse(`SELECT * FROM test()
+WHERE starts_with(string=Name, prefix='svc') OR foo = 1`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(GetStringPredicates(ctx, scope, vql)))
+}
+
+func TestQueryPlan(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope().AppendVars(ordereddict.NewDict().
+		Set("End", 4).
+		Set("Min", 2))
+
+	statements, err := MultiParse(`
+LET X(start) = SELECT * FROM range(start=start, end=End)
+SELECT format(format='%v', args=value) AS V FROM X(start=1) WHERE value > Min
+`)
+	assert.NoError(t, err)
+
+	serialized, err := NewQueryPlan(scope, statements).Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":1,"statements":[`+
+		`"LET X(start)=SELECT*FROM range(start=start,end=End)",`+
+		`"SELECT format(format='%v',args=value)AS V FROM X(start=1)WHERE value\u003eMin"],`+
+		`"parameters":["End","Min"],"plugins":["range"],"functions":["format"]}`,
+		string(serialized))
+
+	plan, err := UnmarshalQueryPlan(serialized)
+	assert.NoError(t, err)
+
+	// The remote scope must provide the parameters.
+	_, err = plan.Load(makeTestScope())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter End, parameter Min")
+
+	remote := makeTestScope().AppendVars(ordereddict.NewDict().
+		Set("End", 5).
+		Set("Min", 3))
+	loaded, err := plan.Load(remote)
+	assert.NoError(t, err)
+
+	values := []string{}
+	for _, vql := range loaded {
+		for row := range vql.Eval(ctx, remote) {
+			value, _ := remote.Associative(row, "V")
+			values = append(values, value.(string))
+		}
+	}
+	assert.Equal(t, []string{"4", "5"}, values)
+
+	_, err = UnmarshalQueryPlan([]byte(`{"version":100}`))
+	assert.Error(t, err)
+}
+
+func TestPreparedQuery(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	prepared, err := Prepare(`
+LET X = SELECT * FROM range(start=1, end=End)
+SELECT value FROM X WHERE value >= Min
+`)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			params := ordereddict.NewDict().
+				Set("End", i+2).
+				Set("Min", i+1)
+
+			values := []string{}
+			for row := range prepared.Eval(ctx, scope, params) {
+				value, _ := scope.Associative(row, "value")
+				values = append(values, fmt.Sprintf("%v", value))
+			}
+			results[i] = strings.Join(values, ",")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprintf("%v,%v", i+1, i+2), result)
+	}
+
+	// Neither the params nor the LET definitions leak into the scope.
+	_, pres := scope.Resolve("X")
+	assert.False(t, pres)
+	_, pres = scope.Resolve("End")
+	assert.False(t, pres)
+
+	_, err = Prepare("SELECT * FROM")
+	assert.Error(t, err)
+}
+
+func TestAggregateMerger(t *testing.T) {
+	ctx := context.Background()
+	scope := makeTestScope()
+
+	vql, err := Parse(`
+SELECT value > 3 AS Big, count() AS Count, sum(item=value) AS Sum,
+       min(item=value) AS Min, max(item=value) AS Max,
+       enumerate(items=value) AS Items, value AS Last
+FROM range(start=Start, end=End)
+GROUP BY Big`)
+	assert.NoError(t, err)
+
+	merger, err := NewAggregateMerger(ctx, scope, vql)
+	assert.NoError(t, err)
+
+	// Evaluate the query over two parts of the data.
+	for _, part := range [][]int{{1, 4}, {5, 6}, {2, 2}} {
+		subscope := scope.Copy().AppendVars(ordereddict.NewDict().
+			Set("Start", part[0]).
+			Set("End", part[1]))
+		for row := range vql.Eval(ctx, subscope) {
+			merger.Add(row)
+		}
+		subscope.Close()
+	}
+
+	serialized, err := json.Marshal(merger.Rows())
+	assert.NoError(t, err)
+	assert.Equal(t, `[`+
+		`{"Big":false,"Count":4,"Sum":8,"Min":1,"Max":3,"Items":[1,2,3,2],"Last":2},`+
+		`{"Big":true,"Count":3,"Sum":15,"Min":4,"Max":6,"Items":[4,5,6],"Last":6}]`,
+		string(serialized))
+
+	// Aggregates inside expressions can not be merged.
+	vql, err = Parse(`
+SELECT value > 3 AS Big, count() + 1 AS Count
+FROM range(start=1, end=5) GROUP BY Big`)
+	assert.NoError(t, err)
+
+	_, err = NewAggregateMerger(ctx, scope, vql)
+	assert.Error(t, err)
+
+	vql, err = Parse(`SELECT count() AS Count FROM range(start=1, end=5)`)
+	assert.NoError(t, err)
+
+	_, err = NewAggregateMerger(ctx, scope, vql)
+	assert.Error(t, err)
+}
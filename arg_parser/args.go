@@ -73,6 +73,9 @@ func ExtractArgsWithContext(
 	}
 
 	err = parser.Parse(ctx, scope, args, v)
+	if err != nil {
+		err = parser.enrichError(types.GetCallName(ctx), err)
+	}
 	scope.Explainer().ParseArgs(args, target, err)
 	return err
 }
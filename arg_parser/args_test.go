@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/alecthomas/assert"
@@ -144,6 +147,64 @@ SELECT parse(r=1,int=1, foobar=2) FROM scope()`},
 
 	{"Required args", `
 SELECT parse() FROM scope()`},
+
+	{"Time from epoch, string and fractional epoch", `
+SELECT parse(r=1, time=1600000000),
+       parse(r=1, time="2020-09-13T12:26:40Z"),
+       parse(r=1, time="2020-09-13"),
+       parse(r=1, time=1600000000.5)
+FROM scope()`},
+
+	{"Invalid time", `
+SELECT parse(r=1, time="yesterday") FROM scope()`},
+
+	{"Duration from seconds and string", `
+SELECT parse(r=1, duration=90), parse(r=1, duration="1h30m"),
+       parse(r=1, duration="2.5")
+FROM scope()`},
+
+	{"IP address", `
+SELECT parse(r=1, ip="192.168.1.1"), parse(r=1, ip="::1"),
+       parse(r=1, ip="not an ip"), parse(r=1, ip=ip(string="10.0.0.1"))
+FROM scope()`},
+
+	{"Nested struct and map", `
+SELECT parse(r=1, nested=dict(name="foo", inner=dict(count=2)),
+             headers=dict(A=1, B="x"))
+FROM scope()`},
+
+	{"Nested struct errors report the field path", `
+SELECT parse(r=1, nested=dict(name="foo", inner=dict())),
+       parse(r=1, nested=dict(name="foo", inner=dict(count="x"))),
+       parse(r=1, nested=dict(name="foo", bar=1))
+FROM scope()`},
+
+	{"Choices", `
+SELECT parse(r=1, choice="b"), parse(r=1, choice="d"),
+       parse(r=1, choices=["a", "c"]), parse(r=1, choices=["a", "x"])
+FROM scope()`},
+
+	{"Default values", `
+SELECT parse(r=1, with_defaults=dict()),
+       parse(r=1, with_defaults=dict(count=2, name="bar"))
+FROM scope()`},
+
+	// The old name is still accepted with a deprecation warning.
+	{"Renamed arg aliases", `
+SELECT parse(r=1, renamed="new"), parse(r=1, old_name="old")
+FROM scope()`},
+
+	// Misspelled args get a suggestion.
+	{"Misspelled args", `
+SELECT parse(r=1, strng="hello"), parse(r=1, Dict=dict()) FROM scope()`},
+
+	// All errors are reported at once.
+	{"Multiple errors", `
+SELECT parse(int="x", foo=1, nested=dict(inner=dict(count="y"))) FROM scope()`},
+
+	// Positional args fill the fields not given by name in order.
+	{"Positional args", `
+SELECT parse(any=1, lazy=2, 5, "hello", r=1) FROM scope()`},
 }
 
 type argFuncArgs struct {
@@ -155,6 +216,33 @@ type argFuncArgs struct {
 	StoredQuery types.StoredQuery `vfilter:"optional,field=query"`
 	R           int               `vfilter:"required,field=r"`
 	Dict        *ordereddict.Dict `vfilter:"optional,field=dict"`
+	Time        time.Time         `vfilter:"optional,field=time"`
+	Duration    time.Duration     `vfilter:"optional,field=duration"`
+	IP          net.IP            `vfilter:"optional,field=ip"`
+	Nested      *nestedArgs       `vfilter:"optional,field=nested"`
+	Headers     map[string]string `vfilter:"optional,field=headers"`
+	Choice      string            `vfilter:"optional,field=choice,choices=a|b|c"`
+	Choices     []string          `vfilter:"optional,field=choices,choices=a|b|c"`
+	Defaults    *defaultArgs      `vfilter:"optional,field=with_defaults"`
+	Renamed     string            `vfilter:"optional,field=renamed,alias=old_name"`
+}
+
+type defaultArgs struct {
+	Count     int64         `vfilter:"optional,field=count,default=5"`
+	Name      string        `vfilter:"optional,field=name,default=foo"`
+	Enabled   bool          `vfilter:"optional,field=enabled,default=true"`
+	Timeout   time.Duration `vfilter:"optional,field=timeout,default=1m"`
+	Tags      []string      `vfilter:"optional,field=tags,default=a|b"`
+	NoDefault int64         `vfilter:"optional,field=no_default"`
+}
+
+type innerArgs struct {
+	Count int64 `vfilter:"required,field=count"`
+}
+
+type nestedArgs struct {
+	Name  string    `vfilter:"required,field=name"`
+	Inner innerArgs `vfilter:"optional,field=inner"`
 }
 
 type argFunc struct{}
@@ -213,6 +301,42 @@ func (self argFunc) Call(ctx context.Context, scope types.Scope, args *ordereddi
 		}
 	}
 
+	if !arg.Time.IsZero() {
+		result.Set("time", arg.Time)
+	}
+
+	if arg.Duration != 0 {
+		result.Set("duration", arg.Duration.String())
+	}
+
+	if arg.IP != nil {
+		result.Set("ip", arg.IP.String())
+	}
+
+	if arg.Nested != nil {
+		result.Set("nested", arg.Nested)
+	}
+
+	if arg.Headers != nil {
+		result.Set("headers", arg.Headers)
+	}
+
+	if arg.Defaults != nil {
+		result.Set("with_defaults", arg.Defaults)
+	}
+
+	if arg.Renamed != "" {
+		result.Set("renamed", arg.Renamed)
+	}
+
+	if arg.Choice != "" {
+		result.Set("choice", arg.Choice)
+	}
+
+	if arg.Choices != nil {
+		result.Set("choices", arg.Choices)
+	}
+
 	if arg.StoredQuery != nil {
 		result.Set("StoredQuery Materialized",
 			types.Materialize(ctx, scope, arg.StoredQuery))
@@ -280,3 +404,60 @@ func TestArgParsing(t *testing.T) {
 	)
 	g.AssertJson(t, "args", result)
 }
+
+// Defaults and choices are visible through the type map so UIs can
+// show them.
+func TestTypeMapDirectives(t *testing.T) {
+	scope := makeTestScope()
+	type_map := types.NewTypeMap()
+	name := type_map.AddType(scope, &defaultArgs{})
+
+	desc, pres := type_map.Get(scope, name)
+	assert.True(t, pres)
+
+	field, pres := desc.Fields.Get("count")
+	assert.True(t, pres)
+	assert.Equal(t, "5", field.(*types.TypeReference).Default)
+
+	desc, _ = type_map.Get(scope, type_map.AddType(scope, &argFuncArgs{}))
+	field, _ = desc.Fields.Get("choice")
+	assert.Equal(t, []string{"a", "b", "c"}, field.(*types.TypeReference).Choices)
+}
+
+type taggedArgs struct {
+	Filter string `vfilter:"optional,field=filter,default=x=1,doc=Only rows where x=1, y=2 or both."`
+}
+
+type badDefaultArgs struct {
+	Mode string `vfilter:"optional,field=mode,choices=a|b,default=c"`
+}
+
+type commaDefaultArgs struct {
+	Sep string `vfilter:"optional,field=sep,default=a,b"`
+}
+
+// Doc values run to the end of the tag and other values may contain
+// "=". Mistakes in the tag are found when the parser is built.
+func TestBuildParserTags(t *testing.T) {
+	scope := makeTestScope()
+	type_map := types.NewTypeMap()
+	desc, _ := type_map.Get(scope, type_map.AddType(scope, &taggedArgs{}))
+	field, _ := desc.Fields.Get("filter")
+	assert.Equal(t, "Only rows where x=1, y=2 or both.",
+		field.(*types.TypeReference).Doc())
+	assert.Equal(t, "x=1", field.(*types.TypeReference).Default)
+
+	arg := &taggedArgs{}
+	err := arg_parser.ExtractArgsWithContext(context.Background(), scope,
+		ordereddict.NewDict(), arg)
+	assert.NoError(t, err)
+	assert.Equal(t, "x=1", arg.Filter)
+
+	_, err = arg_parser.BuildParser(reflect.ValueOf(badDefaultArgs{}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Field mode: invalid default")
+
+	_, err = arg_parser.BuildParser(reflect.ValueOf(commaDefaultArgs{}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown directive "b"`)
+}
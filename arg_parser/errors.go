@@ -0,0 +1,194 @@
+package arg_parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+var (
+	errRequired = errors.New("is required")
+)
+
+// Describes the function being called so errors can tell the user
+// how to call it properly.
+type Usage struct {
+	Name      string
+	Signature string
+}
+
+func (self *Usage) String() string {
+	if self == nil || self.Signature == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (Usage: %s(%s))", self.Name, self.Signature)
+}
+
+// A FieldError is returned when a field could not be parsed. Errors
+// in nested fields are reported with the full path to the field
+// (e.g. "Field a.b.c is required").
+type FieldError struct {
+	Field string
+	Err   error
+	Usage *Usage
+}
+
+func (self *FieldError) Error() string {
+	return fmt.Sprintf("Field %s %v%s", self.Field, self.Err, self.Usage)
+}
+
+func (self *FieldError) Unwrap() error {
+	return self.Err
+}
+
+// Returned when args contain a name which does not match any field.
+type UnexpectedArgError struct {
+	Arg string
+
+	// A similar field name which the user may have meant.
+	Suggestion string
+	Usage      *Usage
+}
+
+func (self *UnexpectedArgError) Error() string {
+	result := fmt.Sprintf("Unexpected arg %v", self.Arg)
+	if IsPositionalArg(self.Arg) {
+		result = "Too many positional args"
+	}
+	if self.Suggestion != "" {
+		result += fmt.Sprintf(" - did you mean %v?", self.Suggestion)
+	}
+	return result + self.Usage.String()
+}
+
+// Many errors reported together, one per line.
+type Errors []error
+
+func (self Errors) Error() string {
+	result := make([]string, 0, len(self))
+	for _, err := range self {
+		result = append(result, err.Error())
+	}
+	return strings.Join(result, "\n")
+}
+
+func (self Errors) Unwrap() []error {
+	return self
+}
+
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return Errors(errs)
+}
+
+// Returns the individual errors if err was joined from many.
+func splitErrors(err error) []error {
+	joined, ok := err.(Errors)
+	if ok {
+		return joined
+	}
+	return []error{err}
+}
+
+// Adds the parent field name to errors from a nested parser.
+func nestError(field string, err error) error {
+	errs := splitErrors(err)
+	if len(errs) > 1 {
+		result := make([]error, 0, len(errs))
+		for _, e := range errs {
+			result = append(result, nestError(field, e))
+		}
+		return joinErrors(result)
+	}
+
+	switch t := err.(type) {
+	case *FieldError:
+		return &FieldError{Field: field + "." + t.Field, Err: t.Err}
+	case *UnexpectedArgError:
+		return &UnexpectedArgError{Arg: field + "." + t.Arg}
+	}
+	return &FieldError{Field: field, Err: err}
+}
+
+// Describe the args the parser accepts, e.g. "start int64, end
+// int64 (required)".
+func (self *Parser) Signature() string {
+	result := make([]string, 0, len(self.Fields))
+	for _, field := range self.Fields {
+		desc := field.Field + " " + field.Type
+		if field.Variadic {
+			desc = "..." + desc
+		}
+		if field.Required {
+			desc += " (required)"
+		}
+		result = append(result, desc)
+	}
+	return strings.Join(result, ", ")
+}
+
+// Adds usage information to the parser's errors.
+func (self *Parser) enrichError(name string, err error) error {
+	usage := &Usage{Name: name, Signature: self.Signature()}
+	if name == "" {
+		usage = nil
+	}
+
+	// Only errors about which args were given need the usage -
+	// type errors are clear enough on their own. When there are
+	// many errors the usage is only shown once at the end.
+	var last_usage **Usage
+	for _, e := range splitErrors(err) {
+		switch t := e.(type) {
+		case *FieldError:
+			if errors.Is(t.Err, errRequired) {
+				last_usage = &t.Usage
+			}
+
+		case *UnexpectedArgError:
+			last_usage = &t.Usage
+			if !strings.Contains(t.Arg, ".") && !IsPositionalArg(t.Arg) {
+				t.Suggestion = self.suggestField(t.Arg)
+			}
+		}
+	}
+
+	if last_usage != nil {
+		*last_usage = usage
+	}
+	return err
+}
+
+// Find the closest field name to a misspelled arg.
+func (self *Parser) suggestField(arg string) string {
+	best := ""
+	best_distance := 0
+	arg = strings.ToLower(arg)
+
+	for _, field := range self.Fields {
+		if field.Variadic {
+			continue
+		}
+
+		// Only suggest reasonably close names.
+		max_distance := len(field.Field)/2 + 1
+		distance := utils.EditDistance(arg, strings.ToLower(field.Field),
+			max_distance)
+		if distance > max_distance {
+			continue
+		}
+
+		if best == "" || distance < best_distance {
+			best = field.Field
+			best_distance = distance
+		}
+	}
+	return best
+}
@@ -0,0 +1,98 @@
+package arg_parser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Nested structs are populated from a dict argument using the
+// struct's own vfilter tags. For example:
+//
+//	type Config struct {
+//	    Timeout int `vfilter:"optional,field=timeout"`
+//	}
+//
+//	type PluginArgs struct {
+//	    Config Config `vfilter:"optional,field=config"`
+//	}
+//
+// can be called with plugin(config=dict(timeout=5))
+func nestedStructParser(field_type reflect.Type) (ParserDipatcher, error) {
+	is_ptr := field_type.Kind() == reflect.Ptr
+	struct_type := field_type
+	if is_ptr {
+		struct_type = field_type.Elem()
+	}
+
+	nested, err := BuildParser(reflect.New(struct_type).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, scope types.Scope,
+		args *ordereddict.Dict, arg interface{}) (interface{}, error) {
+		value, err := dictParser(ctx, scope, args, arg)
+		if err != nil {
+			return nil, err
+		}
+
+		new_value := reflect.New(struct_type)
+		err = nested.Parse(ctx, scope, value.(*ordereddict.Dict), new_value.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		if is_ptr {
+			return new_value.Interface(), nil
+		}
+		return new_value.Elem().Interface(), nil
+	}, nil
+}
+
+// Maps with string keys are populated from a dict
+// argument. map[string]string values are stringified and
+// map[string]types.Any values are passed as is.
+func mapParser(field_type reflect.Type) (ParserDipatcher, error) {
+	if field_type.Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("Only maps with string keys are supported")
+	}
+
+	var value_parser ParserDipatcher
+	switch {
+	case field_type.Elem() == anyType:
+		value_parser = anyParser
+	case field_type.Elem().Kind() == reflect.String:
+		value_parser = stringParser
+	default:
+		return nil, fmt.Errorf(
+			"Only map[string]string and map[string]types.Any are supported")
+	}
+
+	return func(ctx context.Context, scope types.Scope,
+		args *ordereddict.Dict, arg interface{}) (interface{}, error) {
+		value, err := dictParser(ctx, scope, args, arg)
+		if err != nil {
+			return nil, err
+		}
+		dict := value.(*ordereddict.Dict)
+
+		result := reflect.MakeMapWithSize(field_type, dict.Len())
+		for _, k := range dict.Keys() {
+			v, _ := dict.Get(k)
+			new_value, err := value_parser(ctx, scope, args, v)
+			if err != nil {
+				return nil, &FieldError{Field: k, Err: err}
+			}
+			map_value := reflect.Zero(field_type.Elem())
+			if new_value != nil {
+				map_value = reflect.ValueOf(new_value).Convert(field_type.Elem())
+			}
+			result.SetMapIndex(reflect.ValueOf(k).Convert(field_type.Key()), map_value)
+		}
+		return result.Interface(), nil
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -47,32 +48,117 @@ type FieldParser struct {
 	FieldIdx int
 	Required bool
 	Parser   ParserDipatcher
+
+	// If set, string values must be one of these.
+	Choices []string
+
+	// Applied when the field is not given.
+	Default    interface{}
+	HasDefault bool
+
+	// Deprecated names this field may also be given as.
+	Aliases []string
+
+	// A variadic field collects all args not consumed by other
+	// fields, including positional args. It may also be given by
+	// name as a list. Parser converts each element.
+	Variadic bool
+
+	// The Go type of the field used when describing the args.
+	Type string
+}
+
+// Looks for the field under any of its deprecated names.
+func (self *FieldParser) getAlias(
+	scope types.Scope, args *ordereddict.Dict) (string, interface{}, bool) {
+	for _, alias := range self.Aliases {
+		value, pres := args.Get(alias)
+		if pres {
+			scope.Warn("Arg %v is deprecated, please use %v instead",
+				alias, self.Field)
+			return alias, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// Is the field given in args by name or by one of its aliases?
+func (self *FieldParser) isGiven(args *ordereddict.Dict) bool {
+	_, pres := args.Get(self.Field)
+	if pres {
+		return true
+	}
+	for _, alias := range self.Aliases {
+		_, pres := args.Get(alias)
+		if pres {
+			return true
+		}
+	}
+	return false
+}
+
+// Positional args (i.e. given without a name) are named by their
+// position as $0, $1 etc.
+func PositionalArg(idx int) string {
+	return fmt.Sprintf("$%d", idx)
+}
+
+func IsPositionalArg(name string) bool {
+	return strings.HasPrefix(name, "$")
 }
 
 type Parser struct {
 	Fields []*FieldParser
+
+	// At most one field may be variadic.
+	Variadic *FieldParser
 }
 
+// Parse all the fields from args into the target. All problems with
+// the args are reported together so the user can fix them in one go.
 func (self *Parser) Parse(
 	ctx context.Context, scope types.Scope, args *ordereddict.Dict, target reflect.Value) error {
+	args = self.assignPositional(args)
 	parsed := make([]string, 0, args.Len())
+	var errs []error
 
 	for _, parser := range self.Fields {
+		if parser.Variadic {
+			continue
+		}
+
 		value, pres := args.Get(parser.Field)
-		if !pres {
+		if pres {
+			// Keep track of the fields we parsed.
+			parsed = append(parsed, parser.Field)
+
+		} else if alias, alias_value, ok := parser.getAlias(scope, args); ok {
+			value = alias_value
+			parsed = append(parsed, alias)
+
+		} else if parser.HasDefault {
+			value = parser.Default
+
+		} else {
 			if parser.Required {
-				return fmt.Errorf("Field %s is required", parser.Field)
+				errs = append(errs, &FieldError{Field: parser.Field, Err: errRequired})
 			}
 			continue
 		}
 
-		// Keep track of the fields we parsed.
-		parsed = append(parsed, parser.Field)
-
 		// Convert the value using the parser
 		new_value, err := parser.Parser(ctx, scope, args, value)
 		if err != nil {
-			return fmt.Errorf("Field %s %w", parser.Field, err)
+			errs = append(errs, nestError(parser.Field, err))
+			continue
+		}
+
+		if len(parser.Choices) > 0 {
+			err = checkChoices(parser.Choices, new_value)
+			if err != nil {
+				errs = append(errs, &FieldError{Field: parser.Field, Err: err})
+				continue
+			}
 		}
 
 		// Now set the field on the struct.
@@ -80,17 +166,125 @@ func (self *Parser) Parse(
 		field_value.Set(reflect.ValueOf(new_value))
 	}
 
-	// Something is wrong! We did not extract all the fields from
-	// the args, there may be unexpected args.
-	if len(parsed) != args.Len() {
+	if self.Variadic != nil {
+		err := self.parseVariadic(ctx, scope, args, parsed, target)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		// Something is wrong! We did not extract all the fields from
+		// the args, there may be unexpected args.
+	} else if len(parsed) != args.Len() {
 		// Slow path should only be taken on error.
 		for _, key := range args.Keys() {
 			if !utils.InString(&parsed, key) {
-				return fmt.Errorf("Unexpected arg %v", key)
+				errs = append(errs, &UnexpectedArgError{Arg: key})
+			}
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// Positional args fill the fields which were not given by name in
+// the order the fields are declared. Any left over are collected by
+// the variadic field or reported as unexpected.
+func (self *Parser) assignPositional(args *ordereddict.Dict) *ordereddict.Dict {
+	has_positional := false
+	for _, key := range args.Keys() {
+		if IsPositionalArg(key) {
+			has_positional = true
+			break
+		}
+	}
+	if !has_positional {
+		return args
+	}
+
+	free := make([]string, 0, len(self.Fields))
+	for _, parser := range self.Fields {
+		if !parser.Variadic && !parser.isGiven(args) {
+			free = append(free, parser.Field)
+		}
+	}
+
+	result := ordereddict.NewDict()
+	for _, key := range args.Keys() {
+		value, _ := args.Get(key)
+		if IsPositionalArg(key) && len(free) > 0 {
+			key = free[0]
+			free = free[1:]
+		}
+		result.Set(key, value)
+	}
+	return result
+}
+
+// Collect all the args not already parsed into the variadic slice in
+// the order they were given. If the field is given by name its
+// elements are used instead.
+func (self *Parser) parseVariadic(
+	ctx context.Context, scope types.Scope, args *ordereddict.Dict,
+	parsed []string, target reflect.Value) error {
+	parser := self.Variadic
+	field_value := target.Field(parser.FieldIdx)
+	result := reflect.MakeSlice(field_value.Type(), 0, args.Len()-len(parsed))
+
+	var items []interface{}
+	var keys []string
+
+	value, pres := args.Get(parser.Field)
+	if pres {
+		parsed = append(parsed, parser.Field)
+		value, _ = anyParser(ctx, scope, args, value)
+		if utils.IsArray(value) {
+			slice := reflect.ValueOf(value)
+			for i := 0; i < slice.Len(); i++ {
+				items = append(items, slice.Index(i).Interface())
+				keys = append(keys, fmt.Sprintf("%v.%d", parser.Field, i))
 			}
+		} else {
+			items = append(items, value)
+			keys = append(keys, parser.Field)
 		}
 	}
 
+	var errs []error
+	for _, key := range args.Keys() {
+		if utils.InString(&parsed, key) {
+			continue
+		}
+
+		// The field was given explicitly so can not take any
+		// more args.
+		if pres {
+			errs = append(errs, &UnexpectedArgError{Arg: key})
+			continue
+		}
+
+		value, _ := args.Get(key)
+		items = append(items, value)
+		keys = append(keys, key)
+	}
+
+	if len(errs) > 0 {
+		return joinErrors(errs)
+	}
+
+	for idx, value := range items {
+		new_value, err := parser.Parser(ctx, scope, args, value)
+		if err != nil {
+			return nestError(keys[idx], err)
+		}
+
+		item := reflect.Zero(field_value.Type().Elem())
+		if new_value != nil {
+			item = reflect.ValueOf(new_value)
+		}
+		result = reflect.Append(result, item)
+	}
+
+	field_value.Set(result)
 	return nil
 }
 
@@ -335,17 +529,10 @@ func BuildParser(v reflect.Value) (*Parser, error) {
 			continue
 		}
 
-		directives := strings.Split(tag, ",")
-		options := make(map[string]string)
-		for _, directive := range directives {
-			if strings.Contains(directive, "=") {
-				components := strings.Split(directive, "=")
-				if len(components) >= 2 {
-					options[components[0]] = components[1]
-				}
-			} else {
-				options[directive] = "Y"
-			}
+		options, err := types.ParseArgTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("Field %v: %w",
+				field_types_value.Name, err)
 		}
 
 		// Is the name specified in the tag?
@@ -363,9 +550,60 @@ func BuildParser(v reflect.Value) (*Parser, error) {
 			Field:    field_name,
 			FieldIdx: i,
 			Required: required,
+			Type:     field_types_value.Type.String(),
 		}
 		result.Fields = append(result.Fields, field_parser)
 
+		choices, pres := options["choices"]
+		if pres {
+			field_parser.Choices = strings.Split(choices, "|")
+		}
+
+		_, variadic := options["variadic"]
+		if variadic {
+			if result.Variadic != nil {
+				return nil, fmt.Errorf(
+					"Field %v: only one field may be variadic", field_name)
+			}
+
+			field_parser.Parser, err = variadicParser(field_types_value.Type)
+			if err != nil {
+				return nil, fmt.Errorf("Field %v: %w", field_name, err)
+			}
+			field_parser.Variadic = true
+			result.Variadic = field_parser
+
+			field_value := v.Field(field_types_value.Index[0])
+			if !field_value.IsValid() || !field_value.CanSet() {
+				return nil, fmt.Errorf("Field %s is unsettable.", field_name)
+			}
+			continue
+		}
+
+		aliases, pres := options["alias"]
+		if pres {
+			field_parser.Aliases = strings.Split(aliases, "|")
+		}
+
+		default_str, pres := options["default"]
+		if pres {
+			field_parser.HasDefault = true
+			field_parser.Default, err = parseDefault(
+				field_types_value.Type, default_str)
+			if err != nil {
+				return nil, fmt.Errorf("Field %v: invalid default: %w",
+					field_name, err)
+			}
+
+			if field_parser.Choices != nil {
+				err = checkChoices(field_parser.Choices, field_parser.Default)
+				if err != nil {
+					return nil, fmt.Errorf("Field %v: invalid default: %w",
+						field_name, err)
+				}
+			}
+		}
+
 		// Now figure out the required type that will go into
 		// the value output struct field.
 		field_value := v.Field(field_types_value.Index[0])
@@ -428,6 +666,30 @@ func BuildParser(v reflect.Value) (*Parser, error) {
 			field_parser.Parser = intParser
 			continue
 
+		case reflect.Struct:
+			field_parser.Parser, err = nestedStructParser(field_types_value.Type)
+			if err != nil {
+				return nil, fmt.Errorf("Field %v: %w", field_name, err)
+			}
+			continue
+
+		case reflect.Ptr:
+			if field_types_value.Type.Elem().Kind() != reflect.Struct {
+				return nil, fmt.Errorf("Unsupported type for field %v", field_name)
+			}
+			field_parser.Parser, err = nestedStructParser(field_types_value.Type)
+			if err != nil {
+				return nil, fmt.Errorf("Field %v: %w", field_name, err)
+			}
+			continue
+
+		case reflect.Map:
+			field_parser.Parser, err = mapParser(field_types_value.Type)
+			if err != nil {
+				return nil, fmt.Errorf("Field %v: %w", field_name, err)
+			}
+			continue
+
 		default:
 			return nil, fmt.Errorf("Unsupported type for field %v", field_name)
 		}
@@ -437,6 +699,66 @@ func BuildParser(v reflect.Value) (*Parser, error) {
 	return result, nil
 }
 
+// Variadic fields must be slices - each extra arg is converted to
+// the slice element.
+func variadicParser(field_type reflect.Type) (ParserDipatcher, error) {
+	if field_type.Kind() == reflect.Slice {
+		switch {
+		case field_type.Elem() == anyType:
+			return anyParser, nil
+		case field_type.Elem() == dictExprType:
+			return dictParser, nil
+		case field_type.Elem().Kind() == reflect.String:
+			return stringParser, nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"variadic fields must be []string, []types.Any or []*ordereddict.Dict")
+}
+
+// Converts the default directive into a value the field's parser
+// accepts. Types not handled here (e.g. time.Time) parse strings
+// themselves.
+func parseDefault(field_type reflect.Type, value string) (interface{}, error) {
+	switch field_type.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		if field_type == durationType {
+			return value, nil
+		}
+		return strconv.ParseInt(value, 0, 64)
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+
+	case reflect.Slice:
+		if field_type.Elem().Kind() == reflect.String {
+			return strings.Split(value, "|"), nil
+		}
+	}
+	return value, nil
+}
+
+func checkChoices(choices []string, value interface{}) error {
+	var values []string
+	switch t := value.(type) {
+	case string:
+		values = []string{t}
+	case []string:
+		values = t
+	}
+
+	for _, v := range values {
+		if !utils.InString(&choices, v) {
+			return fmt.Errorf("should be one of %v not %q.",
+				strings.Join(choices, ", "), v)
+		}
+	}
+	return nil
+}
+
 func initDefaultTypeDispatcher() map[reflect.Type]ParserDipatcher {
 	result := make(map[reflect.Type]ParserDipatcher)
 	result[anyType] = anyParser
@@ -444,6 +766,9 @@ func initDefaultTypeDispatcher() map[reflect.Type]ParserDipatcher {
 	result[storedQueryType] = storedQueryParser
 	result[lazyExprType] = lazyExprParser
 	result[dictExprType] = dictParser
+	result[timeType] = timeParser
+	result[durationType] = durationParser
+	result[ipType] = ipParser
 	return result
 }
 
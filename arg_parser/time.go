@@ -0,0 +1,144 @@
+package arg_parser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	ipType       = reflect.TypeOf(net.IP{})
+
+	// Formats we try in order when parsing a time from a string.
+	timeFormats = []string{
+		time.RFC3339Nano,
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+)
+
+// Times may be given as a time, an epoch in seconds (possibly
+// fractional) or a string in one of the common formats.
+func timeParser(ctx context.Context, scope types.Scope,
+	args *ordereddict.Dict, arg interface{}) (interface{}, error) {
+	lazy_arg, ok := arg.(types.LazyExpr)
+	if ok {
+		arg = lazy_arg.Reduce(ctx)
+	}
+
+	switch t := arg.(type) {
+	case time.Time:
+		return t, nil
+
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+
+	case string:
+		return parseTimeString(t)
+
+	default:
+		epoch, ok := utils.ToFloat(arg)
+		if ok {
+			return epochToTime(epoch), nil
+		}
+	}
+
+	return nil, fmt.Errorf("should be a time not %T.", arg)
+}
+
+func parseTimeString(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	epoch, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return epochToTime(epoch), nil
+	}
+
+	for _, format := range timeFormats {
+		result, err := time.Parse(format, value)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can not parse %q as a time.", value)
+}
+
+func epochToTime(epoch float64) time.Time {
+	seconds, fraction := math.Modf(epoch)
+	return time.Unix(int64(seconds), int64(fraction*1e9)).UTC()
+}
+
+// Durations may be given as a number of seconds or a string like
+// "1h30m".
+func durationParser(ctx context.Context, scope types.Scope,
+	args *ordereddict.Dict, arg interface{}) (interface{}, error) {
+	lazy_arg, ok := arg.(types.LazyExpr)
+	if ok {
+		arg = lazy_arg.Reduce(ctx)
+	}
+
+	switch t := arg.(type) {
+	case time.Duration:
+		return t, nil
+
+	case string:
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err == nil {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+
+		result, err := time.ParseDuration(strings.TrimSpace(t))
+		if err != nil {
+			return nil, fmt.Errorf("can not parse %q as a duration.", t)
+		}
+		return result, nil
+
+	default:
+		seconds, ok := utils.ToFloat(arg)
+		if ok {
+			return time.Duration(seconds * float64(time.Second)), nil
+		}
+	}
+
+	return nil, fmt.Errorf("should be a duration not %T.", arg)
+}
+
+func ipParser(ctx context.Context, scope types.Scope,
+	args *ordereddict.Dict, arg interface{}) (interface{}, error) {
+	lazy_arg, ok := arg.(types.LazyExpr)
+	if ok {
+		arg = lazy_arg.Reduce(ctx)
+	}
+
+	switch t := arg.(type) {
+	case net.IP:
+		return t, nil
+
+	case types.IPAddress:
+		return t.IP, nil
+
+	case string:
+		result := net.ParseIP(strings.TrimSpace(t))
+		if result != nil {
+			return result, nil
+		}
+		return nil, fmt.Errorf("can not parse %q as an IP address.", t)
+	}
+
+	return nil, fmt.Errorf("should be an IP address not %T.", arg)
+}
@@ -73,3 +73,16 @@ SELECT * FROM foreach(row={
 })`)
 	}
 }
+
+func BenchmarkResolve20k(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		runBenchmark(b, `
+LET A = 1
+LET B = 2
+LET C = 3
+LET D = 4
+SELECT _value FROM range(start=0, step=1, end=20000)
+WHERE _value > A AND _value > B AND _value > C AND _value > D
+  AND RootEnv AND _value != A + B + C + D`)
+	}
+}
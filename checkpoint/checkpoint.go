@@ -0,0 +1,345 @@
+// Package checkpoint allows long running queries to be resumed after
+// they are killed.
+//
+// The host installs a Checkpointer on the scope before running the
+// query and reads the query's rows through Wrap(). Plugins which are
+// able to resume get a Cursor with NewCursor() when they start, look
+// up where they left off with Get() and call Set() with each row
+// just before sending it. The Checkpointer periodically saves all
+// cursors, together with the number of rows emitted so far, into a
+// host provided Store. When the same query is started again with the
+// same key the cursors are loaded from the store and the plugins pick
+// up where they left off.
+//
+// Each call of a plugin has its own cursor, named by the plugin and
+// numbered in the order the calls start. A cursor only takes effect
+// once a row derived from the row it was set for is emitted by
+// Wrap(). The query tracks which of its output rows derive from
+// which input rows, so rows a plugin produces which are consumed
+// inside the query (e.g. the rows of foreach()'s row= query) or
+// which are dropped never move its cursor. Such plugins run from
+// the start again on resume, and calls nested inside them see the
+// same call numbers and resume from their own cursors. Rows which
+// were in flight when the query was killed are produced again, so a
+// resumed query may repeat rows but never skips them. This assumes
+// the query starts its plugin calls in the same order each time
+// (e.g. foreach() with a single worker).
+//
+// To stop a query cleanly the host cancels the context passed to
+// Wrap() and calls Close() to save the exact position.
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+const contextKey = "$checkpointer"
+
+// The most cursors waiting for their row to be emitted. Beyond this
+// the query is dropping rows so the oldest are forgotten.
+const maxPendingCursors = 10000
+
+// The state saved for each checkpoint.
+type State struct {
+	// Cursors keyed by the name the plugin chose.
+	Cursors *ordereddict.Dict `json:"cursors"`
+
+	// Total number of rows emitted by the query.
+	RowCount int64 `json:"row_count"`
+}
+
+// A Store persists checkpoint state. Load should return nil state
+// with no error when the key is not known.
+type Store interface {
+	Load(key string) (*State, error)
+	Save(key string, state *State) error
+}
+
+// A cursor set by a plugin for a row which was not emitted yet.
+type pendingCursor struct {
+	name   string
+	cursor types.Any
+}
+
+// A Cursor records the position of one call of a plugin. A nil
+// Cursor (when checkpointing is not enabled) does nothing.
+type Cursor struct {
+	checkpointer *Checkpointer
+	name         string
+}
+
+type Checkpointer struct {
+	mu       sync.Mutex
+	store    Store
+	key      string
+	state    *State
+	dirty    bool
+	interval time.Duration
+
+	// Cursors keyed by the row they were set for, and the rows in
+	// the order they were sent.
+	pending map[types.Row]pendingCursor
+	order   []types.Row
+
+	// The number of calls of each plugin so far.
+	calls map[string]int
+
+	// Tracks the goroutines started by Wrap().
+	wg sync.WaitGroup
+}
+
+// Install creates a checkpointer on the scope, loading any previous
+// state saved under key. The state is saved every interval until the
+// context is done.
+func Install(ctx context.Context, scope types.Scope,
+	store Store, key string, interval time.Duration) (*Checkpointer, error) {
+	state, err := store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		state = &State{}
+	}
+
+	if state.Cursors == nil {
+		state.Cursors = ordereddict.NewDict()
+	}
+
+	self := &Checkpointer{
+		store:    store,
+		key:      key,
+		state:    state,
+		interval: interval,
+		pending:  make(map[types.Row]pendingCursor),
+		calls:    make(map[string]int),
+	}
+	scope.SetContext(contextKey, self)
+
+	if interval > 0 {
+		go self.run(ctx, scope)
+	}
+
+	return self, nil
+}
+
+// Get returns the checkpointer installed on the scope or nil.
+func Get(scope types.Scope) *Checkpointer {
+	value, pres := scope.GetContext(contextKey)
+	if !pres {
+		return nil
+	}
+
+	self, _ := value.(*Checkpointer)
+	return self
+}
+
+// NewCursor returns the cursor for a new call of the named plugin,
+// or nil when checkpointing is not enabled.
+func NewCursor(scope types.Scope, name string) *Cursor {
+	self := Get(scope)
+	if self == nil {
+		return nil
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	call := self.calls[name]
+	self.calls[name] = call + 1
+
+	return &Cursor{
+		checkpointer: self,
+		name:         fmt.Sprintf("%v#%v", name, call),
+	}
+}
+
+// Get returns the position previously saved for this call.
+func (self *Cursor) Get() (types.Any, bool) {
+	if self == nil {
+		return nil, false
+	}
+
+	self.checkpointer.mu.Lock()
+	defer self.checkpointer.mu.Unlock()
+
+	return self.checkpointer.state.Cursors.Get(self.name)
+}
+
+// Set records the position to resume from once a row derived from
+// row is emitted. The row must be a pointer (e.g. an
+// *ordereddict.Dict) so it can be recognized.
+func (self *Cursor) Set(row types.Row, cursor types.Any) {
+	if self == nil || !isTracked(row) {
+		return
+	}
+
+	self.checkpointer.mu.Lock()
+	defer self.checkpointer.mu.Unlock()
+
+	self.checkpointer.addPending(row, pendingCursor{
+		name: self.name, cursor: cursor,
+	})
+}
+
+// Derive records that the query produced the row to from the row
+// from, so emitting to takes the cursor set for from.
+func (self *Checkpointer) Derive(from, to types.Row) {
+	if self == nil || !isTracked(from) || !isTracked(to) {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	pending, pres := self.pending[from]
+	if !pres {
+		return
+	}
+	delete(self.pending, from)
+	self.addPending(to, pending)
+}
+
+// Forget drops the cursor for a row which does not reach the output
+// in order (e.g. because it is sorted).
+func (self *Checkpointer) Forget(row types.Row) {
+	if self == nil || !isTracked(row) {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.pending, row)
+}
+
+func (self *Checkpointer) addPending(row types.Row, pending pendingCursor) {
+	// Rows which are dropped by the query leave their cursors
+	// behind. Forget the oldest ones, which only means a resumed
+	// query repeats more rows.
+	if len(self.order) >= maxPendingCursors {
+		live := self.order[:0]
+		for _, item := range self.order {
+			if _, pres := self.pending[item]; pres {
+				live = append(live, item)
+			}
+		}
+		self.order = live
+
+		for len(self.order) >= maxPendingCursors {
+			delete(self.pending, self.order[0])
+			self.order = self.order[1:]
+		}
+	}
+
+	self.pending[row] = pending
+	self.order = append(self.order, row)
+}
+
+// Only pointers can be used to recognize rows as they pass through
+// the query.
+func isTracked(row types.Row) bool {
+	return row != nil && reflect.TypeOf(row).Kind() == reflect.Ptr
+}
+
+// RowCount is the number of rows emitted by the query, including
+// those emitted before it was resumed.
+func (self *Checkpointer) RowCount() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.state.RowCount
+}
+
+// Wrap counts the rows passing through the channel. Each row emitted
+// makes the cursor set for the row it derives from current in the
+// same step.
+func (self *Checkpointer) Wrap(
+	ctx context.Context, in <-chan types.Row) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		defer close(output_chan)
+
+		for row := range in {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+
+			self.mu.Lock()
+			self.state.RowCount++
+			if isTracked(row) {
+				pending, pres := self.pending[row]
+				if pres {
+					self.state.Cursors.Set(pending.name, pending.cursor)
+					delete(self.pending, row)
+				}
+			}
+			self.dirty = true
+			self.mu.Unlock()
+		}
+	}()
+
+	return output_chan
+}
+
+// Save writes the current state to the store if it changed.
+func (self *Checkpointer) Save() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if !self.dirty {
+		return nil
+	}
+
+	cursors := ordereddict.NewDict()
+	cursors.MergeFrom(self.state.Cursors)
+
+	err := self.store.Save(self.key, &State{
+		Cursors:  cursors,
+		RowCount: self.state.RowCount,
+	})
+	if err != nil {
+		return err
+	}
+
+	self.dirty = false
+	return nil
+}
+
+// Close waits for the channels returned by Wrap() to stop and saves
+// the final state. The context passed to Wrap() must be cancelled
+// first.
+func (self *Checkpointer) Close() error {
+	self.wg.Wait()
+	return self.Save()
+}
+
+func (self *Checkpointer) run(ctx context.Context, scope types.Scope) {
+	ticker := time.NewTicker(self.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			err := self.Save()
+			if err != nil {
+				scope.Log("checkpoint: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package checkpoint_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/checkpoint"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	saved map[string]*checkpoint.State
+}
+
+func (self *memoryStore) Load(key string) (*checkpoint.State, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.saved[key], nil
+}
+
+func (self *memoryStore) Save(key string, state *checkpoint.State) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.saved[key] = state
+	return nil
+}
+
+func runQuery(t *testing.T, store checkpoint.Store, max_rows int) []int64 {
+	return runQueryString(t, store, "SELECT * FROM range(end=10)", max_rows)
+}
+
+func runQueryString(t *testing.T, store checkpoint.Store,
+	query string, max_rows int) []int64 {
+	var result []int64
+	for _, row := range runQueryRows(t, store, query, max_rows) {
+		value, _ := row.Get("_value")
+		result = append(result, value.(int64))
+	}
+	return result
+}
+
+func runQueryRows(t *testing.T, store checkpoint.Store,
+	query string, max_rows int) []*ordereddict.Dict {
+	scope := vfilter.NewScope()
+	defer scope.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	checkpointer, err := checkpoint.Install(ctx, scope, store, "query", 0)
+	assert.NoError(t, err)
+
+	vql, err := vfilter.Parse(query)
+	assert.NoError(t, err)
+
+	var result []*ordereddict.Dict
+	for row := range checkpointer.Wrap(ctx, vql.Eval(ctx, scope)) {
+		result = append(result, row.(*ordereddict.Dict))
+		if len(result) >= max_rows {
+			break
+		}
+	}
+
+	// Kill the query while more rows are in flight.
+	cancel()
+	assert.NoError(t, checkpointer.Close())
+	return result
+}
+
+func TestResumeRange(t *testing.T) {
+	store := &memoryStore{saved: make(map[string]*checkpoint.State)}
+
+	first := runQuery(t, store, 4)
+	assert.Equal(t, []int64{0, 1, 2, 3}, first)
+
+	// The query resumes exactly after the rows already seen even
+	// though more rows were in flight when it was killed.
+	second := runQuery(t, store, 3)
+	assert.Equal(t, []int64{4, 5, 6}, second)
+	assert.Equal(t, int64(7), store.saved["query"].RowCount)
+
+	third := runQuery(t, store, 100)
+	assert.Equal(t, []int64{7, 8, 9}, third)
+	assert.Equal(t, int64(10), store.saved["query"].RowCount)
+}
+
+// Rows dropped by the query do not prevent the rows after them from
+// moving the cursor.
+func TestResumeRangeWhere(t *testing.T) {
+	store := &memoryStore{saved: make(map[string]*checkpoint.State)}
+
+	first := runQueryString(t, store,
+		"SELECT * FROM range(end=10) WHERE _value != 1", 3)
+	assert.Equal(t, []int64{0, 2, 3}, first)
+
+	second := runQueryString(t, store,
+		"SELECT * FROM range(end=10) WHERE _value != 1", 100)
+	assert.Equal(t, []int64{4, 5, 6, 7, 8, 9}, second)
+}
+
+// Sorted rows are repeated on resume rather than lost.
+func TestResumeRangeOrderBy(t *testing.T) {
+	store := &memoryStore{saved: make(map[string]*checkpoint.State)}
+
+	query := "SELECT * FROM range(end=5) ORDER BY _value DESC"
+	first := runQueryString(t, store, query, 2)
+	assert.Equal(t, []int64{4, 3}, first)
+
+	second := runQueryString(t, store, query, 100)
+	assert.Equal(t, []int64{4, 3, 2, 1, 0}, second)
+}
+
+// The rows of foreach()'s row= query never reach the output so its
+// cursor does not move. Each call of the nested query resumes from
+// its own cursor.
+func TestResumeNested(t *testing.T) {
+	store := &memoryStore{saved: make(map[string]*checkpoint.State)}
+
+	query := `
+SELECT * FROM foreach(
+  row={SELECT _value AS Outer FROM range(start=0, end=4)},
+  query={SELECT Outer, _value AS Inner FROM range(start=0, end=2)})`
+
+	pairs := func(rows []*ordereddict.Dict) [][]int64 {
+		var result [][]int64
+		for _, row := range rows {
+			outer, _ := row.Get("Outer")
+			inner, _ := row.Get("Inner")
+			result = append(result, []int64{outer.(int64), inner.(int64)})
+		}
+		return result
+	}
+
+	first := pairs(runQueryRows(t, store, query, 3))
+	assert.Equal(t, [][]int64{{0, 0}, {0, 1}, {1, 0}}, first)
+
+	second := pairs(runQueryRows(t, store, query, 100))
+	assert.Equal(t, [][]int64{{1, 1}, {2, 0}, {2, 1}, {3, 0}, {3, 1}}, second)
+	assert.Equal(t, int64(8), store.saved["query"].RowCount)
+}
@@ -0,0 +1,128 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// Column metadata flows up from the plugins to the query which reads
+// their rows. Each SELECT passes a collector down to its FROM clause
+// through the context, then reports the metadata of the columns it
+// emits to its own consumer when it is done.
+//
+// Like the row limit hint, the collector only applies to the rows
+// read directly by the SELECT so it is cleared before evaluating
+// anything else.
+type columnMetadataKey int
+
+const columnMetadataKeyValue columnMetadataKey = 0
+
+type columnMetadataCollector struct {
+	mu      sync.Mutex
+	columns map[string]*types.ColumnMetadata
+}
+
+func newColumnMetadataCollector() *columnMetadataCollector {
+	return &columnMetadataCollector{
+		columns: make(map[string]*types.ColumnMetadata),
+	}
+}
+
+func (self *columnMetadataCollector) update(
+	columns map[string]*types.ColumnMetadata) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for k, v := range columns {
+		self.columns[k] = v
+	}
+}
+
+func (self *columnMetadataCollector) get() map[string]*types.ColumnMetadata {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := make(map[string]*types.ColumnMetadata)
+	for k, v := range self.columns {
+		result[k] = v
+	}
+	return result
+}
+
+func withColumnMetadata(ctx context.Context,
+	collector *columnMetadataCollector) context.Context {
+	return context.WithValue(ctx, columnMetadataKeyValue, collector)
+}
+
+// Returns the collector of the query reading our rows or nil if there
+// is none.
+func getColumnMetadata(ctx context.Context) *columnMetadataCollector {
+	collector, _ := ctx.Value(columnMetadataKeyValue).(*columnMetadataCollector)
+	return collector
+}
+
+func clearColumnMetadata(ctx context.Context) context.Context {
+	if getColumnMetadata(ctx) == nil {
+		return ctx
+	}
+	return withColumnMetadata(ctx, nil)
+}
+
+// Record the metadata of the columns emitted by a plugin if it
+// provides any.
+func collectPluginColumnMetadata(ctx context.Context, scope types.Scope,
+	plugin PluginGeneratorInterface, args *ordereddict.Dict) {
+	collector := getColumnMetadata(ctx)
+	if collector == nil {
+		return
+	}
+
+	provider, ok := plugin.(types.ColumnMetadataProtocol)
+	if ok {
+		collector.update(provider.ColumnMetadata(scope, args))
+	}
+}
+
+// Work out the metadata of the columns emitted by the select from the
+// metadata of the rows it reads. Columns which just pass on an input
+// column keep its metadata.
+func (self *_SelectExpression) columnMetadata(scope types.Scope,
+	input map[string]*types.ColumnMetadata) map[string]*types.ColumnMetadata {
+	result := make(map[string]*types.ColumnMetadata)
+	star := self.All
+
+	for _, expr := range self.Expressions {
+		name := expr.GetName(scope)
+		if name == "*" {
+			star = true
+			continue
+		}
+
+		if expr.Expression == nil {
+			continue
+		}
+
+		source := utils.Unquote_ident(FormatToString(scope, expr.Expression))
+		metadata, pres := input[source]
+		if pres {
+			result[name] = metadata
+		}
+	}
+
+	// Explicit columns take precedence over the columns relayed
+	// by *.
+	if star {
+		for k, v := range input {
+			_, pres := result[k]
+			if !pres {
+				result[k] = v
+			}
+		}
+	}
+
+	return result
+}
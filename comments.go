@@ -0,0 +1,79 @@
+package vfilter
+
+import (
+	"strings"
+)
+
+// The comments attached to a statement parsed with
+// MultiParseWithComments(). The comment markers (--, // and /* */)
+// are removed from the text.
+type StatementComments struct {
+	// The comments on the lines before the statement. For a LET
+	// statement this documents the definition.
+	Doc []string
+
+	// The comments following the statement on its last line.
+	Trailing []string
+}
+
+// GetComments returns the comments attached to the statement. It is
+// only populated when the query is parsed with
+// MultiParseWithComments().
+func (self *VQL) GetComments() *StatementComments {
+	result := &StatementComments{}
+	for _, comment := range self.Comments {
+		if !comment.trailing {
+			result.Doc = append(result.Doc, comment.text())
+		}
+	}
+
+	for _, comment := range self.trailing {
+		result.Trailing = append(result.Trailing, comment.text())
+	}
+
+	return result
+}
+
+// The comment text without the comment markers.
+func (self *_Comment) text() string {
+	switch {
+	case self.VQLComment != nil:
+		return strings.TrimSpace(strings.TrimPrefix(*self.VQLComment, "--"))
+
+	case self.Comment != nil:
+		return strings.TrimSpace(strings.TrimPrefix(*self.Comment, "//"))
+
+	case self.MultiLine != nil:
+		text := strings.TrimSuffix(strings.TrimPrefix(*self.MultiLine, "/*"), "*/")
+		return strings.TrimSpace(text)
+	}
+
+	return ""
+}
+
+// Comments which follow a statement on the same line belong to that
+// statement. They are only marked here - the formatter still emits
+// them before the next statement.
+func (self *MultiVQL) attachTrailingComments(expression string) {
+	for node := self; node != nil && node.VQL1 != nil; node = node.VQL2 {
+		for _, comment := range node.Comments2 {
+			if !isTrailingComment(expression, comment) {
+				break
+			}
+			comment.trailing = true
+			node.VQL1.trailing = append(node.VQL1.trailing, comment)
+		}
+	}
+}
+
+// A comment is trailing when there is other text before it on its
+// line.
+func isTrailingComment(expression string, comment *_Comment) bool {
+	offset := comment.Pos.Offset
+	if offset <= 0 || offset > len(expression) {
+		return false
+	}
+
+	line_start := strings.LastIndex(expression[:offset], "\n") + 1
+	return strings.TrimSpace(expression[line_start:offset]) != ""
+}
@@ -0,0 +1,140 @@
+package vfilter
+
+import (
+	"reflect"
+
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// The AST nodes lazily cache values derived from the parsed query
+// (e.g. parsed numbers and column names) the first time they are
+// evaluated. The caches are protected by a mutex in each node which
+// causes contention when one parsed query is evaluated by many
+// concurrent queries.
+//
+// Compile() fills in all the caches up front and marks the nodes as
+// compiled so they are never modified again and may be read without
+// locking.
+
+var (
+	valueType             = reflect.TypeOf(_Value{})
+	aliasedExpressionType = reflect.TypeOf(_AliasedExpression{})
+)
+
+// Compile prepares the statement for evaluation by many concurrent
+// queries. The statement must not be modified afterwards.
+func (self *VQL) Compile(scope types.Scope) *VQL {
+	compileNode(scope, reflect.ValueOf(self))
+	return self
+}
+
+func compileNode(scope types.Scope, value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			compileNode(scope, value.Elem())
+		}
+
+	case reflect.Struct:
+		if value.CanAddr() {
+			switch value.Type() {
+			case valueType:
+				value.Addr().Interface().(*_Value).compile(scope)
+
+			case symbolRefType:
+				value.Addr().Interface().(*_SymbolRef).compile()
+
+			case pluginType:
+				value.Addr().Interface().(*Plugin).compile()
+
+			case aliasedExpressionType:
+				value.Addr().Interface().(*_AliasedExpression).compile(scope)
+
+			case selectType:
+				value.Addr().Interface().(*_Select).compile()
+			}
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			compileNode(scope, value.Field(i))
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			compileNode(scope, value.Index(i))
+		}
+	}
+}
+
+func (self *_Value) compile(scope types.Scope) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.maybeParseStrNumber(scope)
+
+	// Cache the constants.
+	switch {
+	case self.Subexpression != nil, self.SymbolRef != nil,
+		self.Int != nil, self.Float != nil:
+
+	case self.String != nil:
+		value, interpolate := decodeStringLiteral(*self.String)
+		if !interpolate {
+			self.cache = value
+		}
+
+	case self.Boolean != nil:
+		self.cache = self.reduceBoolean()
+
+	default:
+		self.cache = Null{}
+	}
+
+	self.compiled = true
+}
+
+func (self *_Select) compile() {
+	expression := self.SelectExpression
+	if expression == nil {
+		return
+	}
+
+	expression.mu.Lock()
+	defer expression.mu.Unlock()
+
+	if expression.progress_vars == nil {
+		expression.progress_vars = findProgressVars(self)
+	}
+	expression.compiled = true
+}
+
+func (self *_SymbolRef) compile() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.split_symbol == nil {
+		self.split_symbol, self.optional = splitSymbol(self.Symbol)
+	}
+	self.compiled = true
+}
+
+func (self *Plugin) compile() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.split_name == nil {
+		self.split_name = utils.SplitIdent(self.Name)
+	}
+	self.compiled = true
+}
+
+func (self *_AliasedExpression) compile(scope types.Scope) {
+	name := self.columnName(scope)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.column_name = &name
+	self.compiled = true
+}
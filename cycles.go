@@ -0,0 +1,129 @@
+package vfilter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// LET definitions are resolved when they are used, so definitions
+// which refer to each other recurse until the stack overflows at
+// runtime. CheckDefinitionCycles() finds these cycles in a program
+// before it is evaluated.
+//
+// Only definitions without parameters are considered: a definition
+// with parameters may stop recursing depending on its args. A
+// materialized definition (LET X <= ...) is evaluated immediately so
+// it also ends a cycle.
+
+var (
+	selectType = reflect.TypeOf(_Select{})
+	lambdaType = reflect.TypeOf(Lambda{})
+)
+
+// CheckDefinitionCycles returns an error if the LET definitions in
+// the program (e.g. as returned by MultiParse()) refer to each other
+// in a cycle which can never terminate.
+func CheckDefinitionCycles(statements []*VQL) error {
+	// The symbols each lazy definition refers to.
+	definitions := make(map[string][]string)
+
+	for _, vql := range statements {
+		name := utils.Unquote_ident(vql.Let)
+
+		switch {
+		case name != "" && vql.LetOperator == "=" && vql.Parameters == nil:
+			var node interface{} = vql.Expression
+			if vql.StoredQuery != nil {
+				node = vql.StoredQuery
+			}
+			definitions[name] = collectDefinitionRefs(
+				reflect.ValueOf(node), nil)
+
+			cycle := findCycle(definitions, name)
+			if cycle != nil {
+				return fmt.Errorf("Recursive definition: %v",
+					strings.Join(cycle, " -> "))
+			}
+
+		case name != "":
+			delete(definitions, name)
+
+		case vql.Unlet != "":
+			delete(definitions, utils.Unquote_ident(vql.Unlet))
+		}
+	}
+
+	return nil
+}
+
+// Find a path from the name back to itself.
+func findCycle(definitions map[string][]string, name string) []string {
+	visited := make(map[string]bool)
+
+	var visit func(path []string) []string
+	visit = func(path []string) []string {
+		for _, ref := range definitions[path[len(path)-1]] {
+			if ref == name {
+				return append(path, ref)
+			}
+
+			_, pres := definitions[ref]
+			if !pres || visited[ref] {
+				continue
+			}
+			visited[ref] = true
+
+			cycle := visit(append(path[:len(path):len(path)], ref))
+			if cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return visit([]string{name})
+}
+
+// Like collectSymbols() but skips the parts of a query which are
+// evaluated in the context of a row, since the names there may refer
+// to columns rather than definitions.
+func collectDefinitionRefs(value reflect.Value, result []string) []string {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			result = collectDefinitionRefs(value.Elem(), result)
+		}
+
+	case reflect.Struct:
+		switch value.Type() {
+		case lambdaType:
+			return result
+
+		case selectType:
+			result = collectDefinitionRefs(value.FieldByName("From"), result)
+			return collectDefinitionRefs(value.FieldByName("Pipeline"), result)
+
+		case symbolRefType:
+			components, _ := splitSymbol(value.FieldByName("Symbol").String())
+			result = append(result, components[0])
+
+		case pluginType:
+			components, _ := splitSymbol(value.FieldByName("Name").String())
+			result = append(result, components[0])
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			result = collectDefinitionRefs(value.Field(i), result)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			result = collectDefinitionRefs(value.Index(i), result)
+		}
+	}
+
+	return result
+}
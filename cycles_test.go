@@ -0,0 +1,41 @@
+package vfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDefinitionCycles(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		err   string
+	}{
+		{"LET X = 1 + X SELECT * FROM X", "Recursive definition: X -> X"},
+		{"LET X = X.ID SELECT * FROM X", "Recursive definition: X -> X"},
+		{"LET X = SELECT * FROM Y LET Y = SELECT * FROM Z " +
+			"LET Z = Y + X SELECT * FROM X", "Recursive definition: Z -> Y -> Z"},
+
+		// Columns may have the same name as the definition.
+		{"LET X = SELECT X FROM scope() WHERE X SELECT * FROM X", ""},
+
+		// Definitions with parameters may terminate.
+		{"LET X(A) = SELECT * FROM X(A=A + 1) SELECT * FROM X(A=1)", ""},
+
+		// Materialized definitions refer to the previous value.
+		{"LET X = 1 LET X <= SELECT * FROM X SELECT * FROM X", ""},
+		{"LET X = 1 LET Y = X LET X = Y", "Recursive definition: X -> Y -> X"},
+		{"LET X = Y UNLET Y LET Y = 2 LET Y = X", "Recursive definition: Y -> X -> Y"},
+		{"LET X = Y LET Y <= SELECT * FROM X LET Z = X", ""},
+	} {
+		statements, err := MultiParse(test.query)
+		assert.NoError(t, err)
+
+		err = CheckDefinitionCycles(statements)
+		if test.err == "" {
+			assert.NoError(t, err, test.query)
+		} else {
+			assert.EqualError(t, err, test.err, test.query)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package vfilter
+
+import (
+	"fmt"
+	"reflect"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// The types of changes reported by DiffQueries().
+const (
+	StatementAdded   = "statement_added"
+	StatementRemoved = "statement_removed"
+	ColumnAdded      = "column_added"
+	ColumnRemoved    = "column_removed"
+	ColumnChanged    = "column_changed"
+	PluginAdded      = "plugin_added"
+	PluginRemoved    = "plugin_removed"
+	ArgAdded         = "arg_added"
+	ArgRemoved       = "arg_removed"
+	ArgRenamed       = "arg_renamed"
+	ArgChanged       = "arg_changed"
+	ConditionChanged = "condition_changed"
+
+	// The statement changed in some other way.
+	StatementChanged = "statement_changed"
+)
+
+// A semantic difference between two versions of a query.
+type QueryChange struct {
+	Type string
+
+	// The LET name or the position of the query (e.g. "query 1").
+	Statement string
+
+	// The column, plugin or arg which changed.
+	Name string
+
+	// The old and new VQL of the changed part.
+	Old string
+	New string
+}
+
+func (self *QueryChange) String() string {
+	result := fmt.Sprintf("%v: %v", self.Statement, self.Type)
+	if self.Name != "" {
+		result += " " + self.Name
+	}
+	if self.Old != "" || self.New != "" {
+		result += fmt.Sprintf(" (%v -> %v)", self.Old, self.New)
+	}
+	return result
+}
+
+// DiffQueries compares two versions of a program (e.g. as returned by
+// MultiParse()) and reports the semantic differences between them.
+// LET statements are matched by name and queries by their position.
+// Differences in formatting and comments are ignored.
+func DiffQueries(scope types.Scope, old, new []*VQL) []*QueryChange {
+	result := []*QueryChange{}
+
+	old_statements, old_names := statementsByName(old)
+	new_statements, new_names := statementsByName(new)
+
+	for _, name := range old_names {
+		_, pres := new_statements[name]
+		if !pres {
+			result = append(result, &QueryChange{
+				Type:      StatementRemoved,
+				Statement: name,
+				Old:       FormatToString(scope, old_statements[name]),
+			})
+		}
+	}
+
+	for _, name := range new_names {
+		new_vql := new_statements[name]
+		old_vql, pres := old_statements[name]
+		if !pres {
+			result = append(result, &QueryChange{
+				Type:      StatementAdded,
+				Statement: name,
+				New:       FormatToString(scope, new_vql),
+			})
+			continue
+		}
+
+		result = append(result, diffStatement(scope, name, old_vql, new_vql)...)
+	}
+
+	return result
+}
+
+// Name each statement by its LET name or its position amongst the
+// queries.
+func statementsByName(statements []*VQL) (map[string]*VQL, []string) {
+	result := make(map[string]*VQL)
+	names := []string{}
+	queries := 0
+
+	for _, vql := range statements {
+		var name string
+		switch {
+		case vql.Let != "":
+			name = "LET " + vql.Let
+		case vql.Unlet != "":
+			name = "UNLET " + vql.Unlet
+		default:
+			queries++
+			name = fmt.Sprintf("query %d", queries)
+		}
+
+		// A redefinition replaces the earlier one.
+		_, pres := result[name]
+		if !pres {
+			names = append(names, name)
+		}
+		result[name] = vql
+	}
+
+	return result, names
+}
+
+func diffStatement(scope types.Scope, name string,
+	old, new *VQL) []*QueryChange {
+	old_text := FormatToString(scope, old)
+	new_text := FormatToString(scope, new)
+	if old_text == new_text {
+		return nil
+	}
+
+	result := []*QueryChange{}
+	old_select := old.Query
+	if old_select == nil {
+		old_select = old.StoredQuery
+	}
+	new_select := new.Query
+	if new_select == nil {
+		new_select = new.StoredQuery
+	}
+
+	if old_select != nil && new_select != nil {
+		result = append(result, diffColumns(scope, name,
+			old_select.SelectExpression, new_select.SelectExpression)...)
+
+		old_where := formatNode(scope, old_select.Where)
+		new_where := formatNode(scope, new_select.Where)
+		if old_where != new_where {
+			result = append(result, &QueryChange{
+				Type:      ConditionChanged,
+				Statement: name,
+				Old:       old_where,
+				New:       new_where,
+			})
+		}
+	}
+
+	result = append(result, diffPlugins(scope, name, old, new)...)
+
+	// Report changes we do not specifically understand.
+	if len(result) == 0 {
+		result = append(result, &QueryChange{
+			Type:      StatementChanged,
+			Statement: name,
+			Old:       old_text,
+			New:       new_text,
+		})
+	}
+
+	return result
+}
+
+func formatNode(scope types.Scope, node interface{}) string {
+	if reflect.ValueOf(node).IsNil() {
+		return ""
+	}
+	return FormatToString(scope, node)
+}
+
+// The columns of a select expression in order.
+func selectColumns(scope types.Scope,
+	expr *_SelectExpression) ([]string, map[string]string) {
+	names := []string{}
+	columns := make(map[string]string)
+	if expr == nil {
+		return names, columns
+	}
+
+	if expr.All {
+		names = append(names, "*")
+		columns["*"] = "*"
+	}
+
+	for _, column := range expr.Expressions {
+		name := column.GetName(scope)
+		value := "*"
+		if column.Expression != nil {
+			value = FormatToString(scope, column.Expression)
+		} else if column.SubSelect != nil {
+			value = "{" + FormatToString(scope, column.SubSelect) + "}"
+		}
+
+		names = append(names, name)
+		columns[name] = value
+	}
+
+	return names, columns
+}
+
+func diffColumns(scope types.Scope, statement string,
+	old, new *_SelectExpression) []*QueryChange {
+	result := []*QueryChange{}
+
+	old_names, old_columns := selectColumns(scope, old)
+	new_names, new_columns := selectColumns(scope, new)
+
+	for _, name := range old_names {
+		_, pres := new_columns[name]
+		if !pres {
+			result = append(result, &QueryChange{
+				Type:      ColumnRemoved,
+				Statement: statement,
+				Name:      name,
+				Old:       old_columns[name],
+			})
+		}
+	}
+
+	for _, name := range new_names {
+		old_value, pres := old_columns[name]
+		new_value := new_columns[name]
+		if !pres {
+			result = append(result, &QueryChange{
+				Type:      ColumnAdded,
+				Statement: statement,
+				Name:      name,
+				New:       new_value,
+			})
+
+		} else if old_value != new_value {
+			result = append(result, &QueryChange{
+				Type:      ColumnChanged,
+				Statement: statement,
+				Name:      name,
+				Old:       old_value,
+				New:       new_value,
+			})
+		}
+	}
+
+	return result
+}
+
+// A plugin call and its args.
+type pluginCall struct {
+	name string
+	args []string
+	// Arg name to the VQL of its value.
+	values map[string]string
+}
+
+func collectPluginCalls(scope types.Scope, value reflect.Value,
+	result []*pluginCall) []*pluginCall {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			result = collectPluginCalls(scope, value.Elem(), result)
+		}
+
+	case reflect.Struct:
+		if value.Type() == pluginType {
+			plugin := value.Addr().Interface().(*Plugin)
+			call := &pluginCall{
+				name:   plugin.Name,
+				values: make(map[string]string),
+			}
+
+			positional := 0
+			for _, arg := range plugin.Args {
+				name := arg.name(&positional, nil)
+				call.args = append(call.args, name)
+
+				// Format the arg without its name.
+				value := *arg
+				value.Left = ""
+				value.Comments = nil
+				call.values[name] = FormatToString(scope, &value)
+			}
+			result = append(result, call)
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			result = collectPluginCalls(scope, value.Field(i), result)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			result = collectPluginCalls(scope, value.Index(i), result)
+		}
+	}
+
+	return result
+}
+
+func diffPlugins(scope types.Scope, statement string,
+	old, new *VQL) []*QueryChange {
+	result := []*QueryChange{}
+
+	// Calls to the same plugin are matched in order.
+	old_calls := make(map[string][]*pluginCall)
+	old_order := collectPluginCalls(scope, reflect.ValueOf(old), nil)
+	for _, call := range old_order {
+		old_calls[call.name] = append(old_calls[call.name], call)
+	}
+
+	new_calls := make(map[string][]*pluginCall)
+	new_order := []*pluginCall{}
+	for _, call := range collectPluginCalls(scope, reflect.ValueOf(new), nil) {
+		new_calls[call.name] = append(new_calls[call.name], call)
+		new_order = append(new_order, call)
+	}
+
+	seen := make(map[string]int)
+	for _, call := range new_order {
+		idx := seen[call.name]
+		seen[call.name]++
+
+		if idx >= len(old_calls[call.name]) {
+			result = append(result, &QueryChange{
+				Type:      PluginAdded,
+				Statement: statement,
+				Name:      call.name,
+			})
+			continue
+		}
+
+		result = append(result, diffArgs(statement,
+			old_calls[call.name][idx], call)...)
+	}
+
+	seen = make(map[string]int)
+	for _, call := range old_order {
+		idx := seen[call.name]
+		seen[call.name]++
+
+		if idx >= len(new_calls[call.name]) {
+			result = append(result, &QueryChange{
+				Type:      PluginRemoved,
+				Statement: statement,
+				Name:      call.name,
+			})
+		}
+	}
+
+	return result
+}
+
+func diffArgs(statement string, old, new *pluginCall) []*QueryChange {
+	result := []*QueryChange{}
+
+	removed := []string{}
+	for _, name := range old.args {
+		_, pres := new.values[name]
+		if !pres {
+			removed = append(removed, name)
+		}
+	}
+
+	for _, name := range new.args {
+		old_value, pres := old.values[name]
+		new_value := new.values[name]
+		if pres {
+			if old_value != new_value {
+				result = append(result, &QueryChange{
+					Type:      ArgChanged,
+					Statement: statement,
+					Name:      new.name + "." + name,
+					Old:       old_value,
+					New:       new_value,
+				})
+			}
+			continue
+		}
+
+		// An arg which was removed with the same value was
+		// renamed.
+		renamed := false
+		for idx, old_name := range removed {
+			if old.values[old_name] == new_value {
+				result = append(result, &QueryChange{
+					Type:      ArgRenamed,
+					Statement: statement,
+					Name:      new.name + "." + name,
+					Old:       old_name,
+					New:       name,
+				})
+				removed = append(removed[:idx], removed[idx+1:]...)
+				renamed = true
+				break
+			}
+		}
+
+		if !renamed {
+			result = append(result, &QueryChange{
+				Type:      ArgAdded,
+				Statement: statement,
+				Name:      new.name + "." + name,
+				New:       new_value,
+			})
+		}
+	}
+
+	for _, name := range removed {
+		result = append(result, &QueryChange{
+			Type:      ArgRemoved,
+			Statement: statement,
+			Name:      old.name + "." + name,
+			Old:       old.values[name],
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,324 @@
+// This is an example application using vfilter.  The application
+// allow selecting of files from the filesystem based on a VQL
+// query. This example demonstrates how a third party application can
+// integrate with VFilter and extend the VQL language to cater for
+// application specific functionality.
+//
+// The example is built and tested with the library so it also serves
+// as a check of the public API.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/protocols"
+	"www.velocidex.com/golang/vfilter/repl"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// This application will pass back these types to describe each file
+// examined. Note: Go's convention is that only fields starting with
+// upper case can be accessed. Therefore if you want to be able to
+// refer to any of these fields in a VQL query you need to start them
+// with a capital letter. Example:
+// Get all files with names ending with "go"
+// SELECT info.Path from glob() where info.Path =~ "go$"
+
+// You can dereference a contained struct using the dot operator. Example:
+
+// Get all files with size smaller than 100
+// SELECT Path from glob() where Stat.Size < 100
+type FileInfo struct {
+	Path string
+
+	// Unexported fields are not visible to VQL.
+	cache *statCache
+}
+
+// Calling a getter (A method with no args) on the struct happens
+// transparently. Example:
+// SELECT Path, FileType from glob()
+func (self FileInfo) FileType() string {
+	stat, err := self.cache.Lstat(self.Path)
+	if err != nil {
+		return ""
+	}
+
+	switch mode := stat.Mode(); {
+	case mode.IsRegular():
+		return "regular file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symbolic link"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	default:
+		return ""
+	}
+}
+
+// In this example we assume running a Stat operation is very
+// expensive and so we wish to do it sparingly - i.e. only when
+// absolutely required and only once for each file. For example, if
+// the query does not require any of the information in the Stat
+// (e.g. modified time etc), then there is no need to actually perform
+// the Stat operation on each file emitted by the glob plugin.
+type statCache struct {
+	mu    sync.Mutex
+	stats map[string]*statResult
+
+	// The number of times we actually called the OS.
+	misses int
+}
+
+type statResult struct {
+	info os.FileInfo
+	err  error
+}
+
+func newStatCache() *statCache {
+	return &statCache{stats: make(map[string]*statResult)}
+}
+
+func (self *statCache) Lstat(path string) (os.FileInfo, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result, pres := self.stats[path]
+	if !pres {
+		self.misses++
+		info, err := os.Lstat(path)
+		result = &statResult{info: info, err: err}
+		self.stats[path] = result
+	}
+	return result.info, result.err
+}
+
+// In order to determine if the Stat field is required by query we
+// extend the Associative protocol to inform VFilter about the special
+// handling for the FileInfo struct.
+type FileInfoSpecialHandler struct{}
+
+func (self FileInfoSpecialHandler) Applicable(a vfilter.Any, b vfilter.Any) bool {
+	_, a_ok := a.(FileInfo)
+	b_string, b_ok := b.(string)
+	return a_ok && b_ok && b_string == "Stat"
+}
+
+func (self FileInfoSpecialHandler) Associative(
+	scope types.Scope, a vfilter.Any, b vfilter.Any) (vfilter.Any, bool) {
+	// This should never panic because Applicable ensures it is ok.
+	file_info := a.(FileInfo)
+
+	stat, err := file_info.cache.Lstat(file_info.Path)
+	if err != nil {
+		return vfilter.Null{}, false
+	}
+	return stat, true
+}
+
+func (self FileInfoSpecialHandler) GetMembers(
+	scope types.Scope, a vfilter.Any) []string {
+	return append(protocols.DefaultAssociative{}.GetMembers(scope, a), "Stat")
+}
+
+// ---------------------------------------------------------------------
+// Plugins - VQL plugins are data sources analogous to tables in
+// SQL. However, VQL allows the user to specify parameters to plugins
+// which may control the data produced.
+
+// Plugins which produce all their rows at once can use the
+// GenericListPlugin helper.
+// ---------------------------------------------------------------------
+
+type GlobArgs struct {
+	Pattern string `vfilter:"optional,field=pattern,doc=A glob expression. A ** component matches any number of directories."`
+}
+
+// This is a plugin which generates FileInfo objects from a glob
+// expression. Examples:
+// select * from glob(pattern='/*')
+// select * from glob(pattern='**/*.go')
+func makeGlobPlugin(cache *statCache) vfilter.GenericListPlugin {
+	return vfilter.GenericListPlugin{
+		PluginName: "glob",
+		Doc:        "Glob files by expression",
+		ArgType:    &GlobArgs{},
+		Impact:     types.ImpactFilesystemRead,
+		Function: func(ctx context.Context, scope types.Scope,
+			args *ordereddict.Dict) []vfilter.Row {
+			arg := &GlobArgs{}
+			err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+			if err != nil {
+				scope.Log("glob: %v", err)
+				return nil
+			}
+
+			// If no pattern parameter is provided, then just
+			// assume the glob is '*'.
+			if arg.Pattern == "" {
+				arg.Pattern = "*"
+			}
+
+			matches, err := recursiveGlob(ctx, arg.Pattern)
+			if err != nil {
+				scope.Log("glob: %v", err)
+				return nil
+			}
+
+			result := []vfilter.Row{}
+			for _, hit := range matches {
+				result = append(result, FileInfo{Path: hit, cache: cache})
+			}
+			return result
+		},
+	}
+}
+
+// Like filepath.Glob() but a ** component matches zero or more
+// directories. Only the first ** is special.
+func recursiveGlob(ctx context.Context, pattern string) ([]string, error) {
+	components := strings.Split(filepath.ToSlash(pattern), "/")
+	idx := -1
+	for i, component := range components {
+		if component == "**" {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return filepath.Glob(pattern)
+	}
+
+	// The directories the recursion starts from.
+	roots := []string{"."}
+	if idx > 0 {
+		prefix := filepath.FromSlash(strings.Join(components[:idx], "/"))
+		if prefix == "" {
+			prefix = string(filepath.Separator)
+		}
+
+		var err error
+		roots, err = filepath.Glob(prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Match the rest of the pattern against the trailing
+	// components of each path.
+	rest := components[idx+1:]
+	result := []string{}
+
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Skip directories we can not read.
+			if err != nil {
+				if info != nil && info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relative, err := filepath.Rel(root, path)
+			if err != nil || relative == "." {
+				return nil
+			}
+
+			if matchTrailing(strings.Split(filepath.ToSlash(relative), "/"), rest) {
+				result = append(result, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func matchTrailing(path, pattern []string) bool {
+	if len(path) < len(pattern) {
+		return false
+	}
+
+	path = path[len(path)-len(pattern):]
+	for i, component := range pattern {
+		matched, err := filepath.Match(component, path[i])
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func MakeScope() types.Scope {
+	cache := newStatCache()
+	return vfilter.NewScope().AppendPlugins(makeGlobPlugin(cache)).
+		AddProtocolImpl(FileInfoSpecialHandler{})
+}
+
+func evalQuery(ctx context.Context, scope types.Scope, query string) error {
+	vqls, err := vfilter.MultiParse(query)
+	if err != nil {
+		return err
+	}
+
+	for _, vql := range vqls {
+		err := vfilter.OutputTable(ctx, scope, vql, os.Stdout,
+			&vfilter.TableOptions{MaxWidth: 60})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [query ...]\n\n"+
+				"Without a query an interactive shell is started.\n",
+			os.Args[0])
+	}
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scope := MakeScope()
+	defer scope.Close()
+
+	if flag.NArg() == 0 {
+		err := repl.NewRepl(scope, os.Stdin, os.Stdout).Run(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Shell failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, query := range flag.Args() {
+		err := evalQuery(ctx, scope, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to run %v: %v\n", query, err)
+			os.Exit(1)
+		}
+	}
+}
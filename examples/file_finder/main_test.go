@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+)
+
+func makeTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "file_finder")
+	assert.NoError(t, err)
+
+	for _, path := range []string{
+		"a.go", "b.txt", "sub/c.go", "sub/deeper/d.go", "sub/deeper/e.txt",
+	} {
+		full := filepath.Join(dir, filepath.FromSlash(path))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(full), 0700))
+		assert.NoError(t, ioutil.WriteFile(full, []byte(path), 0600))
+	}
+	return dir
+}
+
+func runQuery(t *testing.T, scope vfilter.Scope, query string) []string {
+	vql, err := vfilter.Parse(query)
+	assert.NoError(t, err)
+
+	result := []string{}
+	for row := range vql.Eval(context.Background(), scope) {
+		value, _ := scope.Associative(row, "Path")
+		result = append(result, value.(string))
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestRecursiveGlob(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	scope := MakeScope()
+	defer scope.Close()
+	scope.AppendVars(ordereddict.NewDict().Set("Root", filepath.ToSlash(dir)))
+
+	relative := func(paths []string) []string {
+		result := []string{}
+		for _, path := range paths {
+			rel, err := filepath.Rel(dir, path)
+			assert.NoError(t, err)
+			result = append(result, filepath.ToSlash(rel))
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"a.go", "sub/c.go", "sub/deeper/d.go"},
+		relative(runQuery(t, scope,
+			"SELECT Path FROM glob(pattern=Root + '/**/*.go')")))
+
+	assert.Equal(t, []string{"sub/deeper/d.go", "sub/deeper/e.txt"},
+		relative(runQuery(t, scope,
+			"SELECT Path FROM glob(pattern=Root + '/**/deeper/*')")))
+
+	// Without ** the glob is not recursive.
+	assert.Equal(t, []string{"a.go"},
+		relative(runQuery(t, scope,
+			"SELECT Path FROM glob(pattern=Root + '/*.go')")))
+}
+
+func TestStatCache(t *testing.T) {
+	dir := makeTree(t)
+	defer os.RemoveAll(dir)
+
+	cache := newStatCache()
+	scope := vfilter.NewScope().AppendPlugins(makeGlobPlugin(cache)).
+		AddProtocolImpl(FileInfoSpecialHandler{})
+	defer scope.Close()
+	scope.AppendVars(ordereddict.NewDict().Set("Root", filepath.ToSlash(dir)))
+
+	// Files are only stat'ed when the query needs it.
+	assert.Equal(t, 3, len(runQuery(t, scope,
+		"SELECT Path FROM glob(pattern=Root + '/**/*.go')")))
+	assert.Equal(t, 0, cache.misses)
+
+	// Each file is only stat'ed once even though the query uses
+	// the stat several times.
+	assert.Equal(t, 1, len(runQuery(t, scope, `
+SELECT Path FROM glob(pattern=Root + '/**/*.go')
+WHERE Stat.Size = 4 AND FileType = 'regular file' AND NOT Stat.IsDir`)))
+	assert.Equal(t, 3, cache.misses)
+}
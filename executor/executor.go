@@ -0,0 +1,302 @@
+// Package executor runs queries with admission control. Servers
+// embedding vfilter usually need to limit how many queries run at
+// once and queue the rest:
+//
+//	exec := executor.NewExecutor(executor.Options{
+//		MaxConcurrent: 4,
+//		QueueTimeout:  time.Minute,
+//	})
+//
+//	rows, err := exec.Run(ctx, &executor.Request{
+//		Query:    "SELECT * FROM info()",
+//		Scope:    scope,
+//		Priority: 10,
+//	})
+//
+// Queued queries are admitted by priority, then in the order they
+// arrived. A query holds its slot until its rows are all read (or
+// its context is cancelled).
+package executor
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+var (
+	ErrQueueFull    = errors.New("executor: queue is full")
+	ErrQueueTimeout = errors.New("executor: timed out waiting in queue")
+	ErrClosed       = errors.New("executor: closed")
+)
+
+type Options struct {
+	// The maximum number of queries running at the same time.
+	MaxConcurrent int
+
+	// The maximum number of queries waiting to run. Zero means
+	// no limit.
+	MaxQueued int
+
+	// How long a query may wait to run. Zero means no limit.
+	QueueTimeout time.Duration
+}
+
+type Request struct {
+	// The VQL to run. All its statements are evaluated in order.
+	Query string
+
+	// The scope to run the query in. The caller owns the scope
+	// and must close it.
+	Scope types.Scope
+
+	// Queries with a higher priority are admitted first.
+	Priority int
+
+	// Overrides the executor's QueueTimeout if set.
+	QueueTimeout time.Duration
+}
+
+// A snapshot of the executor's queue.
+type Metrics struct {
+	Running int
+	Queued  int
+
+	// Totals since the executor was created.
+	Admitted uint64
+	Rejected uint64
+	TimedOut uint64
+
+	// The total and longest time admitted queries waited in the
+	// queue.
+	TotalQueueTime time.Duration
+	MaxQueueTime   time.Duration
+}
+
+type Executor struct {
+	mu      sync.Mutex
+	options Options
+	running int
+	queue   waitQueue
+	seq     uint64
+	closed  bool
+	metrics Metrics
+}
+
+func NewExecutor(options Options) *Executor {
+	if options.MaxConcurrent <= 0 {
+		options.MaxConcurrent = 1
+	}
+	return &Executor{options: options}
+}
+
+// Run waits until the query may run then evaluates it. The query is
+// parsed before it is queued so syntax errors are returned
+// immediately.
+func (self *Executor) Run(ctx context.Context,
+	request *Request) (<-chan types.Row, error) {
+	statements, err := vfilter.MultiParse(request.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	err = self.admit(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	output_chan := make(chan types.Row)
+	go func() {
+		defer close(output_chan)
+		defer self.release()
+
+		for _, vql := range statements {
+			for row := range vql.Eval(ctx, request.Scope) {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+		}
+	}()
+
+	return output_chan, nil
+}
+
+// Metrics returns a snapshot of the executor's metrics.
+func (self *Executor) Metrics() Metrics {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := self.metrics
+	result.Running = self.running
+	result.Queued = len(self.queue)
+	return result
+}
+
+// Close rejects all queued and future queries. Running queries are
+// not affected.
+func (self *Executor) Close() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.closed = true
+	for len(self.queue) > 0 {
+		waiter := heap.Pop(&self.queue).(*waiter)
+		waiter.err = ErrClosed
+		close(waiter.ready)
+	}
+}
+
+// Wait for a free slot.
+func (self *Executor) admit(ctx context.Context, request *Request) error {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return ErrClosed
+	}
+
+	// Run immediately if there is a free slot and nothing is
+	// waiting before us.
+	if self.running < self.options.MaxConcurrent && len(self.queue) == 0 {
+		self.running++
+		self.metrics.Admitted++
+		self.mu.Unlock()
+		return nil
+	}
+
+	if self.options.MaxQueued > 0 && len(self.queue) >= self.options.MaxQueued {
+		self.metrics.Rejected++
+		self.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	self.seq++
+	waiter := &waiter{
+		priority: request.Priority,
+		seq:      self.seq,
+		queued:   time.Now(),
+		ready:    make(chan bool),
+	}
+	heap.Push(&self.queue, waiter)
+	self.mu.Unlock()
+
+	timeout := request.QueueTimeout
+	if timeout == 0 {
+		timeout = self.options.QueueTimeout
+	}
+
+	var timeout_chan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeout_chan = timer.C
+	}
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return waiter.err
+	case <-timeout_chan:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// We may have been admitted while giving up.
+	select {
+	case <-waiter.ready:
+		if waiter.err == nil {
+			self.running--
+			self.admitNext()
+		}
+		return err
+	default:
+	}
+
+	heap.Remove(&self.queue, waiter.index)
+	if err == ErrQueueTimeout {
+		self.metrics.TimedOut++
+	}
+	return err
+}
+
+func (self *Executor) release() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.running--
+	self.admitNext()
+}
+
+// Admit waiting queries while there are free slots. Must be called
+// with the lock held.
+func (self *Executor) admitNext() {
+	for self.running < self.options.MaxConcurrent && len(self.queue) > 0 {
+		waiter := heap.Pop(&self.queue).(*waiter)
+
+		waited := time.Since(waiter.queued)
+		self.metrics.TotalQueueTime += waited
+		if waited > self.metrics.MaxQueueTime {
+			self.metrics.MaxQueueTime = waited
+		}
+		self.metrics.Admitted++
+		self.running++
+		close(waiter.ready)
+	}
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	queued   time.Time
+
+	// Closed when the query is admitted or rejected (with err
+	// set).
+	ready chan bool
+	err   error
+
+	// The position in the queue's heap.
+	index int
+}
+
+// A priority queue of waiting queries.
+type waitQueue []*waiter
+
+func (self waitQueue) Len() int { return len(self) }
+
+func (self waitQueue) Less(i, j int) bool {
+	if self[i].priority != self[j].priority {
+		return self[i].priority > self[j].priority
+	}
+	return self[i].seq < self[j].seq
+}
+
+func (self waitQueue) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+	self[i].index = i
+	self[j].index = j
+}
+
+func (self *waitQueue) Push(x interface{}) {
+	item := x.(*waiter)
+	item.index = len(*self)
+	*self = append(*self, item)
+}
+
+func (self *waitQueue) Pop() interface{} {
+	old := *self
+	n := len(old)
+	item := old[n-1]
+	*self = old[:n-1]
+	return item
+}
@@ -0,0 +1,187 @@
+package executor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/executor"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A scope with a plugin which blocks until the gate is closed.
+func makeScope(gate chan bool) types.Scope {
+	return vfilter.NewScope().AppendPlugins(vfilter.GenericListPlugin{
+		PluginName: "gate",
+		Function: func(ctx context.Context, scope types.Scope,
+			args *ordereddict.Dict) []types.Row {
+			<-gate
+			return []types.Row{ordereddict.NewDict().Set("X", 1)}
+		},
+	})
+}
+
+func waitForQueued(t *testing.T, exec *executor.Executor, queued int) {
+	for i := 0; i < 100; i++ {
+		if exec.Metrics().Queued == queued {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %v queued queries", queued)
+}
+
+func drain(rows <-chan types.Row) int {
+	count := 0
+	for range rows {
+		count++
+	}
+	return count
+}
+
+func TestPriorityAdmission(t *testing.T) {
+	ctx := context.Background()
+	exec := executor.NewExecutor(executor.Options{MaxConcurrent: 1})
+
+	gate := make(chan bool)
+	scope := makeScope(gate)
+	defer scope.Close()
+
+	// Occupy the only slot.
+	rows, err := exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM gate()",
+		Scope: scope,
+	})
+	assert.NoError(t, err)
+
+	mu := sync.Mutex{}
+	order := []string{}
+	wg := sync.WaitGroup{}
+
+	queue := func(name string, priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rows, err := exec.Run(ctx, &executor.Request{
+				Query:    "SELECT * FROM scope()",
+				Scope:    scope,
+				Priority: priority,
+			})
+			assert.NoError(t, err)
+
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			drain(rows)
+		}()
+	}
+
+	queue("low", 0)
+	waitForQueued(t, exec, 1)
+	queue("high", 10)
+	waitForQueued(t, exec, 2)
+	queue("low2", 0)
+	waitForQueued(t, exec, 3)
+
+	metrics := exec.Metrics()
+	assert.Equal(t, 1, metrics.Running)
+	assert.Equal(t, 3, metrics.Queued)
+
+	close(gate)
+	assert.Equal(t, 1, drain(rows))
+	wg.Wait()
+
+	// Higher priority first, then in arrival order.
+	assert.Equal(t, []string{"high", "low", "low2"}, order)
+
+	metrics = exec.Metrics()
+	assert.Equal(t, 0, metrics.Running)
+	assert.Equal(t, 0, metrics.Queued)
+	assert.Equal(t, uint64(4), metrics.Admitted)
+	assert.True(t, metrics.MaxQueueTime > 0)
+	assert.True(t, metrics.TotalQueueTime >= metrics.MaxQueueTime)
+}
+
+func TestQueueLimits(t *testing.T) {
+	ctx := context.Background()
+	exec := executor.NewExecutor(executor.Options{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+	})
+
+	gate := make(chan bool)
+	scope := makeScope(gate)
+	defer scope.Close()
+
+	// Syntax errors are reported before queueing.
+	_, err := exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM",
+		Scope: scope,
+	})
+	assert.Error(t, err)
+
+	rows, err := exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM gate()",
+		Scope: scope,
+	})
+	assert.NoError(t, err)
+
+	// Times out waiting for the slot.
+	_, err = exec.Run(ctx, &executor.Request{
+		Query:        "SELECT * FROM scope()",
+		Scope:        scope,
+		QueueTimeout: 50 * time.Millisecond,
+	})
+	assert.Equal(t, executor.ErrQueueTimeout, err)
+
+	// Cancelling the context abandons the wait.
+	sub_ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		_, err := exec.Run(sub_ctx, &executor.Request{
+			Query: "SELECT * FROM scope()",
+			Scope: scope,
+		})
+		done <- err
+	}()
+	waitForQueued(t, exec, 1)
+
+	// The queue is full.
+	_, err = exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM scope()",
+		Scope: scope,
+	})
+	assert.Equal(t, executor.ErrQueueFull, err)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	metrics := exec.Metrics()
+	assert.Equal(t, 1, metrics.Running)
+	assert.Equal(t, 0, metrics.Queued)
+	assert.Equal(t, uint64(1), metrics.TimedOut)
+	assert.Equal(t, uint64(1), metrics.Rejected)
+
+	close(gate)
+	assert.Equal(t, 1, drain(rows))
+
+	// The slot is free again.
+	rows, err = exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM scope()",
+		Scope: scope,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, drain(rows))
+
+	exec.Close()
+	_, err = exec.Run(ctx, &executor.Request{
+		Query: "SELECT * FROM scope()",
+		Scope: scope,
+	})
+	assert.Equal(t, executor.ErrClosed, err)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/sebdah/goldie/v2"
+	"github.com/stretchr/testify/assert"
 	"www.velocidex.com/golang/vfilter"
 	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils/dict"
@@ -73,3 +75,63 @@ func TestExplain(t *testing.T) {
 	)
 	g.AssertJson(t, "TestExplain", result)
 }
+
+func TestExplainSummary(t *testing.T) {
+	logger := &CapturingLogger{}
+	scope := makeTestScope(logger)
+	multi_vql, err := vfilter.MultiParse(`
+EXPLAIN SELECT * FROM range(end=10) WHERE _value < 3
+EXPLAIN SELECT * FROM range(end=4)
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, vql := range multi_vql {
+		for range vql.Eval(ctx, scope) {
+		}
+	}
+
+	scope.EnableExplain()
+	summary := scope.Explainer().(types.SelectivityExplainer).Summary()
+	assert.Equal(t, 2, len(summary))
+
+	for _, item := range []struct {
+		plugin           string
+		produced, passed int64
+		selectivity      float64
+	}{
+		{"range()", 10, 3, 0.3},
+		{"range()", 4, 4, 1},
+	} {
+		row := summary[0]
+		summary = summary[1:]
+
+		plugin, _ := row.Get("Plugin")
+		assert.Equal(t, item.plugin, plugin)
+
+		produced, _ := row.Get("RowsProduced")
+		assert.Equal(t, item.produced, produced)
+
+		passed, _ := row.Get("RowsPassed")
+		assert.Equal(t, item.passed, passed)
+
+		selectivity, _ := row.Get("Selectivity")
+		assert.Equal(t, item.selectivity, selectivity)
+	}
+}
+
+func TestExplainRedaction(t *testing.T) {
+	logger := &CapturingLogger{}
+	scope := makeTestScope(logger)
+	types.SetOption(scope, types.RedactionPolicyOption, &types.RedactionPolicy{
+		Columns: []string{"Password"},
+	})
+
+	vql, err := vfilter.Parse("EXPLAIN SELECT 'x' AS Password FROM scope()")
+	assert.NoError(t, err)
+
+	for range vql.Eval(context.Background(), scope) {
+	}
+	assert.Contains(t, strings.Join(logger.rows, ""),
+		"Redacting columns Password")
+}
@@ -2,6 +2,8 @@ package explain
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/alecthomas/repr"
@@ -15,12 +17,30 @@ type descriptor struct {
 	Value string
 }
 
+// Statistics about the rows processed by a single query.
+type queryStats struct {
+	query          string
+	plugin         string
+	rows_produced  int64
+	rows_passed    int64
+	transform_time time.Duration
+}
+
 type LoggingExplainer struct {
 	scope types.Scope
+
+	mu sync.Mutex
+
+	// Stats are kept per query in the order queries were started.
+	stats       map[interface{}]*queryStats
+	stats_order []interface{}
 }
 
 func NewLoggingExplainer(scope types.Scope) *LoggingExplainer {
-	return &LoggingExplainer{scope: scope}
+	return &LoggingExplainer{
+		scope: scope,
+		stats: make(map[interface{}]*queryStats),
+	}
 }
 
 func (self *LoggingExplainer) StartQuery(select_ast_node interface{}) {
@@ -98,6 +118,55 @@ func (self *LoggingExplainer) Log(message string) {
 	self.scope.Log("DEBUG:" + message)
 }
 
+func (self *LoggingExplainer) RowProcessed(select_ast_node interface{},
+	plugin_ast_node interface{}, passed bool, transform_time time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	stats, pres := self.stats[select_ast_node]
+	if !pres {
+		stats = &queryStats{
+			query: vfilter.FormatToString(self.scope, select_ast_node),
+		}
+		plugin, ok := plugin_ast_node.(*vfilter.Plugin)
+		if ok {
+			stats.plugin = plugin.Name + "()"
+		}
+		self.stats[select_ast_node] = stats
+		self.stats_order = append(self.stats_order, select_ast_node)
+	}
+
+	stats.rows_produced++
+	if passed {
+		stats.rows_passed++
+	}
+	stats.transform_time += transform_time
+}
+
+// Summary returns a row for each query explained so far. Selectivity
+// is the fraction of the plugin's rows which survived the WHERE
+// clause. Queries with a low selectivity benefit most from moving
+// their conditions into the plugin args or an earlier query.
+func (self *LoggingExplainer) Summary() []*ordereddict.Dict {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := []*ordereddict.Dict{}
+	for _, key := range self.stats_order {
+		stats := self.stats[key]
+		result = append(result, ordereddict.NewDict().
+			Set("Query", stats.query).
+			Set("Plugin", stats.plugin).
+			Set("RowsProduced", stats.rows_produced).
+			Set("RowsPassed", stats.rows_passed).
+			Set("Selectivity",
+				float64(stats.rows_passed)/float64(stats.rows_produced)).
+			Set("AvgTransformTime",
+				stats.transform_time/time.Duration(stats.rows_produced)))
+	}
+	return result
+}
+
 func (self *LoggingExplainer) RejectRow(where_ast_node interface{}) {
 	self.scope.Log("DEBUG: REJECTED by " +
 		vfilter.FormatToString(self.scope, where_ast_node))
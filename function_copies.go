@@ -0,0 +1,63 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Each reference to a function in the AST calls its own copy of the
+// function so the function may keep state between calls (e.g. the
+// aggregate functions). The copies are held per query rather than in
+// the AST so one parsed query may be evaluated concurrently in
+// different scopes: Each query uses the functions defined in its own
+// scope and keeps its own state.
+//
+// Nodes evaluated outside VQL.Eval() (which creates the copies) keep
+// their copy in the node itself.
+type functionCopiesKey int
+
+const functionCopiesKeyValue functionCopiesKey = 0
+
+type functionCopy struct {
+	function types.FunctionInterface
+	version  uint64
+}
+
+type functionCopies struct {
+	// Maps *_SymbolRef to *functionCopy
+	functions sync.Map
+}
+
+func withFunctionCopies(ctx context.Context) context.Context {
+	return context.WithValue(ctx, functionCopiesKeyValue, &functionCopies{})
+}
+
+func getFunctionCopies(ctx context.Context) *functionCopies {
+	copies, _ := ctx.Value(functionCopiesKeyValue).(*functionCopies)
+	return copies
+}
+
+// Get the function copy the node called previously in this query.
+func (self *functionCopies) get(
+	node *_SymbolRef, version uint64) types.FunctionInterface {
+	value, pres := self.functions.Load(node)
+	if !pres {
+		return nil
+	}
+
+	function := value.(*functionCopy)
+	if function.version != version {
+		return nil
+	}
+	return function.function
+}
+
+func (self *functionCopies) set(node *_SymbolRef,
+	function types.FunctionInterface, version uint64) {
+	self.functions.Store(node, &functionCopy{
+		function: function,
+		version:  version,
+	})
+}
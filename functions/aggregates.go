@@ -141,6 +141,11 @@ func (self _CountFunction) Call(
 		})
 }
 
+func (self _CountFunction) MergeAggregate(
+	scope types.Scope, a, b types.Any) types.Any {
+	return scope.Add(a, b)
+}
+
 type _SumFunctionArgs struct {
 	Item int64 `vfilter:"required,field=item"`
 }
@@ -194,6 +199,11 @@ func (self _SumFunction) Call(
 		})
 }
 
+func (self _SumFunction) MergeAggregate(
+	scope types.Scope, a, b types.Any) types.Any {
+	return scope.Add(a, b)
+}
+
 type _MinFunctionArgs struct {
 	Item types.LazyExpr `vfilter:"required,field=item"`
 }
@@ -242,6 +252,14 @@ func (self _MinFunction) Call(
 		})
 }
 
+func (self _MinFunction) MergeAggregate(
+	scope types.Scope, a, b types.Any) types.Any {
+	if scope.Lt(b, a) {
+		return b
+	}
+	return a
+}
+
 type _MaxFunction struct {
 	Aggregator
 }
@@ -285,6 +303,14 @@ func (self _MaxFunction) Call(
 		})
 }
 
+func (self _MaxFunction) MergeAggregate(
+	scope types.Scope, a, b types.Any) types.Any {
+	if scope.Lt(a, b) {
+		return b
+	}
+	return a
+}
+
 type _EnumeateFunctionArgs struct {
 	Items types.Any `vfilter:"optional,field=items,doc=The items to enumerate"`
 }
@@ -335,3 +361,9 @@ func (self _EnumerateFunction) Call(
 			return value
 		})
 }
+
+// The arrays are concatenated.
+func (self _EnumerateFunction) MergeAggregate(
+	scope types.Scope, a, b types.Any) types.Any {
+	return scope.Add(a, b)
+}
@@ -0,0 +1,79 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _BigIntFunctionArgs struct {
+	Value types.Any `vfilter:"required,field=value,doc=A number or numeric string to convert"`
+}
+
+// Converts a value to an arbitrary precision integer.
+type _BigIntFunction struct{}
+
+func (self _BigIntFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "bigint",
+		Doc:     "Convert a value to an arbitrary precision integer.",
+		ArgType: type_map.AddType(scope, &_BigIntFunctionArgs{}),
+	}
+}
+
+func (self _BigIntFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_BigIntFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("bigint: %s", err.Error())
+		return types.Null{}
+	}
+
+	value, ok := types.ToBigInt(arg.Value)
+	if !ok {
+		scope.Log("bigint: unable to convert %v to an integer", arg.Value)
+		return types.Null{}
+	}
+
+	return types.NewBigInt(value)
+}
+
+type _DecimalFunctionArgs struct {
+	Value types.Any `vfilter:"required,field=value,doc=A number or numeric string to convert"`
+}
+
+// Converts a value to an exact arbitrary precision decimal.
+type _DecimalFunction struct{}
+
+func (self _DecimalFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "decimal",
+		Doc:     "Convert a value to an exact arbitrary precision decimal.",
+		ArgType: type_map.AddType(scope, &_DecimalFunctionArgs{}),
+	}
+}
+
+func (self _DecimalFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_DecimalFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("decimal: %s", err.Error())
+		return types.Null{}
+	}
+
+	value, ok := types.ToDecimal(arg.Value)
+	if !ok {
+		scope.Log("decimal: unable to convert %v to a decimal", arg.Value)
+		return types.Null{}
+	}
+
+	return types.NewDecimal(value)
+}
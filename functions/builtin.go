@@ -11,6 +11,27 @@ func GetBuiltinFunctions() []types.FunctionInterface {
 		FormatFunction{},
 		_GetFunction{},
 		_EncodeFunction{},
+		_BytesFunction{},
+		_StrFunction{},
+		_BigIntFunction{},
+		_DecimalFunction{},
+		_IPFunction{},
+		_CIDRContainsFunction{},
+		_EqualsFunction{},
+		_IntersectFunction{},
+		_UnionFunction{},
+		_DifferenceFunction{},
+		_PublishFunction{},
+		_HasColumnFunction{},
+		_ExistsFunction{},
+		_NowFunction{},
+		_RandFunction{},
+		_UUIDFunction{},
+		_FuzzyMatchFunction{},
+		_GlobMatchFunction{},
+		_StartsWithFunction{},
+		_EndsWithFunction{},
+		_ContainsFunction{},
 
 		// Aggregate functions must not be implicitly copied. They are
 		// copied deliberately using vfilter.CopyFunction()
@@ -21,6 +42,8 @@ func GetBuiltinFunctions() []types.FunctionInterface {
 		&_EnumerateFunction{},
 		FormatFunction{},
 		LenFunction{},
+		_RunesFunction{},
+		CoalesceFunction{},
 		_Scope{},
 	}
 }
@@ -0,0 +1,99 @@
+package functions
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+type _BytesFunctionArgs struct {
+	Value types.Any `vfilter:"required,field=value,doc=A string or a list of byte values to convert"`
+}
+
+// Converts a value to a binary safe Bytes object.
+type _BytesFunction struct{}
+
+func (self _BytesFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "bytes",
+		Doc:     "Convert a value to binary safe bytes.",
+		ArgType: type_map.AddType(scope, &_BytesFunctionArgs{}),
+	}
+}
+
+func (self _BytesFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_BytesFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("bytes: %s", err.Error())
+		return types.Null{}
+	}
+
+	switch t := arg.Value.(type) {
+	case types.Bytes:
+		return t
+
+	case []byte:
+		return types.Bytes(t)
+
+	case string:
+		return types.Bytes(t)
+
+	case types.Null, *types.Null, nil:
+		return types.Null{}
+	}
+
+	// A list of integers is interpreted as byte values.
+	a_value := reflect.ValueOf(arg.Value)
+	if a_value.Kind() == reflect.Slice || a_value.Kind() == reflect.Array {
+		result := make(types.Bytes, 0, a_value.Len())
+		for i := 0; i < a_value.Len(); i++ {
+			item, ok := utils.ToInt64(a_value.Index(i).Interface())
+			if !ok || item < 0 || item > 255 {
+				scope.Log("bytes: item %v is not a byte value", i)
+				return types.Null{}
+			}
+			result = append(result, byte(item))
+		}
+		return result
+	}
+
+	return types.Bytes(types.ToString(ctx, scope, arg.Value))
+}
+
+type _StrFunctionArgs struct {
+	Value types.Any `vfilter:"required,field=value,doc=The value to convert"`
+}
+
+// Converts a value to a string. Bytes are converted as is without
+// any decoding.
+type _StrFunction struct{}
+
+func (self _StrFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "str",
+		Doc:     "Convert a value to a string.",
+		ArgType: type_map.AddType(scope, &_StrFunctionArgs{}),
+	}
+}
+
+func (self _StrFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_StrFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("str: %s", err.Error())
+		return types.Null{}
+	}
+
+	return types.ToString(ctx, scope, arg.Value)
+}
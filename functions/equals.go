@@ -0,0 +1,41 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/protocols"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _EqualsFunctionArgs struct {
+	A      types.Any `vfilter:"required,field=a,doc=The first value"`
+	B      types.Any `vfilter:"required,field=b,doc=The second value"`
+	Strict bool      `vfilter:"optional,field=strict,doc=If set arrays must have their elements in the same order"`
+}
+
+// Deep compare two values.
+type _EqualsFunction struct{}
+
+func (self _EqualsFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "equals",
+		Doc:     "Deep compare two values. Arrays are compared ignoring order unless strict is set.",
+		ArgType: type_map.AddType(scope, &_EqualsFunctionArgs{}),
+	}
+}
+
+func (self _EqualsFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_EqualsFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("equals: %s", err.Error())
+		return types.Null{}
+	}
+
+	return protocols.DeepEqual(ctx, scope, arg.A, arg.B, arg.Strict)
+}
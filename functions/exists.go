@@ -0,0 +1,103 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _HasColumnFunctionArgs struct {
+	Row  types.Any `vfilter:"optional,field=row,doc=The row to check (default the current scope)"`
+	Name string    `vfilter:"required,field=name,doc=The name of the column"`
+}
+
+// Checks if a row has a column without evaluating it.
+type _HasColumnFunction struct{}
+
+func (self _HasColumnFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "has_column",
+		Doc:     "Returns true if the row has a column with the given name.",
+		ArgType: type_map.AddType(scope, &_HasColumnFunctionArgs{}),
+	}
+}
+
+func (self _HasColumnFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_HasColumnFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("has_column: %s", err.Error())
+		return false
+	}
+
+	// Without a row check the columns of the current row which are
+	// in the scope.
+	if arg.Row == nil {
+		value, pres := scope.Resolve(arg.Name)
+		if !pres {
+			return false
+		}
+		_, unbound := value.(types.Unbound)
+		return !unbound
+	}
+
+	switch t := arg.Row.(type) {
+	case types.LazyRow:
+		return t.Has(arg.Name)
+
+	case *ordereddict.Dict:
+		_, pres := t.Get(arg.Name)
+		return pres
+	}
+
+	for _, member := range scope.GetMembers(arg.Row) {
+		if member == arg.Name {
+			return true
+		}
+	}
+	return false
+}
+
+type _ExistsFunctionArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query to check"`
+}
+
+// Checks if a query returns any rows. The query is cancelled as soon
+// as the first row is seen.
+type _ExistsFunction struct{}
+
+func (self _ExistsFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "exists",
+		Doc:     "Returns true if the query returns at least one row.",
+		ArgType: type_map.AddType(scope, &_ExistsFunctionArgs{}),
+	}
+}
+
+func (self _ExistsFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_ExistsFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("exists: %s", err.Error())
+		return false
+	}
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	subscope := scope.Copy()
+	defer subscope.Close()
+
+	for range arg.Query.Eval(sub_ctx, subscope) {
+		return true
+	}
+	return false
+}
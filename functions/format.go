@@ -3,7 +3,6 @@ package functions
 import (
 	"context"
 	"fmt"
-	"reflect"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/arg_parser"
@@ -11,8 +10,8 @@ import (
 )
 
 type FormatArgs struct {
-	Format string    `vfilter:"required,field=format,doc=Format string to use"`
-	Args   types.Any `vfilter:"optional,field=args,doc=An array of elements to apply into the format string."`
+	Format string      `vfilter:"required,field=format,doc=Format string to use"`
+	Args   []types.Any `vfilter:"variadic,field=args,doc=An array of elements to apply into the format string."`
 }
 
 type FormatFunction struct{}
@@ -27,20 +26,9 @@ func (self FormatFunction) Call(ctx context.Context,
 		return false
 	}
 
-	var format_args []interface{}
-
-	if arg.Args != nil {
-		slice := reflect.ValueOf(arg.Args)
-
-		// A slice of strings.
-		if slice.Type().Kind() != reflect.Slice {
-			format_args = append(format_args, arg.Args)
-		} else {
-			for i := 0; i < slice.Len(); i++ {
-				value := slice.Index(i).Interface()
-				format_args = append(format_args, value)
-			}
-		}
+	format_args := make([]interface{}, 0, len(arg.Args))
+	for _, item := range arg.Args {
+		format_args = append(format_args, item)
 	}
 	return fmt.Sprintf(arg.Format, format_args...)
 }
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Velocidex/ordereddict"
 	"golang.org/x/text/encoding/unicode"
@@ -243,6 +244,17 @@ func (self LenFunction) Call(ctx context.Context,
 		return &types.Null{}
 	}
 
+	// Strings are measured in the same units they are indexed by.
+	str, ok := arg.List.(string)
+	if ok && types.IsOptionEnabled(scope, types.RuneIndexingOption) {
+		return utf8.RuneCountInString(str)
+	}
+
+	view, ok := arg.List.(*types.SliceView)
+	if ok {
+		return view.Len()
+	}
+
 	slice := reflect.ValueOf(arg.List)
 	// A slice of strings. Only the following are supported
 	// https://golang.org/pkg/reflect/#Value.Len
@@ -269,6 +281,38 @@ func (self LenFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.
 	}
 }
 
+type _RunesFunctionArgs struct {
+	String string `vfilter:"required,field=string,doc=The string to split"`
+}
+
+// Splits a string into its unicode characters.
+type _RunesFunction struct{}
+
+func (self _RunesFunction) Call(ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_RunesFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("runes: %s", err.Error())
+		return &types.Null{}
+	}
+
+	result := make([]string, 0, len(arg.String))
+	for _, r := range arg.String {
+		result = append(result, string(r))
+	}
+	return result
+}
+
+func (self _RunesFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "runes",
+		Doc:     "Split a string into a list of unicode characters.",
+		ArgType: type_map.AddType(scope, &_RunesFunctionArgs{}),
+	}
+}
+
 func Materialize(ctx context.Context,
 	scope types.Scope, stored_query types.StoredQuery) []types.Row {
 	result := []types.Row{}
@@ -283,3 +327,35 @@ func Materialize(ctx context.Context,
 
 	return result
 }
+
+type CoalesceFunctionArgs struct {
+	Items []types.Any `vfilter:"variadic,field=items,doc=The values to consider"`
+}
+
+type CoalesceFunction struct{}
+
+func (self CoalesceFunction) Call(ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &CoalesceFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("coalesce: %s", err.Error())
+		return &types.Null{}
+	}
+
+	for _, item := range arg.Items {
+		if !types.IsNil(item) {
+			return item
+		}
+	}
+	return &types.Null{}
+}
+
+func (self CoalesceFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "coalesce",
+		Doc:     "Returns the first value which is not NULL.",
+		ArgType: type_map.AddType(scope, &CoalesceFunctionArgs{}),
+	}
+}
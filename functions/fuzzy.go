@@ -0,0 +1,51 @@
+package functions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+type _FuzzyMatchFunctionArgs struct {
+	String        string `vfilter:"required,field=string,doc=The string to test"`
+	Pattern       string `vfilter:"required,field=pattern,doc=The string to compare with"`
+	Distance      int64  `vfilter:"optional,field=distance,default=2,doc=The maximum number of edits (default 2)"`
+	CaseSensitive bool   `vfilter:"optional,field=case_sensitive,doc=If set case differences count as edits"`
+}
+
+// Match strings which differ by only a few edits.
+type _FuzzyMatchFunction struct{}
+
+func (self _FuzzyMatchFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name: "fuzzy_match",
+		Doc: "Returns true if the string is within distance edits of the pattern. " +
+			"Edits are insertions, deletions, substitutions and transpositions " +
+			"of adjacent characters (Damerau-Levenshtein distance).",
+		ArgType: type_map.AddType(scope, &_FuzzyMatchFunctionArgs{}),
+	}
+}
+
+func (self _FuzzyMatchFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_FuzzyMatchFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("fuzzy_match: %s", err.Error())
+		return types.Null{}
+	}
+
+	if !arg.CaseSensitive {
+		arg.String = strings.ToLower(arg.String)
+		arg.Pattern = strings.ToLower(arg.Pattern)
+	}
+
+	return utils.EditDistance(arg.String, arg.Pattern,
+		int(arg.Distance)) <= int(arg.Distance)
+}
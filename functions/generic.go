@@ -28,6 +28,7 @@ type GenericFunction struct {
 	Function     GenericFunctionInterface
 	Metadata     *ordereddict.Dict
 	ArgType      types.Any
+	Impact       types.Impact
 }
 
 func (self GenericFunction) Copy() types.FunctionInterface {
@@ -46,6 +47,7 @@ func (self GenericFunction) Info(scope types.Scope, type_map *types.TypeMap) *ty
 	result := &types.FunctionInfo{
 		Name:     self.FunctionName,
 		Doc:      self.Doc,
+		Impact:   self.Impact,
 		Metadata: self.Metadata,
 	}
 
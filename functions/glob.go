@@ -0,0 +1,171 @@
+package functions
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _GlobMatchFunctionArgs struct {
+	String        string   `vfilter:"required,field=string,doc=The string to test"`
+	Pattern       []string `vfilter:"required,field=pattern,doc=One or more glob patterns"`
+	CaseSensitive bool     `vfilter:"optional,field=case_sensitive,doc=If set the match is case sensitive"`
+}
+
+// Match strings against shell style glob patterns.
+type _GlobMatchFunction struct{}
+
+func (self _GlobMatchFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name: "glob_match",
+		Doc: "Returns true if the string matches any of the glob patterns. " +
+			"* and ? do not match path separators, ** matches anything, " +
+			"[abc] matches a character class and {a,b} matches alternatives.",
+		ArgType: type_map.AddType(scope, &_GlobMatchFunctionArgs{}),
+	}
+}
+
+func (self _GlobMatchFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_GlobMatchFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("glob_match: %s", err.Error())
+		return types.Null{}
+	}
+
+	for _, pattern := range arg.Pattern {
+		re := compileGlob(scope, pattern, arg.CaseSensitive)
+		if re != nil && re.MatchString(arg.String) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compiled globs are cached in the scope context like regexps.
+func compileGlob(scope types.Scope, pattern string, case_sensitive bool) *regexp.Regexp {
+	key := "__glob" + pattern
+	flags := "(?s)"
+	if !case_sensitive {
+		key = "__globi" + pattern
+		flags = "(?is)"
+	}
+
+	re_any, pres := scope.GetContext(key)
+	if pres {
+		re, _ := re_any.(*regexp.Regexp)
+		return re
+	}
+
+	re, err := regexp.Compile(flags + "^" + globToRegex(pattern) + "$")
+	if err != nil {
+		scope.Log("glob_match: invalid pattern %v: %v", pattern, err)
+		return nil
+	}
+
+	scope.SetContext(key, re)
+	return re
+}
+
+// Translates a glob into an equivalent regular expression. There is
+// no escape character since \ is a path separator on Windows - use a
+// class like [*] to match a special character.
+func globToRegex(glob string) string {
+	result := strings.Builder{}
+	pattern := []rune(glob)
+	braces := 0
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				result.WriteString(".*")
+				i++
+			} else {
+				result.WriteString(`[^/\\]*`)
+			}
+
+		case '?':
+			result.WriteString(`[^/\\]`)
+
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				result.WriteString(`\[`)
+				continue
+			}
+
+			result.WriteString("[")
+			for j := i + 1; j < end; j++ {
+				switch {
+				case j == i+1 && (pattern[j] == '!' || pattern[j] == '^'):
+					result.WriteString("^")
+				case pattern[j] == '\\' || pattern[j] == '[' || pattern[j] == ']':
+					result.WriteString(`\`)
+					result.WriteRune(pattern[j])
+				default:
+					result.WriteRune(pattern[j])
+				}
+			}
+			result.WriteString("]")
+			i = end
+
+		case '{':
+			braces++
+			result.WriteString("(?:")
+
+		case '}':
+			if braces == 0 {
+				result.WriteString(`\}`)
+				continue
+			}
+			braces--
+			result.WriteString(")")
+
+		case ',':
+			if braces > 0 {
+				result.WriteString("|")
+			} else {
+				result.WriteString(",")
+			}
+
+		default:
+			result.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	// Unterminated alternatives extend to the end of the pattern.
+	for ; braces > 0; braces-- {
+		result.WriteString(")")
+	}
+
+	return result.String()
+}
+
+// Returns the index of the ] closing the character class starting
+// at start or -1 if it is not closed. A ] right after the opening
+// [ (or [!) is part of the class.
+func classEnd(pattern []rune, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
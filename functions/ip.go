@@ -0,0 +1,113 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _IPFunctionArgs struct {
+	String types.Any `vfilter:"optional,field=string,doc=An IPv4 or IPv6 address to parse"`
+	CIDR   string    `vfilter:"optional,field=cidr,doc=A network in CIDR notation (e.g. 10.0.0.0/8)"`
+}
+
+// Parses an IP address or a CIDR network. Addresses compare with
+// each other and can be tested for membership in networks:
+// SrcIP in ip(cidr='10.0.0.0/8')
+type _IPFunction struct{}
+
+func (self _IPFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "ip",
+		Doc:     "Parse an IP address or a CIDR network.",
+		ArgType: type_map.AddType(scope, &_IPFunctionArgs{}),
+	}
+}
+
+func (self _IPFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_IPFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("ip: %s", err.Error())
+		return types.Null{}
+	}
+
+	if arg.CIDR != "" {
+		if arg.String != nil {
+			scope.Log("ip: only one of string or cidr may be specified")
+			return types.Null{}
+		}
+
+		network, ok := types.ToIPNetwork(arg.CIDR)
+		if !ok {
+			scope.Log("ip: invalid network %v", arg.CIDR)
+			return types.Null{}
+		}
+		return types.NewIPNetwork(network)
+	}
+
+	if arg.String == nil {
+		scope.Log("ip: one of string or cidr must be specified")
+		return types.Null{}
+	}
+
+	ip, ok := types.ToIP(arg.String)
+	if !ok {
+		// Unparsable addresses are common in real data so this is
+		// not an error.
+		scope.Trace("ip: invalid address %v", arg.String)
+		return types.Null{}
+	}
+	return types.NewIPAddress(ip)
+}
+
+type _CIDRContainsFunctionArgs struct {
+	IP   types.Any `vfilter:"required,field=ip,doc=The address to check"`
+	CIDR []string  `vfilter:"required,field=cidr,doc=One or more networks in CIDR notation"`
+}
+
+// Checks if an address is in any of several networks.
+type _CIDRContainsFunction struct{}
+
+func (self _CIDRContainsFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "cidr_contains",
+		Doc:     "Check if an IP address is in any of the networks.",
+		ArgType: type_map.AddType(scope, &_CIDRContainsFunctionArgs{}),
+	}
+}
+
+func (self _CIDRContainsFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_CIDRContainsFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("cidr_contains: %s", err.Error())
+		return types.Null{}
+	}
+
+	ip, ok := types.ToIP(arg.IP)
+	if !ok {
+		return false
+	}
+
+	for _, cidr := range arg.CIDR {
+		network, ok := types.ToIPNetwork(cidr)
+		if !ok {
+			scope.Log("cidr_contains: invalid network %v", cidr)
+			return types.Null{}
+		}
+
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package functions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Simple string tests which are cheaper than the equivalent regex.
+// They implement types.StringPredicateFunction so they can be
+// recognized in WHERE clauses.
+
+type _StartsWithFunctionArgs struct {
+	String        string `vfilter:"required,field=string,doc=The string to test"`
+	Prefix        string `vfilter:"required,field=prefix,doc=The prefix to look for"`
+	CaseSensitive bool   `vfilter:"optional,field=case_sensitive,doc=If set the test is case sensitive"`
+}
+
+type _StartsWithFunction struct{}
+
+func (self _StartsWithFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "starts_with",
+		Doc:     "Returns true if the string starts with the prefix.",
+		ArgType: type_map.AddType(scope, &_StartsWithFunctionArgs{}),
+	}
+}
+
+func (self _StartsWithFunction) ValueArg() string {
+	return "prefix"
+}
+
+func (self _StartsWithFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_StartsWithFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("starts_with: %s", err.Error())
+		return types.Null{}
+	}
+
+	if len(arg.Prefix) > len(arg.String) {
+		return false
+	}
+
+	head := arg.String[:len(arg.Prefix)]
+	if arg.CaseSensitive {
+		return head == arg.Prefix
+	}
+	return strings.EqualFold(head, arg.Prefix)
+}
+
+type _EndsWithFunctionArgs struct {
+	String        string `vfilter:"required,field=string,doc=The string to test"`
+	Suffix        string `vfilter:"required,field=suffix,doc=The suffix to look for"`
+	CaseSensitive bool   `vfilter:"optional,field=case_sensitive,doc=If set the test is case sensitive"`
+}
+
+type _EndsWithFunction struct{}
+
+func (self _EndsWithFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "ends_with",
+		Doc:     "Returns true if the string ends with the suffix.",
+		ArgType: type_map.AddType(scope, &_EndsWithFunctionArgs{}),
+	}
+}
+
+func (self _EndsWithFunction) ValueArg() string {
+	return "suffix"
+}
+
+func (self _EndsWithFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_EndsWithFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("ends_with: %s", err.Error())
+		return types.Null{}
+	}
+
+	if len(arg.Suffix) > len(arg.String) {
+		return false
+	}
+
+	tail := arg.String[len(arg.String)-len(arg.Suffix):]
+	if arg.CaseSensitive {
+		return tail == arg.Suffix
+	}
+	return strings.EqualFold(tail, arg.Suffix)
+}
+
+type _ContainsFunctionArgs struct {
+	String        string `vfilter:"required,field=string,doc=The string to test"`
+	Substring     string `vfilter:"required,field=substring,doc=The substring to look for"`
+	CaseSensitive bool   `vfilter:"optional,field=case_sensitive,doc=If set the test is case sensitive"`
+}
+
+type _ContainsFunction struct{}
+
+func (self _ContainsFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "contains",
+		Doc:     "Returns true if the string contains the substring.",
+		ArgType: type_map.AddType(scope, &_ContainsFunctionArgs{}),
+	}
+}
+
+func (self _ContainsFunction) ValueArg() string {
+	return "substring"
+}
+
+func (self _ContainsFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_ContainsFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("contains: %s", err.Error())
+		return types.Null{}
+	}
+
+	if arg.CaseSensitive {
+		return strings.Contains(arg.String, arg.Substring)
+	}
+	return containsFold(arg.String, arg.Substring)
+}
+
+// A case insensitive strings.Contains which does not allocate.
+func containsFold(s, substr string) bool {
+	if substr == "" {
+		return true
+	}
+
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/pubsub"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _PublishFunctionArgs struct {
+	Topic string    `vfilter:"required,field=topic,doc=The topic to publish to."`
+	Row   types.Any `vfilter:"required,field=row,doc=The row to publish."`
+}
+
+type _PublishFunction struct{}
+
+func (self _PublishFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name: "publish",
+		Doc: "Publish a row to all subscribers of the topic. Returns " +
+			"the number of subscribers that received it.",
+		ArgType: type_map.AddType(scope, _PublishFunctionArgs{}),
+		Impact:  types.ImpactHostSink,
+	}
+}
+
+func (self _PublishFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+
+	arg := &_PublishFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("publish: %v", err)
+		return types.Null{}
+	}
+
+	return pubsub.GetEventBus(scope).Publish(arg.Topic, arg.Row)
+}
@@ -0,0 +1,90 @@
+package functions
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// These functions return nondeterministic values. They take them from
+// the scope's entropy source so tests can make them repeatable with
+// types.SetDeterministic(). UUIDs come from crypto/rand unless the
+// scope has an entropy source.
+
+type _NowFunction struct{}
+
+func (self _NowFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name: "now",
+		Doc:  "Returns the current time.",
+	}
+}
+
+func (self _NowFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return types.GetEntropySource(scope).Now()
+}
+
+type _RandFunctionArgs struct {
+	Range int64 `vfilter:"optional,field=range,doc=Return a number between 0 and range - 1"`
+}
+
+type _RandFunction struct{}
+
+func (self _RandFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "rand",
+		Doc:     "Returns a random non-negative integer.",
+		ArgType: type_map.AddType(scope, &_RandFunctionArgs{}),
+	}
+}
+
+func (self _RandFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	arg := &_RandFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("rand: %s", err.Error())
+		return types.Null{}
+	}
+
+	value := types.GetEntropySource(scope).Int63()
+	if arg.Range > 0 {
+		value = value % arg.Range
+	}
+	return value
+}
+
+type _UUIDFunction struct{}
+
+func (self _UUIDFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name: "uuid",
+		Doc:  "Returns a random (version 4) UUID.",
+	}
+}
+
+func (self _UUIDFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	b := make([]byte, 16)
+	err := types.ReadRandom(scope, b)
+	if err != nil {
+		scope.Log("uuid: %v", err)
+		return types.Null{}
+	}
+
+	// Set the version and variant bits.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,159 @@
+package functions
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _SetFunctionArgs struct {
+	A types.Any `vfilter:"required,field=a,doc=The first array"`
+	B types.Any `vfilter:"required,field=b,doc=The second array"`
+}
+
+type _IntersectFunction struct{}
+
+func (self _IntersectFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "intersect",
+		Doc:     "Return the elements present in both arrays.",
+		ArgType: type_map.AddType(scope, &_SetFunctionArgs{}),
+	}
+}
+
+func (self _IntersectFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return setOperation(ctx, scope, args, "intersect",
+		func(in_a, in_b bool) bool {
+			return in_a && in_b
+		})
+}
+
+type _UnionFunction struct{}
+
+func (self _UnionFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "union",
+		Doc:     "Return the elements present in either array.",
+		ArgType: type_map.AddType(scope, &_SetFunctionArgs{}),
+	}
+}
+
+func (self _UnionFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return setOperation(ctx, scope, args, "union",
+		func(in_a, in_b bool) bool {
+			return in_a || in_b
+		})
+}
+
+type _DifferenceFunction struct{}
+
+func (self _DifferenceFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "difference",
+		Doc:     "Return the elements of the first array which are not in the second.",
+		ArgType: type_map.AddType(scope, &_SetFunctionArgs{}),
+	}
+}
+
+func (self _DifferenceFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return setOperation(ctx, scope, args, "difference",
+		func(in_a, in_b bool) bool {
+			return in_a && !in_b
+		})
+}
+
+// Set operations on arrays. Elements are compared using the scope's
+// Eq protocol and the result preserves the order of first
+// appearance with duplicates removed. The include callback decides
+// if an element is kept given whether it is present in each array.
+func setOperation(ctx context.Context, scope types.Scope,
+	args *ordereddict.Dict, name string,
+	include func(in_a, in_b bool) bool) types.Any {
+	arg := &_SetFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("%v: %s", name, err.Error())
+		return types.Null{}
+	}
+
+	a := toSetItems(ctx, scope, arg.A)
+	b := toSetItems(ctx, scope, arg.B)
+
+	result := []types.Any{}
+	add := func(item types.Any, in_a bool) {
+		if containsItem(scope, result, item) {
+			return
+		}
+		in_b := containsItem(scope, b, item)
+		if include(in_a, in_b) {
+			result = append(result, item)
+		}
+	}
+
+	for _, item := range a {
+		add(item, true)
+	}
+
+	for _, item := range b {
+		if !containsItem(scope, a, item) {
+			add(item, false)
+		}
+	}
+
+	return result
+}
+
+func containsItem(scope types.Scope, items []types.Any, item types.Any) bool {
+	for _, i := range items {
+		if scope.Eq(i, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert the arg to a list of items. Single values are treated as a
+// list of one item.
+func toSetItems(ctx context.Context,
+	scope types.Scope, value types.Any) []types.Any {
+	switch t := value.(type) {
+	case types.Null, *types.Null, nil:
+		return nil
+
+	case types.LazyExpr:
+		return toSetItems(ctx, scope, t.Reduce(ctx))
+
+	case types.StoredQuery:
+		result := []types.Any{}
+		for _, row := range types.Materialize(ctx, scope, t) {
+			result = append(result, row)
+		}
+		return result
+
+	case string, types.Bytes:
+		return []types.Any{t}
+	}
+
+	a_value := reflect.ValueOf(value)
+	if a_value.Kind() == reflect.Slice || a_value.Kind() == reflect.Array {
+		result := make([]types.Any, 0, a_value.Len())
+		for i := 0; i < a_value.Len(); i++ {
+			result = append(result, a_value.Index(i).Interface())
+		}
+		return result
+	}
+
+	return []types.Any{value}
+}
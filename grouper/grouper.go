@@ -10,6 +10,10 @@ import (
 	"www.velocidex.com/golang/vfilter/types"
 )
 
+// The DefaultGrouper emits groups in the order their first row was
+// seen. Groups are not sorted by the group by key so the ordering of
+// the source (e.g. event time) is preserved. Use ORDER BY to sort the
+// groups.
 type DefaultGrouper struct{}
 
 func (self *DefaultGrouper) Group(
@@ -39,6 +43,7 @@ func (self *DefaultGrouper) Group(
 		// Collect all the rows with the same group_by
 		// member. This is a map between unique group
 		// by values and an aggregate context.
+		// The ordered dict keeps the bins in first seen order.
 		bins := ordereddict.NewDict() //(map[string]*AggregateContext)
 
 		// Append this row to a bin based on a unique
@@ -0,0 +1,155 @@
+package grouper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/aggregators"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A grouper for monitoring queries over endless sources. The
+// DefaultGrouper only emits the groups once all the input is
+// consumed, which never happens for event queries. Instead the
+// StreamingGrouper periodically emits the partial aggregates of the
+// groups which changed since the last emission. A group may
+// therefore be emitted many times as its aggregates are updated.
+//
+// When the input ends, the groups which changed since the last
+// emission are emitted - there is no final pass over all the groups.
+//
+// Install it on the scope with scope.SetGrouper().
+type StreamingGrouper struct {
+	// Emit after this many rows are grouped. Zero means not to
+	// emit based on the number of rows.
+	Rows int
+
+	// Emit at this interval. Zero means not to emit on a timer.
+	Period time.Duration
+}
+
+func NewStreamingGrouper(rows int, period time.Duration) *StreamingGrouper {
+	return &StreamingGrouper{Rows: rows, Period: period}
+}
+
+type streamingBin struct {
+	row     *ordereddict.Dict
+	context types.AggregatorCtx
+	changed bool
+}
+
+func (self *StreamingGrouper) Group(
+	ctx context.Context, scope types.Scope, actor types.GroupbyActor) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	// Protects bins.
+	var mu sync.Mutex
+	bins := ordereddict.NewDict()
+
+	// Serializes emission so rows are not interleaved between the
+	// timer and the row count.
+	var emit_mu sync.Mutex
+
+	// Emit the rows of the bins which changed since the last
+	// emission.
+	emit := func() bool {
+		emit_mu.Lock()
+		defer emit_mu.Unlock()
+
+		rows := []*ordereddict.Dict{}
+		mu.Lock()
+		for _, key := range bins.Keys() {
+			bin_any, _ := bins.Get(key)
+			bin := bin_any.(*streamingBin)
+			if bin.changed {
+				rows = append(rows, bin.row)
+				bin.changed = false
+			}
+		}
+		mu.Unlock()
+
+		for _, row := range rows {
+			select {
+			case <-ctx.Done():
+				return false
+			case output_chan <- row:
+			}
+		}
+		return true
+	}
+
+	done := make(chan bool)
+	var wg sync.WaitGroup
+
+	if self.Period > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(self.Period)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					emit()
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(output_chan)
+		defer wg.Wait()
+		defer close(done)
+
+		new_scope := scope.Copy()
+		defer new_scope.Close()
+
+		count := 0
+		for {
+			row, _, bin_idx, new_scope, err := actor.GetNextRow(ctx, new_scope)
+			if err != nil {
+				break
+			}
+
+			mu.Lock()
+			bin_any, pres := bins.Get(bin_idx)
+			if !pres {
+				bin_any = &streamingBin{
+					context: aggregators.NewAggregatorCtx(),
+				}
+				bins.Set(bin_idx, bin_any)
+			}
+			bin := bin_any.(*streamingBin)
+			mu.Unlock()
+
+			// Each bin has its own aggregate context as in the
+			// DefaultGrouper.
+			new_scope.SetAggregatorCtx(bin.context)
+			new_row := actor.MaterializeRow(ctx, row, new_scope)
+
+			mu.Lock()
+			bin.row = new_row
+			bin.changed = true
+			mu.Unlock()
+
+			count++
+			if self.Rows > 0 && count%self.Rows == 0 {
+				if !emit() {
+					return
+				}
+			}
+		}
+
+		emit()
+	}()
+
+	return output_chan
+}
@@ -0,0 +1,29 @@
+package vfilter
+
+import (
+	"context"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Check the scope's impact policy before calling a plugin or
+// function. The impact is only looked up when there is a policy.
+func allowImpact(ctx context.Context, scope types.Scope,
+	name string, get_impact func() types.Impact) bool {
+	policy, ok := types.GetImpactPolicy(scope)
+	if !ok {
+		return true
+	}
+
+	impact := get_impact()
+	if impact == types.ImpactReadOnly {
+		return true
+	}
+
+	err := policy.Check(ctx, scope, name, impact)
+	if err != nil {
+		scope.Log("ERROR:%v: blocked by policy: %v", name, err)
+		return false
+	}
+	return true
+}
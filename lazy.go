@@ -117,6 +117,59 @@ func MaterializedLazyRow(ctx context.Context, row Row, scope types.Scope) *order
 	}
 }
 
+// MaterializeColumns materializes only the named columns of the row
+// so callers post processing rows do not trigger expensive lazy
+// columns they do not need. Columns are returned in the order they
+// were asked for and columns missing from the row are skipped. The
+// values of a LazyRow are cached so they are not evaluated again if
+// the row is materialized later.
+func MaterializeColumns(ctx context.Context, row Row, scope types.Scope,
+	columns ...string) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+
+	switch t := row.(type) {
+	case *ordereddict.Dict:
+		for _, column := range columns {
+			value, pres := t.Get(column)
+			if pres {
+				result.Set(column, value)
+			}
+		}
+
+	case *LazyRowImpl:
+		for _, column := range columns {
+			value, pres := t.cache.Get(column)
+			if !pres {
+				getter, pres := t.getters[column]
+				if !pres {
+					continue
+				}
+				value = getter(ctx, scope)
+				t.cache.Set(column, value)
+			}
+			result.Set(column, value)
+		}
+
+	case types.LazyRow:
+		for _, column := range columns {
+			if t.Has(column) {
+				value, _ := t.Get(column)
+				result.Set(column, value)
+			}
+		}
+
+	default:
+		for _, column := range columns {
+			value, pres := scope.Associative(row, column)
+			if pres {
+				result.Set(column, value)
+			}
+		}
+	}
+
+	return result
+}
+
 // A LazyExpr may be passed into a plugin arg for later
 // evaluation. The plugin may completely ignore the expression and so
 // will not evaluate it at all. Once evaluated LazyExpr will cache the
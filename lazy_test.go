@@ -8,6 +8,7 @@ import (
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/sebdah/goldie/v2"
+	"github.com/stretchr/testify/assert"
 	"www.velocidex.com/golang/vfilter/arg_parser"
 	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils/dict"
@@ -189,3 +190,39 @@ func logMarkers(format string, args ...interface{}) {
 
 	markers = append(markers, fmt.Sprintf(format, args...))
 }
+
+func TestMaterializeColumns(t *testing.T) {
+	mu.Lock()
+	markers = []string{}
+	mu.Unlock()
+
+	ctx := context.Background()
+	scope := NewScope()
+
+	row := NewLazyRow(ctx, scope).
+		AddColumn("Cheap", func(ctx context.Context, scope types.Scope) Any {
+			logMarkers("Cheap ran")
+			return 1
+		}).
+		AddColumn("Expensive", func(ctx context.Context, scope types.Scope) Any {
+			logMarkers("Expensive ran")
+			return 2
+		})
+
+	// Only the requested columns are evaluated.
+	result := MaterializeColumns(ctx, row, scope, "Cheap", "Missing")
+	assert.Equal(t, ordereddict.NewDict().Set("Cheap", 1), result)
+	assert.Equal(t, []string{"Cheap ran"}, markers)
+
+	// Materialized columns are cached in the row.
+	result = MaterializeColumns(ctx, row, scope, "Expensive", "Cheap")
+	assert.Equal(t, ordereddict.NewDict().
+		Set("Expensive", 2).
+		Set("Cheap", 1), result)
+	assert.Equal(t, []string{"Cheap ran", "Expensive ran"}, markers)
+
+	// Other rows are accessed through the scope.
+	result = MaterializeColumns(ctx, lazyTypeTest{Const: "X"}, scope, "Const")
+	assert.Equal(t, ordereddict.NewDict().Set("Const", "X"), result)
+	assert.Equal(t, []string{"Cheap ran", "Expensive ran"}, markers)
+}
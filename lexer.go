@@ -0,0 +1,179 @@
+package vfilter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// A heredoc starts with <<DELIMITER at the end of a line (optionally
+// prefixed by f to interpolate it) and extends to the next line
+// starting with DELIMITER:
+//
+//	SELECT <<EOF
+//	  Any text - no escaping needed
+//	EOF AS Script FROM scope()
+//
+// Finding the end needs a back reference which the regexp lexer can
+// not do, so the VQL lexer wraps the regexp lexer and handles
+// heredocs itself.
+var heredocStartRegex = regexp.MustCompile(
+	`^f?<<([a-zA-Z_][a-zA-Z0-9_]*)[ \t]*\r?\n`)
+
+const heredocSymbol = "Heredoc"
+
+type vqlLexerDefinition struct {
+	re      *regexp.Regexp
+	symbols map[string]rune
+}
+
+func newVQLLexer(pattern string) *vqlLexerDefinition {
+	re := regexp.MustCompile(pattern)
+	symbols := map[string]rune{
+		"EOF": lexer.EOF,
+	}
+	names := re.SubexpNames()
+	for i, sym := range names[1:] {
+		if sym != "" {
+			symbols[sym] = lexer.EOF - 1 - rune(i)
+		}
+	}
+	symbols[heredocSymbol] = lexer.EOF - rune(len(names))
+
+	return &vqlLexerDefinition{re: re, symbols: symbols}
+}
+
+func (self *vqlLexerDefinition) Lex(r io.Reader) (lexer.Lexer, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &vqlLexerImpl{
+		pos: lexer.Position{
+			Filename: lexer.NameOfReader(r),
+			Line:     1,
+			Column:   1,
+		},
+		b:       b,
+		re:      self.re,
+		names:   self.re.SubexpNames(),
+		heredoc: self.symbols[heredocSymbol],
+	}, nil
+}
+
+func (self *vqlLexerDefinition) Symbols() map[string]rune {
+	return self.symbols
+}
+
+type vqlLexerImpl struct {
+	pos     lexer.Position
+	b       []byte
+	re      *regexp.Regexp
+	names   []string
+	heredoc rune
+}
+
+// Consume the first length bytes of the input and return them as a
+// token.
+func (self *vqlLexerImpl) consume(length int) lexer.Token {
+	match := self.b[:length]
+	token := lexer.Token{
+		Pos:   self.pos,
+		Value: string(match),
+	}
+
+	self.pos.Offset += length
+	lines := bytes.Count(match, []byte("\n"))
+	self.pos.Line += lines
+	if lines == 0 {
+		self.pos.Column += utf8.RuneCount(match)
+	} else {
+		self.pos.Column = utf8.RuneCount(
+			match[bytes.LastIndex(match, []byte("\n")):])
+	}
+	self.b = self.b[length:]
+
+	return token
+}
+
+// Returns the length of the heredoc at the start of the input or 0
+// if there is none.
+func (self *vqlLexerImpl) heredocLength() int {
+	if len(self.b) < 3 || (self.b[0] != '<' && self.b[0] != 'f') {
+		return 0
+	}
+
+	start := heredocStartRegex.FindSubmatchIndex(self.b)
+	if start == nil {
+		return 0
+	}
+	delimiter := self.b[start[2]:start[3]]
+
+	// Find a line starting with the delimiter which is not followed
+	// by more identifier characters.
+	offset := start[1]
+	for offset < len(self.b) {
+		line_end := bytes.IndexByte(self.b[offset:], '\n')
+		line := self.b[offset:]
+		if line_end >= 0 {
+			line = line[:line_end]
+		}
+
+		trimmed := bytes.TrimLeft(line, " \t")
+		if bytes.HasPrefix(trimmed, delimiter) {
+			end := offset + len(line) - len(trimmed) + len(delimiter)
+			if end == len(self.b) || !isIdentChar(self.b[end]) {
+				return end
+			}
+		}
+
+		if line_end < 0 {
+			break
+		}
+		offset += line_end + 1
+	}
+	return 0
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (self *vqlLexerImpl) Next() (lexer.Token, error) {
+nextToken:
+	for len(self.b) != 0 {
+		length := self.heredocLength()
+		if length > 0 {
+			token := self.consume(length)
+			token.Type = self.heredoc
+			return token, nil
+		}
+
+		matches := self.re.FindSubmatchIndex(self.b)
+		if matches == nil || matches[0] != 0 {
+			rn, _ := utf8.DecodeRune(self.b)
+			return lexer.Token{}, lexer.Errorf(self.pos, "invalid token %q", rn)
+		}
+		token := self.consume(matches[1])
+
+		// If it is not a named group, skip to the next token.
+		for i := 2; i < len(matches); i += 2 {
+			if matches[i] != -1 {
+				if self.names[i/2] == "" {
+					continue nextToken
+				}
+				token.Type = lexer.EOF - rune(i/2)
+				break
+			}
+		}
+
+		return token, nil
+	}
+
+	return lexer.EOFToken(self.pos), nil
+}
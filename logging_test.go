@@ -2,13 +2,16 @@ package vfilter
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"log"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/Velocidex/ordereddict"
 	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils"
 )
 
@@ -59,3 +62,262 @@ func TestLogging(t *testing.T) {
 	logger.NotContains(t, "Symbol X not found")
 	logger.NotContains(t, "While resolving X.Foo Symbol X not found")
 }
+
+func TestStrictScoping(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+	types.SetOption(scope, types.StrictScopingOption, true)
+
+	vqls, err := MultiParse(`
+LET X = 1
+LET X = 2
+LET len = 3
+LET test = SELECT * FROM scope()
+UNLET X
+LET X = 4
+SELECT X FROM scope()
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			value, _ := scope.Associative(row, "X")
+			output = append(output, value)
+		}
+	}
+
+	logger.Contains(t, "LET X is already defined")
+	logger.Contains(t, "LET len would mask a built in function")
+	logger.Contains(t, "LET test would mask a built in plugin")
+	assert.Equal(t, []Row{int64(4)}, output)
+}
+
+func TestConstants(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+	scope.DefineConstants(ordereddict.NewDict().Set("Hostname", "server1"))
+
+	vqls, err := MultiParse(`
+LET Hostname = "attacker"
+LET Hostname <= SELECT * FROM scope()
+UNLET Hostname
+LET F(Hostname) = Hostname
+SELECT Hostname, { SELECT Hostname FROM scope() } AS Nested FROM scope()
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			output = append(output, RowToDict(ctx, scope, row))
+		}
+	}
+
+	logger.Contains(t, "LET Hostname: can not redefine a constant")
+	logger.Contains(t, "UNLET Hostname: can not remove a constant")
+	logger.Contains(t, "LET F: parameter Hostname would mask a constant")
+
+	serialized, err := json.Marshal(output)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Hostname":"server1","Nested":"server1"}]`,
+		string(serialized))
+
+	// Columns of the plugin's rows are not constants.
+	scope.DefineConstants(ordereddict.NewDict().Set("Hostname", "configured"))
+	vql, err := Parse(`SELECT Hostname, * FROM foreach(row=[dict(Hostname='from_row')])`)
+	assert.NoError(t, err)
+
+	output = nil
+	for row := range vql.Eval(ctx, scope) {
+		output = append(output, RowToDict(ctx, scope, row))
+	}
+
+	serialized, err = json.Marshal(output)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Hostname":"from_row"}]`, string(serialized))
+
+	// Constants are found in scopes copied before they are defined.
+	subscope := scope.Copy()
+	scope.DefineConstants(ordereddict.NewDict().Set("Domain", "example.com"))
+	value, pres := subscope.Resolve("Domain")
+	assert.True(t, pres)
+	assert.Equal(t, "example.com", value)
+}
+
+func TestStrictBool(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	count := func(query string) int {
+		vql, err := Parse(query)
+		assert.NoError(t, err)
+
+		result := 0
+		for range vql.Eval(context.Background(), scope) {
+			result++
+		}
+		return result
+	}
+
+	// By default values are coerced to bool.
+	assert.Equal(t, 2, count("SELECT * FROM test() WHERE foo"))
+	logger.NotContains(t, "must be a boolean")
+
+	types.SetOption(scope, types.StrictBoolOption, true)
+	assert.Equal(t, 0, count("SELECT * FROM test() WHERE foo"))
+	logger.Contains(t, "WHERE clause foo evaluated to int but must be a boolean")
+
+	assert.Equal(t, 2, count("SELECT * FROM test() WHERE foo > 0"))
+	assert.Equal(t, 0, count("SELECT foo FROM test() WHERE bar GROUP BY foo"))
+}
+
+func TestStrictArithmetic(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	var errors []string
+	ctx := types.WithQueryErrorHandler(context.Background(),
+		func(err error) {
+			errors = append(errors, err.Error())
+		})
+
+	eval := func(query string) Any {
+		vql, err := Parse(query)
+		assert.NoError(t, err)
+
+		var result Any
+		for row := range vql.Eval(ctx, scope) {
+			result, _ = scope.Associative(row, "X")
+		}
+		return result
+	}
+
+	// By default mismatched types silently give NULL.
+	assert.True(t, types.IsNil(eval("SELECT 1 + 'foo' AS X FROM scope()")))
+	assert.Equal(t, 0, len(errors))
+
+	types.SetOption(scope, types.StrictArithmeticOption, true)
+	assert.True(t, types.IsNil(eval("SELECT 1 + 'foo' AS X FROM scope()")))
+	assert.True(t, types.IsNil(eval("SELECT 2 * 3 / 0 AS X FROM scope()")))
+
+	// NULL operands are not an error.
+	assert.True(t, types.IsNil(eval("SELECT Missing + 1 AS X FROM scope()")))
+	assert.Equal(t, int64(3), eval("SELECT 1 + 2 AS X FROM scope()"))
+
+	assert.Equal(t, []string{
+		"Strict arithmetic: cannot evaluate 1 + 'foo' (int64 + string)",
+		"Strict arithmetic: cannot evaluate 2 * 3 / 0 (int64 / int64)",
+	}, errors)
+	logger.Contains(t, "ERROR:Strict arithmetic: cannot evaluate 1 + 'foo'")
+}
+
+func TestSafeNavigation(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	vql, err := Parse("SELECT X?.Foo, Y?.Foo, Y?.Foo.Bar, Z?.Foo?.Bar, dict(A=1)?.B FROM foreach(row=[dict(X=dict(Foo=1)),])")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for row := range vql.Eval(ctx, scope) {
+		output = append(output, row)
+	}
+
+	assert.Equal(t, 1, len(output))
+	value, _ := scope.Associative(output[0], "X?.Foo")
+	assert.Equal(t, int64(1), value)
+
+	value, _ = scope.Associative(output[0], "Y?.Foo")
+	assert.Equal(t, types.Null{}, value)
+
+	logger.NotContains(t, "not found")
+}
+
+func TestMissingSymbolLogDedup(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	run := func() {
+		vql, err := Parse("SELECT value, Y FROM range(start=1, end=5)")
+		assert.NoError(t, err)
+
+		for range vql.Eval(context.Background(), scope) {
+		}
+	}
+
+	// The error is logged once with a summary of the repeats.
+	run()
+	assert.Equal(t, 2, len(logger.logs))
+	logger.Contains(t, "ERROR:Symbol Y not found. Current Scope is")
+	logger.Contains(t, "ERROR:Symbol Y not found ... repeated 4 times")
+
+	// Each query logs its own messages.
+	logger.logs = nil
+	types.SetOption(scope, types.WarnOnMissingSymbolsOption, true)
+	run()
+	assert.Equal(t, 2, len(logger.logs))
+	logger.Contains(t, "WARN:Symbol Y not found. Current Scope is")
+	logger.Contains(t, "WARN:Symbol Y not found ... repeated 4 times")
+	logger.NotContains(t, "ERROR:")
+}
+
+func TestStackOverflowLog(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	vql, err := MultiParse(`
+LET X = 1 + Y
+LET Y = X * 2
+SELECT value, X FROM range(start=1, end=5)
+`)
+	assert.NoError(t, err)
+
+	rows := 0
+	for _, query := range vql {
+		for range query.Eval(context.Background(), scope) {
+			rows++
+		}
+	}
+
+	// Only the recursive branch is stopped and the cycle is
+	// logged once.
+	assert.Equal(t, 5, rows)
+	assert.Equal(t, 1, len(logger.logs))
+	logger.Contains(t, "ERROR:Stack Overflow: Recursive symbol X -> Y -> X")
+}
+
+func TestPositionalArgErrors(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	vqls, err := MultiParse(`
+LET F(X) = X
+SELECT dict(1), len(1, 2), F(1, 2) FROM scope()
+SELECT * FROM chain({ SELECT * FROM scope() })
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			utils.Debug(row)
+		}
+	}
+
+	logger.Contains(t, "dict does not accept positional args")
+	logger.Contains(t, "chain does not accept positional args")
+	logger.Contains(t, "len: Too many positional args")
+	logger.Contains(t, "Extra unrecognized arg $1 when calling F")
+}
@@ -0,0 +1,188 @@
+package materializer
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type expiringRow struct {
+	row      types.Row
+	received time.Time
+}
+
+// Holds a bounded window of the most recent rows of a query. Rows
+// are dropped when there are more than max_rows or when they are
+// older than ttl.
+type ExpiringRows struct {
+	mu   sync.Mutex
+	rows []expiringRow
+
+	max_rows int
+	ttl      time.Duration
+
+	// The scope's entropy source tells the time.
+	clock types.EntropySource
+
+	// Closed when the query feeding us is done.
+	done chan bool
+}
+
+func (self *ExpiringRows) add(row types.Row) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.rows = append(self.rows, expiringRow{row: row, received: self.clock.Now()})
+	self.expire()
+}
+
+// Must be called with the lock held.
+func (self *ExpiringRows) expire() {
+	start := 0
+	if self.max_rows > 0 && len(self.rows) > self.max_rows {
+		start = len(self.rows) - self.max_rows
+	}
+
+	if self.ttl > 0 {
+		cutoff := self.clock.Now().Add(-self.ttl)
+		for start < len(self.rows) && self.rows[start].received.Before(cutoff) {
+			start++
+		}
+	}
+
+	if start > 0 {
+		self.rows = append(self.rows[:0:0], self.rows[start:]...)
+	}
+}
+
+// Rows returns a snapshot of the rows which have not expired yet.
+func (self *ExpiringRows) Rows() []types.Row {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.expire()
+
+	result := make([]types.Row, 0, len(self.rows))
+	for _, item := range self.rows {
+		result = append(result, item.row)
+	}
+	return result
+}
+
+// Done is closed when the query stops producing rows.
+func (self *ExpiringRows) Done() <-chan bool {
+	return self.done
+}
+
+// Support StoredQuery protocol.
+func (self *ExpiringRows) Eval(
+	ctx context.Context, scope types.Scope) <-chan types.Row {
+
+	output_chan := make(chan types.Row)
+	go func() {
+		defer close(output_chan)
+
+		for _, row := range self.Rows() {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Support indexing (Associative protocol) on ExpiringRows. This needs
+// to be registered on the scope with AddProtocolImpl().
+type ExpiringRowsProtocol struct{}
+
+func (self ExpiringRowsProtocol) Applicable(a types.Any, b types.Any) bool {
+	_, ok := a.(*ExpiringRows)
+	return ok
+}
+
+func (self ExpiringRowsProtocol) GetMembers(scope types.Scope, a types.Any) []string {
+	a_rows, ok := a.(*ExpiringRows)
+	if !ok {
+		return nil
+	}
+
+	return scope.GetMembers(a_rows.Rows())
+}
+
+func (self ExpiringRowsProtocol) Associative(scope types.Scope, a types.Any, b types.Any) (res types.Any, pres bool) {
+	a_rows, ok := a.(*ExpiringRows)
+	if !ok {
+		return nil, false
+	}
+
+	return scope.Associative(a_rows.Rows(), b)
+}
+
+func (self *ExpiringRows) Materialize(
+	ctx context.Context, scope types.Scope) types.Any {
+	return self.Rows()
+}
+
+// Support JSON Marshal protocol
+func (self *ExpiringRows) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.Rows())
+}
+
+// A materializer for long running monitoring queries. Rather than
+// waiting for the query to finish (event queries never do), the query
+// is read in the background and the LET variable holds only the last
+// MaxRows rows and/or the rows received within TTL. Each reference to
+// the variable sees the rows held at that time. The age of rows is
+// measured with the scope's types.EntropySource.
+//
+// Install it on the scope with scope.SetMaterializer().
+type ExpiringMaterializer struct {
+	// Zero means no limit.
+	MaxRows int
+	TTL     time.Duration
+}
+
+func NewExpiringMaterializer(
+	max_rows int, ttl time.Duration) *ExpiringMaterializer {
+	return &ExpiringMaterializer{MaxRows: max_rows, TTL: ttl}
+}
+
+func (self *ExpiringMaterializer) Materialize(
+	ctx context.Context, scope types.Scope,
+	name string, query types.StoredQuery) types.StoredQuery {
+	result := &ExpiringRows{
+		max_rows: self.MaxRows,
+		ttl:      self.TTL,
+		clock:    types.GetEntropySource(scope),
+		done:     make(chan bool),
+	}
+
+	// Stop reading the query when the scope is destroyed.
+	sub_ctx, cancel := context.WithCancel(ctx)
+	err := scope.AddDestructor(cancel)
+	if err != nil {
+		cancel()
+		close(result.done)
+		return result
+	}
+
+	sub_scope := scope.Copy()
+
+	go func() {
+		defer close(result.done)
+		defer sub_scope.Close()
+		defer cancel()
+
+		for row := range query.Eval(sub_ctx, sub_scope) {
+			result.add(row)
+		}
+	}()
+
+	return result
+}
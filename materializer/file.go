@@ -0,0 +1,259 @@
+package materializer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+// A Compressor compresses the rows the FileMaterializer writes to
+// disk. The host supplies the implementation (e.g. snappy or zstd)
+// so this library does not need to depend on them.
+type Compressor interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// A Compressor using gzip from the standard library.
+type GzipCompressor struct {
+	// Zero uses the default compression level.
+	Level int
+}
+
+func (self GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if self.Level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, self.Level)
+}
+
+func (self GzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// The rows of a materialized query stored in a temp file as JSON
+// lines. The file is removed when the scope is destroyed.
+type FileRows struct {
+	path       string
+	compressor Compressor
+	count      int
+}
+
+// Len returns the number of rows in the file.
+func (self *FileRows) Len() int {
+	return self.count
+}
+
+// Read the rows from the file, calling cb for each row until it
+// returns false.
+func (self *FileRows) readRows(cb func(row *ordereddict.Dict) bool) error {
+	fd, err := os.Open(self.path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	var reader io.Reader = fd
+	if self.compressor != nil {
+		decompressor, err := self.compressor.NewReader(fd)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+
+	for i := 0; i < self.count; i++ {
+		row := ordereddict.NewDict()
+		err := decoder.Decode(row)
+		if err != nil {
+			return err
+		}
+
+		if !cb(row) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (self *FileRows) Rows() ([]types.Row, error) {
+	result := make([]types.Row, 0, self.count)
+	err := self.readRows(func(row *ordereddict.Dict) bool {
+		result = append(result, row)
+		return true
+	})
+	return result, err
+}
+
+// Support StoredQuery protocol.
+func (self *FileRows) Eval(
+	ctx context.Context, scope types.Scope) <-chan types.Row {
+
+	output_chan := make(chan types.Row)
+	go func() {
+		defer close(output_chan)
+
+		err := self.readRows(func(row *ordereddict.Dict) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case output_chan <- row:
+				return true
+			}
+		})
+		if err != nil {
+			scope.Log("ERROR:FileMaterializer: %v", err)
+		}
+	}()
+
+	return output_chan
+}
+
+func (self *FileRows) Materialize(
+	ctx context.Context, scope types.Scope) types.Any {
+	rows, err := self.Rows()
+	if err != nil {
+		scope.Log("ERROR:FileMaterializer: %v", err)
+	}
+	return rows
+}
+
+// Support JSON Marshal protocol
+func (self *FileRows) MarshalJSON() ([]byte, error) {
+	rows, err := self.Rows()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rows)
+}
+
+// Support indexing (Associative protocol) on FileRows. This needs to
+// be registered on the scope with AddProtocolImpl().
+type FileRowsProtocol struct{}
+
+func (self FileRowsProtocol) Applicable(a types.Any, b types.Any) bool {
+	_, ok := a.(*FileRows)
+	return ok
+}
+
+func (self FileRowsProtocol) GetMembers(scope types.Scope, a types.Any) []string {
+	a_rows, ok := a.(*FileRows)
+	if !ok {
+		return nil
+	}
+
+	return scope.GetMembers(a_rows.Materialize(context.Background(), scope))
+}
+
+func (self FileRowsProtocol) Associative(scope types.Scope, a types.Any, b types.Any) (res types.Any, pres bool) {
+	a_rows, ok := a.(*FileRows)
+	if !ok {
+		return nil, false
+	}
+
+	return scope.Associative(a_rows.Materialize(context.Background(), scope), b)
+}
+
+// A materializer for large intermediate results. Rather than holding
+// the rows in memory, they are written to a temp file which is read
+// back each time the LET variable is used. The rows are stored as
+// JSON so values which can not be represented in JSON lose their
+// original types.
+//
+// The host may supply a Compressor to reduce the size of the temp
+// files.
+//
+// Install it on the scope with scope.SetMaterializer().
+type FileMaterializer struct {
+	// The directory to create temp files in. Empty means the
+	// system temp directory.
+	TempDir string
+
+	// Nil means the rows are not compressed.
+	Compressor Compressor
+}
+
+func NewFileMaterializer(
+	temp_dir string, compressor Compressor) *FileMaterializer {
+	return &FileMaterializer{TempDir: temp_dir, Compressor: compressor}
+}
+
+func (self *FileMaterializer) Materialize(
+	ctx context.Context, scope types.Scope,
+	name string, query types.StoredQuery) types.StoredQuery {
+
+	fd, err := ioutil.TempFile(self.TempDir, "vql_materialize_")
+	if err != nil {
+		// Fall back to holding the rows in memory.
+		scope.Log("ERROR:FileMaterializer: %v", err)
+		return DefaultMaterializer{}.Materialize(ctx, scope, name, query)
+	}
+
+	result := &FileRows{
+		path:       fd.Name(),
+		compressor: self.Compressor,
+	}
+
+	err = self.writeRows(ctx, scope, fd, result, query)
+	if err == nil {
+		err = scope.AddDestructor(func() {
+			os.Remove(result.path)
+		})
+	}
+
+	if err != nil {
+		os.Remove(result.path)
+		scope.Log("ERROR:FileMaterializer: %v", err)
+		return NewInMemoryMatrializer(nil)
+	}
+
+	return result
+}
+
+func (self *FileMaterializer) writeRows(
+	ctx context.Context, scope types.Scope, fd *os.File,
+	result *FileRows, query types.StoredQuery) error {
+	defer fd.Close()
+
+	buffered := bufio.NewWriter(fd)
+	var writer io.Writer = buffered
+
+	var compressor io.WriteCloser
+	if self.Compressor != nil {
+		var err error
+		compressor, err = self.Compressor.NewWriter(buffered)
+		if err != nil {
+			return err
+		}
+		writer = compressor
+	}
+
+	encoder := json.NewEncoder(writer)
+	for row := range query.Eval(ctx, scope) {
+		err := encoder.Encode(dict.RowToDict(ctx, scope, row))
+		if err != nil {
+			return err
+		}
+		result.count++
+	}
+
+	if compressor != nil {
+		err := compressor.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
@@ -0,0 +1,78 @@
+package vfilter
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Minify formats the node (usually a *VQL or []*VQL) into the
+// shortest equivalent text: Comments are removed and tokens are only
+// separated by a space where they would otherwise merge.
+func Minify(scope types.Scope, node interface{}) string {
+	options := ToStringOptions
+	options.OmitComments = true
+
+	visitor := NewVisitor(scope, options)
+	visitor.Visit(node)
+	formatted := visitor.ToString()
+
+	tokens, err := lexTokens(formatted)
+	if err != nil {
+		return formatted
+	}
+
+	result := strings.Builder{}
+	for idx, token := range tokens {
+		if idx > 0 && !sameTokens(tokens[idx-1].Value+token.Value,
+			tokens[idx-1:idx+1]) {
+			result.WriteString(" ")
+		}
+		result.WriteString(token.Value)
+	}
+
+	// Make sure the tokens did not merge in a way the pairwise
+	// check could not detect.
+	minified := result.String()
+	if !sameTokens(minified, tokens) {
+		return formatted
+	}
+
+	return minified
+}
+
+func lexTokens(text string) ([]lexer.Token, error) {
+	lex, err := vqlLexer.Lex(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []lexer.Token{}
+	for {
+		token, err := lex.Next()
+		if err != nil {
+			return nil, err
+		}
+		if token.EOF() {
+			return result, nil
+		}
+		result = append(result, token)
+	}
+}
+
+// Checks if the text lexes into the same tokens.
+func sameTokens(text string, expected []lexer.Token) bool {
+	tokens, err := lexTokens(text)
+	if err != nil || len(tokens) != len(expected) {
+		return false
+	}
+
+	for idx, token := range tokens {
+		if token.Type != expected[idx].Type ||
+			token.Value != expected[idx].Value {
+			return false
+		}
+	}
+	return true
+}
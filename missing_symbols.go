@@ -0,0 +1,88 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Resolving a missing symbol happens for every row so logging each
+// time floods the log with the same message. Instead each query
+// tracks the messages it logged through the context: only the first
+// occurrence is logged and the number of repeats is reported when the
+// query ends.
+type missingSymbolsKey int
+
+const missingSymbolsKeyValue missingSymbolsKey = 0
+
+type missingSymbols struct {
+	mu sync.Mutex
+
+	// Messages in the order they were first logged.
+	messages []string
+	counts   map[string]int
+}
+
+func newMissingSymbols() *missingSymbols {
+	return &missingSymbols{
+		counts: make(map[string]int),
+	}
+}
+
+// Count the message and return true if this is the first time it
+// was seen.
+func (self *missingSymbols) add(message string) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	count := self.counts[message]
+	if count == 0 {
+		self.messages = append(self.messages, message)
+	}
+	self.counts[message] = count + 1
+	return count == 0
+}
+
+// Log a summary of the messages which were suppressed.
+func (self *missingSymbols) report(scope types.Scope) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, message := range self.messages {
+		count := self.counts[message]
+		if count > 1 {
+			scope.Log("%v%v ... repeated %v times",
+				missingSymbolLevel(scope), message, count-1)
+		}
+	}
+}
+
+func withMissingSymbols(ctx context.Context,
+	tracker *missingSymbols) context.Context {
+	return context.WithValue(ctx, missingSymbolsKeyValue, tracker)
+}
+
+func getMissingSymbols(ctx context.Context) *missingSymbols {
+	tracker, _ := ctx.Value(missingSymbolsKeyValue).(*missingSymbols)
+	return tracker
+}
+
+func missingSymbolLevel(scope types.Scope) string {
+	if types.IsOptionEnabled(scope, types.WarnOnMissingSymbolsOption) {
+		return "WARN:"
+	}
+	return "ERROR:"
+}
+
+// Log that a symbol was not found. Within a query each message is
+// only logged once.
+func logMissingSymbol(ctx context.Context, scope types.Scope, message string) {
+	tracker := getMissingSymbols(ctx)
+	if tracker != nil && !tracker.add(message) {
+		return
+	}
+
+	scope.Log("%v%v. Current Scope is %s",
+		missingSymbolLevel(scope), message, scope.PrintVars())
+}
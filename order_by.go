@@ -0,0 +1,251 @@
+package vfilter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	scope_module "www.velocidex.com/golang/vfilter/scope"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// Comparing values of different types depends on the protocols
+// installed in the scope, so a column mixing ints and strings does
+// not sort or group predictably. A cast converts the key to a single
+// type first:
+//
+//	SELECT * FROM info() ORDER BY Size::int
+//	SELECT count() FROM info() GROUP BY Size::int
+//
+// When sorting, values which can not be converted (including NULL)
+// sort before all others. When grouping they are all in the NULL
+// group. The cast only applies to the key - the rows are emitted
+// unchanged.
+type keyCast struct {
+	cast func(ctx context.Context, scope types.Scope,
+		value types.Any) (types.Any, bool)
+
+	// Sorts before all converted values.
+	invalid types.Any
+}
+
+var keyCasts = map[string]keyCast{
+	"int":    {cast: castKeyToInt, invalid: int64(math.MinInt64)},
+	"float":  {cast: castKeyToFloat, invalid: math.Inf(-1)},
+	"string": {cast: castKeyToString, invalid: ""},
+}
+
+// The type named in a cast (e.g. ::int). Unknown types are
+// rejected when the query is parsed.
+type _CastType string
+
+func (self *_CastType) Parse(lex *lexer.PeekingLexer) error {
+	// "::" is lexed as two ":" operators.
+	for i := 0; i < 2; i++ {
+		token, err := lex.Peek(i)
+		if err != nil {
+			return err
+		}
+		if token.Value != ":" {
+			return participle.NextMatch
+		}
+	}
+
+	// Consume the "::" so errors below are reported rather than
+	// treated as the cast being absent.
+	for i := 0; i < 2; i++ {
+		_, err := lex.Next()
+		if err != nil {
+			return err
+		}
+	}
+
+	token, err := lex.Next()
+	if err != nil {
+		return err
+	}
+
+	if token.Type != vqlLexer.Symbols()["Ident"] {
+		return participle.ErrorWithTokenf(token,
+			"unexpected token %q (expected a cast type)", token.Value)
+	}
+
+	_, pres := keyCasts[strings.ToLower(token.Value)]
+	if !pres {
+		return participle.ErrorWithTokenf(token,
+			"unknown cast type %v", token.Value)
+	}
+
+	*self = _CastType(token.Value)
+	return nil
+}
+
+func (self _CastType) keyCast() keyCast {
+	return keyCasts[strings.ToLower(string(self))]
+}
+
+// The sort key and the original row are carried in a dict under
+// column names which can not clash with a real column.
+const (
+	sortKeyColumn = "$SortKey"
+	sortRowColumn = "$Row"
+)
+
+func (self *_Select) sortRows(ctx context.Context, scope types.Scope,
+	input <-chan Row, limit int) <-chan Row {
+	desc := false
+	if self.OrderByDesc != nil {
+		desc = *self.OrderByDesc
+	}
+
+	key := utils.Unquote_ident(*self.OrderBy)
+
+	if self.OrderByCast != nil {
+		return removeSortKey(ctx, sortWithLimit(ctx, scope,
+			addSortKey(ctx, scope, input, key, self.OrderByCast.keyCast()),
+			sortKeyColumn, desc, limit))
+	}
+
+	return sortWithLimit(ctx, scope, input, key, desc, limit)
+}
+
+// Calculates the group a row belongs to.
+func (self *_Select) groupByKey(ctx context.Context, scope types.Scope) string {
+	value := self.GroupBy.Reduce(ctx, scope)
+	if self.GroupByCast != nil {
+		cast_value, ok := self.GroupByCast.keyCast().cast(ctx, scope, value)
+		if !ok {
+			cast_value = types.Null{}
+		}
+		value = cast_value
+	}
+
+	// Materialize the group by value as much as possible - we
+	// dont want a lazy item here.
+	return types.ToString(ctx, scope, value)
+}
+
+func sortWithLimit(ctx context.Context, scope types.Scope,
+	input <-chan Row, key string, desc bool, limit int) <-chan Row {
+	if limit > 0 {
+		return scope.(*scope_module.Scope).SortTopN(
+			ctx, scope, input, key, desc, limit)
+	}
+	return scope.(*scope_module.Scope).Sort(ctx, scope, input, key, desc)
+}
+
+// Wraps each row with its sort key.
+func addSortKey(ctx context.Context, scope types.Scope, input <-chan Row,
+	key string, cast keyCast) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		for row := range input {
+			value, _ := scope.Associative(row, key)
+			sort_key, ok := cast.cast(ctx, scope, value)
+			if !ok {
+				sort_key = cast.invalid
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- ordereddict.NewDict().
+				Set(sortKeyColumn, sort_key).
+				Set(sortRowColumn, row):
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Unwraps the original rows.
+func removeSortKey(ctx context.Context, input <-chan Row) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		for row := range input {
+			row_dict, ok := row.(*ordereddict.Dict)
+			if ok {
+				row, _ = row_dict.Get(sortRowColumn)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func reduceSortKey(ctx context.Context, value types.Any) types.Any {
+	lazy_expr, ok := value.(types.LazyExpr)
+	if ok {
+		return lazy_expr.Reduce(ctx)
+	}
+	return value
+}
+
+func castKeyToInt(ctx context.Context,
+	scope types.Scope, value types.Any) (types.Any, bool) {
+	value = reduceSortKey(ctx, value)
+
+	str, ok := value.(string)
+	if ok {
+		str = strings.TrimSpace(str)
+		result, err := strconv.ParseInt(str, 0, 64)
+		if err == nil {
+			return result, true
+		}
+
+		float_result, err := strconv.ParseFloat(str, 64)
+		if err == nil && !math.IsNaN(float_result) {
+			return int64(float_result), true
+		}
+		return nil, false
+	}
+
+	return utils.ToInt64(value)
+}
+
+func castKeyToFloat(ctx context.Context,
+	scope types.Scope, value types.Any) (types.Any, bool) {
+	value = reduceSortKey(ctx, value)
+
+	str, ok := value.(string)
+	if ok {
+		result, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err == nil && !math.IsNaN(result) {
+			return result, true
+		}
+		return nil, false
+	}
+
+	result, ok := utils.ToFloat(value)
+	if !ok || math.IsNaN(result) {
+		return nil, false
+	}
+	return result, true
+}
+
+func castKeyToString(ctx context.Context,
+	scope types.Scope, value types.Any) (types.Any, bool) {
+	value = reduceSortKey(ctx, value)
+	if types.IsNil(value) {
+		return nil, false
+	}
+	return types.ToString(ctx, scope, value), true
+}
@@ -0,0 +1,134 @@
+package vfilter
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A LET symbol which refers to itself (directly or through other
+// symbols) recurses until the scope's stack depth is exceeded. Each
+// branch of the evaluation then overflows separately so reporting
+// every overflow floods the log.
+//
+// Instead the stored symbols being evaluated are tracked through the
+// context. When the stack overflows the recursive chain of symbols
+// (e.g. X -> Y -> X) is logged once per query and only the branch
+// which overflowed is stopped.
+type symbolChainKey int
+
+const symbolChainKeyValue symbolChainKey = 0
+
+// The chain is a linked list from the most recent symbol so pushing a
+// symbol does not copy the chain.
+type symbolChain struct {
+	name   string
+	parent *symbolChain
+}
+
+// Record that the stored symbol is being evaluated.
+func withSymbol(ctx context.Context, name string) context.Context {
+	parent, _ := ctx.Value(symbolChainKeyValue).(*symbolChain)
+	return context.WithValue(ctx, symbolChainKeyValue, &symbolChain{
+		name:   name,
+		parent: parent,
+	})
+}
+
+// Returns the first cycle in the chain of symbols being evaluated
+// e.g. [X Y X], or nil if there is none.
+func getSymbolCycle(ctx context.Context) []string {
+	var chain []string
+	for item, _ := ctx.Value(symbolChainKeyValue).(*symbolChain); item != nil; item = item.parent {
+		chain = append(chain, item.name)
+	}
+
+	// Walk from the outermost symbol.
+	first_seen := make(map[string]int)
+	for i := len(chain) - 1; i >= 0; i-- {
+		name := chain[i]
+		start, pres := first_seen[name]
+		if !pres {
+			first_seen[name] = i
+			continue
+		}
+
+		var cycle []string
+		for j := start; j >= i; j-- {
+			cycle = append(cycle, chain[j])
+		}
+		return cycle
+	}
+
+	return nil
+}
+
+type overflowReportsKey int
+
+const overflowReportsKeyValue overflowReportsKey = 0
+
+// The overflow messages a query already logged.
+type overflowReports struct {
+	mu   sync.Mutex
+	seen map[string]bool
+
+	// The query is reported when the recursion does not go
+	// through stored symbols.
+	query string
+}
+
+func newOverflowReports(query string) *overflowReports {
+	return &overflowReports{
+		seen:  make(map[string]bool),
+		query: query,
+	}
+}
+
+// Returns true if this is the first time the message was seen.
+func (self *overflowReports) add(message string) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.seen[message] {
+		return false
+	}
+	self.seen[message] = true
+	return true
+}
+
+func withOverflowReports(ctx context.Context,
+	reports *overflowReports) context.Context {
+	return context.WithValue(ctx, overflowReportsKeyValue, reports)
+}
+
+func getOverflowReports(ctx context.Context) *overflowReports {
+	reports, _ := ctx.Value(overflowReportsKeyValue).(*overflowReports)
+	return reports
+}
+
+// Returns true if the scope's stack overflowed. The caller should
+// stop evaluating the current branch.
+func checkForOverflow(ctx context.Context, scope types.Scope) bool {
+	if !scope.CheckForOverflow() {
+		return false
+	}
+
+	reports := getOverflowReports(ctx)
+
+	message := "Maximum stack depth exceeded"
+	cycle := getSymbolCycle(ctx)
+	if cycle != nil {
+		message = "Recursive symbol " + strings.Join(cycle, " -> ")
+	} else if reports != nil {
+		message += " in " + reports.query
+	}
+
+	if reports != nil && !reports.add(message) {
+		return true
+	}
+
+	scope.Log("ERROR:Stack Overflow: %v", message)
+	return true
+}
@@ -0,0 +1,136 @@
+package vfilter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+var invalidCursorError = errors.New("Invalid paging cursor")
+
+// A page of results from EvalPage.
+type Page struct {
+	Rows []*ordereddict.Dict
+
+	// An opaque cursor which fetches the next page or an empty
+	// string when there are no more rows.
+	Cursor string
+}
+
+// The state encoded in the cursor.
+type pageCursor struct {
+	// A hash of the query so a cursor can not be used with a
+	// different query.
+	Query string `json:"query"`
+
+	// The number of rows already returned.
+	Offset int64 `json:"offset"`
+}
+
+func hashQuery(scope types.Scope, vql *VQL) string {
+	hash := sha256.Sum256([]byte(FormatToString(scope, vql)))
+	return hex.EncodeToString(hash[:])
+}
+
+func (self *pageCursor) String() string {
+	serialized, _ := json.Marshal(self)
+	return base64.RawURLEncoding.EncodeToString(serialized)
+}
+
+func parsePageCursor(scope types.Scope, vql *VQL, cursor string) (*pageCursor, error) {
+	result := &pageCursor{Query: hashQuery(scope, vql)}
+	if cursor == "" {
+		return result, nil
+	}
+
+	serialized, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidCursorError
+	}
+
+	parsed := &pageCursor{}
+	err = json.Unmarshal(serialized, parsed)
+	if err != nil || parsed.Query != result.Query || parsed.Offset < 0 {
+		return nil, invalidCursorError
+	}
+
+	return parsed, nil
+}
+
+// EvalPage evaluates the query and returns up to page_size rows
+// following the rows already returned for the cursor. Pass an empty
+// cursor to get the first page.
+//
+// Each page runs the query again in a subscope of the scope. The
+// number of rows needed is pushed down to the query (as for LIMIT) so
+// sources which support it only produce the rows up to the end of the
+// page. The rows of the earlier pages are pushed down too, so sources
+// which can seek (see types.RowOffsetPlugin) start at the page rather
+// than producing all the rows before it again.
+func EvalPage(ctx context.Context, vql *VQL, scope types.Scope,
+	cursor string, page_size int) (*Page, error) {
+	if page_size <= 0 {
+		return nil, errors.New("EvalPage: page_size must be positive")
+	}
+
+	current, err := parsePageCursor(scope, vql, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	subscope := scope.Copy()
+	defer subscope.Close()
+
+	// One extra row tells us if there is another page.
+	needed := int(current.Offset) + page_size + 1
+	sub_ctx = withRowLimit(sub_ctx, needed)
+
+	offset := newRowOffset(current.Offset)
+	sub_ctx = withRowOffset(sub_ctx, offset)
+
+	result := &Page{}
+	skip := int64(-1)
+	more := false
+
+	for row := range vql.Eval(sub_ctx, subscope) {
+		// Skip the rows of earlier pages the query did not skip
+		// itself.
+		if skip < 0 {
+			skip = offset.remaining()
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		if len(result.Rows) >= page_size {
+			more = true
+			break
+		}
+
+		result.Rows = append(result.Rows, dict.RowToDict(ctx, subscope, row))
+
+		// Throttle if needed.
+		subscope.ChargeOp()
+	}
+
+	if more {
+		next := &pageCursor{
+			Query:  current.Query,
+			Offset: current.Offset + int64(len(result.Rows)),
+		}
+		result.Cursor = next.String()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package vfilter
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle"
+)
+
+// The result of parsing a possibly incomplete query with
+// ParsePartial().
+type PartialParse struct {
+	// True if the query parsed without error.
+	Complete bool
+
+	// The position of the first token which could not be parsed
+	// (or the end of the query if it is complete). Line and Column
+	// start at 1.
+	Offset int
+	Line   int
+	Column int
+
+	// The tokens which may appear at Offset.
+	Expected []string
+
+	// The parse error if the query is not complete.
+	Error error
+}
+
+// A candidate token for the next position. Classes of tokens are
+// represented by an example.
+type partialCandidate struct {
+	name    string
+	example string
+}
+
+var partialCandidates = []partialCandidate{
+	{"SELECT", "SELECT"},
+	{"FROM", "FROM"},
+	{"WHERE", "WHERE"},
+	{"GROUP BY", "GROUP BY"},
+	{"HAVING", "HAVING"},
+	{"ORDER BY", "ORDER BY"},
+	{"DESC", "DESC"},
+	{"LIMIT", "LIMIT"},
+	{"EXPLAIN", "EXPLAIN"},
+	{"LET", "LET"},
+	{"UNLET", "UNLET"},
+	{"AS", "AS"},
+	{"AND", "AND"},
+	{"OR", "OR"},
+	{"NOT", "NOT"},
+	{"IN", "IN"},
+	{"NULL", "NULL"},
+	{"<bool>", "TRUE"},
+	{"<ident>", "x"},
+	{"<number>", "1"},
+	{"<string>", "'x'"},
+	{"|>", "|>"},
+	{"||", "||"},
+	{"&&", "&&"},
+	{"<>", "<>"},
+	{"!=", "!="},
+	{"<=", "<="},
+	{">=", ">="},
+	{"=>", "=>"},
+	{"=~", "=~"},
+	{"?.", "?."},
+	{"=", "="},
+	{"<", "<"},
+	{">", ">"},
+	{"+", "+"},
+	{"-", "-"},
+	{"*", "*"},
+	{"/", "/"},
+	{"%", "%"},
+	{":", ":"},
+	{",", ","},
+	{".", "."},
+	{"(", "("},
+	{")", ")"},
+	{"{", "{"},
+	{"}", "}"},
+	{"[", "["},
+	{"]", "]"},
+}
+
+// ParsePartial parses a query which may be incomplete (e.g. while it
+// is being typed into an editor). It reports how far the query is
+// valid and which tokens may follow at that point.
+func ParsePartial(expression string) *PartialParse {
+	result := &PartialParse{
+		Complete: true,
+		Offset:   len(expression),
+	}
+
+	err := multiVQLParser.ParseString(expression, &MultiVQL{})
+	if err != nil {
+		result.Complete = false
+		result.Error = err
+
+		perr, ok := err.(participle.Error)
+		if ok {
+			tok := perr.Token()
+			if tok.Pos.Offset >= 0 && tok.Pos.Offset < result.Offset {
+				result.Offset = tok.Pos.Offset
+			}
+			result.Error = reportError(err, tok, expression)
+		}
+	}
+
+	prefix := expression[:result.Offset]
+	result.Line = strings.Count(prefix, "\n") + 1
+	result.Column = utf8.RuneCountInString(
+		prefix[strings.LastIndex(prefix, "\n")+1:]) + 1
+
+	// Try each candidate token after the valid prefix - a candidate
+	// is expected if the parser gets past it.
+	for _, candidate := range partialCandidates {
+		probe := prefix + " " + candidate.example
+		end := len(probe)
+
+		err := multiVQLParser.ParseString(probe, &MultiVQL{})
+		if err != nil {
+			perr, ok := err.(participle.Error)
+			if !ok || perr.Token().Pos.Offset < end {
+				continue
+			}
+		}
+
+		result.Expected = append(result.Expected, candidate.name)
+	}
+
+	return result
+}
@@ -0,0 +1,45 @@
+package vfilter
+
+import (
+	"context"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A pipeline is written as
+//
+//	SELECT ... FROM x() |> sort(key="X") |> head(n=5)
+//
+// Each stage is a plugin call which receives the previous stage as
+// its query arg, so the above is the same as
+//
+//	SELECT * FROM head(n=5, query={
+//	   SELECT * FROM sort(key="X", query={ SELECT ... FROM x() })})
+const pipelineArg = "query"
+
+// A stored query evaluating one stage of the pipeline.
+type _PipelineStage struct {
+	plugin *Plugin
+	input  types.StoredQuery
+}
+
+func (self *_PipelineStage) Eval(ctx context.Context, scope types.Scope) <-chan Row {
+	return self.plugin.evalWithInput(ctx, scope, self.input)
+}
+
+func (self *_Select) evalPipeline(ctx context.Context, scope types.Scope) <-chan Row {
+	// A limit hint refers to the output of the last stage which
+	// may not correspond to the rows of the query.
+	ctx = clearRowLimit(ctx)
+	ctx = clearRowOffset(ctx)
+
+	self_copy := *self
+	self_copy.Pipeline = nil
+
+	var input types.StoredQuery = &self_copy
+	for _, stage := range self.Pipeline {
+		input = &_PipelineStage{plugin: stage, input: input}
+	}
+
+	return input.Eval(ctx, scope)
+}
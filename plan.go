@@ -0,0 +1,219 @@
+package vfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// The version of the QueryPlan format. It is bumped when a plan can
+// no longer be loaded by an older version.
+const QueryPlanVersion = 1
+
+// A QueryPlan is a portable form of a parsed program. It is built on
+// the node which parsed the query and sent to other nodes which load
+// it into their own scope, so a query can be fanned out without each
+// node needing the original query text or definitions.
+//
+// Besides the statements the plan records what the program needs
+// from the scope: the parameters it references but does not define
+// itself and the plugins and functions it calls. Loading a plan
+// checks the target scope provides them all.
+type QueryPlan struct {
+	Version int `json:"version"`
+
+	// The canonical text of each statement.
+	Statements []string `json:"statements"`
+
+	Parameters []string `json:"parameters,omitempty"`
+	Plugins    []string `json:"plugins,omitempty"`
+	Functions  []string `json:"functions,omitempty"`
+}
+
+// NewQueryPlan analyzes the statements against the scope they would
+// run in. A referenced symbol is a parameter if it is not defined by
+// the program itself but the scope resolves it. Symbols the scope
+// does not know about are assumed to be row columns.
+func NewQueryPlan(scope types.Scope, statements []*VQL) *QueryPlan {
+	result := &QueryPlan{
+		Version:    QueryPlanVersion,
+		Statements: make([]string, 0, len(statements)),
+	}
+
+	// Names defined by the program shadow the scope.
+	defined := make(map[string]bool)
+	for _, vql := range statements {
+		if vql.Let != "" {
+			defined[vql.Let] = true
+			for _, name := range vql.getParameters() {
+				defined[name] = true
+			}
+		}
+	}
+
+	refs := &planRefs{
+		scope:      scope,
+		defined:    defined,
+		parameters: make(map[string]bool),
+		plugins:    make(map[string]bool),
+		functions:  make(map[string]bool),
+	}
+
+	for _, vql := range statements {
+		result.Statements = append(result.Statements, Minify(scope, vql))
+		refs.collect(reflect.ValueOf(vql))
+	}
+
+	result.Parameters = sortedKeys(refs.parameters)
+	result.Plugins = sortedKeys(refs.plugins)
+	result.Functions = sortedKeys(refs.functions)
+
+	return result
+}
+
+func (self *QueryPlan) Marshal() ([]byte, error) {
+	return json.Marshal(self)
+}
+
+func UnmarshalQueryPlan(data []byte) (*QueryPlan, error) {
+	result := &QueryPlan{}
+	err := json.Unmarshal(data, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Version != QueryPlanVersion {
+		return nil, fmt.Errorf("QueryPlan: unsupported version %v",
+			result.Version)
+	}
+	return result, nil
+}
+
+// Load checks the scope provides everything the plan needs and parses
+// the statements so they can be evaluated in it. All the missing
+// parameters, plugins and functions are reported together.
+func (self *QueryPlan) Load(scope types.Scope) ([]*VQL, error) {
+	missing := []string{}
+	for _, name := range self.Parameters {
+		_, pres := scope.Resolve(name)
+		if !pres {
+			missing = append(missing, "parameter "+name)
+		}
+	}
+
+	for _, name := range self.Plugins {
+		_, pres := scope.GetPlugin(name)
+		if !pres {
+			missing = append(missing, "plugin "+name)
+		}
+	}
+
+	for _, name := range self.Functions {
+		_, pres := scope.GetFunction(name)
+		if !pres {
+			missing = append(missing, "function "+name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("QueryPlan: scope is missing %v",
+			strings.Join(missing, ", "))
+	}
+
+	result := make([]*VQL, 0, len(self.Statements))
+	for _, statement := range self.Statements {
+		vql, err := Parse(statement)
+		if err != nil {
+			return nil, fmt.Errorf("QueryPlan: %w", err)
+		}
+		result = append(result, vql)
+	}
+
+	return result, nil
+}
+
+type planRefs struct {
+	scope   types.Scope
+	defined map[string]bool
+
+	parameters map[string]bool
+	plugins    map[string]bool
+	functions  map[string]bool
+}
+
+func (self *planRefs) collect(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			self.collect(value.Elem())
+		}
+
+	case reflect.Struct:
+		switch value.Type() {
+		case symbolRefType:
+			components, _ := splitSymbol(value.FieldByName("Symbol").String())
+			called := value.FieldByName("Called").Bool()
+			self.addRef(components, called, self.functions,
+				func(name string) bool {
+					_, pres := self.scope.GetFunction(name)
+					return pres
+				})
+
+		case pluginType:
+			components, _ := splitSymbol(value.FieldByName("Name").String())
+			called := value.FieldByName("Call").Bool()
+			self.addRef(components, called, self.plugins,
+				func(name string) bool {
+					_, pres := self.scope.GetPlugin(name)
+					return pres
+				})
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			// Skip unexported fields (e.g. cached state).
+			if value.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			self.collect(value.Field(i))
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			self.collect(value.Index(i))
+		}
+	}
+}
+
+// A single called component refers to a builtin (see
+// getFunction()), otherwise the first component is resolved from the
+// scope.
+func (self *planRefs) addRef(components []string, called bool,
+	builtins map[string]bool, is_builtin func(name string) bool) {
+	if len(components) == 0 || self.defined[components[0]] {
+		return
+	}
+
+	name := components[0]
+	if called && len(components) == 1 && is_builtin(name) {
+		builtins[name] = true
+		return
+	}
+
+	_, pres := self.scope.Resolve(name)
+	if pres {
+		self.parameters[name] = true
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for k := range set {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
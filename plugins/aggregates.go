@@ -0,0 +1,60 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _WithNewAggregatesPluginArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query to run with fresh aggregates."`
+}
+
+// Aggregate functions (e.g. count()) keep their state in the scope's
+// aggregator context. Calling a stored query starts a fresh context
+// but referencing it or running a subquery shares the caller's
+// context. This plugin makes the boundary explicit: aggregates in the
+// query always start from scratch and do not affect the caller.
+type _WithNewAggregatesPlugin struct{}
+
+func (self _WithNewAggregatesPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_WithNewAggregatesPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("with_new_aggregates: %v", err)
+			return
+		}
+
+		sub_scope := scope.Copy()
+		sub_scope.SetAggregatorCtx(nil)
+		defer sub_scope.Close()
+
+		for row := range arg.Query.Eval(ctx, sub_scope) {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _WithNewAggregatesPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "with_new_aggregates",
+		Doc:     "Run a query with a fresh aggregation context so aggregate functions start from scratch.",
+		ArgType: type_map.AddType(scope, &_WithNewAggregatesPluginArgs{}),
+	}
+}
@@ -14,6 +14,17 @@ func GetBuiltinPlugins() []types.PluginGeneratorInterface {
 		_ChainPlugin{},
 		_ForeachPluginImpl{},
 		RangePlugin{},
+		_TeePlugin{},
+		_WriteToPlugin{},
+		_SubscribePlugin{},
+		_VarsPlugin{},
+		_WithNewAggregatesPlugin{},
+		_HeadPlugin{},
+		_SamplePlugin{},
+		_SortPlugin{},
+		_JoinPlugin{},
+		_PluginsPlugin{},
+		_FunctionsPlugin{},
 		&GenericListPlugin{
 			PluginName: "scope",
 			Function: func(ctx context.Context,
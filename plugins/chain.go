@@ -2,13 +2,32 @@ package plugins
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/arg_parser"
 	"www.velocidex.com/golang/vfilter/types"
 )
 
+// Any other args are the queries to chain.
+type _ChainPluginArgs struct {
+	UnifySchema   bool     `vfilter:"optional,field=unify_schema,doc=Emit all rows with the same columns, setting missing columns to NULL and dropping other columns. The columns are those of the first row of each query unless columns is given."`
+	Columns       []string `vfilter:"optional,field=columns,doc=The columns to emit when unifying the schema (implies unify_schema)."`
+	StrictSchema  bool     `vfilter:"optional,field=strict_schema,doc=Stop with an error if a row has different columns from the first row."`
+	IncludeSource bool     `vfilter:"optional,field=include_source,doc=Add a column with the name of the query each row came from."`
+	SourceColumn  string   `vfilter:"optional,field=source_column,doc=The name of the source column (default _Source)."`
+}
+
+var chainOptions = map[string]bool{
+	"unify_schema":   true,
+	"columns":        true,
+	"strict_schema":  true,
+	"include_source": true,
+	"source_column":  true,
+}
+
 type _ChainPlugin struct{}
 
 func (self _ChainPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
@@ -16,6 +35,33 @@ func (self _ChainPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types
 		Name: "chain",
 		Doc: "Chain the output of several queries into the same table." +
 			"This plugin takes any args and chains them.",
+		ArgType:      type_map.AddType(scope, &_ChainPluginArgs{}),
+		FreeFormArgs: true,
+	}
+}
+
+type chainBranch struct {
+	name  string
+	query types.StoredQuery
+
+	// Set once the query is started.
+	scope types.Scope
+	rows  <-chan types.Row
+
+	// The first row is read ahead when the schema is inferred.
+	first types.Row
+}
+
+func (self *chainBranch) start(ctx context.Context, scope types.Scope) {
+	if self.rows == nil {
+		self.scope = scope.Copy()
+		self.rows = self.query.Eval(ctx, self.scope)
+	}
+}
+
+func (self *chainBranch) close() {
+	if self.scope != nil {
+		self.scope.Close()
 	}
 }
 
@@ -25,7 +71,8 @@ func (self _ChainPlugin) Call(
 	args *ordereddict.Dict) <-chan types.Row {
 	output_chan := make(chan types.Row)
 
-	queries := []types.StoredQuery{}
+	branches := []*chainBranch{}
+	options := ordereddict.NewDict()
 	members := scope.GetMembers(args)
 	sort.Strings(members)
 
@@ -34,29 +81,196 @@ func (self _ChainPlugin) Call(
 
 		for _, member := range members {
 			member_obj, pres := args.Get(member)
-			if pres {
-				queries = append(queries, arg_parser.ToStoredQuery(ctx, member_obj))
+			if !pres {
+				continue
 			}
+
+			if chainOptions[member] {
+				options.Set(member, member_obj)
+				continue
+			}
+
+			branches = append(branches, &chainBranch{
+				name:  member,
+				query: arg_parser.ToStoredQuery(ctx, member_obj),
+			})
 		}
 
-		for _, query := range queries {
-			new_scope := scope.Copy()
+		arg := &_ChainPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, options, arg)
+		if err != nil {
+			scope.Log("chain: %v", err)
+			return
+		}
+
+		if arg.SourceColumn == "" {
+			arg.SourceColumn = "_Source"
+		}
+
+		// Stop the queries which were started early if we
+		// return before reaching them.
+		sub_ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		defer func() {
+			for _, branch := range branches {
+				branch.close()
+			}
+		}()
+
+		prepare := func(branch *chainBranch, item types.Row) types.Row {
+			if arg.IncludeSource {
+				return addSource(scope, item, arg.SourceColumn, branch.name)
+			}
+			return item
+		}
+
+		schema := newChainSchema(scope, arg)
+
+		// Infer the columns from the first row of each query.
+		if schema.unify && schema.columns == nil && !schema.strict {
+			for _, branch := range branches {
+				branch.start(sub_ctx, scope)
+				item, ok := <-branch.rows
+				if ok {
+					branch.first = prepare(branch, item)
+					schema.addColumns(makeDict(scope, branch.first).Keys())
+				}
+			}
+		}
+
+		for _, branch := range branches {
+			branch.start(sub_ctx, scope)
+
+			emit := func(item types.Row) bool {
+				row, err := schema.transform(branch.name, item)
+				if err != nil {
+					scope.Log("chain: %v", err)
+					return false
+				}
 
-			in_chan := query.Eval(ctx, new_scope)
-			for item := range in_chan {
 				select {
 				case <-ctx.Done():
-					new_scope.Close()
-					return
+					return false
+				case output_chan <- row:
+				}
+				return true
+			}
 
-				case output_chan <- item:
+			if branch.first != nil && !emit(branch.first) {
+				return
+			}
+
+			for item := range branch.rows {
+				if !emit(prepare(branch, item)) {
+					return
 				}
 			}
 
-			new_scope.Close()
+			branch.close()
+			branch.scope = nil
 		}
 	}()
 
 	return output_chan
 
 }
+
+// Returns a copy of the row with the source column first.
+func addSource(scope types.Scope, item types.Row,
+	column, source string) *ordereddict.Dict {
+	result := ordereddict.NewDict().Set(column, source)
+	for _, member := range scope.GetMembers(item) {
+		if member == column {
+			continue
+		}
+		value, pres := scope.Associative(item, member)
+		if pres {
+			result.Set(member, value)
+		}
+	}
+	return result
+}
+
+// Tracks the columns of the chained rows to give them the same
+// schema.
+type chainSchema struct {
+	scope  types.Scope
+	unify  bool
+	strict bool
+
+	// Columns in the order they were first seen.
+	columns []string
+	seen    map[string]bool
+}
+
+func newChainSchema(scope types.Scope, arg *_ChainPluginArgs) *chainSchema {
+	result := &chainSchema{
+		scope:  scope,
+		unify:  arg.UnifySchema || len(arg.Columns) > 0,
+		strict: arg.StrictSchema,
+		seen:   make(map[string]bool),
+	}
+	result.addColumns(arg.Columns)
+	return result
+}
+
+// Returns the row with the schema applied.
+func (self *chainSchema) transform(branch string,
+	item types.Row) (types.Row, error) {
+	if !self.unify && !self.strict {
+		return item, nil
+	}
+
+	row := makeDict(self.scope, item)
+	keys := row.Keys()
+
+	if self.strict {
+		if self.columns == nil {
+			self.addColumns(keys)
+
+		} else if !self.sameColumns(keys) {
+			return nil, fmt.Errorf(
+				"query %v produced columns [%v] but expected [%v]",
+				branch, strings.Join(keys, ", "),
+				strings.Join(self.columns, ", "))
+		}
+	}
+
+	return self.reorder(row), nil
+}
+
+func (self *chainSchema) addColumns(keys []string) {
+	for _, key := range keys {
+		if !self.seen[key] {
+			self.seen[key] = true
+			self.columns = append(self.columns, key)
+		}
+	}
+}
+
+func (self *chainSchema) sameColumns(keys []string) bool {
+	if len(keys) != len(self.columns) {
+		return false
+	}
+	for _, key := range keys {
+		if !self.seen[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Build a row with the schema's columns in order, setting missing
+// columns to NULL.
+func (self *chainSchema) reorder(row *ordereddict.Dict) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+	for _, column := range self.columns {
+		value, pres := row.Get(column)
+		if !pres {
+			value = types.Null{}
+		}
+		result.Set(column, value)
+	}
+	return result
+}
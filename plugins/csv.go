@@ -0,0 +1,99 @@
+package plugins
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type ReadCSVPluginArgs struct {
+	Filename  string   `vfilter:"required,field=filename,doc=The file to read"`
+	Accessor  string   `vfilter:"optional,field=accessor,doc=The accessor used to open the file"`
+	Separator string   `vfilter:"optional,field=separator,doc=Field separator - use a tab for TSV (default comma)"`
+	Columns   []string `vfilter:"optional,field=columns,doc=Column names to use (default taken from the first line)"`
+}
+
+type ReadCSVPlugin struct{}
+
+func (self ReadCSVPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &ReadCSVPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("read_csv: %v", err)
+			return
+		}
+
+		fd, err := OpenFile(ctx, scope, arg.Accessor, arg.Filename)
+		if err != nil {
+			scope.Log("read_csv: %v", err)
+			return
+		}
+		defer fd.Close()
+
+		reader := csv.NewReader(fd)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		if arg.Separator != "" {
+			reader.Comma = []rune(arg.Separator)[0]
+		}
+
+		columns := arg.Columns
+		if len(columns) == 0 {
+			columns, err = reader.Read()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					scope.Log("read_csv: %v", err)
+				}
+				return
+			}
+		}
+
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				scope.Log("read_csv: %v", err)
+				return
+			}
+
+			row := ordereddict.NewDict()
+			for idx, value := range record {
+				if idx < len(columns) {
+					row.Set(columns[idx], value)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ReadCSVPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "read_csv",
+		Doc:     "Read a CSV or TSV file into rows.",
+		ArgType: type_map.AddType(scope, &ReadCSVPluginArgs{}),
+		Impact:  types.ImpactFilesystemRead,
+	}
+}
@@ -0,0 +1,52 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A FileOpener opens a file for plugins that read from files. Hosts
+// install an opener with SetFileOpener() to control how (and if)
+// files are accessed from VQL.
+type FileOpener func(ctx context.Context, scope types.Scope,
+	accessor, filename string) (io.ReadCloser, error)
+
+const fileOpenerContextKey = "$file_opener"
+
+func SetFileOpener(scope types.Scope, opener FileOpener) {
+	scope.SetContext(fileOpenerContextKey, opener)
+}
+
+// LocalFileOpener opens files on the local filesystem. Hosts which
+// want to give VQL unrestricted access to local files must install
+// it explicitly:
+//
+//	plugins.SetFileOpener(scope, plugins.LocalFileOpener)
+func LocalFileOpener(ctx context.Context, scope types.Scope,
+	accessor, filename string) (io.ReadCloser, error) {
+	switch accessor {
+	case "", "file":
+		return os.Open(filename)
+	}
+	return nil, fmt.Errorf("unsupported accessor %v", accessor)
+}
+
+// OpenFile opens the file using the opener registered on the
+// scope. Without a registered opener no files may be opened.
+func OpenFile(ctx context.Context, scope types.Scope,
+	accessor, filename string) (io.ReadCloser, error) {
+	opener_any, pres := scope.GetContext(fileOpenerContextKey)
+	if pres {
+		opener, ok := opener_any.(FileOpener)
+		if ok && opener != nil {
+			return opener(ctx, scope, accessor, filename)
+		}
+	}
+
+	return nil, errors.New("file access is not enabled: no file opener registered")
+}
@@ -39,13 +39,16 @@ func (self _FlattenPluginImpl) Call(ctx context.Context,
 			row_dict := makeDict(scope, row_item)
 			members := row_dict.Keys()
 
-			flattened := flatten(ctx, scope, row_dict, len(members)-1)
-			for _, item := range flattened {
-				select {
-				case <-ctx.Done():
-					return
-				case output_chan <- item:
-				}
+			if !flatten(ctx, scope, row_dict, len(members)-1,
+				func(item *ordereddict.Dict) bool {
+					select {
+					case <-ctx.Done():
+						return false
+					case output_chan <- item:
+						return true
+					}
+				}) {
+				return
 			}
 		}
 	}()
@@ -69,21 +72,28 @@ func makeDict(scope types.Scope, item types.Any) *ordereddict.Dict {
 	return result
 }
 
-// Expands the idx'th key into a list of rows
+// Expands the idx'th key into rows, passing each row to emit as it
+// is generated. The cartesian product of large columns may be huge
+// so it is never held in memory. Returns false if emit asked us to
+// stop.
 func flatten(ctx context.Context,
-	scope types.Scope, item *ordereddict.Dict, idx int) []*ordereddict.Dict {
+	scope types.Scope, item *ordereddict.Dict, idx int,
+	emit func(item *ordereddict.Dict) bool) bool {
 	if idx < 0 {
-		return []*ordereddict.Dict{item}
+		return emit(item)
 	}
 
-	result := []*ordereddict.Dict{}
 	members := item.Keys()
 	column := members[idx]
 	cell, _ := item.Get(column)
 
+	// Stop iterating the cell if we return early.
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Now iterate over all items in the cell.
 	count := 0
-	for member := range scope.Iterate(ctx, cell) {
+	for member := range scope.Iterate(sub_ctx, cell) {
 		count++
 		member_dict, ok := member.(*ordereddict.Dict)
 		if ok {
@@ -99,16 +109,18 @@ func flatten(ctx context.Context,
 		new_row.Update(column, member)
 
 		// By induction
-		result = append(result, flatten(ctx, scope, new_row, idx-1)...)
+		if !flatten(ctx, scope, new_row, idx-1, emit) {
+			return false
+		}
 	}
 
 	// Iterating over the member produced no results, just forward the
 	// member directly.
 	if count == 0 {
-		result = append(result, flatten(ctx, scope, item, idx-1)...)
+		return flatten(ctx, scope, item, idx-1, emit)
 	}
 
-	return result
+	return true
 }
 
 func (self _FlattenPluginImpl) Name() string {
@@ -2,7 +2,9 @@ package plugins
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/arg_parser"
@@ -15,6 +17,9 @@ type _ForeachPluginImplArgs struct {
 	Async   bool              `vfilter:"optional,field=async,doc=If set we run all queries asynchronously (implies workers=1000)."`
 	Workers int64             `vfilter:"optional,field=workers,doc=Total number of asynchronous workers."`
 	Column  string            `vfilter:"optional,field=column,doc=If set we only extract the column from row."`
+
+	RowTimeout time.Duration `vfilter:"optional,field=row_timeout,doc=If set cancel the query for a row taking longer than this many seconds and move on."`
+	OnError    string        `vfilter:"optional,field=on_error,doc=What to do when the query for a row fails: continue (skip the row) or abort (stop the foreach) or collect (emit a row with an _error column). If not set panics are not recovered. Panics inside a plugin's own goroutine are only recovered if the plugin supports it."`
 }
 
 type _ForeachPluginImpl struct{}
@@ -34,6 +39,18 @@ func (self _ForeachPluginImpl) Call(ctx context.Context,
 			return
 		}
 
+		switch arg.OnError {
+		case "", "continue", "abort", "collect":
+		default:
+			scope.Log("foreach: on_error should be one of continue, abort or collect not %v",
+				arg.OnError)
+			return
+		}
+
+		// Cancelled when on_error="abort" and a row fails.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
 		if arg.Async && arg.Workers == 0 {
 			arg.Workers = 100
 		}
@@ -47,7 +64,8 @@ func (self _ForeachPluginImpl) Call(ctx context.Context,
 		if arg.Workers > 1 {
 			scope.Log("DEBUG:Creating %v workers for foreach plugin\n", arg.Workers)
 		}
-		pool := newWorkerPool(ctx, arg.Query, output_chan, int(arg.Workers))
+		pool := newWorkerPool(ctx, arg.Query, output_chan,
+			int(arg.Workers), arg.RowTimeout, arg.OnError, cancel)
 		defer pool.Close()
 
 		row_chan := scope.Iterate(ctx, arg.Row)
@@ -90,7 +108,7 @@ func (self _ForeachPluginImpl) Call(ctx context.Context,
 				// child_scope is closed in the pool worker.
 
 				child_scope.AppendVars(row_item)
-				pool.RunScope(child_scope)
+				pool.RunScope(ctx, child_scope)
 			}
 		}
 	}()
@@ -116,10 +134,23 @@ type workerPool struct {
 	ch          chan types.Scope
 	query       types.StoredQuery
 	output_chan chan types.Row
+
+	// If set, each row's query is cancelled after this long.
+	row_timeout time.Duration
+
+	// How to handle a failed row and how to stop the whole foreach
+	// for on_error="abort".
+	on_error string
+	abort    func()
 }
 
-func (self *workerPool) RunScope(scope types.Scope) {
-	self.ch <- scope
+func (self *workerPool) RunScope(ctx context.Context, scope types.Scope) {
+	select {
+	case <-ctx.Done():
+		// No worker will pick up the scope any more.
+		scope.Close()
+	case self.ch <- scope:
+	}
 }
 
 func (self *workerPool) Close() {
@@ -127,12 +158,62 @@ func (self *workerPool) Close() {
 	self.wg.Wait()
 }
 
+// Collects the first error from a row's query. Errors may be
+// reported from the query's goroutines.
+type rowError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (self *rowError) Set(err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.err == nil {
+		self.err = err
+	}
+}
+
+func (self *rowError) Get() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.err
+}
+
 func (self *workerPool) runQuery(ctx context.Context, scope types.Scope) {
-	child_ctx, cancel := context.WithCancel(ctx)
+	var child_ctx context.Context
+	var cancel func()
+	if self.row_timeout > 0 {
+		child_ctx, cancel = context.WithTimeout(ctx, self.row_timeout)
+	} else {
+		child_ctx, cancel = context.WithCancel(ctx)
+	}
 	defer cancel()
 	defer scope.Close()
 
-	query_chan := self.query.Eval(child_ctx, scope)
+	row_error := &rowError{}
+	if self.on_error != "" {
+		child_ctx = types.WithQueryErrorHandler(child_ctx, row_error.Set)
+	}
+
+	self.relayRows(child_ctx, self.query.Eval(child_ctx, scope))
+
+	// Only this row's query timed out - it is abandoned and the
+	// worker moves on to the next row.
+	if child_ctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		row_error.Set(fmt.Errorf(
+			"row query timed out after %v", self.row_timeout))
+	}
+
+	err := row_error.Get()
+	if err != nil && ctx.Err() == nil {
+		self.handleError(ctx, scope, err)
+	}
+}
+
+func (self *workerPool) relayRows(
+	ctx context.Context, query_chan <-chan types.Row) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -151,6 +232,25 @@ func (self *workerPool) runQuery(ctx context.Context, scope types.Scope) {
 	}
 }
 
+func (self *workerPool) handleError(
+	ctx context.Context, scope types.Scope, err error) {
+	switch self.on_error {
+	case "collect":
+		select {
+		case <-ctx.Done():
+		case self.output_chan <- ordereddict.NewDict().
+			Set("_error", err.Error()):
+		}
+
+	case "abort":
+		scope.Log("foreach: %v - aborting", err)
+		self.abort()
+
+	default:
+		scope.Log("foreach: %v", err)
+	}
+}
+
 func (self *workerPool) worker(ctx context.Context) {
 	defer self.wg.Done()
 	for {
@@ -171,11 +271,16 @@ func (self *workerPool) worker(ctx context.Context) {
 }
 
 func newWorkerPool(ctx context.Context, query types.StoredQuery,
-	output_chan chan types.Row, size int) *workerPool {
+	output_chan chan types.Row, size int,
+	row_timeout time.Duration, on_error string,
+	abort func()) *workerPool {
 	self := &workerPool{
 		ch:          make(chan types.Scope),
 		query:       query,
 		output_chan: output_chan,
+		row_timeout: row_timeout,
+		on_error:    on_error,
+		abort:       abort,
 	}
 
 	for i := 0; i < size; i++ {
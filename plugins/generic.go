@@ -29,6 +29,7 @@ type GenericListPlugin struct {
 
 	ArgType  types.Any
 	Metadata *ordereddict.Dict
+	Impact   types.Impact
 }
 
 func (self GenericListPlugin) Call(
@@ -39,6 +40,7 @@ func (self GenericListPlugin) Call(
 
 	go func() {
 		defer close(output_chan)
+		defer types.RecoverQueryError(ctx, scope)
 
 		for _, item := range self.Function(ctx, scope, args) {
 			select {
@@ -60,6 +62,7 @@ func (self GenericListPlugin) Info(scope types.Scope, type_map *types.TypeMap) *
 	result := &types.PluginInfo{
 		Name:     self.PluginName,
 		Doc:      self.Doc,
+		Impact:   self.Impact,
 		Metadata: self.Metadata,
 	}
 
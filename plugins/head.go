@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _HeadPluginArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query to read rows from."`
+	N     int64             `vfilter:"required,field=n,doc=The number of rows to emit."`
+}
+
+type _HeadPlugin struct{}
+
+func (self _HeadPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_HeadPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("head: %v", err)
+			return
+		}
+
+		if arg.N <= 0 {
+			return
+		}
+
+		// Stop the query once we have enough rows.
+		sub_ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		count := int64(0)
+		for row := range arg.Query.Eval(sub_ctx, scope) {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+
+			count++
+			if count >= arg.N {
+				return
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _HeadPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "head",
+		Doc:     "Emit only the first rows of a query.",
+		ArgType: type_map.AddType(scope, &_HeadPluginArgs{}),
+	}
+}
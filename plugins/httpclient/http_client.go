@@ -0,0 +1,292 @@
+// Package httpclient provides an optional http_client() plugin which
+// allows VQL queries to read rows from REST APIs.
+//
+// The plugin is not part of the builtin set. Hosts decide how
+// requests are made by registering an *http.Client on the scope:
+//
+//	scope := vfilter.NewScope().AppendPlugins(httpclient.HTTPClientPlugin{})
+//	httpclient.RegisterClient(scope, &http.Client{Transport: transport})
+//
+// When no client is registered the plugin refuses to run.
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+const contextKey = "$http_client"
+
+// RegisterClient sets the client used by the http_client() plugin.
+func RegisterClient(scope types.Scope, client *http.Client) {
+	scope.SetContext(contextKey, client)
+}
+
+func getClient(scope types.Scope) (*http.Client, error) {
+	client_any, pres := scope.GetContext(contextKey)
+	if pres {
+		client, ok := client_any.(*http.Client)
+		if ok && client != nil {
+			return client, nil
+		}
+	}
+	return nil, errors.New("no http client registered")
+}
+
+type HTTPClientPluginArgs struct {
+	Url     string            `vfilter:"required,field=url,doc=The URL to fetch"`
+	Method  string            `vfilter:"optional,field=method,doc=HTTP method (default GET)"`
+	Headers *ordereddict.Dict `vfilter:"optional,field=headers,doc=A dict of request headers"`
+	Data    string            `vfilter:"optional,field=data,doc=Request body"`
+	Format  string            `vfilter:"optional,field=format,doc=One of json, jsonl or text (default detected from Content-Type). Text produces a row per line."`
+}
+
+type HTTPClientPlugin struct{}
+
+func (self HTTPClientPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &HTTPClientPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("http_client: %v", err)
+			return
+		}
+
+		client, err := getClient(scope)
+		if err != nil {
+			scope.Log("http_client: %v", err)
+			return
+		}
+
+		if arg.Method == "" {
+			arg.Method = "GET"
+		}
+
+		var body io.Reader
+		if arg.Data != "" {
+			body = strings.NewReader(arg.Data)
+		}
+
+		req, err := http.NewRequestWithContext(
+			ctx, strings.ToUpper(arg.Method), arg.Url, body)
+		if err != nil {
+			scope.Log("http_client: %v", err)
+			return
+		}
+
+		if arg.Headers != nil {
+			for _, k := range arg.Headers.Keys() {
+				v, _ := arg.Headers.Get(k)
+				req.Header.Set(k, fmt.Sprintf("%v", v))
+			}
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			scope.Log("http_client: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			scope.Log("http_client: %v returned status %v",
+				arg.Url, resp.Status)
+			return
+		}
+
+		format := arg.Format
+		if format == "" {
+			format = detectFormat(resp.Header.Get("Content-Type"))
+		}
+
+		switch format {
+		case "json":
+			err = parseJSON(ctx, resp, output_chan)
+		case "jsonl":
+			err = parseJSONL(ctx, resp, output_chan)
+		case "text":
+			err = parseText(ctx, resp, output_chan)
+		default:
+			err = fmt.Errorf("unsupported format %v", format)
+		}
+
+		if err != nil {
+			scope.Log("http_client: %v", err)
+		}
+	}()
+
+	return output_chan
+}
+
+func detectFormat(content_type string) string {
+	switch {
+	case strings.Contains(content_type, "ndjson"),
+		strings.Contains(content_type, "jsonl"):
+		return "jsonl"
+	case strings.Contains(content_type, "json"):
+		return "json"
+	}
+	return "text"
+}
+
+func send(ctx context.Context, output_chan chan types.Row, row types.Row) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case output_chan <- row:
+		return true
+	}
+}
+
+// Objects are rows, other values are wrapped in a row with a _value
+// column.
+func decodeRow(raw json.RawMessage) (*ordereddict.Dict, error) {
+	row := ordereddict.NewDict()
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return row, json.Unmarshal(trimmed, row)
+	}
+
+	wrapped := append([]byte(`{"_value":`), trimmed...)
+	wrapped = append(wrapped, '}')
+	return row, json.Unmarshal(wrapped, row)
+}
+
+// A JSON array produces one row per element, anything else is a
+// single row.
+func parseJSON(ctx context.Context,
+	resp *http.Response, output_chan chan types.Row) error {
+	reader := bufio.NewReader(resp.Body)
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first != '[' {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err != nil {
+			return err
+		}
+		row, err := decodeRow(raw)
+		if err != nil {
+			return err
+		}
+		send(ctx, output_chan, row)
+		return nil
+	}
+
+	// Consume the opening [
+	_, err = decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err != nil {
+			return err
+		}
+		row, err := decodeRow(raw)
+		if err != nil {
+			return err
+		}
+		if !send(ctx, output_chan, row) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}
+
+func parseJSONL(ctx context.Context,
+	resp *http.Response, output_chan chan types.Row) error {
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row, err := decodeRow(line)
+			if err != nil {
+				return err
+			}
+			if !send(ctx, output_chan, row) {
+				return nil
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Each line is a row so the body is never held in memory.
+func parseText(ctx context.Context,
+	resp *http.Response, output_chan chan types.Row) error {
+	url := resp.Request.URL.String()
+	reader := bufio.NewReader(resp.Body)
+	for line_number := 1; ; line_number++ {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			row := ordereddict.NewDict().
+				Set("Url", url).
+				Set("LineNumber", line_number).
+				Set("Line", strings.TrimRight(line, "\r\n"))
+			if !send(ctx, output_chan, row) {
+				return nil
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (self HTTPClientPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "http_client",
+		Doc:     "Fetch a URL and parse the response into rows.",
+		ArgType: type_map.AddType(scope, &HTTPClientPluginArgs{}),
+		Impact:  types.ImpactNetwork,
+	}
+}
@@ -0,0 +1,178 @@
+package httpclient_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/plugins/httpclient"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/objects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`)
+	})
+	mux.HandleFunc("/scalars", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, ` [1, "two", null, [3]]`)
+	})
+	mux.HandleFunc("/object", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("/lines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"id\":1}\n\n{\"id\":2}\n")
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first\r\nsecond\nthird")
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"header": r.Header.Get("X-Test"),
+			"body":   string(body),
+		})
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func newScope(logs *bytes.Buffer, client *http.Client) types.Scope {
+	scope := vfilter.NewScope().AppendPlugins(httpclient.HTTPClientPlugin{})
+	scope.SetLogger(log.New(logs, "", 0))
+	if client != nil {
+		httpclient.RegisterClient(scope, client)
+	}
+	return scope
+}
+
+func runQuery(t *testing.T, scope types.Scope, query string) string {
+	ctx := context.Background()
+	vql, err := vfilter.Parse(query)
+	assert.NoError(t, err)
+
+	rows := []types.Row{}
+	for row := range vql.Eval(ctx, scope) {
+		rows = append(rows, dict.RowToDict(ctx, scope, row))
+	}
+
+	serialized, err := json.Marshal(rows)
+	assert.NoError(t, err)
+	return string(serialized)
+}
+
+func TestHTTPClientFormats(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	logs := &bytes.Buffer{}
+	scope := newScope(logs, server.Client())
+	defer scope.Close()
+
+	query := func(path, extra string) string {
+		return runQuery(t, scope, fmt.Sprintf(
+			`SELECT * FROM http_client(url=%q%v)`, server.URL+path, extra))
+	}
+
+	assert.Equal(t, `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`,
+		query("/objects", ""))
+	assert.Equal(t, `[{"_value":1},{"_value":"two"},{"_value":null},{"_value":[3]}]`,
+		query("/scalars", ""))
+	assert.Equal(t, `[{"status":"ok"}]`, query("/object", ""))
+	assert.Equal(t, `[{"id":1},{"id":2}]`, query("/lines", ""))
+
+	url := server.URL + "/text"
+	assert.Equal(t, `[{"Url":"`+url+`","LineNumber":1,"Line":"first"},`+
+		`{"Url":"`+url+`","LineNumber":2,"Line":"second"},`+
+		`{"Url":"`+url+`","LineNumber":3,"Line":"third"}]`,
+		query("/text", ""))
+
+	// The format can be forced.
+	assert.Equal(t, `[{"Url":"`+server.URL+`/object","LineNumber":1,"Line":"{\"status\":\"ok\"}"}]`,
+		query("/object", `, format="text"`))
+
+	assert.Equal(t, `[{"body":"hello","header":"yes","method":"POST"}]`,
+		query("/echo", `, method="post", data="hello", headers=dict(`+"`X-Test`"+`="yes")`))
+	assert.Equal(t, "", logs.String())
+}
+
+func TestHTTPClientErrors(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	// Without a registered client the plugin refuses to run.
+	logs := &bytes.Buffer{}
+	scope := newScope(logs, nil)
+	assert.Equal(t, `[]`, runQuery(t, scope, fmt.Sprintf(
+		`SELECT * FROM http_client(url=%q)`, server.URL+"/objects")))
+	assert.Contains(t, logs.String(), "http_client: no http client registered")
+	scope.Close()
+
+	logs = &bytes.Buffer{}
+	scope = newScope(logs, server.Client())
+	defer scope.Close()
+
+	// Error responses do not produce rows.
+	assert.Equal(t, `[]`, runQuery(t, scope, fmt.Sprintf(
+		`SELECT * FROM http_client(url=%q)`, server.URL+"/missing")))
+	assert.Contains(t, logs.String(), "returned status 404 Not Found")
+
+	logs.Reset()
+	assert.Equal(t, `[]`, runQuery(t, scope, fmt.Sprintf(
+		`SELECT * FROM http_client(url=%q, format="xml")`, server.URL+"/objects")))
+	assert.Contains(t, logs.String(), "http_client: unsupported format xml")
+}
+
+// Rows are produced while the response is still being sent.
+func TestHTTPClientStreaming(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			fmt.Fprint(w, "{\"id\":1}\n")
+			w.(http.Flusher).Flush()
+			<-release
+			fmt.Fprint(w, "{\"id\":2}\n")
+		}))
+	defer server.Close()
+
+	logs := &bytes.Buffer{}
+	scope := newScope(logs, server.Client())
+	defer scope.Close()
+
+	vql, err := vfilter.Parse(fmt.Sprintf(
+		`SELECT * FROM http_client(url=%q)`, server.URL))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	output := vql.Eval(ctx, scope)
+	row := <-output
+	id, _ := scope.Associative(row, "id")
+	assert.Equal(t, uint64(1), id)
+
+	close(release)
+	row = <-output
+	id, _ = scope.Associative(row, "id")
+	assert.Equal(t, uint64(2), id)
+}
@@ -0,0 +1,126 @@
+package plugins
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Lists the plugins available in the scope.
+type _PluginsPlugin struct{}
+
+func (self _PluginsPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		type_map := types.NewTypeMap()
+		info := scope.Describe(type_map)
+		sort.Slice(info.Plugins, func(i, j int) bool {
+			return info.Plugins[i].Name < info.Plugins[j].Name
+		})
+
+		for _, plugin := range info.Plugins {
+			row := ordereddict.NewDict().
+				Set("Name", plugin.Name).
+				Set("Doc", plugin.Doc).
+				Set("Args", describeArgs(scope, type_map, plugin.ArgType)).
+				Set("Version", plugin.Version).
+				Set("Impact", plugin.Impact.String())
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _PluginsPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name: "plugins",
+		Doc:  "List the plugins available in the scope with their args.",
+	}
+}
+
+// Lists the functions available in the scope.
+type _FunctionsPlugin struct{}
+
+func (self _FunctionsPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		type_map := types.NewTypeMap()
+		info := scope.Describe(type_map)
+		sort.Slice(info.Functions, func(i, j int) bool {
+			return info.Functions[i].Name < info.Functions[j].Name
+		})
+
+		for _, function := range info.Functions {
+			row := ordereddict.NewDict().
+				Set("Name", function.Name).
+				Set("Doc", function.Doc).
+				Set("Args", describeArgs(scope, type_map, function.ArgType)).
+				Set("IsAggregate", function.IsAggregate).
+				Set("Version", function.Version).
+				Set("Impact", function.Impact.String())
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _FunctionsPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name: "functions",
+		Doc:  "List the functions available in the scope with their args.",
+	}
+}
+
+// Describe each arg of an args type collected in the type map.
+func describeArgs(scope types.Scope,
+	type_map *types.TypeMap, arg_type string) []*ordereddict.Dict {
+	result := []*ordereddict.Dict{}
+
+	desc, pres := type_map.Get(scope, arg_type)
+	if !pres || desc == nil {
+		return result
+	}
+
+	for _, name := range desc.Fields.Keys() {
+		value, _ := desc.Fields.Get(name)
+		field, ok := value.(*types.TypeReference)
+		if !ok {
+			continue
+		}
+
+		result = append(result, ordereddict.NewDict().
+			Set("Name", name).
+			Set("Type", field.Target).
+			Set("Repeated", field.Repeated).
+			Set("Required", field.Required()).
+			Set("Doc", field.Doc()))
+	}
+
+	return result
+}
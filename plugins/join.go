@@ -0,0 +1,143 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _JoinPluginArgs struct {
+	Lhs   types.StoredQuery `vfilter:"required,field=lhs,doc=The query whose rows are streamed."`
+	Rhs   types.StoredQuery `vfilter:"required,field=rhs,doc=The query to match rows from. It is held in memory so should be the smaller query."`
+	On    string            `vfilter:"required,field=on,doc=The column to join on."`
+	RhsOn string            `vfilter:"optional,field=rhs_on,doc=The column of the rhs to join on if it is named differently."`
+	Type  string            `vfilter:"optional,field=type,choices=inner|left,doc=The type of join: inner (the default) or left."`
+}
+
+// A hash join: The rhs rows are loaded into a table keyed by the join
+// column, then the lhs rows are streamed and matched against it. Each
+// lhs row is emitted once for each matching rhs row with the rhs
+// columns added (the lhs wins if both have a column). A left join
+// also emits unmatched lhs rows with the rhs columns set to NULL.
+// Rows with a NULL key never match.
+type _JoinPlugin struct{}
+
+func (self _JoinPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_JoinPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("join: %v", err)
+			return
+		}
+
+		rhs_on := arg.RhsOn
+		if rhs_on == "" {
+			rhs_on = arg.On
+		}
+
+		// Build the hash table from the rhs.
+		table := make(map[string][]*ordereddict.Dict)
+		rhs_columns := []string{}
+		seen := make(map[string]bool)
+
+		for row := range arg.Rhs.Eval(ctx, scope) {
+			row_dict := makeDict(scope, row)
+			for _, column := range row_dict.Keys() {
+				if !seen[column] {
+					seen[column] = true
+					rhs_columns = append(rhs_columns, column)
+				}
+			}
+
+			key, ok := joinKey(ctx, scope, row_dict, rhs_on)
+			if ok {
+				table[key] = append(table[key], row_dict)
+			}
+		}
+
+		emit := func(row *ordereddict.Dict) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case output_chan <- row:
+				return true
+			}
+		}
+
+		for row := range arg.Lhs.Eval(ctx, scope) {
+			lhs := makeDict(scope, row)
+
+			var matches []*ordereddict.Dict
+			key, ok := joinKey(ctx, scope, lhs, arg.On)
+			if ok {
+				matches = table[key]
+			}
+
+			if len(matches) == 0 && arg.Type == "left" {
+				result := copyDict(lhs)
+				for _, column := range rhs_columns {
+					_, pres := result.Get(column)
+					if !pres {
+						result.Set(column, types.Null{})
+					}
+				}
+				if !emit(result) {
+					return
+				}
+				continue
+			}
+
+			for _, rhs := range matches {
+				result := copyDict(lhs)
+				for _, column := range rhs.Keys() {
+					_, pres := result.Get(column)
+					if !pres {
+						value, _ := rhs.Get(column)
+						result.Set(column, value)
+					}
+				}
+				if !emit(result) {
+					return
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func joinKey(ctx context.Context, scope types.Scope,
+	row *ordereddict.Dict, column string) (string, bool) {
+	value, pres := row.Get(column)
+	if !pres || types.IsNil(value) {
+		return "", false
+	}
+	return types.ToString(ctx, scope, value), true
+}
+
+func copyDict(item *ordereddict.Dict) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+	for _, key := range item.Keys() {
+		value, _ := item.Get(key)
+		result.Set(key, value)
+	}
+	return result
+}
+
+func (self _JoinPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "join",
+		Doc:     "Join the rows of two queries on a column.",
+		ArgType: type_map.AddType(scope, &_JoinPluginArgs{}),
+	}
+}
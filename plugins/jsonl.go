@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type ReadJSONLPluginArgs struct {
+	Filename string    `vfilter:"optional,field=filename,doc=The file to read"`
+	Accessor string    `vfilter:"optional,field=accessor,doc=The accessor used to open the file"`
+	Reader   types.Any `vfilter:"optional,field=reader,doc=An io.Reader to read from instead of a file"`
+}
+
+// Reads newline delimited JSON one line at a time so arbitrarily
+// large files can be processed with bounded memory.
+type ReadJSONLPlugin struct{}
+
+func (self ReadJSONLPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &ReadJSONLPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("read_jsonl: %v", err)
+			return
+		}
+
+		var fd io.Reader
+		if !types.IsNil(arg.Reader) {
+			reader, ok := arg.Reader.(io.Reader)
+			if !ok {
+				scope.Log("read_jsonl: reader should be an io.Reader not %T",
+					arg.Reader)
+				return
+			}
+			fd = reader
+
+		} else if arg.Filename != "" {
+			file, err := OpenFile(ctx, scope, arg.Accessor, arg.Filename)
+			if err != nil {
+				scope.Log("read_jsonl: %v", err)
+				return
+			}
+			defer file.Close()
+			fd = file
+
+		} else {
+			scope.Log("read_jsonl: one of filename or reader should be specified")
+			return
+		}
+
+		reader := bufio.NewReader(fd)
+		for {
+			line, err := reader.ReadBytes('\n')
+			line = bytes.TrimSpace(line)
+			if len(line) > 0 {
+				row := ordereddict.NewDict()
+				err := json.Unmarshal(line, row)
+				if err != nil {
+					scope.Log("read_jsonl: %v", err)
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				scope.Log("read_jsonl: %v", err)
+				return
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self ReadJSONLPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "read_jsonl",
+		Doc:     "Read a newline delimited JSON file into rows.",
+		ArgType: type_map.AddType(scope, &ReadJSONLPluginArgs{}),
+		Impact:  types.ImpactFilesystemRead,
+	}
+}
@@ -2,10 +2,13 @@ package plugins
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/checkpoint"
 	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
 )
 
 type RangePluginArgs struct {
@@ -20,6 +23,14 @@ func (self RangePlugin) Call(
 	ctx context.Context,
 	scope types.Scope,
 	args *ordereddict.Dict) <-chan types.Row {
+	return self.CallWithOffset(ctx, scope, args, 0)
+}
+
+// The range can start anywhere so skipped rows are never produced.
+func (self RangePlugin) CallWithOffset(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict, offset int64) <-chan types.Row {
 	output_chan := make(chan types.Row)
 
 	go func() {
@@ -36,12 +47,29 @@ func (self RangePlugin) Call(
 			arg.Step = 1
 		}
 
-		for i := arg.Start; i < arg.End; i += arg.Step {
+		// Resume from a previous checkpoint if there is one.
+		start := arg.Start
+		cursor := checkpoint.NewCursor(scope, fmt.Sprintf(
+			"range:%v:%v:%v", arg.Start, arg.End, arg.Step))
+		position, pres := cursor.Get()
+		if pres {
+			position_int, ok := utils.ToInt64(position)
+			if ok {
+				start = position_int
+			}
+		}
+
+		for i := start + offset*arg.Step; i < arg.End; i += arg.Step {
+			row := ordereddict.NewDict().Set("_value", i)
+
+			// Once this row is emitted we resume after it.
+			cursor.Set(row, i+arg.Step)
+
 			select {
 			case <-ctx.Done():
 				return
 
-			case output_chan <- ordereddict.NewDict().Set("_value", i):
+			case output_chan <- row:
 			}
 		}
 	}()
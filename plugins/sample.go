@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _SamplePluginArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query to read rows from."`
+	N     int64             `vfilter:"required,field=n,doc=The number of rows to emit."`
+}
+
+type _SamplePlugin struct{}
+
+func (self _SamplePlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_SamplePluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("sample: %v", err)
+			return
+		}
+
+		if arg.N <= 0 {
+			return
+		}
+
+		// Reservoir sampling: each row ends up in the sample with
+		// the same probability.
+		source := types.GetEntropySource(scope)
+		sample := []types.Row{}
+		count := int64(0)
+		for row := range arg.Query.Eval(ctx, scope) {
+			count++
+			if int64(len(sample)) < arg.N {
+				sample = append(sample, row)
+				continue
+			}
+
+			idx := source.Int63() % count
+			if idx < arg.N {
+				sample[idx] = row
+			}
+		}
+
+		for _, row := range sample {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _SamplePlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "sample",
+		Doc:     "Emit a random sample of the rows of a query.",
+		ArgType: type_map.AddType(scope, &_SamplePluginArgs{}),
+	}
+}
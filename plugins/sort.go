@@ -0,0 +1,57 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _SortPluginArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query to sort."`
+	Key   string            `vfilter:"required,field=key,doc=The column to sort by."`
+	// DESC is a keyword so can not be used as an arg name.
+	Reverse bool `vfilter:"optional,field=reverse,doc=If set sort in descending order."`
+}
+
+// The scope sorts using the host's installed Sorter but this is not
+// part of the types.Scope interface.
+type scopeSorter interface {
+	Sort(ctx context.Context, scope types.Scope, input <-chan types.Row,
+		key string, desc bool) <-chan types.Row
+}
+
+type _SortPlugin struct{}
+
+func (self _SortPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	arg := &_SortPluginArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("sort: %v", err)
+		close(output_chan)
+		return output_chan
+	}
+
+	sorter, ok := scope.(scopeSorter)
+	if !ok {
+		scope.Log("sort: scope does not support sorting")
+		close(output_chan)
+		return output_chan
+	}
+
+	return sorter.Sort(ctx, scope, arg.Query.Eval(ctx, scope), arg.Key, arg.Reverse)
+}
+
+func (self _SortPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "sort",
+		Doc:     "Sort the rows of a query by a column.",
+		ArgType: type_map.AddType(scope, &_SortPluginArgs{}),
+	}
+}
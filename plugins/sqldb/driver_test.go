@@ -0,0 +1,126 @@
+package sqldb_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+)
+
+// A database/sql driver which serves canned results for the queries
+// the tests run, so they do not need a real database.
+const fakeDriverName = "sqldb_fake"
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+}
+
+type fakeTable struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// Text columns are returned as []byte like most drivers do.
+var fakeUsers = [][]driver.Value{
+	{int64(1), []byte("alice"), []byte("alice@example.com")},
+	{int64(2), []byte("bob"), nil},
+	{int64(3), []byte("carol"), []byte("carol@example.com")},
+}
+
+var fakeQueries = map[string]func(args []driver.Value) (*fakeTable, error){
+	"SELECT * FROM users ORDER BY id": func(args []driver.Value) (*fakeTable, error) {
+		return &fakeTable{
+			columns: []string{"id", "name", "email"},
+			rows:    fakeUsers,
+		}, nil
+	},
+
+	"SELECT name FROM users WHERE id >= ? AND name != ? ORDER BY id": func(
+		args []driver.Value) (*fakeTable, error) {
+		result := &fakeTable{columns: []string{"name"}}
+		for _, user := range fakeUsers {
+			if user[0].(int64) >= args[0].(int64) &&
+				string(user[1].([]byte)) != args[1].(string) {
+				result.rows = append(result.rows, user[1:2])
+			}
+		}
+		return result, nil
+	},
+
+	"SELECT * FROM users WHERE id = ?": func(args []driver.Value) (*fakeTable, error) {
+		return &fakeTable{columns: []string{"id", "name", "email"}}, nil
+	},
+}
+
+type fakeDriver struct{}
+
+func (self fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (self fakeConn) Prepare(query string) (driver.Stmt, error) {
+	handler, pres := fakeQueries[query]
+	if !pres {
+		return nil, errors.New("no such table: missing")
+	}
+	return &fakeStmt{query: query, handler: handler}, nil
+}
+
+func (self fakeConn) Close() error {
+	return nil
+}
+
+func (self fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeStmt struct {
+	query   string
+	handler func(args []driver.Value) (*fakeTable, error)
+}
+
+func (self *fakeStmt) Close() error {
+	return nil
+}
+
+// The sql package checks the number of bind args against this.
+func (self *fakeStmt) NumInput() int {
+	return strings.Count(self.query, "?")
+}
+
+func (self *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (self *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	table, err := self.handler(args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{table: table}, nil
+}
+
+type fakeRows struct {
+	table *fakeTable
+	next  int
+}
+
+func (self *fakeRows) Columns() []string {
+	return self.table.columns
+}
+
+func (self *fakeRows) Close() error {
+	return nil
+}
+
+func (self *fakeRows) Next(dest []driver.Value) error {
+	if self.next >= len(self.table.rows) {
+		return io.EOF
+	}
+	copy(dest, self.table.rows[self.next])
+	self.next++
+	return nil
+}
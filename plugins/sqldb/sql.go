@@ -0,0 +1,157 @@
+// Package sqldb provides an optional sql() plugin which allows VQL
+// queries to read from a database/sql handle provided by the
+// embedding program.
+//
+// The plugin is not part of the builtin set. Hosts that want it
+// should register their database handles on the scope and add the
+// plugin explicitly:
+//
+//	scope := vfilter.NewScope().AppendPlugins(sqldb.SQLPlugin{})
+//	sqldb.RegisterDB(scope, "main", db)
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+const (
+	// The name used when the query does not specify a db.
+	DefaultDB = "default"
+
+	contextPrefix = "$sqldb:"
+)
+
+// RegisterDB makes the database handle available to the sql()
+// plugin under the given name. The handle remains owned by the
+// caller who is responsible for closing it.
+func RegisterDB(scope types.Scope, name string, db *sql.DB) {
+	scope.SetContext(contextPrefix+name, db)
+}
+
+func getDB(scope types.Scope, name string) (*sql.DB, error) {
+	db_any, pres := scope.GetContext(contextPrefix + name)
+	if !pres {
+		return nil, fmt.Errorf("database %v is not registered", name)
+	}
+
+	db, ok := db_any.(*sql.DB)
+	if !ok || db == nil {
+		return nil, fmt.Errorf("database %v is not registered", name)
+	}
+	return db, nil
+}
+
+type SQLPluginArgs struct {
+	DB    string      `vfilter:"optional,field=db,doc=Name of the registered database (default 'default')"`
+	Query string      `vfilter:"required,field=query,doc=The SQL query to run"`
+	Args  []types.Any `vfilter:"optional,field=args,doc=Positional bind args for the query"`
+}
+
+type SQLPlugin struct{}
+
+func (self SQLPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &SQLPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("sql: %v", err)
+			return
+		}
+
+		if arg.DB == "" {
+			arg.DB = DefaultDB
+		}
+
+		db, err := getDB(scope, arg.DB)
+		if err != nil {
+			scope.Log("sql: %v", err)
+			return
+		}
+
+		query_args := make([]interface{}, 0, len(arg.Args))
+		for _, a := range arg.Args {
+			query_args = append(query_args, a)
+		}
+
+		rows, err := db.QueryContext(ctx, arg.Query, query_args...)
+		if err != nil {
+			scope.Log("sql: %v", err)
+			return
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			scope.Log("sql: %v", err)
+			return
+		}
+
+		for rows.Next() {
+			values := make([]interface{}, len(columns))
+			pointers := make([]interface{}, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+
+			err := rows.Scan(pointers...)
+			if err != nil {
+				scope.Log("sql: %v", err)
+				return
+			}
+
+			row := ordereddict.NewDict()
+			for i, column := range columns {
+				row.Set(column, normalizeValue(values[i]))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+
+		err = rows.Err()
+		if err != nil {
+			scope.Log("sql: %v", err)
+		}
+	}()
+
+	return output_chan
+}
+
+// Drivers commonly return text columns as []byte which is not very
+// useful in VQL.
+func normalizeValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case []byte:
+		return string(t)
+	case nil:
+		return types.Null{}
+	}
+	return value
+}
+
+func (self SQLPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "sql",
+		Doc:     "Run a query against a database registered by the host.",
+		ArgType: type_map.AddType(scope, &SQLPluginArgs{}),
+
+		// The statement may modify the database which may be remote.
+		Impact: types.ImpactFilesystemWrite | types.ImpactNetwork,
+	}
+}
@@ -0,0 +1,105 @@
+package sqldb_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/plugins/sqldb"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(fakeDriverName, "")
+	assert.NoError(t, err)
+	return db
+}
+
+func runQuery(t *testing.T, scope types.Scope, query string) string {
+	ctx := context.Background()
+	vql, err := vfilter.Parse(query)
+	assert.NoError(t, err)
+
+	rows := []types.Row{}
+	for row := range vql.Eval(ctx, scope) {
+		rows = append(rows, dict.RowToDict(ctx, scope, row))
+	}
+
+	serialized, err := json.Marshal(rows)
+	assert.NoError(t, err)
+	return string(serialized)
+}
+
+func newScope(logs *bytes.Buffer) types.Scope {
+	scope := vfilter.NewScope().AppendPlugins(sqldb.SQLPlugin{})
+	scope.SetLogger(log.New(logs, "", 0))
+	return scope
+}
+
+func TestSQLQuery(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	logs := &bytes.Buffer{}
+	scope := newScope(logs)
+	defer scope.Close()
+
+	sqldb.RegisterDB(scope, sqldb.DefaultDB, db)
+
+	// Text columns are strings and NULL columns are NULL.
+	assert.Equal(t, `[{"id":1,"name":"alice","email":"alice@example.com"},`+
+		`{"id":2,"name":"bob","email":null},`+
+		`{"id":3,"name":"carol","email":"carol@example.com"}]`,
+		runQuery(t, scope, `SELECT * FROM sql(query="SELECT * FROM users ORDER BY id")`))
+	assert.Equal(t, "", logs.String())
+}
+
+func TestSQLArgs(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	logs := &bytes.Buffer{}
+	scope := newScope(logs)
+	defer scope.Close()
+
+	sqldb.RegisterDB(scope, "users", db)
+
+	assert.Equal(t, `[{"name":"bob"},{"name":"carol"}]`,
+		runQuery(t, scope, `
+SELECT * FROM sql(db="users",
+   query="SELECT name FROM users WHERE id >= ? AND name != ? ORDER BY id",
+   args=[2, "alice"])`))
+	assert.Equal(t, "", logs.String())
+}
+
+func TestSQLErrors(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	logs := &bytes.Buffer{}
+	scope := newScope(logs)
+	defer scope.Close()
+
+	// No database is registered under the default name.
+	sqldb.RegisterDB(scope, "users", db)
+	assert.Equal(t, `[]`, runQuery(t, scope,
+		`SELECT * FROM sql(query="SELECT * FROM users")`))
+	assert.Contains(t, logs.String(), "sql: database default is not registered")
+
+	logs.Reset()
+	assert.Equal(t, `[]`, runQuery(t, scope,
+		`SELECT * FROM sql(db="users", query="SELECT * FROM missing")`))
+	assert.Contains(t, logs.String(), "sql: no such table: missing")
+
+	// The wrong number of bind args.
+	logs.Reset()
+	assert.Equal(t, `[]`, runQuery(t, scope,
+		`SELECT * FROM sql(db="users", query="SELECT * FROM users WHERE id = ?")`))
+	assert.Contains(t, logs.String(), "sql: ")
+}
@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/pubsub"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _SubscribePluginArgs struct {
+	Topic     string `vfilter:"required,field=topic,doc=The topic to subscribe to."`
+	QueueSize int64  `vfilter:"optional,field=queue_size,doc=Number of rows to queue before dropping (default 1000)."`
+}
+
+// An event plugin which emits rows published to a topic until the
+// query is cancelled.
+type _SubscribePlugin struct{}
+
+func (self _SubscribePlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_SubscribePluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("subscribe: %v", err)
+			return
+		}
+
+		events, unsubscribe := pubsub.GetEventBus(scope).Subscribe(
+			arg.Topic, int(arg.QueueSize))
+		defer func() {
+			dropped := unsubscribe()
+			if dropped > 0 {
+				scope.Log("subscribe: dropped %v rows from topic %v",
+					dropped, arg.Topic)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case row, ok := <-events:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _SubscribePlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "subscribe",
+		Doc:     "Emit rows published to the topic by other queries.",
+		ArgType: type_map.AddType(scope, &_SubscribePluginArgs{}),
+		Impact:  types.ImpactHostSink,
+	}
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _TeePluginArgs struct {
+	Query    types.StoredQuery `vfilter:"required,field=query,doc=The query to relay."`
+	Sink     string            `vfilter:"optional,field=sink,doc=The name of a sink registered by the host."`
+	Consumer types.StoredQuery `vfilter:"optional,field=consumer,doc=A query run for each row with the row's columns in scope."`
+}
+
+type _TeePlugin struct{}
+
+func (self _TeePlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_TeePluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("tee: %v", err)
+			return
+		}
+
+		var sink types.RowSink
+		if arg.Sink != "" {
+			sink, err = getSink(scope, arg.Sink)
+			if err != nil {
+				scope.Log("tee: %v", err)
+				return
+			}
+		}
+
+		for row := range arg.Query.Eval(ctx, scope) {
+			if sink != nil {
+				err := sink.Write(ctx, scope, row)
+				if err != nil {
+					scope.Log("tee: %v", err)
+				}
+			}
+
+			if arg.Consumer != nil {
+				runConsumer(ctx, scope, arg.Consumer, row)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+func getSink(scope types.Scope, name string) (types.RowSink, error) {
+	sink, pres := scope.GetSink(name)
+	if !pres || sink == nil {
+		return nil, fmt.Errorf("sink %v is not registered", name)
+	}
+	return sink, nil
+}
+
+// The consumer's own output is discarded - it is run for its side
+// effects only.
+func runConsumer(ctx context.Context, scope types.Scope,
+	consumer types.StoredQuery, row types.Row) {
+	child_scope := scope.Copy()
+	defer child_scope.Close()
+
+	child_scope.AppendVars(row)
+	for range consumer.Eval(ctx, child_scope) {
+	}
+}
+
+func (self _TeePlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name: "tee",
+		Doc: "Relay rows from the query unchanged while also sending " +
+			"them to a sink or consumer query.",
+		ArgType: type_map.AddType(scope, &_TeePluginArgs{}),
+		Impact:  types.ImpactHostSink,
+	}
+}
@@ -0,0 +1,97 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _VarsPluginArgs struct {
+	Builtins bool `vfilter:"optional,field=builtins,doc=Also list the functions and plugins available"`
+}
+
+// Lists the symbols defined in the scope. This is useful to debug
+// long chains of LET statements.
+type _VarsPlugin struct{}
+
+func (self _VarsPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_VarsPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("vars: %v", err)
+			return
+		}
+
+		var rows []types.Row
+		for _, name := range scope.VarNames() {
+			value, _ := scope.Resolve(name)
+			rows = append(rows, ordereddict.NewDict().
+				Set("Name", name).
+				Set("Type", fmt.Sprintf("%T", value)).
+				Set("Kind", varKind(value)).
+				Set("Origin", types.GetVarOrigin(scope, name)))
+		}
+
+		if arg.Builtins {
+			info := scope.Describe(types.NewTypeMap())
+			for _, function := range info.Functions {
+				rows = append(rows, ordereddict.NewDict().
+					Set("Name", function.Name).
+					Set("Type", "").
+					Set("Kind", "function").
+					Set("Origin", ""))
+			}
+
+			for _, plugin := range info.Plugins {
+				rows = append(rows, ordereddict.NewDict().
+					Set("Name", plugin.Name).
+					Set("Type", "").
+					Set("Kind", "plugin").
+					Set("Origin", ""))
+			}
+		}
+
+		for _, row := range rows {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
+}
+
+// Describe how the variable will be evaluated when used.
+func varKind(value types.Any) string {
+	switch value.(type) {
+	case types.Materializer:
+		return "materialized"
+	case types.StoredQuery:
+		return "lazy query"
+	case types.StoredExpression, types.LazyExpr:
+		return "lazy expression"
+	default:
+		return "value"
+	}
+}
+
+func (self _VarsPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "vars",
+		Doc:     "List the variables defined in the scope with their types and origins (if the host enabled tracking them).",
+		ArgType: type_map.AddType(scope, &_VarsPluginArgs{}),
+	}
+}
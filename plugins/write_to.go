@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type _WriteToPluginArgs struct {
+	Query types.StoredQuery `vfilter:"required,field=query,doc=The query whose rows will be written."`
+	Sink  string            `vfilter:"required,field=sink,doc=The name of a sink registered by the host."`
+}
+
+// Routes all rows from the query into a host provided sink and emits
+// a single summary row when done.
+type _WriteToPlugin struct{}
+
+func (self _WriteToPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		arg := &_WriteToPluginArgs{}
+		err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+		if err != nil {
+			scope.Log("write_to: %v", err)
+			return
+		}
+
+		sink, err := getSink(scope, arg.Sink)
+		if err != nil {
+			scope.Log("write_to: %v", err)
+			return
+		}
+
+		var rows, errors int64
+		for row := range arg.Query.Eval(ctx, scope) {
+			err := sink.Write(ctx, scope, row)
+			if err != nil {
+				scope.Log("write_to: %v", err)
+				errors++
+				continue
+			}
+			rows++
+		}
+
+		select {
+		case <-ctx.Done():
+		case output_chan <- ordereddict.NewDict().
+			Set("Sink", arg.Sink).
+			Set("Rows", rows).
+			Set("Errors", errors):
+		}
+	}()
+
+	return output_chan
+}
+
+func (self _WriteToPlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name:    "write_to",
+		Doc:     "Write the rows of a query into a sink registered by the host.",
+		ArgType: type_map.AddType(scope, &_WriteToPluginArgs{}),
+		Impact:  types.ImpactHostSink,
+	}
+}
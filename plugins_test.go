@@ -2,9 +2,17 @@ package vfilter
 
 import (
 	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter/functions"
+	"www.velocidex.com/golang/vfilter/plugins"
 	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils"
 )
@@ -95,3 +103,387 @@ func TestPlugins(t *testing.T) {
 		}
 	}
 }
+
+// Emits its value unless it is 2, in which case it hangs until
+// cancelled.
+type HangingPlugin struct{}
+
+func (self HangingPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		value, _ := args.Get("value")
+		if scope.Eq(value, 2) {
+			<-ctx.Done()
+			return
+		}
+		output_chan <- ordereddict.NewDict().Set("Value", value)
+	}()
+
+	return output_chan
+}
+
+func (self HangingPlugin) Info(scope types.Scope, type_map *TypeMap) *PluginInfo {
+	return &PluginInfo{
+		Name: "hanging",
+	}
+}
+
+func TestForeachRowTimeout(t *testing.T) {
+	scope := makeTestScope().AppendPlugins(HangingPlugin{})
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	vql, err := Parse(`
+SELECT Value FROM foreach(row=(1, 2, 3), row_timeout=0.1,
+    query={ SELECT * FROM hanging(value=_value) })`)
+	assert.NoError(t, err)
+
+	var result []Row
+	for row := range vql.Eval(context.Background(), scope) {
+		value, _ := scope.Associative(row, "Value")
+		result = append(result, value)
+	}
+
+	assert.Equal(t, []Row{int64(1), int64(3)}, result)
+	logger.Contains(t, "foreach: row query timed out after 100ms")
+}
+
+// Panics while calling the plugin when the value is 2.
+type PanickingCallPlugin struct{}
+
+func (self PanickingCallPlugin) Call(ctx context.Context,
+	scope types.Scope, args *ordereddict.Dict) <-chan Row {
+	value, _ := args.Get("value")
+	if value == int64(2) {
+		panic("call failed")
+	}
+
+	output_chan := make(chan Row, 1)
+	output_chan <- ordereddict.NewDict().Set("Value", value)
+	close(output_chan)
+	return output_chan
+}
+
+func (self PanickingCallPlugin) Info(scope types.Scope, type_map *TypeMap) *PluginInfo {
+	return &PluginInfo{
+		Name: "panicking_call",
+	}
+}
+
+// Panics in a plugin are reported to foreach()'s on_error whether
+// they happen while calling it or in the goroutine producing its
+// rows.
+func TestForeachPanickingPlugin(t *testing.T) {
+	scope := makeTestScope().AppendPlugins(
+		PanickingCallPlugin{},
+		plugins.GenericListPlugin{
+			PluginName: "panicking_rows",
+			Function: func(ctx context.Context, scope types.Scope,
+				args *ordereddict.Dict) []Row {
+				value, _ := args.Get("value")
+				if value == int64(2) {
+					panic("rows failed")
+				}
+				return []Row{ordereddict.NewDict().Set("Value", value)}
+			},
+		})
+
+	for _, plugin := range []string{"panicking_call", "panicking_rows"} {
+		vql, err := Parse(`
+SELECT Value, _error FROM foreach(row=(1, 2, 3), on_error="collect",
+    query={ SELECT * FROM ` + plugin + `(value=_value) })`)
+		assert.NoError(t, err)
+
+		var result []Row
+		for row := range vql.Eval(context.Background(), scope) {
+			value, _ := scope.Associative(row, "Value")
+			error_value, _ := scope.Associative(row, "_error")
+			result = append(result, []Row{value, error_value})
+		}
+
+		message := "panic: call failed"
+		if plugin == "panicking_rows" {
+			message = "panic: rows failed"
+		}
+		assert.Equal(t, []Row{
+			[]Row{int64(1), Null{}},
+			[]Row{Null{}, message},
+			[]Row{int64(3), Null{}},
+		}, result, plugin)
+	}
+}
+
+// Unifying the schema does not wait for the queries to finish.
+func TestChainUnifyStreams(t *testing.T) {
+	scope := makeTestScope().AppendPlugins(HangingPlugin{})
+
+	vql, err := Parse(`
+SELECT * FROM chain(
+   a={ SELECT * FROM foreach(row=(1, 2),
+         query={ SELECT * FROM hanging(value=_value) }) },
+   b={ SELECT * FROM hanging(value=3) },
+   unify_schema=TRUE)`)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	select {
+	case row := <-vql.Eval(ctx, scope):
+		value, _ := scope.Associative(row, "Value")
+		assert.Equal(t, int64(1), value)
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("chain did not emit the first row")
+	}
+}
+
+func TestPluginMiddleware(t *testing.T) {
+	scope := NewScope().AppendPlugins(TestGeneratorPlugin{})
+
+	// Record the calls and the order the middleware runs in.
+	var calls []string
+	scope.AddPluginMiddleware(func(ctx context.Context, scope types.Scope,
+		name string, args *ordereddict.Dict, next types.PluginCall) <-chan Row {
+		calls = append(calls, "outer:"+name)
+		return next(ctx, scope, args)
+	})
+
+	// Only pass the first 2 rows.
+	scope.AddPluginMiddleware(func(ctx context.Context, scope types.Scope,
+		name string, args *ordereddict.Dict, next types.PluginCall) <-chan Row {
+		calls = append(calls, "inner:"+name)
+
+		output_chan := make(chan Row)
+		go func() {
+			defer close(output_chan)
+
+			count := 0
+			for row := range next(ctx, scope, args) {
+				if count >= 2 {
+					continue
+				}
+				output_chan <- row
+				count++
+			}
+		}()
+		return output_chan
+	})
+
+	vql, err := Parse("SELECT foo_2 FROM test_plugin()")
+	assert.NoError(t, err)
+
+	var result []Row
+	for row := range vql.Eval(context.Background(), scope) {
+		value, _ := scope.Associative(row, "foo_2")
+		result = append(result, value)
+	}
+
+	assert.Equal(t, []Row{2, 4}, result)
+	assert.Equal(t, []string{"outer:test_plugin", "inner:test_plugin"}, calls)
+}
+
+func TestPluginMiddlewareSharing(t *testing.T) {
+	scope := NewScope().AppendPlugins(TestGeneratorPlugin{})
+
+	counter := func(name string, calls *[]string) types.PluginMiddleware {
+		return func(ctx context.Context, scope types.Scope,
+			plugin string, args *ordereddict.Dict, next types.PluginCall) <-chan Row {
+			*calls = append(*calls, name)
+			return next(ctx, scope, args)
+		}
+	}
+
+	var calls []string
+	subscope := scope.Copy()
+
+	// Middleware added to a subscope is shared with its parent.
+	subscope.AddPluginMiddleware(counter("subscope", &calls))
+
+	// A new scope starts with a copy of the middleware.
+	new_scope := scope.NewScope()
+	new_scope.AddPluginMiddleware(counter("new_scope", &calls))
+
+	assert.Equal(t, 1, len(scope.GetPluginMiddleware()))
+	assert.Equal(t, 1, len(subscope.GetPluginMiddleware()))
+	assert.Equal(t, 2, len(new_scope.GetPluginMiddleware()))
+
+	vql, err := Parse("SELECT * FROM test_plugin()")
+	assert.NoError(t, err)
+	for range vql.Eval(context.Background(), scope) {
+	}
+	assert.Equal(t, []string{"subscope"}, calls)
+}
+
+func TestImpactPolicy(t *testing.T) {
+	scope := makeTestScope().AppendPlugins(plugins.GenericListPlugin{
+		PluginName: "fetch",
+		Impact:     types.ImpactNetwork,
+		Function: func(ctx context.Context, scope types.Scope, args *ordereddict.Dict) []Row {
+			return []Row{ordereddict.NewDict().Set("Fetched", true)}
+		},
+	}).AppendFunctions(functions.GenericFunction{
+		FunctionName: "write_file",
+		Impact:       types.ImpactFilesystemWrite,
+		Function: func(ctx context.Context, scope types.Scope, args *ordereddict.Dict) Any {
+			return "written"
+		},
+	})
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	// Block network access and record the operations which required
+	// confirmation.
+	var confirmed []string
+	block := types.BlockImpact(types.ImpactNetwork)
+	types.SetOption(scope, types.ImpactPolicyOption, types.ImpactPolicyFunc(
+		func(ctx context.Context, scope types.Scope,
+			name string, impact types.Impact) error {
+			err := block.Check(ctx, scope, name, impact)
+			if err == nil {
+				confirmed = append(confirmed, name+":"+impact.String())
+			}
+			return err
+		}))
+
+	vqls, err := MultiParse(`
+SELECT * FROM fetch()
+SELECT write_file() AS Result, len(list=(1, 2)) AS Len FROM scope()
+`)
+	assert.NoError(t, err)
+
+	var result []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(context.Background(), scope) {
+			result = append(result, row)
+		}
+	}
+
+	assert.Equal(t, 1, len(result))
+	value, _ := scope.Associative(result[0], "Result")
+	assert.Equal(t, "written", value)
+	assert.Equal(t, []string{"write_file:filesystem-write"}, confirmed)
+	logger.Contains(t, "fetch: blocked by policy: network operations are not allowed")
+}
+
+// Writing to the host's sinks is a side effect which policies can
+// block.
+func TestImpactPolicyHostSink(t *testing.T) {
+	scope := makeTestScope()
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
+
+	var sunk []Row
+	scope.RegisterSink("results", types.RowSinkFunc(
+		func(ctx context.Context, scope types.Scope, row Row) error {
+			sunk = append(sunk, row)
+			return nil
+		}))
+	types.SetOption(scope, types.ImpactPolicyOption,
+		types.BlockImpact(types.ImpactHostSink))
+
+	vqls, err := MultiParse(`
+SELECT * FROM write_to(query={ SELECT * FROM test() }, sink="results")
+SELECT * FROM tee(query={ SELECT * FROM test() }, sink="results")
+`)
+	assert.NoError(t, err)
+
+	var result []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(context.Background(), scope) {
+			result = append(result, row)
+		}
+	}
+
+	assert.Equal(t, 0, len(result))
+	assert.Equal(t, 0, len(sunk))
+	logger.Contains(t, "write_to: blocked by policy: host-sink operations are not allowed")
+	logger.Contains(t, "tee: blocked by policy: host-sink operations are not allowed")
+}
+
+func TestPluginConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running := 0
+	max_running := 0
+
+	scope := makeTestScope().AppendPlugins(plugins.GenericListPlugin{
+		PluginName: "expensive",
+		Function: func(ctx context.Context, scope types.Scope, args *ordereddict.Dict) []Row {
+			mu.Lock()
+			running++
+			if running > max_running {
+				max_running = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			return []Row{ordereddict.NewDict().Set("Done", true)}
+		},
+	})
+	scope.SetPluginConcurrency("expensive", 2)
+
+	vql, err := Parse(`SELECT * FROM foreach(
+  row={ SELECT * FROM range(start=1, end=20) },
+  query={ SELECT * FROM expensive() }, workers=10)`)
+	assert.NoError(t, err)
+
+	rows := 0
+	for _ = range vql.Eval(context.Background(), scope) {
+		rows++
+	}
+
+	assert.Equal(t, 20, rows)
+	assert.Equal(t, 2, max_running)
+
+	// Removing the limit allows more concurrent calls.
+	scope.SetPluginConcurrency("expensive", 0)
+	max_running = 0
+	for _ = range vql.Eval(context.Background(), scope) {
+	}
+	assert.True(t, max_running > 2)
+}
+
+func TestFileOpener(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "vfilter*.csv")
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString("Name,Size\nfoo,1\n")
+	assert.NoError(t, err)
+	tmpfile.Close()
+
+	query := "SELECT Name FROM read_csv(filename=Filename)"
+	vql, err := Parse(query)
+	assert.NoError(t, err)
+
+	// Local files can not be read unless the host allows it.
+	scope := NewScope().AppendPlugins(plugins.ReadCSVPlugin{}).
+		AppendVars(ordereddict.NewDict().Set("Filename", tmpfile.Name()))
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", 0))
+
+	var result []Row
+	for row := range vql.Eval(context.Background(), scope) {
+		result = append(result, row)
+	}
+	assert.Equal(t, 0, len(result))
+	logger.Contains(t, "no file opener registered")
+
+	plugins.SetFileOpener(scope, plugins.LocalFileOpener)
+	for row := range vql.Eval(context.Background(), scope) {
+		value, _ := scope.Associative(row, "Name")
+		result = append(result, value)
+	}
+	assert.Equal(t, []Row{"foo"}, result)
+}
@@ -0,0 +1,160 @@
+package vfilter
+
+import (
+	"context"
+
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// GetStringPredicates returns the string predicates (e.g.
+// starts_with(string=Name, prefix='svc')) which every row must
+// satisfy to pass the WHERE clause of the query. Only predicates
+// which are ANDed together at the top level of the WHERE clause,
+// test a column directly and compare it with a literal are
+// returned. The WHERE clause is still applied to all rows so a
+// plugin may use the predicates as a hint only.
+func GetStringPredicates(ctx context.Context, scope types.Scope,
+	vql *VQL) []*types.StringPredicate {
+	result := []*types.StringPredicate{}
+
+	query := vql.Query
+	if query == nil {
+		query = vql.StoredQuery
+	}
+	if query == nil || query.Where == nil || len(query.Where.Right) > 0 {
+		return result
+	}
+
+	and_expression := query.Where.Left
+	terms := []*_OrExpression{and_expression.Left}
+	for _, term := range and_expression.Right {
+		terms = append(terms, term.Term)
+	}
+
+	for _, term := range terms {
+		value := orSingleValue(term)
+		if value == nil || value.SymbolRef == nil || !value.SymbolRef.Called {
+			continue
+		}
+
+		predicate := getStringPredicate(ctx, scope, value.SymbolRef)
+		if predicate != nil {
+			result = append(result, predicate)
+		}
+	}
+
+	return result
+}
+
+func getStringPredicate(ctx context.Context, scope types.Scope,
+	call *_SymbolRef) *types.StringPredicate {
+	function, pres := scope.GetFunction(call.Symbol)
+	if !pres {
+		return nil
+	}
+
+	predicate_function, ok := function.(types.StringPredicateFunction)
+	if !ok {
+		return nil
+	}
+
+	result := &types.StringPredicate{
+		Operator: call.Symbol,
+	}
+	value_arg := predicate_function.ValueArg()
+	found_column, found_value := false, false
+
+	for _, arg := range call.Parameters {
+		if arg.Right == nil {
+			return nil
+		}
+
+		value := andSingleValue(arg.Right)
+		if value == nil {
+			return nil
+		}
+
+		switch arg.Left {
+		case "string":
+			if value.SymbolRef == nil || value.SymbolRef.Called {
+				return nil
+			}
+			result.Column = utils.Unquote_ident(value.SymbolRef.Symbol)
+			found_column = true
+
+		case value_arg:
+			if value.String == nil {
+				return nil
+			}
+			literal, ok := value.Reduce(ctx, scope).(string)
+			if !ok {
+				return nil
+			}
+			result.Value = literal
+			found_value = true
+
+		case "case_sensitive":
+			if value.Boolean == nil {
+				return nil
+			}
+			result.CaseSensitive = value.reduceBoolean()
+
+		default:
+			return nil
+		}
+	}
+
+	if !found_column || !found_value {
+		return nil
+	}
+	return result
+}
+
+// Returns the value if the expression is a single value without any
+// operators (possibly in parentheses).
+func andSingleValue(node *_AndExpression) *_Value {
+	if node == nil || len(node.Right) > 0 {
+		return nil
+	}
+	return orSingleValue(node.Left)
+}
+
+func orSingleValue(node *_OrExpression) *_Value {
+	if node == nil || len(node.Right) > 0 {
+		return nil
+	}
+
+	condition := node.Left
+	if condition == nil || condition.Not != nil || condition.Right != nil {
+		return nil
+	}
+
+	addition := condition.Left
+	if addition == nil || len(addition.Right) > 0 {
+		return nil
+	}
+
+	multiplication := addition.Left
+	if multiplication == nil || len(multiplication.Right) > 0 {
+		return nil
+	}
+
+	member := multiplication.Left
+	if member == nil || len(member.Right) > 0 {
+		return nil
+	}
+
+	value := member.Left
+	if value == nil || value.Negated {
+		return nil
+	}
+
+	if value.Subexpression != nil {
+		if len(value.Subexpression.Right) > 0 {
+			return nil
+		}
+		return andSingleValue(value.Subexpression.Left)
+	}
+	return value
+}
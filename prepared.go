@@ -0,0 +1,69 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// A PreparedQuery is parsed once and may then be evaluated many
+// times, possibly concurrently, with different parameters. This
+// avoids parsing the same query for every request.
+type PreparedQuery struct {
+	statements []*VQL
+
+	// The statements are compiled on first use because compiling
+	// needs a scope.
+	once sync.Once
+}
+
+// Prepare parses the query which may consist of several statements
+// (e.g. LET definitions followed by a SELECT).
+func Prepare(query string) (*PreparedQuery, error) {
+	statements, err := MultiParse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedQuery{statements: statements}, nil
+}
+
+// Eval runs all the statements in a copy of the scope which has the
+// params added, so the params and any LET definitions are not visible
+// in the scope or to other evaluations. The rows of all the
+// statements are sent to the channel in order.
+func (self *PreparedQuery) Eval(ctx context.Context, scope types.Scope,
+	params *ordereddict.Dict) <-chan Row {
+	self.once.Do(func() {
+		for _, vql := range self.statements {
+			vql.Compile(scope)
+		}
+	})
+
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		subscope := scope.Copy()
+		defer subscope.Close()
+
+		if params != nil {
+			subscope.AppendVars(params)
+		}
+
+		for _, vql := range self.statements {
+			for row := range vql.Eval(ctx, subscope) {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
@@ -0,0 +1,123 @@
+package protocols
+
+import (
+	"math/big"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Protocols for BigInt and Decimal values. Operations between
+// integers (including BigInt) produce a BigInt, while operations
+// involving a Decimal or a float produce a Decimal. Division always
+// produces a Decimal so no precision is lost.
+
+func isBigNumber(a types.Any) bool {
+	switch a.(type) {
+	case types.BigInt, types.Decimal:
+		return true
+	}
+	return false
+}
+
+func bigNumberApplicable(a types.Any, b types.Any) bool {
+	return (isBigNumber(a) || isBigNumber(b)) && isNumber(a) && isNumber(b)
+}
+
+func bigNumberOp(a types.Any, b types.Any,
+	int_op func(z, x, y *big.Int) *big.Int,
+	rat_op func(z, x, y *big.Rat) *big.Rat) types.Any {
+	if int_op != nil && isInteger(a) && isInteger(b) {
+		lhs, _ := types.ToBigInt(a)
+		rhs, _ := types.ToBigInt(b)
+		return types.NewBigInt(int_op(new(big.Int), lhs, rhs))
+	}
+
+	lhs, ok := types.ToDecimal(a)
+	if !ok {
+		return &types.Null{}
+	}
+
+	rhs, ok := types.ToDecimal(b)
+	if !ok {
+		return &types.Null{}
+	}
+
+	return types.NewDecimal(rat_op(new(big.Rat), lhs, rhs))
+}
+
+type _BigNumberEq struct{}
+
+func (self _BigNumberEq) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberEq) Eq(scope types.Scope, a types.Any, b types.Any) bool {
+	cmp, ok := compareNumbers(a, b)
+	return ok && cmp == 0
+}
+
+type _BigNumberLt struct{}
+
+func (self _BigNumberLt) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberLt) Lt(scope types.Scope, a types.Any, b types.Any) bool {
+	cmp, ok := compareNumbers(a, b)
+	return ok && cmp < 0
+}
+
+type _BigNumberGt struct{}
+
+func (self _BigNumberGt) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberGt) Gt(scope types.Scope, a types.Any, b types.Any) bool {
+	cmp, ok := compareNumbers(a, b)
+	return ok && cmp > 0
+}
+
+type _BigNumberAdd struct{}
+
+func (self _BigNumberAdd) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberAdd) Add(scope types.Scope, a types.Any, b types.Any) types.Any {
+	return bigNumberOp(a, b, (*big.Int).Add, (*big.Rat).Add)
+}
+
+type _BigNumberSub struct{}
+
+func (self _BigNumberSub) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberSub) Sub(scope types.Scope, a types.Any, b types.Any) types.Any {
+	return bigNumberOp(a, b, (*big.Int).Sub, (*big.Rat).Sub)
+}
+
+type _BigNumberMul struct{}
+
+func (self _BigNumberMul) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberMul) Mul(scope types.Scope, a types.Any, b types.Any) types.Any {
+	return bigNumberOp(a, b, (*big.Int).Mul, (*big.Rat).Mul)
+}
+
+type _BigNumberDiv struct{}
+
+func (self _BigNumberDiv) Applicable(a types.Any, b types.Any) bool {
+	return bigNumberApplicable(a, b)
+}
+
+func (self _BigNumberDiv) Div(scope types.Scope, a types.Any, b types.Any) types.Any {
+	cmp, _ := compareNumbers(b, 0)
+	if cmp == 0 {
+		return &types.Null{}
+	}
+	return bigNumberOp(a, b, nil, (*big.Rat).Quo)
+}
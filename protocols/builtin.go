@@ -36,5 +36,10 @@ func GetBuiltinTypes() []types.Any {
 		// _ArrayRegex{},
 
 		// _SliceIterator{}, // _LazyExprIterator{}, _StoredQueryIterator{}, _DictIterator{},
+
+		_BigNumberEq{}, _BigNumberLt{}, _BigNumberGt{},
+		_BigNumberAdd{}, _BigNumberSub{}, _BigNumberMul{}, _BigNumberDiv{},
+
+		_IPEq{}, _IPLt{}, _IPGt{}, _IPNetworkMembership{},
 	}
 }
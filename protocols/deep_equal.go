@@ -0,0 +1,120 @@
+package protocols
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// DeepEqual compares two values recursively:
+//
+//  1. Lazy values are reduced and stored queries are materialized
+//     into an array of rows.
+//  2. Dicts (and rows) are equal when they have the same set of keys
+//     and the values of each key are deeply equal. Key order is
+//     ignored.
+//  3. Arrays are equal when they have the same length and their
+//     elements are deeply equal. When order_sensitive is set
+//     elements are compared pairwise, otherwise each element must
+//     match a distinct element of the other array in any order.
+//  4. All other values are compared using the scope's Eq protocol.
+func DeepEqual(ctx context.Context, scope types.Scope,
+	a types.Any, b types.Any, order_sensitive bool) bool {
+	a = materializeForEqual(ctx, scope, a)
+	b = materializeForEqual(ctx, scope, b)
+
+	a_dict, a_ok := toDeepDict(a)
+	b_dict, b_ok := toDeepDict(b)
+	if a_ok || b_ok {
+		if !a_ok || !b_ok || a_dict.Len() != b_dict.Len() {
+			return false
+		}
+
+		for _, key := range a_dict.Keys() {
+			a_value, _ := a_dict.Get(key)
+			b_value, pres := b_dict.Get(key)
+			if !pres || !DeepEqual(ctx, scope, a_value, b_value, order_sensitive) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Bytes are arrays too but compare as a whole.
+	_, a_bytes := a.(types.Bytes)
+	_, b_bytes := b.(types.Bytes)
+	if !a_bytes && !b_bytes && is_array(a) && is_array(b) {
+		return deepArrayEqual(ctx, scope, a, b, order_sensitive)
+	}
+
+	return scope.Eq(a, b)
+}
+
+func deepArrayEqual(ctx context.Context, scope types.Scope,
+	a types.Any, b types.Any, order_sensitive bool) bool {
+	value_a := reflect.ValueOf(a)
+	value_b := reflect.ValueOf(b)
+
+	if value_a.Len() != value_b.Len() {
+		return false
+	}
+
+	if order_sensitive {
+		for i := 0; i < value_a.Len(); i++ {
+			if !DeepEqual(ctx, scope, value_a.Index(i).Interface(),
+				value_b.Index(i).Interface(), order_sensitive) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Match each element of a with an unused element of b.
+	used := make([]bool, value_b.Len())
+	for i := 0; i < value_a.Len(); i++ {
+		item := value_a.Index(i).Interface()
+		found := false
+		for j := 0; j < value_b.Len(); j++ {
+			if used[j] {
+				continue
+			}
+			if DeepEqual(ctx, scope, item,
+				value_b.Index(j).Interface(), order_sensitive) {
+				used[j] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func materializeForEqual(ctx context.Context,
+	scope types.Scope, a types.Any) types.Any {
+	a = maybeReduce(a)
+
+	switch t := a.(type) {
+	case types.StoredQuery:
+		return types.Materialize(ctx, scope, t)
+	}
+	return a
+}
+
+func toDeepDict(a types.Any) (*ordereddict.Dict, bool) {
+	switch t := a.(type) {
+	case types.LazyRow:
+		result := ordereddict.NewDict()
+		for _, column := range t.Columns() {
+			value, _ := t.Get(column)
+			result.Set(column, value)
+		}
+		return result, true
+	}
+	return to_dict(a)
+}
@@ -0,0 +1,115 @@
+package protocols
+
+import (
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Protocols for IP addresses and networks. Addresses compare with
+// other addresses and with address strings, while an address (or
+// address string) is in a network when the network contains it:
+//
+// SELECT * FROM connections WHERE SrcIP in ip(cidr='10.0.0.0/8')
+
+func isIPAddress(a types.Any) bool {
+	switch a.(type) {
+	case types.IPAddress, *types.IPAddress:
+		return true
+	}
+	return false
+}
+
+func isIPNetwork(a types.Any) bool {
+	switch a.(type) {
+	case types.IPNetwork, *types.IPNetwork:
+		return true
+	}
+	return false
+}
+
+func ipApplicable(a types.Any, b types.Any) bool {
+	if !isIPAddress(a) && !isIPAddress(b) {
+		return false
+	}
+	_, ok := types.ToIP(a)
+	if !ok {
+		return false
+	}
+	_, ok = types.ToIP(b)
+	return ok
+}
+
+func compareIPs(a types.Any, b types.Any) (int, bool) {
+	lhs, ok := types.ToIP(a)
+	if !ok {
+		return 0, false
+	}
+	rhs, ok := types.ToIP(b)
+	if !ok {
+		return 0, false
+	}
+	return types.CompareIP(lhs, rhs), true
+}
+
+type _IPEq struct{}
+
+func (self _IPEq) Applicable(a types.Any, b types.Any) bool {
+	if isIPNetwork(a) || isIPNetwork(b) {
+		_, ok := types.ToIPNetwork(a)
+		if !ok {
+			return false
+		}
+		_, ok = types.ToIPNetwork(b)
+		return ok
+	}
+	return ipApplicable(a, b)
+}
+
+func (self _IPEq) Eq(scope types.Scope, a types.Any, b types.Any) bool {
+	if isIPNetwork(a) || isIPNetwork(b) {
+		lhs, _ := types.ToIPNetwork(a)
+		rhs, _ := types.ToIPNetwork(b)
+		return lhs.String() == rhs.String()
+	}
+
+	cmp, ok := compareIPs(a, b)
+	return ok && cmp == 0
+}
+
+type _IPLt struct{}
+
+func (self _IPLt) Applicable(a types.Any, b types.Any) bool {
+	return ipApplicable(a, b)
+}
+
+func (self _IPLt) Lt(scope types.Scope, a types.Any, b types.Any) bool {
+	cmp, ok := compareIPs(a, b)
+	return ok && cmp < 0
+}
+
+type _IPGt struct{}
+
+func (self _IPGt) Applicable(a types.Any, b types.Any) bool {
+	return ipApplicable(a, b)
+}
+
+func (self _IPGt) Gt(scope types.Scope, a types.Any, b types.Any) bool {
+	cmp, ok := compareIPs(a, b)
+	return ok && cmp > 0
+}
+
+type _IPNetworkMembership struct{}
+
+func (self _IPNetworkMembership) Applicable(a types.Any, b types.Any) bool {
+	if !isIPNetwork(b) {
+		return false
+	}
+	_, ok := types.ToIP(a)
+	return ok
+}
+
+func (self _IPNetworkMembership) Membership(
+	scope types.Scope, a types.Any, b types.Any) bool {
+	ip, _ := types.ToIP(a)
+	network, ok := types.ToIPNetwork(b)
+	return ok && network.Contains(ip)
+}
@@ -0,0 +1,162 @@
+package protocols
+
+import (
+	"math"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Largest magnitude of an integer which converts to float64 exactly.
+const maxExactFloatInt = 1 << 53
+
+// Compare two numbers exactly, returning -1, 0 or 1. Converting
+// uint64 values above math.MaxInt64 to int64 wraps them around, and
+// converting large integers to float64 loses precision. The common
+// cases (two int64 sized integers, two floats or a float and a small
+// integer) are compared directly and only the others are done using
+// big.Rat. Returns false if either value is not a number (or is
+// NaN).
+func compareNumbers(a types.Any, b types.Any) (int, bool) {
+	lhs_int, lhs_is_int := exactInt64(a)
+	rhs_int, rhs_is_int := exactInt64(b)
+	if lhs_is_int && rhs_is_int {
+		return compareInt64(lhs_int, rhs_int), true
+	}
+
+	lhs_float, lhs_is_float := toFloat(a)
+	rhs_float, rhs_is_float := toFloat(b)
+	if lhs_is_int && isExactFloat(lhs_int) {
+		lhs_float, lhs_is_float = float64(lhs_int), true
+	}
+	if rhs_is_int && isExactFloat(rhs_int) {
+		rhs_float, rhs_is_float = float64(rhs_int), true
+	}
+	if lhs_is_float && rhs_is_float {
+		if math.IsNaN(lhs_float) || math.IsNaN(rhs_float) {
+			return 0, false
+		}
+		return compareFloat64(lhs_float, rhs_float), true
+	}
+
+	if !isNumber(a) || !isNumber(b) {
+		return 0, false
+	}
+
+	// Infinities can not be represented as a big.Rat but compare
+	// larger (or smaller) than any finite number.
+	lhs_inf := infSign(a)
+	rhs_inf := infSign(b)
+	if lhs_inf != 0 || rhs_inf != 0 {
+		return compareInt64(int64(lhs_inf), int64(rhs_inf)), true
+	}
+
+	lhs, ok := types.ToDecimal(a)
+	if !ok {
+		return 0, false
+	}
+
+	rhs, ok := types.ToDecimal(b)
+	if !ok {
+		return 0, false
+	}
+
+	return lhs.Cmp(rhs), true
+}
+
+func compareInt64(lhs, rhs int64) int {
+	switch {
+	case lhs < rhs:
+		return -1
+	case lhs > rhs:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(lhs, rhs float64) int {
+	switch {
+	case lhs < rhs:
+		return -1
+	case lhs > rhs:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(a types.Any) (float64, bool) {
+	switch t := a.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+func isExactFloat(value int64) bool {
+	return value >= -maxExactFloatInt && value <= maxExactFloatInt
+}
+
+// Convert integer types to int64 only when this can be done without
+// loss.
+func exactInt64(a types.Any) (int64, bool) {
+	switch t := a.(type) {
+	case int:
+		return int64(t), true
+	case int8:
+		return int64(t), true
+	case int16:
+		return int64(t), true
+	case int32:
+		return int64(t), true
+	case int64:
+		return t, true
+	case uint8:
+		return int64(t), true
+	case uint16:
+		return int64(t), true
+	case uint32:
+		return int64(t), true
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t), true
+		}
+	}
+	return 0, false
+}
+
+// Integers of any size, including BigInt.
+func isInteger(a types.Any) bool {
+	switch a.(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64,
+		types.BigInt:
+		return true
+	}
+	return false
+}
+
+func isNumber(a types.Any) bool {
+	switch t := a.(type) {
+	case float64:
+		return !math.IsNaN(t)
+	case float32:
+		return !math.IsNaN(float64(t))
+	case types.Decimal:
+		return true
+	}
+	return isInteger(a)
+}
+
+func infSign(a types.Any) int {
+	switch t := a.(type) {
+	case float64:
+		if math.IsInf(t, 1) {
+			return 1
+		} else if math.IsInf(t, -1) {
+			return -1
+		}
+	case float32:
+		return infSign(float64(t))
+	}
+	return 0
+}
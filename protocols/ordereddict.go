@@ -1,6 +1,8 @@
 package protocols
 
 import (
+	"strconv"
+
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/types"
 )
@@ -52,3 +54,33 @@ func (self _DictEq) Applicable(a types.Any, b types.Any) bool {
 
 	return a_ok && b_ok
 }
+
+// Dicts may be indexed by integers (e.g. X[0]). Dicts normalized
+// from maps with integer keys store the key's string form, so an
+// entry with a key matching the index takes precedence. Otherwise the
+// index selects the Nth entry in insertion order, with negative
+// indexes counting from the end like arrays.
+func dictIndex(dict *ordereddict.Dict, index int64) (types.Any, bool) {
+	value, pres := dict.Get(strconv.FormatInt(index, 10))
+	if !pres {
+		keys := dict.Keys()
+		if index < 0 {
+			index += int64(len(keys))
+		}
+
+		if index < 0 || index >= int64(len(keys)) {
+			return nil, false
+		}
+		value, pres = dict.Get(keys[index])
+	}
+
+	if types.IsNil(value) {
+		value = types.Null{}
+	}
+	return value, pres
+}
+
+// Only integer types can be used as dict indexes.
+func toDictIndex(b types.Any) (int64, bool) {
+	return exactInt64(b)
+}
@@ -0,0 +1,56 @@
+package protocols
+
+import (
+	"fmt"
+	"reflect"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Each dispatcher tries its implementations in order. AddImpl()
+// places new implementations first while InsertImpl() places them
+// relative to an existing implementation so callers can layer their
+// implementations explicitly.
+
+// Insert the elements (a slice) into the implementations (a pointer
+// to a slice) before or after the first implementation of the same
+// type as the anchor. Returns false if there is no such
+// implementation.
+func insertImpl(impls interface{}, anchor types.Any,
+	after bool, elements interface{}) bool {
+	slice := reflect.ValueOf(impls).Elem()
+	anchor_type := reflect.TypeOf(anchor)
+
+	idx := -1
+	for i := 0; i < slice.Len(); i++ {
+		if slice.Index(i).Elem().Type() == anchor_type {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return false
+	}
+	if after {
+		idx++
+	}
+
+	new_elements := reflect.ValueOf(elements)
+	result := reflect.MakeSlice(slice.Type(), 0, slice.Len()+new_elements.Len())
+	result = reflect.AppendSlice(result, slice.Slice(0, idx))
+	result = reflect.AppendSlice(result, new_elements)
+	result = reflect.AppendSlice(result, slice.Slice(idx, slice.Len()))
+	slice.Set(result)
+
+	return true
+}
+
+// The type names of the implementations in the order they are tried.
+func implNames(impls interface{}) []string {
+	slice := reflect.ValueOf(impls)
+	result := make([]string, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		result = append(result, fmt.Sprintf("%T", slice.Index(i).Interface()))
+	}
+	return result
+}
@@ -65,6 +65,16 @@ func (self AddDispatcher) Add(scope types.Scope, a types.Any, b types.Any) types
 			return t + b_str
 		}
 
+	case types.Bytes:
+		switch rhs := b.(type) {
+		case types.Bytes:
+			result := make(types.Bytes, 0, len(t)+len(rhs))
+			return append(append(result, t...), rhs...)
+		case string:
+			result := make(types.Bytes, 0, len(t)+len(rhs))
+			return append(append(result, t...), rhs...)
+		}
+
 	case types.Null, *types.Null, nil:
 		return &types.Null{}
 
@@ -110,6 +120,15 @@ func (self *AddDispatcher) AddImpl(elements ...AddProtocol) {
 	}
 }
 
+func (self *AddDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...AddProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self AddDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 func convertToSlice(a types.Any) []types.Any {
 	if is_array(a) {
 		a_slice := reflect.ValueOf(a)
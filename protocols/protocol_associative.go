@@ -39,6 +39,14 @@ func (self *AssociativeDispatcher) Associative(
 		return types.Null{}, true
 	}
 
+	dict, ok := a.(*ordereddict.Dict)
+	if ok {
+		index, ok := toDictIndex(b)
+		if ok {
+			return dictIndex(dict, index)
+		}
+	}
+
 	b_str, ok := utils.ToString(b)
 	if ok {
 		switch t := a.(type) {
@@ -139,6 +147,15 @@ func (self *AssociativeDispatcher) AddImpl(elements ...AssociativeProtocol) {
 	}
 }
 
+func (self *AssociativeDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...AssociativeProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self AssociativeDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 // Last resort associative - uses reflect package to resolve struct
 // fields.
 type DefaultAssociative struct{}
@@ -153,11 +170,21 @@ func (self DefaultAssociative) Associative(scope types.Scope, a types.Any, b typ
 		recover()
 	}()
 
+	view, ok := a.(*types.SliceView)
+	if ok {
+		return sliceViewAssociative(scope, view, b)
+	}
+
 	a = maybeReduce(a)
 
 	// Handle an int index.
 	idx, ok := utils.ToInt64(b)
 	if ok {
+		a_str, is_str := a.(string)
+		if is_str && types.IsOptionEnabled(scope, types.RuneIndexingOption) {
+			return runeIndex(a_str, idx)
+		}
+
 		a_value := reflect.Indirect(reflect.ValueOf(a))
 
 		// Handle string especially
@@ -197,6 +224,10 @@ func (self DefaultAssociative) Associative(scope types.Scope, a types.Any, b typ
 		a_value := reflect.Indirect(reflect.ValueOf(a))
 		if a_value.Type().Kind() == reflect.String {
 			value := a_value.String()
+			if types.IsOptionEnabled(scope, types.RuneIndexingOption) {
+				return runeSlice(value, field_name), true
+			}
+
 			array_length := int64(len(value))
 			start_range, end_range := getRanges(field_name, array_length)
 			if end_range <= start_range {
@@ -206,6 +237,16 @@ func (self DefaultAssociative) Associative(scope types.Scope, a types.Any, b typ
 			return value[int(start_range):int(end_range)], true
 		}
 
+		// Slicing binary data yields binary data.
+		bytes_value, ok := a.(types.Bytes)
+		if ok {
+			start_range, end_range := getRanges(field_name, int64(len(bytes_value)))
+			if end_range <= start_range {
+				return types.Bytes{}, true
+			}
+			return bytes_value[start_range:end_range], true
+		}
+
 		if a_value.Type().Kind() == reflect.Slice {
 			array_length := int64(a_value.Len())
 			start_range, end_range := getRanges(field_name, array_length)
@@ -213,16 +254,10 @@ func (self DefaultAssociative) Associative(scope types.Scope, a types.Any, b typ
 				return []types.Any{}, true
 			}
 
-			result := make([]types.Any, 0, end_range-start_range)
-			for i := start_range; i < end_range; i++ {
-				value := a_value.Index(int(i))
-				if value.Kind() == reflect.Ptr && value.IsNil() {
-					result = append(result, &types.Null{})
-				} else {
-					result = append(result, value.Interface())
-				}
-			}
-			return result, true
+			// Return a view of the original array rather than a
+			// copy so windows over large arrays are cheap.
+			return types.NewSliceView(a_value.Interface(),
+				int(start_range), int(end_range)), true
 		}
 
 	case string:
@@ -284,6 +319,29 @@ func (self DefaultAssociative) Associative(scope types.Scope, a types.Any, b typ
 	return &types.Null{}, false
 }
 
+// Index a string by unicode character rather than by byte.
+func runeIndex(value string, idx int64) (types.Any, bool) {
+	runes := []rune(value)
+	array_length := int64(len(runes))
+	if idx < 0 {
+		idx = array_length + idx
+	}
+
+	if idx < 0 || idx >= array_length {
+		return &types.Null{}, false
+	}
+	return string(runes[idx]), true
+}
+
+func runeSlice(value string, field_name []*int64) string {
+	runes := []rune(value)
+	start_range, end_range := getRanges(field_name, int64(len(runes)))
+	if end_range <= start_range {
+		return ""
+	}
+	return string(runes[start_range:end_range])
+}
+
 func FieldMatchName(
 	struct_type reflect.Type,
 	field_name string) func(in string) bool {
@@ -344,3 +402,39 @@ func (self DefaultAssociative) GetMembers(scope types.Scope, a types.Any) []stri
 
 	return result
 }
+
+// Index and slice a view without copying it. Anything else operates
+// on a copy of the window.
+func sliceViewAssociative(scope types.Scope,
+	view *types.SliceView, b types.Any) (types.Any, bool) {
+	array_length := int64(view.Len())
+
+	idx, ok := utils.ToInt64(b)
+	if ok {
+		// Negative index refers to the end of the slice.
+		if idx < 0 {
+			idx = array_length + idx
+		}
+
+		// Index out of bounds - return NULL
+		if idx < 0 || idx >= array_length {
+			return &types.Null{}, false
+		}
+		return view.Index(int(idx)), true
+	}
+
+	ranges, ok := b.([]*int64)
+	if ok {
+		if len(ranges) != 2 {
+			return &types.Null{}, true
+		}
+
+		start_range, end_range := getRanges(ranges, array_length)
+		if end_range <= start_range {
+			return []types.Any{}, true
+		}
+		return view.Slice(int(start_range), int(end_range)), true
+	}
+
+	return scope.Associative(view.ToArray(), b)
+}
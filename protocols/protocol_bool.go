@@ -3,6 +3,7 @@ package protocols
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/types"
@@ -17,6 +18,21 @@ func (self BoolDispatcher) Copy() BoolDispatcher {
 		append([]BoolProtocol{}, self.impl...)}
 }
 
+// Bool returns the truth value of a. The built in types convert as
+// follows:
+//
+//	NULL                    false
+//	bool                    itself
+//	integers and floats     true if greater than 0 (negative is false)
+//	BigInt and Decimal      true if greater than 0
+//	strings                 true if not empty
+//	dicts                   true if they have any keys
+//	arrays and Bytes        true if not empty
+//	time.Time               true if not the zero time
+//	lazy expressions        the truth value of their reduced value
+//
+// Other types are passed to the registered BoolProtocol
+// implementations and are false if none apply.
 func (self BoolDispatcher) Bool(ctx context.Context, scope types.Scope, a types.Any) bool {
 	a = maybeReduce(a)
 
@@ -46,6 +62,17 @@ func (self BoolDispatcher) Bool(ctx context.Context, scope types.Scope, a types.
 		return t > 0
 	case float64:
 		return t > 0
+	case float32:
+		return t > 0
+	case types.BigInt:
+		return t.Sign() > 0
+	case types.Decimal:
+		return t.Sign() > 0
+
+	case time.Time:
+		return !t.IsZero()
+	case *time.Time:
+		return !t.IsZero()
 
 	case string:
 		return len(t) > 0
@@ -81,6 +108,15 @@ func (self *BoolDispatcher) AddImpl(elements ...BoolProtocol) {
 	}
 }
 
+func (self *BoolDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...BoolProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self BoolDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 // This protocol implements the truth value.
 type BoolProtocol interface {
 	Applicable(a types.Any) bool
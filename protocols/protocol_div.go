@@ -81,3 +81,12 @@ func (self *DivDispatcher) AddImpl(elements ...DivProtocol) {
 		self.impl = append([]DivProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *DivDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...DivProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self DivDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
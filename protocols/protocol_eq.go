@@ -1,6 +1,7 @@
 package protocols
 
 import (
+	"bytes"
 	"reflect"
 	"time"
 
@@ -38,9 +39,14 @@ func (self EqDispatcher) Eq(scope types.Scope, a types.Any, b types.Any) bool {
 		}
 
 	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		lhs, ok := utils.ToInt64(a)
-		if ok {
-			return intEq(lhs, b)
+		return intEq(a, b)
+
+	case types.Bytes:
+		switch rhs := b.(type) {
+		case types.Bytes:
+			return bytes.Equal(t, rhs)
+		case string:
+			return string(t) == rhs
 		}
 
 	case bool:
@@ -50,6 +56,11 @@ func (self EqDispatcher) Eq(scope types.Scope, a types.Any, b types.Any) bool {
 		}
 
 	case float64:
+		cmp, ok := compareNumbers(t, b)
+		if ok {
+			return cmp == 0
+		}
+
 		rhs, ok := utils.ToFloat(b)
 		if ok {
 			return t == rhs
@@ -98,6 +109,15 @@ func (self *EqDispatcher) AddImpl(elements ...EqProtocol) {
 	}
 }
 
+func (self *EqDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...EqProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self EqDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 func _ArrayEq(scope types.Scope, a types.Any, b types.Any) bool {
 	value_a := reflect.ValueOf(a)
 	value_b := reflect.ValueOf(b)
@@ -22,25 +22,43 @@ func (self GtDispatcher) Copy() GtDispatcher {
 		append([]GtProtocol{}, self.impl...)}
 }
 
-func intGt(lhs int64, b types.Any) bool {
-	switch b.(type) {
-	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		rhs, _ := utils.ToInt64(b)
-		return lhs > rhs
-	case float64, float32:
-		rhs, _ := utils.ToFloat(b)
-		return float64(lhs) > rhs
-	}
-	return false
+func intGt(lhs types.Any, b types.Any) bool {
+	cmp, ok := compareNumbers(lhs, b)
+	return ok && cmp > 0
 }
 
 func (self GtDispatcher) Gt(scope types.Scope, a types.Any, b types.Any) bool {
+	result, _ := self.gt(scope, a, b)
+	return result
+}
+
+// GtOrDerive is like Gt() but types without a Gt implementation which
+// do implement the Lt protocol are greater when they are neither less
+// than nor equal. This keeps > consistent with < for these types.
+func (self GtDispatcher) GtOrDerive(scope types.Scope, lt *LtDispatcher,
+	a types.Any, b types.Any) bool {
+	a = maybeReduce(a)
+	b = maybeReduce(b)
+
+	result, ok := self.gt(scope, a, b)
+	if ok || !lt.Applicable(a, b) {
+		return result
+	}
+
+	return !lt.Lt(scope, a, b) && !scope.Eq(a, b)
+}
+
+// Returns false for ok if no implementation handles the types. The
+// result is then the default comparison.
+func (self GtDispatcher) gt(scope types.Scope, a types.Any, b types.Any) (bool, bool) {
 	a = maybeReduce(a)
 	b = maybeReduce(b)
 
+	fallback := false
+
 	switch t := a.(type) {
 	case types.Null, *types.Null, nil:
-		return false
+		return false, true
 
 	case string:
 		if isTime(b) {
@@ -48,13 +66,13 @@ func (self GtDispatcher) Gt(scope types.Scope, a types.Any, b types.Any) bool {
 			if ok {
 				rhs, ok := toTime(b)
 				if ok {
-					return time.Unix(lhs, 0).After(*rhs)
+					return time.Unix(lhs, 0).After(*rhs), true
 				}
 			}
 		}
 		rhs, ok := b.(string)
 		if ok {
-			return t > rhs
+			return t > rhs, true
 		}
 
 		// If it is integer like, coerce to int.
@@ -64,85 +82,97 @@ func (self GtDispatcher) Gt(scope types.Scope, a types.Any, b types.Any) bool {
 			if ok {
 				rhs, ok := toTime(b)
 				if ok {
-					return time.Unix(lhs, 0).After(*rhs)
+					return time.Unix(lhs, 0).After(*rhs), true
 				}
 			}
 		}
 
-		lhs, ok := utils.ToInt64(t)
+		return intGt(t, b), true
+
+	case float64:
+		cmp, ok := compareNumbers(t, b)
 		if ok {
-			return intGt(lhs, b)
+			return cmp > 0, true
 		}
 
-	case float64:
 		rhs, ok := utils.ToFloat(b)
 		if ok {
-			return t > rhs
+			return t > rhs, true
 		}
 
 	case time.Time:
 		rhs, ok := toTime(b)
 		if ok {
-			return t.After(*rhs)
+			return t.After(*rhs), true
 		}
 
 	case *time.Time:
 		rhs, ok := toTime(b)
 		if ok {
-			return t.After(*rhs)
+			return t.After(*rhs), true
 		}
 	}
 
 	switch t := b.(type) {
 	case types.Null, *types.Null, nil:
-		return false
+		return false, true
 
 	case string:
 		lhs, ok := a.(string)
 		if ok {
-			return lhs > t
+			return lhs > t, true
 		}
 
 		// If it is integer like, coerce to int.
 	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		rhs, ok := utils.ToInt64(t)
+		cmp, ok := compareNumbers(a, t)
 		if ok {
-			if intLt(rhs, a) {
-				return false
-			}
-			if intEq(rhs, a) {
-				return false
-			}
-			return true
+			return cmp > 0, true
 		}
 
+		if intLt(t, a) {
+			return false, true
+		}
+		if intEq(t, a) {
+			return false, true
+		}
+
+		// Other types are greater than numbers unless an
+		// implementation handles them.
+		fallback = true
+
 	case float64:
+		cmp, ok := compareNumbers(a, t)
+		if ok {
+			return cmp > 0, true
+		}
+
 		lhs, ok := utils.ToFloat(a)
 		if ok {
-			return lhs > t
+			return lhs > t, true
 		}
 
 	case time.Time:
 		lhs, ok := toTime(a)
 		if ok {
-			return t.Before(*lhs)
+			return t.Before(*lhs), true
 		}
 
 	case *time.Time:
 		lhs, ok := toTime(a)
 		if ok {
-			return t.Before(*lhs)
+			return t.Before(*lhs), true
 		}
 	}
 
 	for i, impl := range self.impl {
 		if impl.Applicable(a, b) {
 			scope.GetStats().IncProtocolSearch(i)
-			return impl.Gt(scope, a, b)
+			return impl.Gt(scope, a, b), true
 		}
 	}
 
-	return false
+	return fallback, false
 }
 
 func (self *GtDispatcher) AddImpl(elements ...GtProtocol) {
@@ -150,3 +180,12 @@ func (self *GtDispatcher) AddImpl(elements ...GtProtocol) {
 		self.impl = append([]GtProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *GtDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...GtProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self GtDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
@@ -23,6 +23,10 @@ func (self IterateDispatcher) Iterate(
 
 	switch t := a.(type) {
 
+	// Iterate over a view without copying it.
+	case *types.SliceView:
+		return _SliceViewIterator(ctx, t)
+
 	// A LazyExpr is a placeholder for a real value.
 	case types.LazyExpr:
 		return scope.Iterate(ctx, t.Reduce(ctx))
@@ -83,6 +87,15 @@ func (self *IterateDispatcher) AddImpl(elements ...IterateProtocol) {
 	}
 }
 
+func (self *IterateDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...IterateProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self IterateDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 // This protocol implements the truth value.
 type IterateProtocol interface {
 	Applicable(a types.Any) bool
@@ -121,3 +134,32 @@ func _SliceIterator(ctx context.Context, scope types.Scope, a types.Any) <-chan
 
 	return output_chan
 }
+
+func _SliceViewIterator(ctx context.Context, view *types.SliceView) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		for i := 0; i < view.Len(); i++ {
+			value := view.Index(i)
+			if types.IsNil(value) {
+				continue
+			}
+
+			item, ok := value.(*ordereddict.Dict)
+			if !ok {
+				item = ordereddict.NewDict().
+					Set("_value", value)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- item:
+			}
+		}
+	}()
+
+	return output_chan
+}
@@ -30,36 +30,28 @@ func (self LtDispatcher) Copy() LtDispatcher {
 // float int  -> lhs < float(rhs)
 // float float -> lhs < lhs
 
-func intLt(lhs int64, b types.Any) bool {
-	switch b.(type) {
-	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		rhs, _ := utils.ToInt64(b)
-		return lhs < rhs
-	case float64, float32:
-		rhs, _ := utils.ToFloat(b)
-		return float64(lhs) < rhs
-	}
-	return false
+func intLt(lhs types.Any, b types.Any) bool {
+	cmp, ok := compareNumbers(lhs, b)
+	return ok && cmp < 0
 }
 
-func intEq(lhs int64, b types.Any) bool {
-	switch t := b.(type) {
-	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		rhs, _ := utils.ToInt64(b)
-		return lhs == rhs
-	case float64, float32:
-		rhs, _ := utils.ToFloat(b)
-		return float64(lhs) == rhs
-	case bool:
-		return lhs != 0 == t
+func intEq(lhs types.Any, b types.Any) bool {
+	t, ok := b.(bool)
+	if ok {
+		value, _ := utils.ToInt64(lhs)
+		return value != 0 == t
 	}
-	return false
+
+	cmp, ok := compareNumbers(lhs, b)
+	return ok && cmp == 0
 }
 
 func (self LtDispatcher) Lt(scope types.Scope, a types.Any, b types.Any) bool {
 	a = maybeReduce(a)
 	b = maybeReduce(b)
 
+	fallback := false
+
 	switch t := a.(type) {
 	case types.Null, *types.Null, nil:
 		return false
@@ -85,12 +77,14 @@ func (self LtDispatcher) Lt(scope types.Scope, a types.Any, b types.Any) bool {
 				}
 			}
 		}
-		lhs, ok := utils.ToInt64(t)
+		return intLt(t, b)
+
+	case float64:
+		cmp, ok := compareNumbers(t, b)
 		if ok {
-			return intLt(lhs, b)
+			return cmp < 0
 		}
 
-	case float64:
 		rhs, ok := utils.ToFloat(b)
 		if ok {
 			return t < rhs
@@ -115,18 +109,28 @@ func (self LtDispatcher) Lt(scope types.Scope, a types.Any, b types.Any) bool {
 
 		// If it is integer like, coerce to int.
 	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-		rhs, ok := utils.ToInt64(t)
+		cmp, ok := compareNumbers(a, t)
 		if ok {
-			if intGt(rhs, a) {
-				return false
-			}
-			if intEq(rhs, a) {
-				return false
-			}
-			return true
+			return cmp < 0
+		}
+
+		if intGt(t, a) {
+			return false
+		}
+		if intEq(t, a) {
+			return false
 		}
 
+		// Other types are less than numbers unless an
+		// implementation handles them.
+		fallback = true
+
 	case float64:
+		cmp, ok := compareNumbers(a, t)
+		if ok {
+			return cmp < 0
+		}
+
 		lhs, ok := utils.ToFloat(a)
 		if ok {
 			return lhs < t
@@ -152,7 +156,7 @@ func (self LtDispatcher) Lt(scope types.Scope, a types.Any, b types.Any) bool {
 		}
 	}
 
-	return false
+	return fallback
 }
 
 func isTime(a types.Any) bool {
@@ -192,8 +196,27 @@ func toTime(a types.Any) (*time.Time, bool) {
 	}
 }
 
+// Applicable returns true if an implementation handles the types.
+func (self LtDispatcher) Applicable(a types.Any, b types.Any) bool {
+	for _, impl := range self.impl {
+		if impl.Applicable(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
 func (self *LtDispatcher) AddImpl(elements ...LtProtocol) {
 	for _, impl := range elements {
 		self.impl = append([]LtProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *LtDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...LtProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self LtDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
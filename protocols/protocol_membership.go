@@ -1,10 +1,13 @@
 package protocols
 
 import (
+	"context"
 	"reflect"
 	"strings"
 
+	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
 )
 
 // Membership protocol (the "in" operator)
@@ -45,6 +48,14 @@ func (self MembershipDispatcher) Membership(scope types.Scope, a types.Any, b ty
 		}
 	}
 
+	switch t := b.(type) {
+	case *ordereddict.Dict:
+		return dictMembership(scope, a, t)
+
+	case types.StoredQuery:
+		return storedQueryMembership(scope, a, t)
+	}
+
 	// Default behavior: Test lhs against each member in RHS -
 	// slow but works.
 	rt := reflect.TypeOf(b)
@@ -69,8 +80,63 @@ func (self MembershipDispatcher) Membership(scope types.Scope, a types.Any, b ty
 	return false
 }
 
+// Depending on the scope's setting a dict contains its keys or its
+// values.
+func dictMembership(scope types.Scope, a types.Any, dict *ordereddict.Dict) bool {
+	if types.GetDictMembership(scope) == types.DictMembershipValues {
+		for _, key := range dict.Keys() {
+			value, _ := dict.Get(key)
+			if scope.Eq(a, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	key, ok := utils.ToString(a)
+	if !ok {
+		return false
+	}
+	_, pres := dict.Get(key)
+	return pres
+}
+
+// The rows of a stored query are evaluated until one matches. Like
+// SQL, rows with a single column (e.g. SELECT Name FROM ...) match
+// the value of the column, other rows must equal the value.
+func storedQueryMembership(scope types.Scope, a types.Any,
+	stored_query types.StoredQuery) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	new_scope := scope.Copy()
+	defer new_scope.Close()
+
+	for row := range stored_query.Eval(ctx, new_scope) {
+		var item types.Any = row
+		members := scope.GetMembers(row)
+		if len(members) == 1 {
+			item, _ = scope.Associative(row, members[0])
+		}
+
+		if scope.Eq(a, item) {
+			return true
+		}
+	}
+	return false
+}
+
 func (self *MembershipDispatcher) AddImpl(elements ...MembershipProtocol) {
 	for _, impl := range elements {
 		self.impl = append([]MembershipProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *MembershipDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...MembershipProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self MembershipDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
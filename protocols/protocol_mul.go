@@ -85,3 +85,12 @@ func (self *MulDispatcher) AddImpl(elements ...MulProtocol) {
 		self.impl = append([]MulProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *MulDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...MulProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self MulDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"regexp"
 
+	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/types"
 )
 
@@ -38,6 +39,9 @@ func (self RegexDispatcher) Match(scope types.Scope, pattern types.Any, target t
 		switch t := target.(type) {
 		case string:
 			return Match(scope, pattern_str, t)
+
+		case types.Bytes:
+			return MatchBytes(scope, pattern_str, t)
 		}
 
 		if is_array(target) {
@@ -58,6 +62,30 @@ func (self RegexDispatcher) Match(scope types.Scope, pattern types.Any, target t
 		}
 	}
 
+	if ok && types.IsOptionEnabled(scope, types.DeepRegexOption) {
+		switch t := target.(type) {
+		case *ordereddict.Dict:
+			for _, key := range t.Keys() {
+				value, _ := t.Get(key)
+				if scope.Match(pattern, value) {
+					return true
+				}
+			}
+			return false
+
+		default:
+			a_map := reflect.ValueOf(target)
+			if a_map.Kind() == reflect.Map {
+				for _, key := range a_map.MapKeys() {
+					if scope.Match(pattern, a_map.MapIndex(key).Interface()) {
+						return true
+					}
+				}
+				return false
+			}
+		}
+	}
+
 	scope.Trace("Protocol Regex not found for %v (%T) and %v (%T)",
 		pattern, pattern, target, target)
 
@@ -70,24 +98,51 @@ func (self *RegexDispatcher) AddImpl(elements ...RegexProtocol) {
 	}
 }
 
+func (self *RegexDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...RegexProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self RegexDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
+
 func Match(scope types.Scope, pattern string, target string) bool {
+	re := compileRegex(scope, pattern)
+	if re == nil {
+		return false
+	}
+	return re.MatchString(target)
+}
+
+// MatchBytes matches the pattern against raw bytes without assuming
+// they are valid UTF-8.
+func MatchBytes(scope types.Scope, pattern string, target []byte) bool {
+	re := compileRegex(scope, pattern)
+	if re == nil {
+		return false
+	}
+	return re.Match(target)
+}
+
+// Compiled regexps are cached in the scope context.
+func compileRegex(scope types.Scope, pattern string) *regexp.Regexp {
 	var re *regexp.Regexp
 	key := "__re" + pattern
 
 	re_any, pres := scope.GetContext(key)
 	if pres {
 		re, _ = re_any.(*regexp.Regexp)
-
 	} else {
 		var err error
 		re, err = regexp.Compile("(?i)" + pattern)
 		if err != nil {
 			scope.Log("Compile regexp: %v", err)
-			return false
+			return nil
 		}
 
 		scope.SetContext(key, re)
 	}
 
-	return re.MatchString(target)
+	return re
 }
@@ -71,3 +71,12 @@ func (self *SubDispatcher) AddImpl(elements ...SubProtocol) {
 		self.impl = append([]SubProtocol{impl}, self.impl...)
 	}
 }
+
+func (self *SubDispatcher) InsertImpl(
+	anchor types.Any, after bool, elements ...SubProtocol) bool {
+	return insertImpl(&self.impl, anchor, after, elements)
+}
+
+func (self SubDispatcher) Implementations() []string {
+	return implNames(self.impl)
+}
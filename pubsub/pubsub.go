@@ -0,0 +1,113 @@
+// Package pubsub implements a simple in process event bus which
+// allows one query to feed rows into another long running query.
+//
+// The bus is stored in the scope context so it is shared between a
+// root scope and all its subscopes.
+package pubsub
+
+import (
+	"sync"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+const (
+	// The default number of rows queued for each subscriber. When a
+	// subscriber's queue is full further rows are dropped.
+	DefaultQueueSize = 1000
+
+	contextKey = "$event_bus"
+)
+
+var (
+	mu sync.Mutex
+)
+
+type subscriber struct {
+	ch      chan types.Row
+	dropped int64
+}
+
+type EventBus struct {
+	mu     sync.Mutex
+	topics map[string][]*subscriber
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		topics: make(map[string][]*subscriber),
+	}
+}
+
+// Publish delivers the row to all current subscribers of the topic
+// and returns the number of subscribers that received it. This never
+// blocks - subscribers with full queues miss the row.
+func (self *EventBus) Publish(topic string, row types.Row) int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delivered := 0
+	for _, s := range self.topics[topic] {
+		select {
+		case s.ch <- row:
+			delivered++
+		default:
+			s.dropped++
+		}
+	}
+	return delivered
+}
+
+// Subscribe returns a channel receiving rows published to the
+// topic. The caller must call the returned function to unsubscribe
+// when done, after which the channel is closed.
+func (self *EventBus) Subscribe(
+	topic string, queue_size int) (<-chan types.Row, func() int64) {
+	if queue_size <= 0 {
+		queue_size = DefaultQueueSize
+	}
+
+	s := &subscriber{ch: make(chan types.Row, queue_size)}
+
+	self.mu.Lock()
+	self.topics[topic] = append(self.topics[topic], s)
+	self.mu.Unlock()
+
+	return s.ch, func() int64 {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+
+		subscribers := self.topics[topic]
+		for i, item := range subscribers {
+			if item == s {
+				self.topics[topic] = append(subscribers[:i:i], subscribers[i+1:]...)
+				close(s.ch)
+				break
+			}
+		}
+
+		if len(self.topics[topic]) == 0 {
+			delete(self.topics, topic)
+		}
+		return s.dropped
+	}
+}
+
+// GetEventBus returns the event bus attached to the scope, creating
+// it if needed.
+func GetEventBus(scope types.Scope) *EventBus {
+	mu.Lock()
+	defer mu.Unlock()
+
+	bus_any, pres := scope.GetContext(contextKey)
+	if pres {
+		bus, ok := bus_any.(*EventBus)
+		if ok {
+			return bus
+		}
+	}
+
+	bus := NewEventBus()
+	scope.SetContext(contextKey, bus)
+	return bus
+}
@@ -0,0 +1,75 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/pubsub"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+func TestEventBusBoundedQueue(t *testing.T) {
+	bus := pubsub.NewEventBus()
+
+	// No subscribers - nothing is delivered.
+	assert.Equal(t, 0, bus.Publish("topic", 1))
+
+	events, unsubscribe := bus.Subscribe("topic", 2)
+	assert.Equal(t, 1, bus.Publish("topic", 1))
+	assert.Equal(t, 1, bus.Publish("topic", 2))
+
+	// Queue is full now so the row is dropped.
+	assert.Equal(t, 0, bus.Publish("topic", 3))
+
+	assert.Equal(t, 1, <-events)
+	assert.Equal(t, 2, <-events)
+	assert.Equal(t, int64(1), unsubscribe())
+
+	// Channel is closed after unsubscribing.
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	scope := vfilter.NewScope()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	vql, err := vfilter.Parse(`SELECT * FROM subscribe(topic="test") LIMIT 2`)
+	assert.NoError(t, err)
+
+	output := make(chan []types.Row)
+	go func() {
+		var rows []types.Row
+		for row := range vql.Eval(ctx, scope) {
+			rows = append(rows, row)
+		}
+		output <- rows
+	}()
+
+	publish, err := vfilter.Parse(
+		`SELECT publish(topic="test", row=dict(X=1)) AS Count FROM scope()`)
+	assert.NoError(t, err)
+
+	// Keep publishing until the subscriber is done.
+	for {
+		select {
+		case rows := <-output:
+			assert.Equal(t, 2, len(rows))
+			x, _ := rows[0].(*ordereddict.Dict).Get("X")
+			assert.Equal(t, int64(1), x)
+			return
+
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for subscriber")
+
+		case <-time.After(10 * time.Millisecond):
+			for range publish.Eval(ctx, scope) {
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+)
+
+// When a query only needs the first few rows of a stored query (e.g.
+// SELECT * FROM X LIMIT 5), the limit is passed down to the stored
+// query through the context. A stored query with an ORDER BY clause
+// can then keep only the top rows instead of sorting everything.
+//
+// The hint is only valid for the rows emitted directly by the stored
+// query, so each consumer clears it before evaluating anything else.
+type rowLimitKey int
+
+const rowLimitKeyValue rowLimitKey = 0
+
+func withRowLimit(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, rowLimitKeyValue, limit)
+}
+
+// Returns the row limit hint or 0 if there is none.
+func getRowLimit(ctx context.Context) int {
+	limit, _ := ctx.Value(rowLimitKeyValue).(int)
+	return limit
+}
+
+func clearRowLimit(ctx context.Context) context.Context {
+	if getRowLimit(ctx) == 0 {
+		return ctx
+	}
+	return withRowLimit(ctx, 0)
+}
+
+// EvalPage also passes down the number of rows it will skip. Where
+// each row of a source produces one row of the query, the hint flows
+// to the source: arrays start after the skipped rows and plugins
+// implementing types.RowOffsetPlugin take the offset so they do not
+// produce the skipped rows at all. The caller then only skips the
+// rows which nobody took.
+//
+// Like the limit, the hint only applies to the rows emitted directly
+// so each consumer clears it before evaluating anything else.
+type rowOffsetKey int
+
+const rowOffsetKeyValue rowOffsetKey = 0
+
+type rowOffset struct {
+	mu   sync.Mutex
+	skip int64
+}
+
+func newRowOffset(skip int64) *rowOffset {
+	return &rowOffset{skip: skip}
+}
+
+// The source takes the whole offset. It must do so before emitting
+// its first row.
+func (self *rowOffset) take() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	skip := self.skip
+	self.skip = 0
+	return skip
+}
+
+// The number of rows the caller still needs to skip. This is final
+// once the first row arrives.
+func (self *rowOffset) remaining() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.skip
+}
+
+func withRowOffset(ctx context.Context, offset *rowOffset) context.Context {
+	return context.WithValue(ctx, rowOffsetKeyValue, offset)
+}
+
+// Returns the row offset hint or nil if there is none.
+func getRowOffset(ctx context.Context) *rowOffset {
+	offset, _ := ctx.Value(rowOffsetKeyValue).(*rowOffset)
+	return offset
+}
+
+func clearRowOffset(ctx context.Context) context.Context {
+	if getRowOffset(ctx) == nil {
+		return ctx
+	}
+	return withRowOffset(ctx, nil)
+}
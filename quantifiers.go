@@ -0,0 +1,111 @@
+package vfilter
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// The any() and all() functions live here rather than in the
+// functions package because they need the lambda parser.
+
+type _QuantifierFunctionArgs struct {
+	Items  types.Any `vfilter:"required,field=items,doc=An array or a query to check"`
+	Filter string    `vfilter:"required,field=filter,doc=A lambda (e.g. x=>x > 1) applied to each item"`
+}
+
+// Apply the filter to each item until it returns stop_on. Items are
+// only evaluated until the result is known so queries are cancelled
+// early.
+func quantify(ctx context.Context, scope types.Scope,
+	args *ordereddict.Dict, name string, stop_on bool) types.Any {
+	arg := &_QuantifierFunctionArgs{}
+	err := arg_parser.ExtractArgsWithContext(ctx, scope, args, arg)
+	if err != nil {
+		scope.Log("%v: %s", name, err.Error())
+		return types.Null{}
+	}
+
+	lambda, err := ParseLambda(arg.Filter)
+	if err != nil {
+		scope.Log("%v: %s", name, err.Error())
+		return types.Null{}
+	}
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	test := func(item types.Any) bool {
+		return scope.Bool(lambda.Reduce(sub_ctx, scope, []Any{item})) == stop_on
+	}
+
+	items := arg.Items
+	lazy_expr, ok := items.(types.LazyExpr)
+	if ok {
+		items = lazy_expr.Reduce(sub_ctx)
+	}
+
+	switch t := items.(type) {
+	case types.StoredQuery:
+		for row := range t.Eval(sub_ctx, scope) {
+			if test(row) {
+				return stop_on
+			}
+		}
+
+	default:
+		if utils.IsArray(items) {
+			value := reflect.Indirect(reflect.ValueOf(items))
+			for i := 0; i < value.Len(); i++ {
+				if test(value.Index(i).Interface()) {
+					return stop_on
+				}
+			}
+
+		} else if !types.IsNil(items) {
+			if test(items) {
+				return stop_on
+			}
+		}
+	}
+
+	return !stop_on
+}
+
+type _AnyFunction struct{}
+
+func (self _AnyFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "any",
+		Doc:     "Returns true if the filter is true for any of the items.",
+		ArgType: type_map.AddType(scope, &_QuantifierFunctionArgs{}),
+	}
+}
+
+func (self _AnyFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return quantify(ctx, scope, args, "any", true)
+}
+
+type _AllFunction struct{}
+
+func (self _AllFunction) Info(scope types.Scope, type_map *types.TypeMap) *types.FunctionInfo {
+	return &types.FunctionInfo{
+		Name:    "all",
+		Doc:     "Returns true if the filter is true for all of the items.",
+		ArgType: type_map.AddType(scope, &_QuantifierFunctionArgs{}),
+	}
+}
+
+func (self _AllFunction) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) types.Any {
+	return quantify(ctx, scope, args, "all", false)
+}
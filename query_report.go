@@ -0,0 +1,116 @@
+package vfilter
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Collects a types.QueryReport for a query evaluated with
+// types.EnableQueryReports() or types.QueryReportTrailerOption. The
+// reporter is passed down to the query through the context so only
+// the work done for this query is counted, even when other queries
+// run concurrently in the same scope.
+type queryReporter struct {
+	query string
+	start time.Time
+
+	rows_scanned     uint64
+	plugins_called   uint64
+	functions_called uint64
+	rows_emitted     uint64
+}
+
+type queryReporterKey int
+
+const queryReporterKeyValue queryReporterKey = 0
+
+func newQueryReporter(query string) *queryReporter {
+	return &queryReporter{
+		query: query,
+		start: time.Now(),
+	}
+}
+
+func withQueryReporter(ctx context.Context,
+	reporter *queryReporter) context.Context {
+	return context.WithValue(ctx, queryReporterKeyValue, reporter)
+}
+
+// Returns the reporter of the query or nil if it is not reported.
+func getQueryReporter(ctx context.Context) *queryReporter {
+	reporter, _ := ctx.Value(queryReporterKeyValue).(*queryReporter)
+	return reporter
+}
+
+// Each query counts the rows it reads from plugins, including those
+// read by its subqueries, so types.QueryLimits.MaxRowsScanned applies
+// to each query separately.
+type rowsScannedKey int
+
+const rowsScannedKeyValue rowsScannedKey = 0
+
+func withRowsScanned(ctx context.Context) context.Context {
+	_, ok := ctx.Value(rowsScannedKeyValue).(*uint64)
+	if ok {
+		return ctx
+	}
+	return context.WithValue(ctx, rowsScannedKeyValue, new(uint64))
+}
+
+// Count a row read from a plugin in the scope's stats and the query's
+// report. Returns the number of rows the query has read so far.
+func countRowScanned(ctx context.Context, scope types.Scope) uint64 {
+	scope.GetStats().IncRowsScanned()
+	reporter := getQueryReporter(ctx)
+	if reporter != nil {
+		atomic.AddUint64(&reporter.rows_scanned, 1)
+	}
+
+	rows_scanned, ok := ctx.Value(rowsScannedKeyValue).(*uint64)
+	if !ok {
+		return 0
+	}
+	return atomic.AddUint64(rows_scanned, 1)
+}
+
+func countPluginCall(ctx context.Context, scope types.Scope) {
+	scope.GetStats().IncPluginsCalled()
+	reporter := getQueryReporter(ctx)
+	if reporter != nil {
+		atomic.AddUint64(&reporter.plugins_called, 1)
+	}
+}
+
+func countFunctionCall(ctx context.Context, scope types.Scope) {
+	scope.GetStats().IncFunctionsCalled()
+	reporter := getQueryReporter(ctx)
+	if reporter != nil {
+		atomic.AddUint64(&reporter.functions_called, 1)
+	}
+}
+
+func (self *queryReporter) incRowsEmitted() {
+	atomic.AddUint64(&self.rows_emitted, 1)
+}
+
+// Make the report when the query is done. Reading the memory stats
+// briefly stops the world so the heap is only sampled once per
+// reported query.
+func (self *queryReporter) report() *types.QueryReport {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return &types.QueryReport{
+		Query:           self.query,
+		RowsScanned:     atomic.LoadUint64(&self.rows_scanned),
+		RowsEmitted:     atomic.LoadUint64(&self.rows_emitted),
+		PluginsCalled:   atomic.LoadUint64(&self.plugins_called),
+		FunctionsCalled: atomic.LoadUint64(&self.functions_called),
+		Duration:        time.Since(self.start),
+		HeapAllocAtEnd:  mem.HeapAlloc,
+	}
+}
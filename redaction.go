@@ -0,0 +1,64 @@
+package vfilter
+
+import (
+	"fmt"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Replace the sensitive values in a row emitted by a query. The row
+// may be shared (e.g. from a materialized LET) so it is copied rather
+// than modified.
+func redactRow(scope types.Scope, row *ordereddict.Dict) *ordereddict.Dict {
+	policy := types.GetActiveRedactionPolicy(scope)
+	if policy == nil {
+		return row
+	}
+	return policy.RedactDict(row)
+}
+
+// Replace the sensitive values in a row produced by a plugin before
+// the query sees it. Rows other than dicts are only materialized
+// when they have a sensitive column.
+func redactInputRow(scope types.Scope,
+	policy *types.RedactionPolicy, row Row) Row {
+	dict, ok := row.(*ordereddict.Dict)
+	if ok {
+		return policy.RedactDict(dict)
+	}
+
+	members := scope.GetMembers(row)
+	sensitive := false
+	for _, column := range members {
+		if policy.IsSensitive(column, nil) {
+			sensitive = true
+			break
+		}
+	}
+	if !sensitive {
+		return policy.Redact(row)
+	}
+
+	result := ordereddict.NewDict()
+	for _, column := range members {
+		value, _ := scope.Associative(row, column)
+		result.Set(column, policy.RedactColumn(column, value))
+	}
+	return result
+}
+
+// Report the redaction policy when explaining the query.
+func explainRedaction(scope types.Scope) {
+	policy := types.GetRedactionPolicy(scope)
+	if policy == nil {
+		return
+	}
+
+	if types.IsOptionEnabled(scope, types.RedactionPrivilegeOption) {
+		scope.Explainer().Log(fmt.Sprintf(
+			"Redaction policy (%v) not applied: scope is privileged", policy))
+		return
+	}
+	scope.Explainer().Log(fmt.Sprintf("Redacting %v", policy))
+}
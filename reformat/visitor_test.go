@@ -85,6 +85,9 @@ FROM Artifact.Windows.EventLogs.EvtxHunter(EvtxGlob='''%SystemRoot%\System32\Win
 	{"Subquery", "SELECT {SELECT * FROM info()} AS Foo, Bar FROM scope()"},
 	{"Simple Statement", "SELECT A AS First, B AS Second, C, D FROM info(arg=1, arg2=3) WHERE 1 ORDER BY C LIMIT 1"},
 	{"Explain statements", "EXPLAIN SELECT 'A' FROM scope()"},
+	{"Group by having", "SELECT Name, count() AS Count FROM info() GROUP BY Name HAVING Count > 5 ORDER BY Count DESC"},
+	{"Order by with a cast", "SELECT Name, Size FROM info() ORDER BY Size::int DESC LIMIT 5"},
+	{"Group by with a cast", "SELECT Size, count() AS Count FROM info() GROUP BY Size::int"},
 }
 
 func makeTestScope() types.Scope {
@@ -0,0 +1,366 @@
+// Package repl implements an interactive VQL shell which can be
+// embedded in any tool:
+//
+//	shell := repl.NewRepl(scope, os.Stdin, os.Stdout)
+//	err := shell.Run(ctx)
+//
+// Statements may span several lines - the shell keeps reading while
+// the statement is incomplete. An empty line runs the statement
+// regardless (showing any syntax errors). LET definitions persist in
+// the scope across inputs.
+//
+// Lines starting with a backslash are commands (see \help), for
+// example to describe the available plugins or change the output
+// format.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Output formats supported by the shell.
+const (
+	FormatTable    = "table"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// A LineReader reads input lines. Tools may install a reader with
+// richer line editing (e.g. a readline library). The default reader
+// relies on the terminal's own line editing.
+type LineReader interface {
+	// ReadLine shows the prompt and returns the next line without
+	// the line ending. It returns io.EOF when there is no more
+	// input.
+	ReadLine(prompt string) (string, error)
+}
+
+type simpleLineReader struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (self *simpleLineReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(self.out, prompt)
+
+	line, err := self.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+type Repl struct {
+	Scope  types.Scope
+	Reader LineReader
+	Out    io.Writer
+
+	// One of FormatTable, FormatMarkdown or FormatJSON.
+	Format string
+
+	// Table cells wider than this are truncated.
+	MaxWidth int
+
+	Prompt             string
+	ContinuationPrompt string
+
+	history []string
+}
+
+func NewRepl(scope types.Scope, in io.Reader, out io.Writer) *Repl {
+	return &Repl{
+		Scope: scope,
+		Reader: &simpleLineReader{
+			reader: bufio.NewReader(in),
+			out:    out,
+		},
+		Out:                out,
+		Format:             FormatTable,
+		MaxWidth:           80,
+		Prompt:             "vql> ",
+		ContinuationPrompt: "...> ",
+	}
+}
+
+// Run reads and executes statements until the input ends, the
+// context is cancelled or the \quit command is given.
+func (self *Repl) Run(ctx context.Context) error {
+	lines := []string{}
+
+	for {
+		prompt := self.Prompt
+		if len(lines) > 0 {
+			prompt = self.ContinuationPrompt
+		}
+
+		line, err := self.Reader.ReadLine(prompt)
+		if err == io.EOF {
+			if len(lines) > 0 {
+				self.Execute(ctx, strings.Join(lines, "\n"))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if len(lines) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+
+			if strings.HasPrefix(trimmed, "\\") {
+				if !self.runCommand(trimmed) {
+					return nil
+				}
+				continue
+			}
+		}
+
+		// An empty line runs what we have so far.
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+			if needsMoreInput(strings.Join(lines, "\n")) {
+				continue
+			}
+		}
+
+		self.Execute(ctx, strings.Join(lines, "\n"))
+		lines = nil
+	}
+}
+
+// Execute runs the statements in the text and writes their output.
+func (self *Repl) Execute(ctx context.Context, text string) {
+	self.history = append(self.history, text)
+
+	statements, err := vfilter.MultiParse(text)
+	if err != nil {
+		fmt.Fprintf(self.Out, "Error: %v\n", err)
+		return
+	}
+
+	for _, vql := range statements {
+		// LET statements only define things in the scope.
+		if vql.Let != "" || vql.Unlet != "" {
+			for range vql.Eval(ctx, self.Scope) {
+			}
+			continue
+		}
+
+		err := self.output(ctx, vql)
+		if err != nil {
+			fmt.Fprintf(self.Out, "Error: %v\n", err)
+			return
+		}
+	}
+}
+
+func (self *Repl) output(ctx context.Context, vql *vfilter.VQL) error {
+	switch self.Format {
+	case FormatJSON:
+		serialized, err := vfilter.OutputJSON(vql, ctx, self.Scope,
+			func(rows []vfilter.Row) ([]byte, error) {
+				return json.MarshalIndent(rows, "", " ")
+			})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(self.Out, "%s\n", serialized)
+		return err
+
+	default:
+		return vfilter.OutputTable(ctx, self.Scope, vql, self.Out,
+			&vfilter.TableOptions{
+				Markdown: self.Format == FormatMarkdown,
+				MaxWidth: self.MaxWidth,
+			})
+	}
+}
+
+// A statement needs more input if it stopped parsing at the end of
+// the text, or inside an unterminated string or comment.
+func needsMoreInput(text string) bool {
+	partial := vfilter.ParsePartial(text)
+	if partial.Complete {
+		return false
+	}
+
+	rest := strings.TrimSpace(text[partial.Offset:])
+	return rest == "" ||
+		strings.HasPrefix(rest, "'") ||
+		strings.HasPrefix(rest, "\"") ||
+		strings.HasPrefix(rest, "/*")
+}
+
+// Returns false when the shell should exit.
+func (self *Repl) runCommand(line string) bool {
+	fields := strings.Fields(line)
+	command := strings.TrimPrefix(fields[0], "\\")
+	args := fields[1:]
+
+	switch command {
+	case "q", "quit":
+		return false
+
+	case "h", "help":
+		fmt.Fprint(self.Out, helpText)
+
+	case "plugins":
+		self.listNames(self.describe().Plugins, args)
+
+	case "functions":
+		self.listNames(self.describe().Functions, args)
+
+	case "d", "describe":
+		if len(args) != 1 {
+			fmt.Fprintln(self.Out, "Usage: \\describe <plugin or function>")
+			break
+		}
+		self.describeName(args[0])
+
+	case "format":
+		if len(args) == 0 {
+			fmt.Fprintf(self.Out, "Output format is %v\n", self.Format)
+			break
+		}
+		switch args[0] {
+		case FormatTable, FormatMarkdown, FormatJSON:
+			self.Format = args[0]
+		default:
+			fmt.Fprintf(self.Out, "Unknown format %v (expected %v, %v or %v)\n",
+				args[0], FormatTable, FormatMarkdown, FormatJSON)
+		}
+
+	case "history":
+		for idx, item := range self.history {
+			fmt.Fprintf(self.Out, "%3d  %v\n", idx+1, item)
+		}
+
+	default:
+		fmt.Fprintf(self.Out, "Unknown command \\%v. Try \\help\n", command)
+	}
+
+	return true
+}
+
+const helpText = `Commands:
+  \plugins [prefix]     List the available plugins.
+  \functions [prefix]   List the available functions.
+  \describe <name>      Describe a plugin or function and its args.
+  \format [name]        Show or set the output format (table, markdown or json).
+  \history              Show the statements run so far.
+  \quit                 Exit the shell.
+`
+
+func (self *Repl) describe() *types.ScopeInformation {
+	return self.Scope.Describe(types.NewTypeMap())
+}
+
+// Items are *types.PluginInfo or *types.FunctionInfo.
+func (self *Repl) listNames(items interface{}, args []string) {
+	names := []string{}
+	switch t := items.(type) {
+	case []*types.PluginInfo:
+		for _, item := range t {
+			names = append(names, item.Name)
+		}
+	case []*types.FunctionInfo:
+		for _, item := range t {
+			names = append(names, item.Name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if len(args) > 0 && !strings.HasPrefix(name, args[0]) {
+			continue
+		}
+		fmt.Fprintln(self.Out, name)
+	}
+}
+
+func (self *Repl) describeName(name string) {
+	type_map := types.NewTypeMap()
+	info := self.Scope.Describe(type_map)
+	found := false
+
+	for _, plugin := range info.Plugins {
+		if plugin.Name == name {
+			found = true
+			fmt.Fprintf(self.Out, "Plugin %v: %v\n", plugin.Name, plugin.Doc)
+			self.describeArgs(type_map, plugin.ArgType)
+		}
+	}
+
+	for _, function := range info.Functions {
+		if function.Name == name {
+			found = true
+			fmt.Fprintf(self.Out, "Function %v: %v\n", function.Name, function.Doc)
+			self.describeArgs(type_map, function.ArgType)
+		}
+	}
+
+	if !found {
+		fmt.Fprintf(self.Out, "No plugin or function named %v\n", name)
+	}
+}
+
+func (self *Repl) describeArgs(type_map *types.TypeMap, arg_type string) {
+	desc, pres := type_map.Get(self.Scope, arg_type)
+	if !pres || desc.Fields.Len() == 0 {
+		return
+	}
+
+	fmt.Fprintln(self.Out, "Args:")
+	for _, key := range desc.Fields.Keys() {
+		value, _ := desc.Fields.Get(key)
+		field, ok := value.(*types.TypeReference)
+		if !ok {
+			continue
+		}
+
+		name, doc, required := parseArgTag(key, field.Tag)
+		if required {
+			doc = "(required) " + doc
+		}
+		fmt.Fprintf(self.Out, "  %v (%v): %v\n", name, field.Target, doc)
+	}
+}
+
+// Extract the arg's name and doc from its vfilter struct tag. The doc
+// is the rest of the tag since it may contain commas.
+func parseArgTag(field_name, tag string) (name, doc string, required bool) {
+	name = field_name
+	idx := strings.Index(tag, "doc=")
+	if idx >= 0 {
+		doc = tag[idx+len("doc="):]
+		tag = tag[:idx]
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		switch {
+		case part == "required":
+			required = true
+		case strings.HasPrefix(part, "field="):
+			name = strings.TrimPrefix(part, "field=")
+		}
+	}
+	return name, doc, required
+}
@@ -0,0 +1,70 @@
+package repl_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/repl"
+)
+
+func run(t *testing.T, input string) string {
+	out := &strings.Builder{}
+	shell := repl.NewRepl(vfilter.NewScope(), strings.NewReader(input), out)
+	assert.NoError(t, shell.Run(context.Background()))
+	return out.String()
+}
+
+func TestMultiLineStatements(t *testing.T) {
+	output := run(t, `LET X = SELECT _value AS Value
+FROM range(end=3)
+SELECT * FROM X WHERE
+  Value > 0
+\format json
+SELECT 'multi
+line' AS Text FROM scope()
+SELECT * FROM
+`)
+
+	// The LET persists into the next statement.
+	assert.Contains(t, output, `vql> ...> vql> ...> +-------+
+| Value |
++-------+
+| 1     |
+| 2     |
++-------+
+`)
+
+	// Unterminated strings continue on the next line.
+	assert.Contains(t, output, `"Text": "multi\nline"`)
+
+	// An incomplete statement at the end of the input is reported.
+	assert.Contains(t, output, "Error: 1:14: unexpected token")
+}
+
+func TestCommands(t *testing.T) {
+	output := run(t, `\plugins ran
+\describe range
+\format csv
+\format markdown
+SELECT 1 AS A FROM scope()
+SELECT 1 AS A FROM foo(
+
+\history
+\quit
+SELECT 'not run' FROM scope()
+`)
+
+	assert.Contains(t, output, "vql> range\n")
+	assert.Contains(t, output, "Plugin range: Iterate over range.")
+	assert.Contains(t, output, "  end (int64): (required) ")
+	assert.Contains(t, output, "Unknown format csv")
+	assert.Contains(t, output, "| A |\n| - |\n| 1 |\n")
+
+	// The empty line runs the incomplete statement.
+	assert.Contains(t, output, "...> Error: ")
+	assert.Contains(t, output, "  2  SELECT 1 AS A FROM foo(\n")
+	assert.NotContains(t, output, "not run")
+}
@@ -0,0 +1,73 @@
+package vfilter
+
+import (
+	"time"
+
+	"www.velocidex.com/golang/vfilter/scope"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Functions available in a sandbox scope. These only compute values
+// from their args and have no side effects.
+var sandboxFunctions = []string{
+	"all", "any", "bigint", "bytes", "cidr_contains", "coalesce",
+	"contains", "count", "decimal", "dict", "difference", "encode",
+	"ends_with", "enumerate", "equals", "exists", "format",
+	"fuzzy_match", "get", "glob_match", "has_column", "if",
+	"intersect", "ip", "len", "max", "min", "runes", "split",
+	"starts_with", "str", "sum", "timestamp", "union",
+}
+
+// Plugins available in a sandbox scope.
+var sandboxPlugins = []string{
+	"chain", "flatten", "foreach", "if", "range", "scope",
+}
+
+// DefaultSandboxLimits are the limits NewSandboxScope() installs.
+func DefaultSandboxLimits() *types.QueryLimits {
+	return &types.QueryLimits{
+		MaxRowsScanned: 1000000,
+		MaxStackDepth:  100,
+		Timeout:        10 * time.Second,
+	}
+}
+
+// NewSandboxScope creates a scope for evaluating untrusted queries
+// over data provided by the host (e.g. with AppendVars()). Only pure
+// functions and plugins which read the query's own data are
+// available, operations with side effects are blocked and queries
+// run with DefaultSandboxLimits(). Set types.QueryLimitsOption to
+// change the limits.
+func NewSandboxScope() types.Scope {
+	// Take the definitions from the default scope.
+	builtins := NewScope()
+	defer builtins.Close()
+
+	functions := []types.FunctionInterface{}
+	for _, name := range sandboxFunctions {
+		function, pres := builtins.GetFunction(name)
+		if pres {
+			functions = append(functions, function)
+		}
+	}
+
+	plugins := []types.PluginGeneratorInterface{}
+	for _, name := range sandboxPlugins {
+		plugin, pres := builtins.GetPlugin(name)
+		if pres {
+			plugins = append(plugins, plugin)
+		}
+	}
+
+	result := scope.NewEmptyScope()
+	result.ReplaceDefinitions(functions, plugins)
+
+	// Nothing in the sandbox should have side effects but block
+	// them in case the host adds more plugins.
+	types.SetOption(result, types.ImpactPolicyOption, types.BlockImpact(
+		types.ImpactFilesystemRead|types.ImpactFilesystemWrite|
+			types.ImpactNetwork|types.ImpactHostSink))
+	types.SetOption(result, types.QueryLimitsOption, DefaultSandboxLimits())
+
+	return result
+}
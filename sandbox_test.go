@@ -0,0 +1,108 @@
+package vfilter
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter/plugins"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+func runSandboxQuery(t *testing.T, scope types.Scope, query string) []Row {
+	vql, err := Parse(query)
+	assert.NoError(t, err)
+
+	result := []Row{}
+	for row := range vql.Eval(context.Background(), scope) {
+		result = append(result, row)
+	}
+	return result
+}
+
+func TestSandboxScope(t *testing.T) {
+	scope := NewSandboxScope()
+	defer scope.Close()
+
+	logger := &logWriter{Writer: os.Stdout}
+	scope.SetLogger(log.New(logger, "Log: ", 0))
+	scope.AppendVars(ordereddict.NewDict().Set("Data", []int{1, 2, 3}))
+
+	// Only the allowlisted definitions are available.
+	_, pres := scope.GetPlugin("write_to")
+	assert.False(t, pres)
+	_, pres = scope.GetFunction("publish")
+	assert.False(t, pres)
+
+	rows := runSandboxQuery(t, scope,
+		"SELECT _value, all(items=Data, filter='x=>x > 0') AS All "+
+			"FROM foreach(row=Data)")
+	assert.Equal(t, 3, len(rows))
+
+	// Queries stop once too many rows are scanned.
+	types.SetOption(scope, types.QueryLimitsOption, &types.QueryLimits{MaxRowsScanned: 5})
+	rows = runSandboxQuery(t, scope, "SELECT * FROM range(end=100)")
+	assert.Equal(t, 5, len(rows))
+	logger.Contains(t, "ERROR:Query limit exceeded: more than 5 rows scanned")
+
+	// Rows read by subqueries count towards the limit.
+	rows = runSandboxQuery(t, scope, `SELECT * FROM foreach(
+   row={ SELECT * FROM range(end=3) },
+   query={ SELECT * FROM range(end=3) })`)
+	assert.True(t, len(rows) < 5)
+
+	// The limit applies to each query separately.
+	rows = runSandboxQuery(t, scope, "SELECT * FROM range(end=5)")
+	assert.Equal(t, 5, len(rows))
+
+	// Queries are cancelled when they run too long.
+	types.SetOption(scope, types.QueryLimitsOption, &types.QueryLimits{
+		Timeout: 100 * time.Millisecond})
+	scope.AppendPlugins(plugins.GenericListPlugin{
+		PluginName: "slow",
+		Function: func(ctx context.Context, scope types.Scope, args *ordereddict.Dict) []Row {
+			<-ctx.Done()
+			return nil
+		},
+	})
+
+	start := time.Now()
+	runSandboxQuery(t, scope, "SELECT * FROM slow()")
+	assert.True(t, time.Now().Sub(start) < 5*time.Second)
+	logger.Contains(t, "ERROR:Query limit exceeded: timed out after 100ms")
+}
+
+// Builtins which are deliberately not available in a sandbox. New
+// builtins must be added here or to the sandbox lists.
+var (
+	notSandboxFunctions = []string{
+		"now", "publish", "rand", "scope", "uuid", "version",
+	}
+	notSandboxPlugins = []string{
+		"functions", "head", "join", "plugins", "sample", "sort",
+		"subscribe", "tee", "vars", "with_new_aggregates", "write_to",
+	}
+)
+
+func TestSandboxCoversBuiltins(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+
+	info := scope.Describe(types.NewTypeMap())
+	for _, function := range info.Functions {
+		assert.True(t, utils.InString(&sandboxFunctions, function.Name) ||
+			utils.InString(&notSandboxFunctions, function.Name),
+			"function %v is not classified for the sandbox", function.Name)
+	}
+
+	for _, plugin := range info.Plugins {
+		assert.True(t, utils.InString(&sandboxPlugins, plugin.Name) ||
+			utils.InString(&notSandboxPlugins, plugin.Name),
+			"plugin %v is not classified for the sandbox", plugin.Name)
+	}
+}
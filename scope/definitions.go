@@ -0,0 +1,83 @@
+package scope
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// The functions and plugins known to a scope. Definitions are never
+// modified once they are published, instead changes make a new
+// copy. This allows running queries to hold on to the definitions
+// they started with (see Scope.PinDefinitions()).
+type definitions struct {
+	functions map[string]types.FunctionInterface
+	plugins   map[string]types.PluginGeneratorInterface
+
+	// A unique version for each set of definitions.
+	version uint64
+}
+
+var definitionsVersion uint64
+
+func nextDefinitionsVersion() uint64 {
+	return atomic.AddUint64(&definitionsVersion, 1)
+}
+
+func newDefinitions() *definitions {
+	return &definitions{
+		functions: make(map[string]types.FunctionInterface),
+		plugins:   make(map[string]types.PluginGeneratorInterface),
+		version:   nextDefinitionsVersion(),
+	}
+}
+
+func (self *definitions) copy() *definitions {
+	result := &definitions{
+		functions: make(map[string]types.FunctionInterface, len(self.functions)),
+		plugins:   make(map[string]types.PluginGeneratorInterface, len(self.plugins)),
+		version:   nextDefinitionsVersion(),
+	}
+
+	for k, v := range self.functions {
+		result.functions[k] = v
+	}
+
+	for k, v := range self.plugins {
+		result.plugins[k] = v
+	}
+
+	return result
+}
+
+// Holds the current definitions.
+type definitionRegistry struct {
+	mu      sync.Mutex
+	current *definitions
+}
+
+func newDefinitionRegistry(defs *definitions) *definitionRegistry {
+	return &definitionRegistry{current: defs}
+}
+
+func (self *definitionRegistry) get() *definitions {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.current
+}
+
+// Apply the changes to a copy of the current definitions and publish
+// it in one step.
+func (self *definitionRegistry) update(
+	cb func(defs *definitions)) *definitions {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	result := self.current.copy()
+	cb(result)
+	self.current = result
+
+	return result
+}
@@ -21,8 +21,7 @@ import (
 type protocolDispatcher struct {
 	sync.Mutex
 
-	functions map[string]types.FunctionInterface
-	plugins   map[string]types.PluginGeneratorInterface
+	definitions *definitionRegistry
 
 	Stats *types.Stats
 
@@ -53,6 +52,11 @@ type protocolDispatcher struct {
 	Tracer *log.Logger
 
 	context *ordereddict.Dict
+
+	plugin_middleware []types.PluginMiddleware
+
+	// Limits on concurrent plugin calls by plugin name.
+	plugin_limits map[string]pluginSemaphore
 }
 
 func (self *protocolDispatcher) SetContext(context *ordereddict.Dict) {
@@ -123,16 +127,14 @@ func (self *protocolDispatcher) GetStats() *types.Stats {
 	return self.Stats
 }
 
-func (self *protocolDispatcher) Describe(scope *Scope, type_map *types.TypeMap) *types.ScopeInformation {
-	self.Lock()
-	defer self.Unlock()
-
+func (self *protocolDispatcher) Describe(scope *Scope,
+	defs *definitions, type_map *types.TypeMap) *types.ScopeInformation {
 	result := &types.ScopeInformation{}
-	for _, item := range self.plugins {
+	for _, item := range defs.plugins {
 		result.Plugins = append(result.Plugins, item.Info(scope, type_map))
 	}
 
-	for _, func_item := range self.functions {
+	for _, func_item := range defs.functions {
 		result.Functions = append(result.Functions, func_item.Info(scope, type_map))
 	}
 
@@ -143,8 +145,7 @@ func (self *protocolDispatcher) WithNewContext() *protocolDispatcher {
 	return &protocolDispatcher{
 		Stats:        &types.Stats{},
 		context:      ordereddict.NewDict(),
-		functions:    self.functions,
-		plugins:      self.plugins,
+		definitions:  self.definitions,
 		bool:         self.bool,
 		eq:           self.eq,
 		lt:           self.lt,
@@ -166,21 +167,10 @@ func (self *protocolDispatcher) WithNewContext() *protocolDispatcher {
 }
 
 func (self *protocolDispatcher) Copy() *protocolDispatcher {
-	function_copy := make(map[string]types.FunctionInterface)
-	for k, v := range self.functions {
-		function_copy[k] = v
-	}
-
-	plugins_copy := make(map[string]types.PluginGeneratorInterface)
-	for k, v := range self.plugins {
-		plugins_copy[k] = v
-	}
-
 	return &protocolDispatcher{
 		Stats:        &types.Stats{},
 		context:      ordereddict.NewDict(),
-		functions:    function_copy,
-		plugins:      plugins_copy,
+		definitions:  newDefinitionRegistry(self.definitions.get().copy()),
 		bool:         self.bool.Copy(),
 		eq:           self.eq.Copy(),
 		lt:           self.lt.Copy(),
@@ -199,53 +189,46 @@ func (self *protocolDispatcher) Copy() *protocolDispatcher {
 		explainer:    self.explainer,
 		Logger:       self.Logger,
 		Tracer:       self.Tracer,
+
+		// The new dispatcher belongs to an independent scope
+		// so it gets its own middleware list.
+		plugin_middleware: append([]types.PluginMiddleware{},
+			self.plugin_middleware...),
+		plugin_limits: self.copyPluginLimits(),
 	}
 }
 
-func (self *protocolDispatcher) AppendPlugins(
-	scope *Scope, plugins ...types.PluginGeneratorInterface) {
-	self.Lock()
-	defer self.Unlock()
+// Add or replace the functions and plugins in one step. Returns the
+// new definitions.
+func (self *protocolDispatcher) ReplaceDefinitions(scope *Scope,
+	functions []types.FunctionInterface,
+	plugins []types.PluginGeneratorInterface) *definitions {
+	return self.definitions.update(func(defs *definitions) {
+		for _, function := range functions {
+			info := function.Info(scope, nil)
+			defs.functions[info.Name] = function
+		}
 
-	result := self
-	for _, plugin := range plugins {
-		info := plugin.Info(scope, nil)
-		result.plugins[info.Name] = plugin
-	}
+		for _, plugin := range plugins {
+			info := plugin.Info(scope, nil)
+			defs.plugins[info.Name] = plugin
+		}
+	})
 }
 
-func (self *protocolDispatcher) AppendFunctions(
-	scope *Scope, functions ...types.FunctionInterface) {
+func (self *protocolDispatcher) AddPluginMiddleware(
+	middleware types.PluginMiddleware) {
 	self.Lock()
 	defer self.Unlock()
 
-	result := self
-	for _, function := range functions {
-		info := function.Info(scope, nil)
-		result.functions[info.Name] = function
-	}
-}
-
-func (self *protocolDispatcher) GetFunction(name string) (types.FunctionInterface, bool) {
-	res, pres := self.functions[name]
-	return res, pres
-}
-
-func (self *protocolDispatcher) GetPlugin(name string) (types.PluginGeneratorInterface, bool) {
-	res, pres := self.plugins[name]
-	return res, pres
+	self.plugin_middleware = append(self.plugin_middleware, middleware)
 }
 
-func (self *protocolDispatcher) Info(scope *Scope,
-	type_map *types.TypeMap, name string) (*types.PluginInfo, bool) {
+func (self *protocolDispatcher) GetPluginMiddleware() []types.PluginMiddleware {
 	self.Lock()
 	defer self.Unlock()
 
-	if plugin, pres := self.plugins[name]; pres {
-		return plugin.Info(scope, type_map), true
-	}
-
-	return nil, false
+	return self.plugin_middleware
 }
 
 func (self *protocolDispatcher) Log(format string, a ...interface{}) {
@@ -277,48 +260,114 @@ func (self *protocolDispatcher) AddProtocolImpl(implementations ...types.Any) {
 	defer self.Unlock()
 
 	for _, imp := range implementations {
-		switch t := imp.(type) {
-		case protocols.BoolProtocol:
+		self.addProtocolImpl(imp, nil, false)
+	}
+}
+
+// Insert the implementations before or after the implementation of
+// the same type as the anchor. If the anchor does not implement the
+// same protocol the implementation is added first as usual.
+func (self *protocolDispatcher) InsertProtocolImpl(
+	anchor types.Any, after bool, implementations ...types.Any) {
+	self.Lock()
+	defer self.Unlock()
+
+	// Keep the implementations in the order given.
+	for i := range implementations {
+		imp := implementations[i]
+		if after {
+			imp = implementations[len(implementations)-i-1]
+		}
+		self.addProtocolImpl(imp, anchor, after)
+	}
+}
+
+func (self *protocolDispatcher) addProtocolImpl(
+	imp types.Any, anchor types.Any, after bool) {
+	switch t := imp.(type) {
+	case protocols.BoolProtocol:
+		if anchor == nil || !self.bool.InsertImpl(anchor, after, t) {
 			self.bool.AddImpl(t)
-		case protocols.EqProtocol:
+		}
+	case protocols.EqProtocol:
+		if anchor == nil || !self.eq.InsertImpl(anchor, after, t) {
 			self.eq.AddImpl(t)
-		case protocols.LtProtocol:
+		}
+	case protocols.LtProtocol:
+		if anchor == nil || !self.lt.InsertImpl(anchor, after, t) {
 			self.lt.AddImpl(t)
-		case protocols.GtProtocol:
+		}
+	case protocols.GtProtocol:
+		if anchor == nil || !self.gt.InsertImpl(anchor, after, t) {
 			self.gt.AddImpl(t)
-		case protocols.AddProtocol:
+		}
+	case protocols.AddProtocol:
+		if anchor == nil || !self.add.InsertImpl(anchor, after, t) {
 			self.add.AddImpl(t)
-		case protocols.SubProtocol:
+		}
+	case protocols.SubProtocol:
+		if anchor == nil || !self.sub.InsertImpl(anchor, after, t) {
 			self.sub.AddImpl(t)
-		case protocols.MulProtocol:
+		}
+	case protocols.MulProtocol:
+		if anchor == nil || !self.mul.InsertImpl(anchor, after, t) {
 			self.mul.AddImpl(t)
-		case protocols.DivProtocol:
+		}
+	case protocols.DivProtocol:
+		if anchor == nil || !self.div.InsertImpl(anchor, after, t) {
 			self.div.AddImpl(t)
-		case protocols.MembershipProtocol:
+		}
+	case protocols.MembershipProtocol:
+		if anchor == nil || !self.membership.InsertImpl(anchor, after, t) {
 			self.membership.AddImpl(t)
-		case protocols.AssociativeProtocol:
+		}
+	case protocols.AssociativeProtocol:
+		if anchor == nil || !self.associative.InsertImpl(anchor, after, t) {
 			self.associative.AddImpl(t)
-		case protocols.RegexProtocol:
+		}
+	case protocols.RegexProtocol:
+		if anchor == nil || !self.regex.InsertImpl(anchor, after, t) {
 			self.regex.AddImpl(t)
-		case protocols.IterateProtocol:
+		}
+	case protocols.IterateProtocol:
+		if anchor == nil || !self.iterator.InsertImpl(anchor, after, t) {
 			self.iterator.AddImpl(t)
-		default:
-			utils.Debug(t)
-			panic(fmt.Sprintf("Unsupported interface: %T", imp))
 		}
+	default:
+		utils.Debug(t)
+		panic(fmt.Sprintf("Unsupported interface: %T", imp))
+	}
+}
+
+// The implementations of each protocol in the order they are tried.
+func (self *protocolDispatcher) DescribeProtocols() []*types.ProtocolInformation {
+	self.Lock()
+	defer self.Unlock()
+
+	return []*types.ProtocolInformation{
+		{Protocol: "Bool", Implementations: self.bool.Implementations()},
+		{Protocol: "Eq", Implementations: self.eq.Implementations()},
+		{Protocol: "Lt", Implementations: self.lt.Implementations()},
+		{Protocol: "Gt", Implementations: self.gt.Implementations()},
+		{Protocol: "Add", Implementations: self.add.Implementations()},
+		{Protocol: "Sub", Implementations: self.sub.Implementations()},
+		{Protocol: "Mul", Implementations: self.mul.Implementations()},
+		{Protocol: "Div", Implementations: self.div.Implementations()},
+		{Protocol: "Membership", Implementations: self.membership.Implementations()},
+		{Protocol: "Associative", Implementations: self.associative.Implementations()},
+		{Protocol: "Regex", Implementations: self.regex.Implementations()},
+		{Protocol: "Iterate", Implementations: self.iterator.Implementations()},
 	}
 }
 
 // Get a list of similar sounding plugins.
-func (self *protocolDispatcher) GetSimilarPlugins(name string) []string {
+func (self *protocolDispatcher) GetSimilarPlugins(
+	defs *definitions, name string) []string {
 	result := []string{}
 	parts := strings.Split(name, "_")
 
-	self.Lock()
-	defer self.Unlock()
-
 	for _, part := range parts {
-		for k, _ := range self.plugins {
+		for k, _ := range defs.plugins {
 			if strings.Contains(k, part) && !utils.InString(&result, k) {
 				result = append(result, k)
 			}
@@ -335,8 +384,7 @@ func newprotocolDispatcher() *protocolDispatcher {
 		Sorter:       &sorter.DefaultSorter{},
 		Grouper:      &grouper.DefaultGrouper{},
 		Materializer: &materializer.DefaultMaterializer{},
-		functions:    make(map[string]types.FunctionInterface),
-		plugins:      make(map[string]types.PluginGeneratorInterface),
+		definitions:  newDefinitionRegistry(newDefinitions()),
 		context:      ordereddict.NewDict(),
 		Stats:        &types.Stats{},
 	}
@@ -0,0 +1,49 @@
+package scope
+
+import (
+	"sync"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Forks share the dispatcher (and therefore its context) with the
+// scope they were forked from. Context values set in the subscopes
+// of a fork go into the fork's own layer so they are not visible to
+// the original scope or other forks. Lookups fall through to the
+// layer of the parent fork (if the fork was made from a subscope of
+// another fork) and then to the dispatcher.
+type forkContext struct {
+	mu sync.Mutex
+
+	// Created on the first write.
+	values map[string]types.Any
+
+	parent *forkContext
+}
+
+func newForkContext(parent *forkContext) *forkContext {
+	return &forkContext{parent: parent}
+}
+
+func (self *forkContext) get(name string) (types.Any, bool) {
+	for layer := self; layer != nil; layer = layer.parent {
+		layer.mu.Lock()
+		value, pres := layer.values[name]
+		layer.mu.Unlock()
+
+		if pres {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (self *forkContext) set(name string, value types.Any) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.values == nil {
+		self.values = make(map[string]types.Any)
+	}
+	self.values[name] = value
+}
@@ -0,0 +1,78 @@
+package scope
+
+import (
+	"context"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Limits on the number of concurrent calls of plugins. The
+// semaphores are held by the dispatcher so the limits apply to all
+// subscopes (e.g. all the workers of a foreach).
+type pluginSemaphore chan bool
+
+func (self pluginSemaphore) Acquire(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case self <- true:
+		return nil
+	}
+}
+
+func (self pluginSemaphore) Release() {
+	<-self
+}
+
+func (self *protocolDispatcher) SetPluginConcurrency(name string, limit int) {
+	self.Lock()
+	defer self.Unlock()
+
+	if self.plugin_limits == nil {
+		self.plugin_limits = make(map[string]pluginSemaphore)
+	}
+
+	if limit <= 0 {
+		delete(self.plugin_limits, name)
+		return
+	}
+
+	// Calls already running release their slot in the old
+	// semaphore.
+	self.plugin_limits[name] = make(pluginSemaphore, limit)
+}
+
+func (self *protocolDispatcher) GetPluginSemaphore(
+	name string) (types.PluginSemaphore, bool) {
+	self.Lock()
+	defer self.Unlock()
+
+	semaphore, pres := self.plugin_limits[name]
+	return semaphore, pres
+}
+
+// Copy the limits with new semaphores.
+func (self *protocolDispatcher) copyPluginLimits() map[string]pluginSemaphore {
+	self.Lock()
+	defer self.Unlock()
+
+	result := make(map[string]pluginSemaphore)
+	for k, v := range self.plugin_limits {
+		result[k] = make(pluginSemaphore, cap(v))
+	}
+	return result
+}
+
+// Limit how many calls of the plugin may run at the same time in
+// this scope and all its subscopes. A limit of 0 removes the limit.
+func (self *Scope) SetPluginConcurrency(name string, limit int) {
+	if !self.checkDefinitionsWritable("SetPluginConcurrency") {
+		return
+	}
+
+	self.dispatcher.SetPluginConcurrency(name, limit)
+}
+
+func (self *Scope) GetPluginSemaphore(name string) (types.PluginSemaphore, bool) {
+	return self.dispatcher.GetPluginSemaphore(name)
+}
@@ -0,0 +1,65 @@
+package scope
+
+import (
+	"sync/atomic"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Resolve() needs the constants, the redaction policy and the query
+// limits which are stored in the scope's context. Looking them up locks the scope and
+// the dispatcher so it is too slow to do for every symbol. Instead
+// each scope keeps a snapshot of them which is only refreshed after
+// a context value changes in any scope.
+//
+// Context values are rarely changed while queries run so a single
+// counter is enough to tell when the snapshots are stale.
+var context_generation uint64
+
+func contextChanged() {
+	atomic.AddUint64(&context_generation, 1)
+}
+
+// A snapshot is never changed once taken so scope copies may share it.
+type resolveSettings struct {
+	generation uint64
+
+	// Nil if there are no constants.
+	constants map[string]types.Any
+
+	// Nil if nothing needs to be redacted.
+	redaction_policy *types.RedactionPolicy
+
+	// Scopes nested this deep may not resolve anything.
+	max_stack_depth int
+}
+
+// Returns the settings if they are still current or a new snapshot.
+func (self *Scope) refreshResolveSettings(
+	settings *resolveSettings) *resolveSettings {
+	generation := atomic.LoadUint64(&context_generation)
+	if settings != nil && settings.generation == generation {
+		return settings
+	}
+
+	// The generation is read before the context so a change made
+	// while the snapshot is taken makes it stale.
+	settings = &resolveSettings{
+		generation:       generation,
+		constants:        types.GetConstants(self),
+		redaction_policy: types.GetActiveRedactionPolicy(self),
+		max_stack_depth:  1000,
+	}
+
+	limits, ok := types.GetQueryLimits(self)
+	if ok && limits.MaxStackDepth > 0 &&
+		limits.MaxStackDepth < settings.max_stack_depth {
+		settings.max_stack_depth = limits.MaxStackDepth
+	}
+
+	self.Lock()
+	self.resolve_settings = settings
+	self.Unlock()
+
+	return settings
+}
@@ -26,6 +26,8 @@ var (
 	idx uint64
 )
 
+const sinkContextPrefix = "$sink:"
+
 // Destructors are attached to each scope in the stack - they are
 // called when scope.Close() is called.
 type _destructors struct {
@@ -87,6 +89,13 @@ type Scope struct {
 
 	vars []types.Row
 
+	// Where the names defined by AppendDefinitions() are found in
+	// vars. See varIndex.
+	var_index *varIndex
+
+	// The context values Resolve() needs. See resolveSettings.
+	resolve_settings *resolveSettings
+
 	// The dispatcher contains all items that are constant for the
 	// entire query evaluation. Pulling it into its own object
 	// make scope copy very cheap.
@@ -109,6 +118,20 @@ type Scope struct {
 
 	throttler types.Throttler
 
+	// A read only scope may not have vars or definitions added to
+	// it. Its children may add vars but not definitions since the
+	// dispatcher is shared. See ForkReadOnly().
+	read_only             bool
+	definitions_read_only bool
+
+	// Context values set in a fork's subscopes. Nil if this scope
+	// is not a fork or a subscope of one.
+	fork_context *forkContext
+
+	// If set, the functions and plugins this scope uses regardless
+	// of later changes. See PinDefinitions().
+	pinned *definitions
+
 	id uint64
 }
 
@@ -175,10 +198,25 @@ func (self *Scope) GetStats() *types.Stats {
 }
 
 func (self *Scope) GetContext(name string) (types.Any, bool) {
+	self.Lock()
+	fork_context := self.fork_context
+	self.Unlock()
+
+	if fork_context != nil {
+		value, pres := fork_context.get(name)
+		if pres {
+			return value, true
+		}
+	}
 	return self.dispatcher.GetContext(name)
 }
 
 func (self *Scope) ClearContext() {
+	if self.read_only {
+		self.Log("ERROR:ClearContext: scope is read only")
+		return
+	}
+
 	self.Lock()
 	defer self.Unlock()
 
@@ -187,15 +225,44 @@ func (self *Scope) ClearContext() {
 	// a new dispatcher object to hold the new context.
 	self.dispatcher = self.dispatcher.WithNewContext()
 	self.dispatcher.SetContext(ordereddict.NewDict())
+	self.fork_context = nil
+	contextChanged()
 }
 
+// A read only scope may not change the context since it is shared
+// with the scope it was forked from. Subscopes of a fork write to
+// the fork's own context layer instead (see ForkReadOnly()).
 func (self *Scope) SetContext(name string, value types.Any) {
+	if self.read_only {
+		self.Log("ERROR:SetContext: scope is read only")
+		return
+	}
+
 	self.Lock()
 	defer self.Unlock()
+	defer contextChanged()
 
+	if self.fork_context != nil {
+		self.fork_context.set(name, value)
+		return
+	}
 	self.dispatcher.SetContextValue(name, value)
 }
 
+func (self *Scope) RegisterSink(name string, sink types.RowSink) {
+	self.SetContext(sinkContextPrefix+name, sink)
+}
+
+func (self *Scope) GetSink(name string) (types.RowSink, bool) {
+	sink_any, pres := self.GetContext(sinkContextPrefix + name)
+	if !pres {
+		return nil, false
+	}
+
+	sink, ok := sink_any.(types.RowSink)
+	return sink, ok
+}
+
 func (self *Scope) PrintVars() string {
 	self.Lock()
 	defer self.Unlock()
@@ -232,7 +299,7 @@ func (self *Scope) Keys() []string {
 */
 
 func (self *Scope) Describe(type_map *types.TypeMap) *types.ScopeInformation {
-	return self.dispatcher.Describe(self, type_map)
+	return self.dispatcher.Describe(self, self.getDefinitions(), type_map)
 }
 
 func (self *Scope) SetThrottler(t types.Throttler) {
@@ -248,20 +315,19 @@ func (self *Scope) ChargeOp() {
 	}
 }
 
+// Returns true if the scope is nested too deeply. This usually
+// indicates a recursive definition. The caller is responsible for
+// reporting the overflow.
 func (self *Scope) CheckForOverflow() bool {
 	self.Lock()
-	vars := self.vars[:]
+	settings := self.resolve_settings
 	self.Unlock()
 
-	if self.stack_depth < 1000 {
-		return false
-	}
-
-	// Log the query for overflow
-	query, _ := self._ResolveVars("$Query", vars)
-	self.Log("Stack Overflow: %v", query)
+	return self.checkForOverflow(self.refreshResolveSettings(settings))
+}
 
-	return true
+func (self *Scope) checkForOverflow(settings *resolveSettings) bool {
+	return self.stack_depth >= settings.max_stack_depth
 }
 
 // Tests two values for equality.
@@ -281,7 +347,7 @@ func (self *Scope) Lt(a types.Any, b types.Any) bool {
 }
 
 func (self *Scope) Gt(a types.Any, b types.Any) bool {
-	return self.dispatcher.gt.Gt(self, a, b)
+	return self.dispatcher.gt.GtOrDerive(self, &self.dispatcher.lt, a, b)
 }
 
 // Add a and b together.
@@ -330,6 +396,14 @@ func (self *Scope) Iterate(ctx context.Context, a types.Any) <-chan types.Row {
 
 func (self *Scope) Materialize(ctx context.Context,
 	name string, query types.StoredQuery) types.StoredQuery {
+	tracer, ok := types.GetQueryTracer(self)
+	if ok {
+		var span types.Span
+		ctx, span = tracer.StartSpan(ctx, types.MaterializeSpan)
+		span.SetAttribute(types.NameAttribute, name)
+		defer span.End()
+	}
+
 	return self.dispatcher.Materializer.Materialize(ctx, self, name, query)
 }
 
@@ -353,12 +427,18 @@ func (self *Scope) Copy() types.Scope {
 	child_scope := &Scope{
 		dispatcher:       self.dispatcher,
 		vars:             var_copy,
+		var_index:        self.var_index,
+		resolve_settings: self.resolve_settings,
 		stack_depth:      self.stack_depth + 1,
 		parent:           self,
 		enable_explainer: self.enable_explainer,
 		throttler:        self.throttler,
 		ag_context:       nil, //  Search for context in our parent.
 		id:               NextId(),
+
+		definitions_read_only: self.read_only || self.definitions_read_only,
+		fork_context:          self.fork_context,
+		pinned:                self.pinned,
 	}
 
 	// Compact the children list lazily
@@ -383,16 +463,109 @@ func (self *Scope) Copy() types.Scope {
 	return child_scope
 }
 
+// ForkReadOnly makes a lightweight scope which shares the vars and
+// definitions of this scope without copying them. The fork may not
+// have vars, functions, plugins or protocols added to it, so many
+// forks of a prepared scope may be used by concurrent queries.
+//
+// Unlike Copy() the fork is not a child of this scope and has its
+// own aggregator context. It must be closed separately. Use
+// fork.Copy() to get a subscope which may receive vars (e.g. for LET
+// statements) or context values (e.g. types.SetOption()). Context
+// values set in the subscopes are only visible to the fork and its
+// subscopes.
+func (self *Scope) ForkReadOnly() types.Scope {
+	self.Lock()
+	defer self.Unlock()
+
+	self.GetStats().IncScopeCopy()
+
+	return &Scope{
+		dispatcher: self.dispatcher,
+
+		// The fork never appends to vars so it can share the slice.
+		vars:             self.vars[:len(self.vars):len(self.vars)],
+		var_index:        self.var_index,
+		resolve_settings: self.resolve_settings,
+		stack_depth:      self.stack_depth + 1,
+		enable_explainer: self.enable_explainer,
+		throttler:        self.throttler,
+		ag_context:       NewAggregatorCtx(),
+		read_only:        true,
+		fork_context:     newForkContext(self.fork_context),
+		pinned:           self.pinned,
+		id:               NextId(),
+	}
+}
+
+func (self *Scope) IsReadOnly() bool {
+	return self.read_only
+}
+
+// Definitions are stored in the dispatcher which is shared with the
+// scope's parents and children.
+func (self *Scope) checkDefinitionsWritable(op string) bool {
+	if self.read_only || self.definitions_read_only {
+		self.Log("ERROR:%v: scope is read only", op)
+		return false
+	}
+	return true
+}
+
 // Add various protocol implementations into this
 // scope. Implementations must be one of the supported protocols or
 // this function will panic.
 func (self *Scope) AddProtocolImpl(implementations ...types.Any) types.Scope {
+	if !self.checkDefinitionsWritable("AddProtocolImpl") {
+		return self
+	}
+
 	self.dispatcher.AddProtocolImpl(implementations...)
 	return self
 }
 
+// AddProtocolImplBefore adds the implementations so they are tried
+// before the implementation of the same type as the anchor. If the
+// anchor does not implement the same protocol this is the same as
+// AddProtocolImpl().
+func (self *Scope) AddProtocolImplBefore(
+	anchor types.Any, implementations ...types.Any) types.Scope {
+	if !self.checkDefinitionsWritable("AddProtocolImplBefore") {
+		return self
+	}
+
+	self.dispatcher.InsertProtocolImpl(anchor, false, implementations...)
+	return self
+}
+
+// AddProtocolImplAfter adds the implementations so they are tried
+// after the implementation of the same type as the anchor. If the
+// anchor does not implement the same protocol this is the same as
+// AddProtocolImpl().
+func (self *Scope) AddProtocolImplAfter(
+	anchor types.Any, implementations ...types.Any) types.Scope {
+	if !self.checkDefinitionsWritable("AddProtocolImplAfter") {
+		return self
+	}
+
+	self.dispatcher.InsertProtocolImpl(anchor, true, implementations...)
+	return self
+}
+
+// DescribeProtocols lists the implementations of each protocol in the
+// order they are tried. This helps to debug which implementation
+// handles an operator.
+func (self *Scope) DescribeProtocols() []*types.ProtocolInformation {
+	return self.dispatcher.DescribeProtocols()
+}
+
 // Append the variables in types.Row to the scope.
 func (self *Scope) AppendVars(row types.Row) types.Scope {
+	if self.read_only {
+		self.Log("ERROR:AppendVars: scope is read only")
+		return self
+	}
+
 	self.Lock()
 	defer self.Unlock()
 
@@ -403,30 +576,132 @@ func (self *Scope) AppendVars(row types.Row) types.Scope {
 	return result
 }
 
+// DefineConstants adds variables which queries can not redefine.
+// This is useful for configuration injected by the application
+// (e.g. the hostname) which user queries should not be able to
+// override. A LET or UNLET of a constant is an error and is ignored.
+// Constants apply to all scopes sharing this scope's context and are
+// resolved as the outermost vars, so plugin rows may still have
+// columns of the same name.
+func (self *Scope) DefineConstants(vars *ordereddict.Dict) types.Scope {
+	if self.read_only {
+		self.Log("ERROR:DefineConstants: scope is read only")
+		return self
+	}
+
+	types.AddConstants(self, vars)
+	return self.AppendVars(vars)
+}
+
 // Add client function implementations to the scope. Queries using
 // this scope can call these functions from within VQL queries.
 func (self *Scope) AppendFunctions(functions ...types.FunctionInterface) types.Scope {
-	self.dispatcher.AppendFunctions(self, functions...)
+	if !self.checkDefinitionsWritable("AppendFunctions") {
+		return self
+	}
+
+	self.replaceDefinitions(functions, nil)
 	return self
 }
 
 // Add plugins (data sources) to the scope. VQL queries may select
 // from these newly added plugins.
 func (self *Scope) AppendPlugins(plugins ...types.PluginGeneratorInterface) types.Scope {
-	self.dispatcher.AppendPlugins(self, plugins...)
+	if !self.checkDefinitionsWritable("AppendPlugins") {
+		return self
+	}
+
+	self.replaceDefinitions(nil, plugins)
 	return self
 }
 
+// ReplaceDefinitions atomically adds or replaces the functions and
+// plugins with the same names. This allows definitions to be reloaded
+// while queries are running: Queries started afterwards use the new
+// definitions while queries already running keep the definitions
+// they started with.
+func (self *Scope) ReplaceDefinitions(
+	functions []types.FunctionInterface,
+	plugins []types.PluginGeneratorInterface) {
+	if !self.checkDefinitionsWritable("ReplaceDefinitions") {
+		return
+	}
+
+	self.replaceDefinitions(functions, plugins)
+}
+
+func (self *Scope) replaceDefinitions(
+	functions []types.FunctionInterface,
+	plugins []types.PluginGeneratorInterface) {
+	defs := self.dispatcher.ReplaceDefinitions(self, functions, plugins)
+
+	// A pinned scope should see its own changes.
+	self.Lock()
+	if self.pinned != nil {
+		self.pinned = defs
+	}
+	self.Unlock()
+}
+
+// PinDefinitions makes the scope and its future children keep using
+// the current functions and plugins even if they are replaced
+// later. VQL pins the definitions for each query it runs.
+func (self *Scope) PinDefinitions() {
+	defs := self.dispatcher.definitions.get()
+
+	self.Lock()
+	self.pinned = defs
+	self.Unlock()
+}
+
+// DefinitionsVersion changes when the functions and plugins seen by
+// this scope change.
+func (self *Scope) DefinitionsVersion() uint64 {
+	return self.getDefinitions().version
+}
+
+func (self *Scope) getDefinitions() *definitions {
+	self.Lock()
+	defs := self.pinned
+	self.Unlock()
+
+	if defs != nil {
+		return defs
+	}
+	return self.dispatcher.definitions.get()
+}
+
+// Middleware is called for every plugin call in this scope and the
+// subscopes which share its dispatcher (including subscopes made
+// before the middleware was added). See types.PluginMiddleware.
+func (self *Scope) AddPluginMiddleware(middleware types.PluginMiddleware) {
+	if !self.checkDefinitionsWritable("AddPluginMiddleware") {
+		return
+	}
+
+	self.dispatcher.AddPluginMiddleware(middleware)
+}
+
+func (self *Scope) GetPluginMiddleware() []types.PluginMiddleware {
+	return self.dispatcher.GetPluginMiddleware()
+}
+
 func (self *Scope) GetFunction(name string) (types.FunctionInterface, bool) {
-	return self.dispatcher.GetFunction(name)
+	res, pres := self.getDefinitions().functions[name]
+	return res, pres
 }
 
 func (self *Scope) GetPlugin(name string) (types.PluginGeneratorInterface, bool) {
-	return self.dispatcher.GetPlugin(name)
+	res, pres := self.getDefinitions().plugins[name]
+	return res, pres
 }
 
 func (self *Scope) Info(type_map *types.TypeMap, name string) (*types.PluginInfo, bool) {
-	return self.dispatcher.Info(self, type_map, name)
+	plugin, pres := self.GetPlugin(name)
+	if !pres {
+		return nil, false
+	}
+	return plugin.Info(self, type_map), true
 }
 
 func (self *Scope) Log(format string, a ...interface{}) {
@@ -455,6 +730,42 @@ func (self *Scope) Sort(
 	return self.dispatcher.Sorter.Sort(ctx, scope, input, key, desc)
 }
 
+// SortTopN sorts the input but only emits the first limit rows. If
+// the installed sorter does not support this, all rows are sorted and
+// the output is truncated.
+func (self *Scope) SortTopN(
+	ctx context.Context, scope types.Scope, input <-chan types.Row,
+	key string, desc bool, limit int) <-chan types.Row {
+	top_n_sorter, ok := self.dispatcher.Sorter.(types.TopNSorter)
+	if ok {
+		return top_n_sorter.SortTopN(ctx, scope, input, key, desc, limit)
+	}
+
+	output_chan := make(chan types.Row)
+	go func() {
+		defer close(output_chan)
+
+		sub_ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		count := 0
+		for row := range self.dispatcher.Sorter.Sort(
+			sub_ctx, scope, input, key, desc) {
+			if count >= limit {
+				return
+			}
+			count++
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+	return output_chan
+}
+
 func (self *Scope) Group(
 	ctx context.Context, scope types.Scope, actor types.GroupbyActor) <-chan types.Row {
 	return self.dispatcher.Grouper.Group(ctx, scope, actor)
@@ -570,6 +881,20 @@ func (self *Scope) Close() {
 // own specialized protocols, functions and plugins to specialize
 // their scope objects.
 func NewScope() *Scope {
+	result := NewEmptyScope()
+
+	// Add Builtin functions and plugins
+	result.dispatcher.ReplaceDefinitions(result,
+		append(functions.GetBuiltinFunctions(), _GetVersion{}),
+		plugins.GetBuiltinPlugins())
+
+	return result
+}
+
+// NewEmptyScope creates a scope with the builtin protocols but no
+// functions or plugins. This is useful to control exactly which
+// functions and plugins queries may call.
+func NewEmptyScope() *Scope {
 	dispatcher := newprotocolDispatcher()
 
 	result := &Scope{
@@ -578,17 +903,16 @@ func NewScope() *Scope {
 		id:         NextId(),
 	}
 
-	// Add Builtin protocols, functions, and plugins
+	// Add Builtin protocols
 	dispatcher.AddProtocolImpl(protocols.GetBuiltinTypes()...)
-	dispatcher.AppendFunctions(result, functions.GetBuiltinFunctions()...)
-	dispatcher.AppendPlugins(result, plugins.GetBuiltinPlugins()...)
-	dispatcher.AppendFunctions(result, _GetVersion{})
 
 	result.AppendVars(
 		ordereddict.NewDict().
 			Set("NULL", types.Null{}))
 
 	dispatcher.AddProtocolImpl(materializer.InMemoryMatrializer{})
+	dispatcher.AddProtocolImpl(materializer.ExpiringRowsProtocol{})
+	dispatcher.AddProtocolImpl(materializer.FileRowsProtocol{})
 
 	return result
 }
@@ -632,42 +956,114 @@ func (self *Scope) Explainer() types.Explainer {
 
 // Fetch the field from the scope variables.
 func (self *Scope) Resolve(field string) (interface{}, bool) {
-	if self.CheckForOverflow() {
+	// Snapshot the vars to remove the need to lock the scope for so
+	// long. The index always describes the vars it was taken with.
+	self.Lock()
+	vars := self.vars[:]
+	index := self.var_index
+	settings := self.resolve_settings
+	self.Unlock()
+
+	settings = self.refreshResolveSettings(settings)
+	if self.checkForOverflow(settings) {
 		return types.Null{}, false
 	}
 
-	// Snapshot the vars to remove the need to lock the scope for so
-	// long.
+	value, pres := self.resolve(field, vars, index, settings)
+
+	// Sensitive values are redacted before the query sees them.
+	if pres && settings.redaction_policy != nil {
+		value = settings.redaction_policy.RedactColumn(field, value)
+	}
+	return value, pres
+}
+
+func (self *Scope) resolve(field string, vars []types.Row,
+	index *varIndex, settings *resolveSettings) (interface{}, bool) {
+	value, pres := self._ResolveVars(field, vars, index)
+	if pres {
+		return value, pres
+	}
+
+	// Constants are also visible to scopes copied before they were
+	// defined.
+	constant, pres := settings.constants[field]
+	if pres {
+		return resolvedValue(constant)
+	}
+	return value, false
+}
+
+func (self *Scope) VarNames() []string {
 	self.Lock()
 	vars := self.vars[:]
 	self.Unlock()
 
-	return self._ResolveVars(field, vars)
+	// Walk the scope stack in reverse so only the most recent
+	// definition of each name counts.
+	seen := make(map[string]bool)
+	var result []string
+	for i := len(vars) - 1; i >= 0; i-- {
+		for _, name := range self.GetMembers(vars[i]) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			// Internal variables are not interesting.
+			if strings.HasPrefix(name, "$") {
+				continue
+			}
+
+			value, _ := self.Associative(vars[i], name)
+			_, unbound := value.(types.Unbound)
+			if !unbound {
+				result = append(result, name)
+			}
+		}
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
 }
 
-func (self *Scope) _ResolveVars(field string, vars []types.Row) (interface{}, bool) {
+func (self *Scope) _ResolveVars(field string, vars []types.Row,
+	index *varIndex) (interface{}, bool) {
 	var default_value types.Any
 
+	// The definition level holding the name, and the definition
+	// levels which can be skipped.
+	defined_level := -1
+	var levels []int
+	if index != nil {
+		level, pres := index.names[field]
+		if pres {
+			defined_level = level
+		}
+		levels = index.levels
+	}
+	next_level := len(levels) - 1
+
 	// Walk the scope stack in reverse so more recent vars shadow
-	// older ones.
+	// older ones. Vars may be changed after they are added to the
+	// scope (e.g. a dict passed to AppendVars) so every level which
+	// is not a definition is searched each time.
 	for i := len(vars) - 1; i >= 0; i-- {
-		subscope := vars[i]
+		if next_level >= 0 && levels[next_level] == i {
+			next_level--
+			if i != defined_level {
+				continue
+			}
+		}
 
 		// Allow each subscope to specify a default. In the
 		// end if a default was found then return Resolve as
 		// present.
-		element, pres := self.Associative(subscope, field)
+		element, pres := self.Associative(vars[i], field)
 		if pres {
-			// Do not allow go nil to be emitted into the
-			// query - this leads to various panics and
-			// does not interact well with the reflect
-			// package. It is better to emit vfilter types.Null{}
-			// objects which do the right thing when
-			// participating in protocols.
-			if element == nil {
-				element = types.Null{}
-			}
-			return element, true
+			return resolvedValue(element)
 		}
 
 		// Default value of inner most scope will prevail.
@@ -679,6 +1075,24 @@ func (self *Scope) _ResolveVars(field string, vars []types.Row) (interface{}, bo
 	return default_value, default_value != nil
 }
 
+func resolvedValue(element types.Any) (interface{}, bool) {
+	// The variable was removed by UNLET.
+	_, ok := element.(types.Unbound)
+	if ok {
+		return nil, false
+	}
+
+	// Do not allow go nil to be emitted into the query - this
+	// leads to various panics and does not interact well with the
+	// reflect package. It is better to emit vfilter types.Null{}
+	// objects which do the right thing when participating in
+	// protocols.
+	if element == nil {
+		element = types.Null{}
+	}
+	return element, true
+}
+
 // Scope Associative
 type _ScopeAssociative struct{}
 
@@ -1,14 +1,18 @@
 package scope_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/sebdah/goldie/v2"
+	"github.com/stretchr/testify/assert"
 	"www.velocidex.com/golang/vfilter"
 	"www.velocidex.com/golang/vfilter/arg_parser"
 	"www.velocidex.com/golang/vfilter/functions"
@@ -231,3 +235,464 @@ func logMarkers(format string, args ...interface{}) {
 
 	markers = append(markers, fmt.Sprintf(format, args...))
 }
+
+func TestForkReadOnly(t *testing.T) {
+	ctx := context.Background()
+	scope := vfilter.NewScope()
+	scope.AppendVars(ordereddict.NewDict().Set("X", 1))
+
+	vql, err := vfilter.Parse("LET Y = X + 1")
+	assert.NoError(t, err)
+	for range vql.Eval(ctx, scope) {
+	}
+
+	query, err := vfilter.Parse("SELECT X, Y, count() AS Count FROM range(start=1, end=10) GROUP BY 1")
+	assert.NoError(t, err)
+
+	// Many forks of the same scope may run queries concurrently.
+	var wg sync.WaitGroup
+	results := make([]*ordereddict.Dict, 10)
+	for i := 0; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			fork := scope.ForkReadOnly()
+			defer fork.Close()
+
+			for row := range query.Eval(ctx, fork) {
+				results[i] = dict.RowToDict(ctx, fork, row)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		serialized, err := json.Marshal(result)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"X":1,"Y":2,"Count":9}`, string(serialized))
+	}
+
+	// Forks refuse new vars and definitions.
+	fork := scope.ForkReadOnly()
+	defer fork.Close()
+
+	assert.True(t, fork.IsReadOnly())
+	fork.AppendVars(ordereddict.NewDict().Set("Z", 3))
+	_, pres := fork.Resolve("Z")
+	assert.False(t, pres)
+
+	fork.AppendFunctions(DestructorFunction{})
+	_, pres = scope.GetFunction("destructor")
+	assert.False(t, pres)
+
+	// Subscopes of the fork may receive vars but not definitions.
+	subscope := fork.Copy()
+	assert.False(t, subscope.IsReadOnly())
+	subscope.AppendVars(ordereddict.NewDict().Set("Z", 3))
+	_, pres = subscope.Resolve("Z")
+	assert.True(t, pres)
+
+	subscope.AppendPlugins(&DestructorPlugin{})
+	_, pres = scope.GetPlugin("destructor")
+	assert.False(t, pres)
+
+	// The original scope is unaffected.
+	_, pres = scope.Resolve("Z")
+	assert.False(t, pres)
+}
+
+func TestForkContext(t *testing.T) {
+	logs := &bytes.Buffer{}
+	scope := vfilter.NewScope()
+	scope.SetLogger(log.New(logs, "", 0))
+	scope.SetContext("A", 1)
+
+	// The fork itself may not change the context.
+	fork := scope.ForkReadOnly()
+	defer fork.Close()
+
+	fork.SetContext("B", 2)
+	_, pres := fork.GetContext("B")
+	assert.False(t, pres)
+	assert.Contains(t, logs.String(), "SetContext: scope is read only")
+
+	types.SetOption(fork, types.StrictBoolOption, true)
+	assert.False(t, types.IsOptionEnabled(fork, types.StrictBoolOption))
+
+	// Subscopes of the fork write to the fork's own context.
+	subscope := fork.Copy()
+	subscope.SetContext("A", 3)
+	types.SetOption(subscope, types.StrictBoolOption, true)
+
+	value, _ := subscope.GetContext("A")
+	assert.Equal(t, 3, value)
+	value, _ = fork.GetContext("A")
+	assert.Equal(t, 3, value)
+	assert.True(t, types.IsOptionEnabled(fork, types.StrictBoolOption))
+
+	// The original scope and other forks are unaffected.
+	value, _ = scope.GetContext("A")
+	assert.Equal(t, 1, value)
+	assert.False(t, types.IsOptionEnabled(scope, types.StrictBoolOption))
+
+	other := scope.ForkReadOnly()
+	defer other.Close()
+
+	value, _ = other.GetContext("A")
+	assert.Equal(t, 1, value)
+	assert.False(t, types.IsOptionEnabled(other, types.StrictBoolOption))
+
+	// Column metadata is recorded in the fork's context too.
+	types.SetColumnMetadata(subscope, "Size", &types.ColumnMetadata{Units: "bytes"})
+	assert.Equal(t, 1, len(types.GetColumnMetadata(fork)))
+	assert.Equal(t, 0, len(types.GetColumnMetadata(scope)))
+}
+
+// Emits a row, then waits to be released before emitting another.
+type GatePlugin struct {
+	release chan bool
+}
+
+func (self GatePlugin) Call(
+	ctx context.Context, scope types.Scope, args *ordereddict.Dict) <-chan types.Row {
+	output_chan := make(chan types.Row)
+
+	go func() {
+		defer close(output_chan)
+
+		output_chan <- ordereddict.NewDict().Set("Row", 1)
+		select {
+		case <-ctx.Done():
+			return
+		case <-self.release:
+		}
+		output_chan <- ordereddict.NewDict().Set("Row", 2)
+	}()
+
+	return output_chan
+}
+
+func (self GatePlugin) Info(scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name: "gate",
+	}
+}
+
+func versionFunction(version string) types.FunctionInterface {
+	return vfilter.GenericFunction{
+		FunctionName: "impl",
+		Function: func(ctx context.Context, scope types.Scope,
+			args *ordereddict.Dict) types.Any {
+			return version
+		},
+	}
+}
+
+func TestReplaceDefinitions(t *testing.T) {
+	ctx := context.Background()
+	gate := GatePlugin{release: make(chan bool)}
+	scope := vfilter.NewScope().
+		AppendFunctions(versionFunction("v1")).
+		AppendPlugins(gate)
+
+	vql, err := vfilter.Parse("SELECT Row, impl() AS Version FROM gate()")
+	assert.NoError(t, err)
+
+	run_query := func(reload bool) []string {
+		result := []string{}
+		for row := range vql.Eval(ctx, scope) {
+			serialized, err := json.Marshal(dict.RowToDict(ctx, scope, row))
+			assert.NoError(t, err)
+			result = append(result, string(serialized))
+
+			if len(result) == 1 {
+				// Reload the function while the query is running.
+				if reload {
+					scope.ReplaceDefinitions([]types.FunctionInterface{
+						versionFunction("v2")}, nil)
+				}
+				gate.release <- true
+			}
+		}
+		return result
+	}
+
+	// The running query keeps the old version.
+	assert.Equal(t, []string{
+		`{"Row":1,"Version":"v1"}`,
+		`{"Row":2,"Version":"v1"}`,
+	}, run_query(true))
+
+	// New queries get the new version.
+	assert.Equal(t, []string{
+		`{"Row":1,"Version":"v2"}`,
+		`{"Row":2,"Version":"v2"}`,
+	}, run_query(false))
+}
+
+func TestResolveShadowing(t *testing.T) {
+	scope := vfilter.NewScope()
+	for i := 0; i < 10; i++ {
+		scope.AppendVars(ordereddict.NewDict().
+			Set(fmt.Sprintf("Var%d", i), i).Set("Shadowed", i))
+	}
+
+	resolve := func(scope types.Scope, name string) types.Any {
+		value, pres := scope.Resolve(name)
+		if !pres {
+			return "missing"
+		}
+		return value
+	}
+
+	// Resolving again gives the same result.
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 2, resolve(scope, "Var2"))
+		assert.Equal(t, 9, resolve(scope, "Shadowed"))
+		assert.Equal(t, "missing", resolve(scope, "Unknown"))
+	}
+
+	// Subscopes see their own vars first.
+	subscope := scope.Copy()
+	subscope.AppendVars(ordereddict.NewDict().Set("Shadowed", "sub"))
+	assert.Equal(t, 2, resolve(subscope, "Var2"))
+	assert.Equal(t, "sub", resolve(subscope, "Shadowed"))
+
+	// New vars shadow older ones.
+	for i := 0; i < 10; i++ {
+		scope.AppendVars(ordereddict.NewDict().Set("Var2", fmt.Sprintf("new %d", i)))
+		assert.Equal(t, fmt.Sprintf("new %d", i), resolve(scope, "Var2"))
+	}
+
+	// The subscope still sees the vars at the time it was copied.
+	assert.Equal(t, 2, resolve(subscope, "Var2"))
+
+	// Names removed by UNLET are not found.
+	scope.AppendVars(ordereddict.NewDict().Set("Var3", types.Unbound{}))
+	assert.Equal(t, "missing", resolve(scope, "Var3"))
+	assert.Equal(t, 3, resolve(subscope, "Var3"))
+
+	// A default is used only when the name is not found.
+	scope.AppendVars(ordereddict.NewDict().SetDefault("default"))
+	assert.Equal(t, "default", resolve(scope, "Unknown"))
+	assert.Equal(t, 4, resolve(scope, "Var4"))
+}
+
+type money struct{ cents int64 }
+
+// Adds money to numbers.
+type moneyAdder struct{ name string }
+
+func (self moneyAdder) Applicable(a types.Any, b types.Any) bool {
+	_, ok := a.(money)
+	return ok
+}
+
+func (self moneyAdder) Add(scope types.Scope, a types.Any, b types.Any) types.Any {
+	return self.name
+}
+
+type fallbackAdder struct{}
+
+func (self fallbackAdder) Applicable(a types.Any, b types.Any) bool {
+	return true
+}
+
+func (self fallbackAdder) Add(scope types.Scope, a types.Any, b types.Any) types.Any {
+	return "fallback"
+}
+
+type firstAdder struct{ moneyAdder }
+type secondAdder struct{ moneyAdder }
+
+func addImpls(scope types.Scope) []string {
+	for _, info := range scope.DescribeProtocols() {
+		if info.Protocol == "Add" {
+			return info.Implementations
+		}
+	}
+	return nil
+}
+
+func TestProtocolOrdering(t *testing.T) {
+	scope := vfilter.NewScope()
+	defer scope.Close()
+
+	builtin := addImpls(scope)
+
+	scope.AddProtocolImpl(fallbackAdder{})
+	assert.Equal(t, "fallback", scope.Add(money{}, 1))
+
+	// An implementation added after the fallback is never reached.
+	scope.AddProtocolImplAfter(fallbackAdder{}, moneyAdder{name: "money"})
+	assert.Equal(t, "fallback", scope.Add(money{}, 1))
+
+	// Several implementations keep their order.
+	scope.AddProtocolImplBefore(fallbackAdder{},
+		firstAdder{moneyAdder{name: "first"}},
+		secondAdder{moneyAdder{name: "second"}})
+	assert.Equal(t, "first", scope.Add(money{}, 1))
+
+	assert.Equal(t, append([]string{
+		"scope_test.firstAdder",
+		"scope_test.secondAdder",
+		"scope_test.fallbackAdder",
+		"scope_test.moneyAdder",
+	}, builtin...), addImpls(scope))
+
+	// Without the anchor the implementation is added first.
+	scope.AddProtocolImplAfter(money{}, moneyAdder{name: "money"})
+	assert.Equal(t, "money", scope.Add(money{}, 1))
+}
+
+type version struct{ major int64 }
+
+// Only implements Lt. Versions compare with versions and numbers.
+type versionLt struct{}
+
+func (self versionLt) Applicable(a types.Any, b types.Any) bool {
+	_, ok := a.(version)
+	return ok
+}
+
+func (self versionLt) Lt(scope types.Scope, a types.Any, b types.Any) bool {
+	switch t := b.(type) {
+	case version:
+		return a.(version).major < t.major
+	case int64:
+		return a.(version).major < t
+	}
+	return false
+}
+
+type versionEq struct{}
+
+func (self versionEq) Applicable(a types.Any, b types.Any) bool {
+	_, ok := a.(version)
+	return ok
+}
+
+func (self versionEq) Eq(scope types.Scope, a types.Any, b types.Any) bool {
+	switch t := b.(type) {
+	case version:
+		return a.(version).major == t.major
+	case int64:
+		return a.(version).major == t
+	}
+	return false
+}
+
+func TestGtDerivedFromLt(t *testing.T) {
+	scope := vfilter.NewScope()
+	defer scope.Close()
+	scope.AddProtocolImpl(versionLt{}, versionEq{})
+
+	for _, item := range []struct {
+		a, b       types.Any
+		lt, eq, gt bool
+	}{
+		{version{1}, version{2}, true, false, false},
+		{version{2}, version{2}, false, true, false},
+		{version{3}, version{2}, false, false, true},
+		{version{3}, int64(2), false, false, true},
+		{version{2}, int64(2), false, true, false},
+		{version{1}, int64(2), true, false, false},
+	} {
+		assert.Equal(t, item.lt, scope.Lt(item.a, item.b), "%v < %v", item.a, item.b)
+		assert.Equal(t, item.eq, scope.Eq(item.a, item.b), "%v = %v", item.a, item.b)
+		assert.Equal(t, item.gt, scope.Gt(item.a, item.b), "%v > %v", item.a, item.b)
+	}
+}
+
+// Vars may be changed after they are added to the scope.
+func TestResolveMutableVars(t *testing.T) {
+	env := ordereddict.NewDict()
+	scope := vfilter.NewScope()
+	scope.AppendVars(ordereddict.NewDict().Set("X", 1))
+	scope.AppendVars(env)
+
+	value, pres := scope.Resolve("X")
+	assert.True(t, pres)
+	assert.Equal(t, 1, value)
+
+	env.Set("X", 2)
+	value, pres = scope.Resolve("X")
+	assert.True(t, pres)
+	assert.Equal(t, 2, value)
+}
+
+// Definitions are indexed while other vars are searched each time.
+func TestResolveDefinitions(t *testing.T) {
+	scope := vfilter.NewScope()
+	env := ordereddict.NewDict()
+	scope.AppendVars(env)
+	for i := 0; i < 10; i++ {
+		scope.AppendDefinitions(ordereddict.NewDict().
+			Set(fmt.Sprintf("Def%d", i), i).
+			Set("Shadowed", i))
+	}
+
+	resolve := func(scope types.Scope, name string) types.Any {
+		value, pres := scope.Resolve(name)
+		if !pres {
+			return "missing"
+		}
+		return value
+	}
+
+	assert.Equal(t, 2, resolve(scope, "Def2"))
+	assert.Equal(t, 9, resolve(scope, "Shadowed"))
+	assert.Equal(t, "missing", resolve(scope, "Unknown"))
+
+	// Vars below the definitions may still change.
+	env.Set("Unknown", "env")
+	assert.Equal(t, "env", resolve(scope, "Unknown"))
+
+	// Vars above the definitions shadow them.
+	subscope := scope.Copy()
+	row := ordereddict.NewDict()
+	subscope.AppendVars(row)
+	assert.Equal(t, 9, resolve(subscope, "Shadowed"))
+	row.Set("Shadowed", "row")
+	assert.Equal(t, "row", resolve(subscope, "Shadowed"))
+
+	// Definitions added to the subscope are not seen by its parent.
+	subscope.AppendDefinitions(ordereddict.NewDict().Set("Def2", "sub"))
+	assert.Equal(t, "sub", resolve(subscope, "Def2"))
+	assert.Equal(t, 2, resolve(scope, "Def2"))
+
+	// Definitions added to the parent are not seen by the subscope
+	// which was copied before.
+	scope.AppendDefinitions(ordereddict.NewDict().Set("Def3", types.Unbound{}))
+	assert.Equal(t, "missing", resolve(scope, "Def3"))
+	assert.Equal(t, 3, resolve(subscope, "Def3"))
+	assert.Equal(t, "row", resolve(subscope, "Shadowed"))
+}
+
+// Resolve() keeps a snapshot of the context values it needs which
+// must follow changes made after the scope was first used.
+func TestResolveSettings(t *testing.T) {
+	scope := vfilter.NewScope()
+	scope.AppendVars(ordereddict.NewDict().Set("Password", "hunter2"))
+	subscope := scope.Copy()
+
+	value, _ := subscope.Resolve("Password")
+	assert.Equal(t, "hunter2", value)
+
+	types.SetOption(scope, types.RedactionPolicyOption, &types.RedactionPolicy{
+		Columns: []string{"Password"},
+	})
+	value, _ = subscope.Resolve("Password")
+	assert.Equal(t, types.RedactedMarker, value)
+
+	scope.DefineConstants(ordereddict.NewDict().Set("Hostname", "server1"))
+	value, _ = subscope.Resolve("Hostname")
+	assert.Equal(t, "server1", value)
+
+	types.SetOption(scope, types.QueryLimitsOption, &types.QueryLimits{
+		MaxStackDepth: 1})
+	assert.True(t, subscope.CheckForOverflow())
+	_, pres := subscope.Resolve("Hostname")
+	assert.False(t, pres)
+}
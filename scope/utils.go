@@ -2,5 +2,5 @@ package scope
 
 // Get a list of similar sounding plugins.
 func (self *Scope) GetSimilarPlugins(name string) []string {
-	return self.dispatcher.GetSimilarPlugins(name)
+	return self.dispatcher.GetSimilarPlugins(self.getDefinitions(), name)
 }
@@ -0,0 +1,69 @@
+package scope
+
+import (
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Resolving a symbol walks the vars stack from the most recent vars
+// calling Associative on each level. Queries resolve the same names
+// for every row, usually from LET definitions deep in the stack.
+//
+// Vars added with AppendVars() may be changed after they are added
+// (e.g. a dict the host keeps updating) so they are searched every
+// time. Levels added with AppendDefinitions() never change, so the
+// varIndex records which names they define. Resolve() only calls
+// Associative on the definition level which holds the name and skips
+// all other definition levels.
+//
+// An index is never changed once built. Appending a definition makes
+// a new index so scope copies sharing the old one are not affected.
+type varIndex struct {
+	// The position in vars of the most recent definition of each
+	// name.
+	names map[string]int
+
+	// The positions in vars of all definition levels in ascending
+	// order.
+	levels []int
+}
+
+// Returns a new index which also includes the definition level at
+// position level.
+func (self *varIndex) add(level int, names []string) *varIndex {
+	result := &varIndex{
+		names: make(map[string]int),
+	}
+
+	if self != nil {
+		for k, v := range self.names {
+			result.names[k] = v
+		}
+		result.levels = append(result.levels, self.levels...)
+	}
+
+	for _, name := range names {
+		result.names[name] = level
+	}
+	result.levels = append(result.levels, level)
+
+	return result
+}
+
+// AppendDefinitions adds vars to the scope which must not be changed
+// afterwards, such as those defined by LET. This allows Resolve() to
+// find them without searching every level.
+func (self *Scope) AppendDefinitions(vars *ordereddict.Dict) types.Scope {
+	if self.read_only {
+		self.Log("ERROR:AppendDefinitions: scope is read only")
+		return self
+	}
+
+	self.Lock()
+	defer self.Unlock()
+
+	self.var_index = self.var_index.add(len(self.vars), vars.Keys())
+	self.vars = append(self.vars, vars)
+
+	return self
+}
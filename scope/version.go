@@ -40,19 +40,14 @@ func (self _GetVersion) Call(ctx context.Context,
 	}
 
 	if arg.Plugin != "" {
-		scope.dispatcher.Lock()
-		plugin, pres := scope.dispatcher.plugins[arg.Plugin]
-		scope.dispatcher.Unlock()
-
+		plugin, pres := scope.GetPlugin(arg.Plugin)
 		if pres {
 			return plugin.Info(scope, nil).Version
 		}
 		return types.Null{}
 
 	} else if arg.Function != "" {
-		scope.dispatcher.Lock()
-		function, pres := scope.dispatcher.functions[arg.Function]
-		scope.dispatcher.Unlock()
+		function, pres := scope.GetFunction(arg.Function)
 		if pres {
 			return function.Info(scope, nil).Version
 		}
@@ -0,0 +1,288 @@
+// Package service exposes VQL parsing and evaluation as a simple
+// JSON over HTTP service so a query service can be built around
+// vfilter without rewriting the plumbing.
+//
+// The host supplies a ScopeFactory which builds the scope each
+// request runs in (with the plugins, functions and data the host
+// wants to expose):
+//
+//	handler := service.NewService(func(r *http.Request) (types.Scope, error) {
+//		return vfilter.NewScope().AppendPlugins(...), nil
+//	})
+//	http.ListenAndServe(":8080", handler)
+//
+// All endpoints take a POST with a JSON Request body:
+//
+//	/v1/parse    - Checks the query and returns it reformatted.
+//	/v1/analyze  - Describes each statement in the query.
+//	/v1/eval     - Runs the query and streams the results.
+//
+// Results from /v1/eval are streamed as newline delimited JSON
+// messages so clients can process rows as they arrive. The messages
+// are plain structs so the same service can be exposed over gRPC by
+// wrapping it in a gateway.
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+// Builds the scope a request runs in. Each request gets its own
+// scope which is closed when the request completes.
+type ScopeFactory func(r *http.Request) (types.Scope, error)
+
+type Request struct {
+	Query string `json:"query"`
+
+	// Stop after this many rows (0 means no limit).
+	MaxRows int `json:"max_rows,omitempty"`
+}
+
+type ParseResponse struct {
+	// The statements reformatted into canonical VQL.
+	Statements []string `json:"statements"`
+}
+
+type Statement struct {
+	// The statement type (e.g. SELECT or LAZY_LET).
+	Type string `json:"type"`
+
+	// The name defined by LET statements.
+	Name string `json:"name,omitempty"`
+
+	Query string `json:"query"`
+}
+
+type AnalyzeResponse struct {
+	Statements []*Statement `json:"statements"`
+}
+
+// A message streamed by /v1/eval. Each message carries either a row,
+// a log message or Done, which marks the end of the results.
+type EvalMessage struct {
+	// The index of the statement which produced the row.
+	Statement int         `json:"statement"`
+	Row       interface{} `json:"row,omitempty"`
+	Log       string      `json:"log,omitempty"`
+	Done      bool        `json:"done,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Service struct {
+	mux     *http.ServeMux
+	factory ScopeFactory
+}
+
+func NewService(factory ScopeFactory) *Service {
+	self := &Service{
+		mux:     http.NewServeMux(),
+		factory: factory,
+	}
+
+	self.mux.HandleFunc("/v1/parse", self.handleParse)
+	self.mux.HandleFunc("/v1/analyze", self.handleAnalyze)
+	self.mux.HandleFunc("/v1/eval", self.handleEval)
+
+	return self
+}
+
+func (self *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+// Decode the request and parse the query. Errors are reported to the
+// client and nil is returned.
+func (self *Service) parseRequest(
+	w http.ResponseWriter, r *http.Request) (*Request, []*vfilter.VQL) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST is supported")
+		return nil, nil
+	}
+
+	request := &Request{}
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, nil
+	}
+
+	statements, err := vfilter.MultiParse(request.Query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, nil
+	}
+
+	return request, statements
+}
+
+func (self *Service) newScope(
+	w http.ResponseWriter, r *http.Request) types.Scope {
+	scope, err := self.factory(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return scope
+}
+
+func (self *Service) handleParse(w http.ResponseWriter, r *http.Request) {
+	_, statements := self.parseRequest(w, r)
+	if statements == nil {
+		return
+	}
+
+	scope := self.newScope(w, r)
+	if scope == nil {
+		return
+	}
+	defer scope.Close()
+
+	response := &ParseResponse{Statements: []string{}}
+	for _, vql := range statements {
+		response.Statements = append(response.Statements,
+			vfilter.FormatToString(scope, vql))
+	}
+
+	writeJSON(w, response)
+}
+
+func (self *Service) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	_, statements := self.parseRequest(w, r)
+	if statements == nil {
+		return
+	}
+
+	scope := self.newScope(w, r)
+	if scope == nil {
+		return
+	}
+	defer scope.Close()
+
+	response := &AnalyzeResponse{Statements: []*Statement{}}
+	for _, vql := range statements {
+		statement := &Statement{
+			Type:  vql.Type(),
+			Query: vfilter.FormatToString(scope, vql),
+		}
+
+		if vql.Let != "" {
+			statement.Name = utils.Unquote_ident(vql.Let)
+		} else if vql.Unlet != "" {
+			statement.Name = utils.Unquote_ident(vql.Unlet)
+		}
+
+		response.Statements = append(response.Statements, statement)
+	}
+
+	writeJSON(w, response)
+}
+
+// Writes eval messages to the client as they are produced.
+type messageWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	encoder *json.Encoder
+
+	// Set once the response is complete. Queries may still log
+	// while they shut down but the response can not be written
+	// any more.
+	closed bool
+}
+
+func (self *messageWriter) send(message *EvalMessage) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.closed {
+		return
+	}
+
+	// The client went away - the request context will be
+	// cancelled.
+	err := self.encoder.Encode(message)
+	if err != nil {
+		return
+	}
+
+	flusher, ok := self.w.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+}
+
+// Send the final message and stop writing to the response.
+func (self *messageWriter) close() {
+	self.send(&EvalMessage{Done: true})
+
+	self.mu.Lock()
+	self.closed = true
+	self.mu.Unlock()
+}
+
+// Relay the query logs to the client.
+func (self *messageWriter) Write(b []byte) (int, error) {
+	self.send(&EvalMessage{Log: string(b)})
+	return len(b), nil
+}
+
+func (self *Service) handleEval(w http.ResponseWriter, r *http.Request) {
+	request, statements := self.parseRequest(w, r)
+	if statements == nil {
+		return
+	}
+
+	scope := self.newScope(w, r)
+	if scope == nil {
+		return
+	}
+	defer scope.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	writer := &messageWriter{w: w, encoder: json.NewEncoder(w)}
+	defer writer.close()
+	scope.SetLogger(log.New(writer, "", 0))
+
+	// Stop the query when we return early or the client goes
+	// away.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	rows := 0
+
+	for idx, vql := range statements {
+		for row := range vql.Eval(ctx, scope) {
+			writer.send(&EvalMessage{
+				Statement: idx,
+				Row:       dict.RowToDict(ctx, scope, row),
+			})
+
+			rows++
+			if request.MaxRows > 0 && rows >= request.MaxRows {
+				return
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{Error: message})
+}
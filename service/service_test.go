@@ -0,0 +1,111 @@
+package service_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter"
+	"www.velocidex.com/golang/vfilter/service"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(service.NewService(
+		func(r *http.Request) (types.Scope, error) {
+			return vfilter.NewScope(), nil
+		}))
+}
+
+func post(t *testing.T, server *httptest.Server,
+	path string, request *service.Request) *http.Response {
+	serialized, err := json.Marshal(request)
+	assert.NoError(t, err)
+
+	resp, err := http.Post(server.URL+path, "application/json",
+		bytes.NewReader(serialized))
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestParseAndAnalyze(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	resp := post(t, server, "/v1/analyze", &service.Request{
+		Query: "LET X = SELECT * FROM scope() select * from X",
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	analysis := &service.AnalyzeResponse{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(analysis))
+	assert.Equal(t, []*service.Statement{{
+		Type:  "LAZY_LET",
+		Name:  "X",
+		Query: "LET X = SELECT * FROM scope()",
+	}, {
+		Type:  "SELECT",
+		Query: "SELECT * FROM X",
+	}}, analysis.Statements)
+
+	// Syntax errors are reported to the client.
+	resp = post(t, server, "/v1/parse", &service.Request{
+		Query: "SELECT * FROM",
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestEval(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	eval := func(request *service.Request) []*service.EvalMessage {
+		resp := post(t, server, "/v1/eval", request)
+		defer resp.Body.Close()
+
+		result := []*service.EvalMessage{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			message := &service.EvalMessage{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), message))
+			result = append(result, message)
+		}
+		return result
+	}
+
+	messages := eval(&service.Request{
+		Query: "LET X = 1 SELECT X, Y FROM range(end=3)",
+	})
+
+	rows := []interface{}{}
+	logs := 0
+	for _, message := range messages {
+		if message.Row != nil {
+			assert.Equal(t, 1, message.Statement)
+			rows = append(rows, message.Row)
+		}
+		if message.Log != "" {
+			logs++
+		}
+	}
+
+	assert.Equal(t, 3, len(rows))
+	assert.Equal(t, map[string]interface{}{
+		"X": float64(1), "Y": nil}, rows[0])
+	assert.True(t, logs > 0)
+	assert.True(t, messages[len(messages)-1].Done)
+
+	// Results stop at MaxRows.
+	messages = eval(&service.Request{
+		Query:   "SELECT * FROM range(end=100)",
+		MaxRows: 2,
+	})
+	assert.Equal(t, 3, len(messages))
+	assert.True(t, messages[2].Done)
+}
@@ -28,8 +28,9 @@ func (self DefaultSorter) Sort(ctx context.Context,
 		// On exit from the function, sort our memory buffer
 		// and dump it to the output chan.
 		defer func() {
-			// Sort ourselves
-			sort.Sort(sort_ctx)
+			// Sort ourselves. A stable sort resolves ties by
+			// arrival order so the result agrees with SortTopN.
+			sort.Stable(sort_ctx)
 
 			// Dump everything to the output.
 			for _, row := range sort_ctx.Items {
@@ -59,6 +60,65 @@ func (self DefaultSorter) Sort(ctx context.Context,
 	return output_chan
 }
 
+// SortTopN only keeps the first limit rows in memory. Rows are
+// buffered until the buffer is twice the limit, then the buffer is
+// sorted and truncated.
+func (self DefaultSorter) SortTopN(ctx context.Context,
+	scope types.Scope,
+	input <-chan types.Row,
+	key string,
+	desc bool,
+	limit int) <-chan types.Row {
+
+	output_chan := make(chan types.Row)
+
+	sort_ctx := &DefaultSorterCtx{
+		OrderBy: key,
+		Desc:    desc,
+		Scope:   scope,
+	}
+
+	truncate := func() {
+		// A stable sort ensures ties are resolved by arrival
+		// order, no matter how many times we truncate.
+		sort.Stable(sort_ctx)
+		if len(sort_ctx.Items) > limit {
+			sort_ctx.Items = sort_ctx.Items[:limit]
+		}
+	}
+
+	go func() {
+		defer close(output_chan)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case row, ok := <-input:
+				if !ok {
+					truncate()
+					for _, row := range sort_ctx.Items {
+						select {
+						case <-ctx.Done():
+							return
+
+						case output_chan <- row:
+						}
+					}
+					return
+				}
+
+				sort_ctx.Items = append(sort_ctx.Items, row)
+				if len(sort_ctx.Items) >= 2*limit {
+					truncate()
+				}
+			}
+		}
+	}()
+	return output_chan
+}
+
 // The Default Sorter implements sorting in memory.
 type DefaultSorterCtx struct {
 	Items   []types.Row
@@ -92,8 +152,10 @@ func (self *DefaultSorterCtx) Less(i, j int) bool {
 		element2 = ""
 	}
 
+	// Tied rows must compare equal both ways for the sort to keep
+	// them in arrival order.
 	if self.Desc {
-		return !self.Scope.Lt(element1, element2)
+		return self.Scope.Lt(element2, element1)
 	}
 
 	return self.Scope.Lt(element1, element2)
@@ -0,0 +1,229 @@
+package vfilter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+)
+
+// A StatementHandler compiles a custom statement into regular VQL
+// statements. It is called with the keyword as written in the query
+// and the text following it. For example a handler for CREATE could
+// turn "CREATE VIEW X AS SELECT ..." into "LET X = SELECT ...":
+//
+//	vfilter.RegisterStatementHandler("CREATE",
+//	    func(keyword, body string) ([]*vfilter.VQL, error) {
+//	        ...
+//	        return vfilter.MultiParse("LET " + name + " = " + query)
+//	    })
+//
+// A custom statement starts with its keyword and extends to the next
+// ";" outside any brackets (or the end of the query). The keyword is
+// only recognized at the start of the query or after a ";", so a
+// statement before a custom statement must also end with ";":
+//
+//	CREATE VIEW X AS SELECT * FROM info();
+//	SELECT * FROM X
+//
+// The handler is called once with the text between the keyword and
+// the ";".
+type StatementHandler func(keyword, body string) ([]*VQL, error)
+
+var (
+	statement_mu       sync.Mutex
+	statement_handlers = make(map[string]StatementHandler)
+)
+
+// RegisterStatementHandler adds a custom top level statement
+// starting with keyword (case insensitive). The keyword must be an
+// identifier which is not already a VQL keyword.
+func RegisterStatementHandler(keyword string, handler StatementHandler) error {
+	tokens, err := lexTokens(keyword)
+	if err != nil || len(tokens) != 1 || tokens[0].Value != keyword ||
+		tokens[0].Type != vqlLexer.Symbols()["Ident"] ||
+		strings.HasPrefix(keyword, "`") {
+		return fmt.Errorf("RegisterStatementHandler: %v is not a valid keyword",
+			keyword)
+	}
+
+	statement_mu.Lock()
+	defer statement_mu.Unlock()
+
+	statement_handlers[strings.ToUpper(keyword)] = handler
+	return nil
+}
+
+// UnregisterStatementHandler removes the custom statement.
+func UnregisterStatementHandler(keyword string) {
+	statement_mu.Lock()
+	defer statement_mu.Unlock()
+
+	delete(statement_handlers, strings.ToUpper(keyword))
+}
+
+func getStatementHandlers() map[string]StatementHandler {
+	statement_mu.Lock()
+	defer statement_mu.Unlock()
+
+	if len(statement_handlers) == 0 {
+		return nil
+	}
+
+	result := make(map[string]StatementHandler, len(statement_handlers))
+	for k, v := range statement_handlers {
+		result[k] = v
+	}
+	return result
+}
+
+// A top level statement separated from the others by ";".
+type statementSegment struct {
+	start, end int
+
+	// The first token of the statement.
+	token lexer.Token
+
+	// Set if there are no tokens in the statement.
+	empty bool
+
+	// Set if this is a custom statement.
+	handler StatementHandler
+}
+
+// Splits the expression at each ";" outside any brackets. Returns
+// false if there are no custom statements.
+func findStatementSegments(expression string,
+	handlers map[string]StatementHandler) ([]statementSegment, bool) {
+	tokens, err := lexTokens(expression)
+	if err != nil {
+		return nil, false
+	}
+
+	symbols := vqlLexer.Symbols()
+	result := []statementSegment{}
+	current := statementSegment{empty: true}
+	depth := 0
+	custom := false
+
+	for _, token := range tokens {
+		switch token.Type {
+		case symbols["Comment"], symbols["MLineComment"],
+			symbols["VQLComment"]:
+			continue
+
+		case symbols["Terminator"]:
+			if depth == 0 {
+				current.end = token.Pos.Offset
+				result = append(result, current)
+				current = statementSegment{
+					start: token.Pos.Offset + len(token.Value),
+					empty: true,
+				}
+				continue
+			}
+
+		case symbols["Operators"]:
+			switch token.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+		}
+
+		if current.empty {
+			current.empty = false
+			current.token = token
+
+			if token.Type == symbols["Ident"] {
+				handler, pres := handlers[strings.ToUpper(token.Value)]
+				if pres {
+					current.handler = handler
+					custom = true
+				}
+			}
+		}
+	}
+
+	current.end = len(expression)
+	result = append(result, current)
+
+	return result, custom
+}
+
+// Parses an expression containing custom statements. Returns false
+// if there are no custom statements so the expression should be
+// parsed normally.
+func parseCustomStatements(expression string, parser *participle.Parser,
+	with_comments bool) ([]*VQL, bool, error) {
+	handlers := getStatementHandlers()
+	if len(handlers) == 0 {
+		return nil, false, nil
+	}
+
+	segments, custom := findStatementSegments(expression, handlers)
+	if !custom {
+		return nil, false, nil
+	}
+
+	result := []*VQL{}
+	for _, segment := range segments {
+		if segment.empty {
+			continue
+		}
+
+		if segment.handler == nil {
+			statements, err := parseStatementRange(
+				expression, segment.start, segment.end, parser, with_comments)
+			if err != nil {
+				return nil, true, err
+			}
+			result = append(result, statements...)
+			continue
+		}
+
+		keyword := segment.token.Value
+		body_start := segment.token.Pos.Offset + len(keyword)
+		statements, err := segment.handler(
+			keyword, expression[body_start:segment.end])
+		if err != nil {
+			return nil, true, reportError(
+				fmt.Errorf("%v: %w", keyword, err),
+				segment.token, expression)
+		}
+		result = append(result, statements...)
+	}
+
+	return result, true, nil
+}
+
+// Parses the part of the expression between start and end. The text
+// before start is blanked out so positions in errors and comments
+// refer to the whole expression.
+func parseStatementRange(expression string, start, end int,
+	parser *participle.Parser, with_comments bool) ([]*VQL, error) {
+	blank := []byte(expression[:start])
+	for i, c := range blank {
+		if c != '\n' {
+			blank[i] = ' '
+		}
+	}
+
+	vql := &MultiVQL{}
+	err := parser.ParseString(string(blank)+expression[start:end], vql)
+	switch t := err.(type) {
+	case nil:
+	case participle.Error:
+		return nil, reportError(err, t.Token(), expression)
+	default:
+		return nil, err
+	}
+
+	if with_comments {
+		vql.attachTrailingComments(expression)
+	}
+	return vql.GetStatements(), nil
+}
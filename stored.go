@@ -46,6 +46,14 @@ func NewStoredQuery(query *_Select, name string) *_StoredQuery {
 }
 
 func (self *_StoredQuery) Eval(ctx context.Context, scope types.Scope) <-chan Row {
+	cache := getStoredQueryCache(scope)
+	if cache != nil {
+		return cache.Eval(ctx, scope, self)
+	}
+	return self.eval(ctx, scope)
+}
+
+func (self *_StoredQuery) eval(ctx context.Context, scope types.Scope) <-chan Row {
 	output_chan := make(chan Row)
 
 	go func() {
@@ -85,19 +93,22 @@ func (self *_StoredQuery) Call(ctx context.Context,
 
 	self.checkCallingArgs(sub_scope, args)
 
+	// Any limit hint only applies to our own output.
+	args_ctx := clearRowOffset(clearRowLimit(ctx))
+
 	vars := ordereddict.NewDict()
 	for _, k := range args.Keys() {
 		v, _ := args.Get(k)
 		switch t := v.(type) {
 
 		case types.LazyExpr:
-			v = t.Reduce(ctx)
+			v = t.Reduce(args_ctx)
 
 		case types.Materializer:
-			v = t.Materialize(ctx, sub_scope)
+			v = t.Materialize(args_ctx, sub_scope)
 
 		case types.StoredQuery:
-			v = types.Materialize(ctx, sub_scope, t)
+			v = types.Materialize(args_ctx, sub_scope, t)
 		}
 		vars.Set(k, v)
 	}
@@ -0,0 +1,250 @@
+package vfilter
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/Velocidex/ordereddict"
+	"www.velocidex.com/golang/vfilter/protocols"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Stored queries are normally re-evaluated each time they are
+// expanded. When the stored query cache is enabled, the rows produced
+// by a stored query are remembered along with the values of all the
+// variables the query refers to. Expanding the same stored query
+// again while those variables are unchanged replays the cached rows
+// instead of running the query again.
+//
+// Since the cache can not tell if a plugin returns different results
+// each time it is called, it must only be enabled when stored queries
+// are expected to be repeatable.
+
+const storedQueryCacheContextKey = "$stored_query_cache"
+
+type storedQueryCacheEntry struct {
+	names  []string
+	inputs []types.Any
+	rows   []Row
+}
+
+type storedQueryCache struct {
+	mu      sync.Mutex
+	entries map[*_StoredQuery]*storedQueryCacheEntry
+}
+
+// EnableStoredQueryCache enables caching of stored query results for
+// the scope and all its children.
+func EnableStoredQueryCache(scope types.Scope) {
+	scope.SetContext(storedQueryCacheContextKey, &storedQueryCache{
+		entries: make(map[*_StoredQuery]*storedQueryCacheEntry),
+	})
+}
+
+func getStoredQueryCache(scope types.Scope) *storedQueryCache {
+	value, pres := scope.GetContext(storedQueryCacheContextKey)
+	if !pres {
+		return nil
+	}
+	cache, _ := value.(*storedQueryCache)
+	return cache
+}
+
+func (self *storedQueryCache) Eval(ctx context.Context,
+	scope types.Scope, query *_StoredQuery) <-chan Row {
+	// A limited or offset expansion does not produce all the rows
+	// so can not be cached.
+	if getRowLimit(ctx) > 0 || getRowOffset(ctx) != nil {
+		return query.eval(ctx, scope)
+	}
+
+	output_chan := make(chan Row)
+
+	names := referencedSymbols(scope, query.query)
+	inputs := make([]types.Any, 0, len(names))
+	for _, name := range names {
+		value, _ := scope.Resolve(name)
+		inputs = append(inputs, value)
+	}
+
+	rows, pres := self.get(ctx, scope, query, names, inputs)
+	if pres {
+		go func() {
+			defer close(output_chan)
+
+			for _, row := range rows {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+		}()
+		return output_chan
+	}
+
+	go func() {
+		defer close(output_chan)
+
+		rows := []Row{}
+		for row := range query.eval(ctx, scope) {
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+				rows = append(rows, row)
+			}
+		}
+
+		// Only cache complete results.
+		if ctx.Err() == nil {
+			self.set(query, &storedQueryCacheEntry{
+				names:  names,
+				inputs: inputs,
+				rows:   rows,
+			})
+		}
+	}()
+	return output_chan
+}
+
+func (self *storedQueryCache) get(ctx context.Context, scope types.Scope,
+	query *_StoredQuery, names []string, inputs []types.Any) ([]Row, bool) {
+	self.mu.Lock()
+	entry, pres := self.entries[query]
+	self.mu.Unlock()
+
+	if !pres || len(entry.names) != len(names) {
+		return nil, false
+	}
+
+	for i, name := range names {
+		if entry.names[i] != name ||
+			!sameInput(ctx, scope, entry.inputs[i], inputs[i]) {
+			return nil, false
+		}
+	}
+	scope.GetStats().IncStoredQueryCacheHit()
+	return entry.rows, true
+}
+
+func (self *storedQueryCache) set(
+	query *_StoredQuery, entry *storedQueryCacheEntry) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.entries[query] = entry
+}
+
+// Inputs referring to other objects are compared by identity since
+// evaluating them may be expensive. Plain data is compared by value.
+func sameInput(ctx context.Context, scope types.Scope, a, b types.Any) bool {
+	if types.IsNil(a) || types.IsNil(b) {
+		return types.IsNil(a) && types.IsNil(b)
+	}
+
+	a_type := reflect.TypeOf(a)
+	if a_type != reflect.TypeOf(b) {
+		return false
+	}
+
+	switch t := a.(type) {
+	case *ordereddict.Dict:
+		return protocols.DeepEqual(ctx, scope, a, b, true)
+
+		// Redefining a LET with the same text does not change its
+		// result. The variables it depends on are checked
+		// separately.
+	case *_StoredQuery:
+		return FormatToString(scope, t) == FormatToString(scope, b)
+
+	case *StoredExpression:
+		return FormatToString(scope, t) == FormatToString(scope, b)
+	}
+
+	switch a_type.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Chan, reflect.Map:
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+
+	return protocols.DeepEqual(ctx, scope, a, b, true)
+}
+
+// Find the names of all the variables a query depends on. Stored
+// queries and expressions referenced by the query are followed so
+// changes to their own inputs are also detected.
+func referencedSymbols(scope types.Scope, node interface{}) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+
+	var visit func(node interface{})
+	visit = func(node interface{}) {
+		for _, name := range collectSymbols(reflect.ValueOf(node), nil) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			result = append(result, name)
+
+			value, _ := scope.Resolve(name)
+			switch t := value.(type) {
+			case *_StoredQuery:
+				visit(t.query)
+			case *StoredExpression:
+				visit(t.Expr)
+			}
+		}
+	}
+	visit(node)
+
+	return result
+}
+
+var (
+	symbolRefType = reflect.TypeOf(_SymbolRef{})
+	pluginType    = reflect.TypeOf(Plugin{})
+)
+
+// Walk the AST collecting symbol and plugin names. Only the first
+// component of a dotted name refers to a variable. Unexported fields
+// hold caches which other queries may be filling in concurrently, so
+// only the parsed (exported) fields are visited.
+func collectSymbols(value reflect.Value, result []string) []string {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			result = collectSymbols(value.Elem(), result)
+		}
+
+	case reflect.Struct:
+		var name string
+		switch value.Type() {
+		case symbolRefType:
+			name = value.FieldByName("Symbol").String()
+		case pluginType:
+			name = value.FieldByName("Name").String()
+		}
+
+		if name != "" {
+			components, _ := splitSymbol(name)
+			if len(components) > 0 {
+				result = append(result, components[0])
+			}
+		}
+
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			result = collectSymbols(value.Field(i), result)
+		}
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			result = collectSymbols(value.Index(i), result)
+		}
+	}
+
+	return result
+}
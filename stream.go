@@ -0,0 +1,109 @@
+package vfilter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+type JSONStreamOptions struct {
+	// Write one JSON object per line (JSONL) instead of a JSON
+	// array.
+	Lines bool
+}
+
+// A JSONStreamer serializes the rows of a query to a writer as they
+// are produced so the result set is never held in memory. Unlike
+// OutputJSON() the query only proceeds as fast as the writer accepts
+// the rows.
+type JSONStreamer struct {
+	ctx   context.Context
+	scope types.Scope
+	vql   *VQL
+	opts  JSONStreamOptions
+}
+
+func NewJSONStreamer(ctx context.Context, scope types.Scope, vql *VQL,
+	opts *JSONStreamOptions) *JSONStreamer {
+	result := &JSONStreamer{
+		ctx:   ctx,
+		scope: scope,
+		vql:   vql,
+	}
+	if opts != nil {
+		result.opts = *opts
+	}
+	return result
+}
+
+// WriteTo runs the query and writes its rows to w. If writing fails
+// the query is cancelled and the error is returned. Rows which can
+// not be serialized are logged and skipped.
+func (self *JSONStreamer) WriteTo(w io.Writer) (int64, error) {
+	sub_ctx, cancel := context.WithCancel(self.ctx)
+	defer cancel()
+
+	out := &countingWriter{w: w}
+	separator := "[\n"
+	if self.opts.Lines {
+		separator = ""
+	}
+
+	for row := range self.vql.Eval(sub_ctx, self.scope) {
+		value := dict.RowToDict(sub_ctx, self.scope, row)
+		serialized, err := json.Marshal(value)
+		if err != nil {
+			self.scope.Log("ERROR:Unable to serialize: %v", err)
+			continue
+		}
+
+		out.writeString(separator)
+		out.write(serialized)
+		if self.opts.Lines {
+			out.writeString("\n")
+		} else {
+			separator = ",\n"
+		}
+
+		if out.err != nil {
+			return out.n, out.err
+		}
+
+		// Throttle if needed.
+		self.scope.ChargeOp()
+	}
+
+	if !self.opts.Lines {
+		if separator == "[\n" {
+			out.writeString("[]\n")
+		} else {
+			out.writeString("\n]\n")
+		}
+	}
+
+	return out.n, out.err
+}
+
+// Counts the bytes written and remembers the first error so a
+// sequence of writes only needs to be checked once.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (self *countingWriter) write(b []byte) {
+	if self.err != nil {
+		return
+	}
+	n, err := self.w.Write(b)
+	self.n += int64(n)
+	self.err = err
+}
+
+func (self *countingWriter) writeString(s string) {
+	self.write([]byte(s))
+}
@@ -0,0 +1,43 @@
+package vfilter
+
+import (
+	"context"
+	"fmt"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// An arithmetic operation which gives NULL even though neither of its
+// operands is NULL could not handle the operand types (or divided by
+// zero). In strict arithmetic mode this is reported as an error.
+func checkArithmetic(ctx context.Context, scope types.Scope,
+	node interface{}, operator string, lhs, rhs, result Any) {
+	if !types.IsNil(result) || !types.IsOptionEnabled(scope, types.StrictArithmeticOption) {
+		return
+	}
+
+	lhs = reduceOperand(ctx, lhs)
+	rhs = reduceOperand(ctx, rhs)
+	if types.IsNil(lhs) || types.IsNil(rhs) {
+		return
+	}
+
+	err := fmt.Errorf("Strict arithmetic: cannot evaluate %v (%T %v %T)",
+		FormatToString(scope, node), lhs, operator, rhs)
+	scope.Log("ERROR:%v", err)
+
+	handler, ok := types.GetQueryErrorHandler(ctx)
+	if ok {
+		handler(err)
+	}
+}
+
+func reduceOperand(ctx context.Context, value Any) Any {
+	for {
+		lazy_expr, ok := value.(types.LazyExpr)
+		if !ok {
+			return value
+		}
+		value = lazy_expr.Reduce(ctx)
+	}
+}
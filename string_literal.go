@@ -0,0 +1,105 @@
+package vfilter
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils"
+)
+
+// VQL has several kinds of string literals:
+//
+// 'x' and "x" process backslash escapes.
+//
+// '''x''' and <<EOF heredocs are raw - their content is used exactly
+// as written.
+//
+// f'''x''' and f<<EOF heredocs are raw but expand ${Var} and
+// ${Var.Member} references from the scope each time they are
+// evaluated. Use $${ for a literal ${.
+
+var interpolationRegex = regexp.MustCompile(
+	`\$\$\{|\$\{([a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*)\}`)
+
+// Returns the value of the string literal token and whether it needs
+// to be interpolated.
+func decodeStringLiteral(literal string) (string, bool) {
+	switch {
+	case strings.HasPrefix(literal, "f'''"):
+		return literal[4 : len(literal)-3], true
+
+	case strings.HasPrefix(literal, "f<<"):
+		return heredocBody(literal), true
+
+	case strings.HasPrefix(literal, "<<"):
+		return heredocBody(literal), false
+	}
+
+	return utils.Unquote(literal), false
+}
+
+// The body is everything between the line opening the heredoc and
+// the line with the closing delimiter.
+func heredocBody(literal string) string {
+	start := strings.IndexByte(literal, '\n') + 1
+	end := strings.LastIndexByte(literal, '\n')
+	if end < start {
+		return ""
+	}
+	return strings.TrimSuffix(literal[start:end], "\r")
+}
+
+func interpolateString(ctx context.Context,
+	scope types.Scope, template string) string {
+	return interpolationRegex.ReplaceAllStringFunc(template, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		components := strings.Split(match[2:len(match)-1], ".")
+		value, pres := scope.Resolve(components[0])
+		if !pres {
+			scope.Log("ERROR:String interpolation: Symbol %v not found",
+				components[0])
+			return ""
+		}
+		value = reduceInterpolated(ctx, scope, components[0], value)
+
+		for _, member := range components[1:] {
+			value, pres = scope.Associative(value, member)
+			if !pres {
+				return ""
+			}
+			value = reduceInterpolated(ctx, scope, member, value)
+		}
+
+		return types.ToString(ctx, scope, value)
+	})
+}
+
+// Variables defined by LET are stored expressions which are
+// evaluated like a symbol reference would.
+func reduceInterpolated(ctx context.Context,
+	scope types.Scope, name string, value types.Any) types.Any {
+	stored_expression, ok := value.(*StoredExpression)
+	if ok {
+		subscope := scope.Copy()
+		defer subscope.Close()
+
+		symbol_ctx := withSymbol(ctx, name)
+		if checkForOverflow(symbol_ctx, subscope) {
+			return types.Null{}
+		}
+		value = stored_expression.Reduce(symbol_ctx, subscope)
+	}
+
+	for {
+		lazy_expr, ok := value.(types.LazyExpr)
+		if !ok {
+			return value
+		}
+		value = lazy_expr.ReduceWithScope(ctx, scope)
+	}
+}
@@ -0,0 +1,163 @@
+package vfilter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"www.velocidex.com/golang/vfilter/types"
+	"www.velocidex.com/golang/vfilter/utils/dict"
+)
+
+type TableOptions struct {
+	// Render a markdown table instead of an ASCII one.
+	Markdown bool
+
+	// Cells wider than this are truncated. Zero means no limit.
+	MaxWidth int
+
+	// Only render this many rows. Zero means all rows.
+	MaxRows int
+}
+
+// A convenience function to render the results of a VQL query as a
+// table for display in a terminal. Columns are taken from all the
+// rows in the order they first appear. The table is only written once
+// the query completes since all the rows are needed to size the
+// columns.
+func OutputTable(ctx context.Context, scope types.Scope, vql *VQL,
+	w io.Writer, opts *TableOptions) error {
+	if opts == nil {
+		opts = &TableOptions{}
+	}
+
+	sub_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	columns := []string{}
+	seen := make(map[string]bool)
+	rows := [][]string{}
+	truncated := false
+
+	for row := range vql.Eval(sub_ctx, scope) {
+		if opts.MaxRows > 0 && len(rows) >= opts.MaxRows {
+			truncated = true
+			break
+		}
+
+		value := dict.RowToDict(sub_ctx, scope, row)
+		for _, column := range value.Keys() {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+
+		cells := make([]string, 0, len(columns))
+		for _, column := range columns {
+			cell, pres := value.Get(column)
+			if !pres {
+				cells = append(cells, "")
+				continue
+			}
+			cells = append(cells, formatCell(sub_ctx, scope, cell, opts))
+		}
+		rows = append(rows, cells)
+
+		// Throttle if needed.
+		scope.ChargeOp()
+	}
+
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, formatCell(ctx, scope, column, opts))
+	}
+
+	widths := make([]int, len(columns))
+	for _, cells := range append(rows, header) {
+		for idx, cell := range cells {
+			width := utf8.RuneCountInString(cell)
+			if width > widths[idx] {
+				widths[idx] = width
+			}
+		}
+	}
+
+	table := &strings.Builder{}
+	if opts.Markdown {
+		writeTableRow(table, header, widths)
+		separators := []string{}
+		for _, width := range widths {
+			separators = append(separators, strings.Repeat("-", width))
+		}
+		writeTableRow(table, separators, widths)
+		for _, cells := range rows {
+			writeTableRow(table, cells, widths)
+		}
+
+	} else {
+		border := &strings.Builder{}
+		for _, width := range widths {
+			border.WriteString("+" + strings.Repeat("-", width+2))
+		}
+		border.WriteString("+\n")
+
+		table.WriteString(border.String())
+		writeTableRow(table, header, widths)
+		table.WriteString(border.String())
+		for _, cells := range rows {
+			writeTableRow(table, cells, widths)
+		}
+		if len(rows) > 0 {
+			table.WriteString(border.String())
+		}
+	}
+
+	if truncated {
+		fmt.Fprintf(table, "Only the first %d rows are shown.\n", opts.MaxRows)
+	}
+
+	_, err := io.WriteString(w, table.String())
+	return err
+}
+
+// Cells must fit on one line and may not contain the markdown column
+// separator.
+func formatCell(ctx context.Context, scope types.Scope,
+	value interface{}, opts *TableOptions) string {
+	var result string
+	if value != nil {
+		result = types.ToString(ctx, scope, value)
+	}
+	result = strings.Join(strings.Fields(result), " ")
+
+	if opts.MaxWidth > 0 && utf8.RuneCountInString(result) > opts.MaxWidth {
+		runes := []rune(result)
+		if opts.MaxWidth > 3 {
+			result = string(runes[:opts.MaxWidth-3]) + "..."
+		} else {
+			result = string(runes[:opts.MaxWidth])
+		}
+	}
+
+	if opts.Markdown {
+		result = strings.Replace(result, "|", "\\|", -1)
+	}
+	return result
+}
+
+// Rows emitted before a new column appeared have fewer cells than the
+// header.
+func writeTableRow(table *strings.Builder, cells []string, widths []int) {
+	for idx, width := range widths {
+		cell := ""
+		if idx < len(cells) {
+			cell = cells[idx]
+		}
+		table.WriteString("| " + cell +
+			strings.Repeat(" ", width-utf8.RuneCountInString(cell)) + " ")
+	}
+	table.WriteString("|\n")
+}
@@ -0,0 +1,45 @@
+package vfilter
+
+import (
+	"context"
+
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+// Relay rows from the channel while counting them. The span is ended
+// when the channel is exhausted or the query is cancelled.
+func traceRows(ctx context.Context, span types.Span,
+	in <-chan Row) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		count := 0
+		defer func() {
+			span.SetAttribute(types.RowsAttribute, count)
+			span.End()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case row, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+					count++
+				}
+			}
+		}
+	}()
+
+	return output_chan
+}
@@ -0,0 +1,120 @@
+package vfilter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+	"github.com/stretchr/testify/assert"
+	"www.velocidex.com/golang/vfilter/types"
+)
+
+type spanKey int
+
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	parent string
+	attrs  *ordereddict.Dict
+	ended  bool
+}
+
+func (self *recordedSpan) SetAttribute(key string, value interface{}) {
+	self.tracer.mu.Lock()
+	defer self.tracer.mu.Unlock()
+	self.attrs.Set(key, value)
+}
+
+func (self *recordedSpan) End() {
+	self.tracer.mu.Lock()
+	defer self.tracer.mu.Unlock()
+	self.ended = true
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (self *recordingTracer) StartSpan(
+	ctx context.Context, name string) (context.Context, types.Span) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	parent, _ := ctx.Value(spanKey(0)).(string)
+	span := &recordedSpan{
+		tracer: self,
+		name:   name,
+		parent: parent,
+		attrs:  ordereddict.NewDict(),
+	}
+	self.spans = append(self.spans, span)
+	return context.WithValue(ctx, spanKey(0), name), span
+}
+
+func TestQueryTracing(t *testing.T) {
+	scope := makeTestScope()
+	tracer := &recordingTracer{}
+	types.SetOption(scope, types.QueryTracerOption, tracer)
+
+	vqls, err := MultiParse(`
+LET X <= SELECT * FROM test()
+SELECT * FROM test()
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, vql := range vqls {
+		for range vql.Eval(ctx, scope) {
+		}
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	var summary []string
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, span.name)
+		summary = append(summary, span.parent+">"+span.name)
+	}
+	assert.Equal(t, []string{
+		">vql.materialize",
+		"vql.materialize>vql.plugin",
+		">vql.query",
+		"vql.query>vql.plugin",
+	}, summary)
+
+	name, _ := tracer.spans[0].attrs.Get(types.NameAttribute)
+	assert.Equal(t, "X", name)
+
+	query, _ := tracer.spans[2].attrs.Get(types.QueryAttribute)
+	assert.Equal(t, "SELECT * FROM test()", query)
+
+	plugin, _ := tracer.spans[3].attrs.Get(types.PluginAttribute)
+	assert.Equal(t, "test", plugin)
+
+	rows, _ := tracer.spans[3].attrs.Get(types.RowsAttribute)
+	assert.Equal(t, 3, rows)
+}
+
+// Stopping the query's time limit when it finishes must not lose the
+// rows still being relayed to the caller.
+func TestQueryTracingWithTimeout(t *testing.T) {
+	scope := makeTestScope()
+	types.SetOption(scope, types.QueryTracerOption, &recordingTracer{})
+	types.SetOption(scope, types.QueryLimitsOption, &types.QueryLimits{
+		Timeout: 10 * time.Second})
+
+	vql, err := Parse("SELECT * FROM test()")
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		rows := 0
+		for range vql.Eval(context.Background(), scope) {
+			rows++
+		}
+		assert.Equal(t, 3, rows)
+	}
+}
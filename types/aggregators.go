@@ -6,3 +6,11 @@ type AggregatorCtx interface {
 	// to read the old value as well by just returning it.
 	Modify(name string, modifier func(old_value Any, pres bool) Any) Any
 }
+
+// Aggregate functions implementing MergeableAggregator can combine
+// two partial results of the aggregate into the result over both
+// parts. This allows a GROUP BY to be computed in parts (e.g. on
+// different nodes) and merged afterwards.
+type MergeableAggregator interface {
+	MergeAggregate(scope Scope, a, b Any) Any
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Args structs describe each field with a vfilter tag made of comma
+// separated directives, for example:
+//
+//	`vfilter:"optional,field=name,default=foo,doc=The name."`
+//
+// A directive is either a flag or a name=value pair where the value
+// is everything after the first "=". The doc directive must come last
+// and its value is the rest of the tag so docs may contain "," and
+// "=".
+
+// The directives which do not take a value.
+var argTagFlags = []string{"required", "optional", "variadic"}
+
+// ParseArgTag returns the directives of a vfilter tag by name. Flags
+// are set to "Y". An unknown flag is an error since it usually means
+// a value contained a ",".
+func ParseArgTag(tag string) (map[string]string, error) {
+	result := make(map[string]string)
+	for tag != "" {
+		if strings.HasPrefix(tag, "doc=") {
+			result["doc"] = strings.TrimPrefix(tag, "doc=")
+			break
+		}
+
+		directive := tag
+		tag = ""
+		idx := strings.Index(directive, ",")
+		if idx >= 0 {
+			directive, tag = directive[:idx], directive[idx+1:]
+		}
+
+		if directive == "" {
+			continue
+		}
+
+		idx = strings.Index(directive, "=")
+		if idx >= 0 {
+			result[directive[:idx]] = directive[idx+1:]
+			continue
+		}
+
+		if !isArgTagFlag(directive) {
+			return result, fmt.Errorf("unknown directive %q in tag", directive)
+		}
+		result[directive] = "Y"
+	}
+	return result, nil
+}
+
+func isArgTagFlag(directive string) bool {
+	for _, flag := range argTagFlags {
+		if directive == flag {
+			return true
+		}
+	}
+	return false
+}
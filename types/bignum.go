@@ -0,0 +1,165 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Decimals which do not terminate are rendered with this many
+// decimal places.
+const DecimalPrecision = 20
+
+// BigInt is an arbitrary precision integer. It is used for values
+// which overflow int64, for example when adding up large byte
+// counters.
+type BigInt struct {
+	Value *big.Int
+}
+
+func NewBigInt(value *big.Int) BigInt {
+	return BigInt{Value: value}
+}
+
+func (self BigInt) Sign() int {
+	if self.Value == nil {
+		return 0
+	}
+	return self.Value.Sign()
+}
+
+func (self BigInt) String() string {
+	if self.Value == nil {
+		return "0"
+	}
+	return self.Value.String()
+}
+
+// JSON numbers have arbitrary precision so emit all the digits.
+func (self BigInt) MarshalJSON() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// Decimal is an exact arbitrary precision rational number. Adding
+// and multiplying Decimals never loses precision.
+type Decimal struct {
+	Value *big.Rat
+}
+
+func NewDecimal(value *big.Rat) Decimal {
+	return Decimal{Value: value}
+}
+
+func (self Decimal) Sign() int {
+	if self.Value == nil {
+		return 0
+	}
+	return self.Value.Sign()
+}
+
+func (self Decimal) String() string {
+	if self.Value == nil {
+		return "0"
+	}
+
+	if self.Value.IsInt() {
+		return self.Value.Num().String()
+	}
+
+	result := self.Value.FloatString(DecimalPrecision)
+	result = strings.TrimRight(result, "0")
+	result = strings.TrimSuffix(result, ".")
+	if result == "-0" {
+		return "0"
+	}
+	return result
+}
+
+func (self Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(self.String()), nil
+}
+
+// ToBigInt converts integers, floats, big numbers and numeric
+// strings to a big.Int. Fractions are truncated towards zero.
+func ToBigInt(a Any) (*big.Int, bool) {
+	switch t := a.(type) {
+	case BigInt:
+		if t.Value == nil {
+			return new(big.Int), true
+		}
+		return t.Value, true
+
+	case uint64:
+		return new(big.Int).SetUint64(t), true
+
+	case string:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(t), 0)
+		if ok {
+			return value, true
+		}
+	}
+
+	value, ok := ToDecimal(a)
+	if !ok {
+		return nil, false
+	}
+
+	if value.IsInt() {
+		return value.Num(), true
+	}
+	return new(big.Int).Quo(value.Num(), value.Denom()), true
+}
+
+// ToDecimal converts integers, finite floats, big numbers and numeric
+// strings to a big.Rat.
+func ToDecimal(a Any) (*big.Rat, bool) {
+	switch t := a.(type) {
+	case Decimal:
+		if t.Value == nil {
+			return new(big.Rat), true
+		}
+		return t.Value, true
+
+	case BigInt:
+		if t.Value == nil {
+			return new(big.Rat), true
+		}
+		return new(big.Rat).SetInt(t.Value), true
+
+	case int:
+		return big.NewRat(int64(t), 1), true
+	case int8:
+		return big.NewRat(int64(t), 1), true
+	case int16:
+		return big.NewRat(int64(t), 1), true
+	case int32:
+		return big.NewRat(int64(t), 1), true
+	case int64:
+		return big.NewRat(t, 1), true
+	case uint8:
+		return big.NewRat(int64(t), 1), true
+	case uint16:
+		return big.NewRat(int64(t), 1), true
+	case uint32:
+		return big.NewRat(int64(t), 1), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(t)), true
+
+	case float32:
+		return floatToDecimal(float64(t))
+	case float64:
+		return floatToDecimal(t)
+
+	case string:
+		return new(big.Rat).SetString(strings.TrimSpace(t))
+	}
+
+	return nil, false
+}
+
+func floatToDecimal(value float64) (*big.Rat, bool) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, false
+	}
+	return new(big.Rat).SetFloat64(value), true
+}
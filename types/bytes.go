@@ -0,0 +1,6 @@
+package types
+
+// Bytes is a binary safe string. Unlike a Go string it is never
+// assumed to contain valid UTF-8 so indexing, slicing and matching
+// operate on raw bytes and the data is never re-encoded.
+type Bytes []byte
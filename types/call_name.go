@@ -0,0 +1,20 @@
+package types
+
+import "context"
+
+type callNameKey int
+
+const callNameKeyValue callNameKey = 0
+
+// WithCallName records the name of the function or plugin being
+// called so helpers like the arg parser can report it in errors.
+func WithCallName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, callNameKeyValue, name)
+}
+
+// GetCallName returns the name of the function or plugin currently
+// being called, or an empty string if not known.
+func GetCallName(ctx context.Context) string {
+	name, _ := ctx.Value(callNameKeyValue).(string)
+	return name
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"github.com/Velocidex/ordereddict"
+)
+
+// ColumnMetadata describes a column of the rows a query emits so
+// embedders can present the results (e.g. in a rich table).
+type ColumnMetadata struct {
+	// The units of the column's values (e.g. "bytes" or "seconds").
+	Units string `json:"units,omitempty"`
+
+	Description string `json:"description,omitempty"`
+
+	// How the column should be rendered (e.g. "timestamp" or "hex").
+	RenderHint string `json:"render_hint,omitempty"`
+}
+
+// Plugins may implement ColumnMetadataProtocol to attach metadata to
+// the columns of the rows they emit. The metadata follows a column
+// through SELECT transforms which pass it on unchanged (e.g. `SELECT
+// Size AS Length FROM ...`) but is dropped for computed columns.
+type ColumnMetadataProtocol interface {
+	ColumnMetadata(scope Scope, args *ordereddict.Dict) map[string]*ColumnMetadata
+}
+
+// Holds a map[string]*ColumnMetadata which is never modified once
+// stored.
+var columnMetadataOption = RegisterOption("column_metadata")
+
+// SetColumnMetadata records the metadata of a column emitted by a
+// query. This is called when a query evaluated in the scope
+// completes.
+func SetColumnMetadata(scope Scope, column string, metadata *ColumnMetadata) {
+	updateOption(scope, columnMetadataOption, func(old Any) Any {
+		old_columns, _ := old.(map[string]*ColumnMetadata)
+		columns := make(map[string]*ColumnMetadata, len(old_columns)+1)
+		for k, v := range old_columns {
+			columns[k] = v
+		}
+		columns[column] = metadata
+		return columns
+	})
+}
+
+// GetColumnMetadata returns the metadata of the columns emitted by
+// the queries evaluated in the scope so far, keyed by column name.
+func GetColumnMetadata(scope Scope) map[string]*ColumnMetadata {
+	result := make(map[string]*ColumnMetadata)
+
+	value, _ := GetOption(scope, columnMetadataOption)
+	columns, _ := value.(map[string]*ColumnMetadata)
+	for k, v := range columns {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package types
+
+import "github.com/Velocidex/ordereddict"
+
+var constantsOption = RegisterOption("constants")
+
+// AddConstants defines the vars as constants. Queries may not
+// redefine constants with LET, remove them with UNLET or mask them
+// with the parameters of a LET. Use Scope.DefineConstants() to
+// define constants.
+func AddConstants(scope Scope, vars *ordereddict.Dict) {
+	updateOption(scope, constantsOption, func(old Any) Any {
+		// Replace the set rather than modify it since other
+		// scopes may be reading it.
+		constants := make(map[string]Any)
+		existing, _ := old.(map[string]Any)
+		for name, value := range existing {
+			constants[name] = value
+		}
+		for _, name := range vars.Keys() {
+			constants[name], _ = vars.Get(name)
+		}
+		return constants
+	})
+}
+
+// IsConstant returns true if the name was defined as a constant.
+func IsConstant(scope Scope, name string) bool {
+	_, pres := GetConstant(scope, name)
+	return pres
+}
+
+// GetConstant returns the value of the constant.
+func GetConstant(scope Scope, name string) (Any, bool) {
+	result, pres := GetConstants(scope)[name]
+	return result, pres
+}
+
+// GetConstants returns all the constants by name. The map must not
+// be modified.
+func GetConstants(scope Scope) map[string]Any {
+	value, _ := GetOption(scope, constantsOption)
+	constants, _ := value.(map[string]Any)
+	return constants
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	crypto_rand "crypto/rand"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// EntropySource provides the nondeterministic values used by
+// functions like now() and rand(). By default the system clock and a
+// random generator are used. Tests can install a deterministic source
+// with SetDeterministic() so the results of queries are stable.
+type EntropySource interface {
+	Now() time.Time
+
+	// A non-negative random number.
+	Int63() int64
+}
+
+type systemEntropySource struct{}
+
+func (self systemEntropySource) Now() time.Time {
+	return time.Now()
+}
+
+func (self systemEntropySource) Int63() int64 {
+	return rand.Int63()
+}
+
+// DeterministicSource returns a fixed time and a seeded sequence of
+// random numbers.
+type DeterministicSource struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+	now  time.Time
+}
+
+func NewDeterministicSource(seed int64, now time.Time) *DeterministicSource {
+	return &DeterministicSource{
+		rand: rand.New(rand.NewSource(seed)),
+		now:  now,
+	}
+}
+
+func (self *DeterministicSource) Now() time.Time {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.now
+}
+
+// Advance moves the fixed time forward.
+func (self *DeterministicSource) Advance(duration time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.now = self.now.Add(duration)
+}
+
+func (self *DeterministicSource) Int63() int64 {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.rand.Int63()
+}
+
+// The EntropySource for the scope and its children.
+var EntropySourceOption = RegisterOption("entropy_source")
+
+// SetDeterministic makes the scope use a fixed time and a random
+// sequence generated from the seed.
+func SetDeterministic(scope Scope, seed int64, now time.Time) {
+	SetOption(scope, EntropySourceOption, NewDeterministicSource(seed, now))
+}
+
+// ReadRandom fills b with random bytes. Unless the scope has its own
+// entropy source these come from crypto/rand so they are suitable for
+// identifiers which must not be guessed.
+func ReadRandom(scope Scope, b []byte) error {
+	value, _ := GetOption(scope, EntropySourceOption)
+	source, ok := value.(EntropySource)
+	if !ok || source == nil {
+		_, err := crypto_rand.Read(b)
+		return err
+	}
+
+	for i := 0; i < len(b); i += 4 {
+		value := source.Int63()
+		for j := 0; j < 4 && i+j < len(b); j++ {
+			b[i+j] = byte(value >> (8 * uint(j)))
+		}
+	}
+	return nil
+}
+
+// GetEntropySource returns the source set on the scope or the system
+// source.
+func GetEntropySource(scope Scope) EntropySource {
+	value, _ := GetOption(scope, EntropySourceOption)
+	source, ok := value.(EntropySource)
+	if ok && source != nil {
+		return source
+	}
+	return systemEntropySource{}
+}
@@ -1,6 +1,10 @@
 package types
 
-import "github.com/Velocidex/ordereddict"
+import (
+	"time"
+
+	"github.com/Velocidex/ordereddict"
+)
 
 type TypeDescriber interface {
 	DescribeType() string
@@ -26,3 +30,18 @@ type Explainer interface {
 	// A general purpose log
 	Log(message string)
 }
+
+// An Explainer may also implement this to summarize how selective
+// each query is. Rows are only timed when the installed explainer
+// implements it.
+type SelectivityExplainer interface {
+	// Report that a row from the plugin was processed by the
+	// query. passed is true if the row survived the WHERE clause and
+	// transform_time is the time taken to transform and filter it.
+	RowProcessed(select_ast_node interface{}, plugin_ast_node interface{},
+		passed bool, transform_time time.Duration)
+
+	// A table summarizing the rows produced by each plugin and how
+	// many of them survived filtering.
+	Summary() []*ordereddict.Dict
+}
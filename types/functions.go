@@ -30,6 +30,9 @@ type PluginInfo struct {
 
 	ArgType string
 
+	// The type of rows the plugin emits, if known.
+	RowType string
+
 	// A version of this plugin. VQL queries can target certain
 	// versions of this plugin if needed.
 	Version int
@@ -40,6 +43,9 @@ type PluginInfo struct {
 	// Set to true if the plugin accepts free form args (i.e. any
 	// keyword args).
 	FreeFormArgs bool
+
+	// The side effects of calling the plugin. See ImpactPolicy.
+	Impact Impact
 }
 
 // Describe functions.
@@ -64,6 +70,9 @@ type FunctionInfo struct {
 	// Set to true if the plugin accepts free form args (i.e. any
 	// keyword args).
 	FreeFormArgs bool
+
+	// The side effects of calling the function. See ImpactPolicy.
+	Impact Impact
 }
 
 // Describe a type. This is meant for human consumption so it does not
@@ -81,9 +90,27 @@ type TypeReference struct {
 	Target   string
 	Repeated bool
 	Tag      string
+
+	// The allowed values for the field if it has a choices
+	// directive.
+	Choices []string `json:",omitempty"`
+
+	// The default value applied by the arg parser if the field is
+	// not given.
+	Default string `json:",omitempty"`
 }
 
 // Map between type name and its description.
 type TypeMap struct {
 	desc *ordereddict.Dict
 }
+
+// Plugins which can start producing rows part way through (e.g. by
+// seeking) implement RowOffsetPlugin. When the caller will discard
+// the first rows of the plugin's output (e.g. when fetching a later
+// page with EvalPage) CallWithOffset is called instead of Call and
+// the plugin must not emit the first offset rows.
+type RowOffsetPlugin interface {
+	CallWithOffset(ctx context.Context, scope Scope,
+		args *ordereddict.Dict, offset int64) <-chan Row
+}
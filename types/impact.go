@@ -0,0 +1,86 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Impact describes the side effects of a plugin or function. It is a
+// bit mask so an operation may have several.
+type Impact int
+
+const (
+	// The zero value: the operation has no side effects.
+	ImpactReadOnly Impact = 0
+
+	ImpactFilesystemRead Impact = 1 << iota
+	ImpactFilesystemWrite
+	ImpactNetwork
+
+	// Sends rows to, or receives them from, the sinks and the
+	// event bus of the host.
+	ImpactHostSink
+)
+
+var impactNames = []struct {
+	impact Impact
+	name   string
+}{
+	{ImpactFilesystemRead, "filesystem-read"},
+	{ImpactFilesystemWrite, "filesystem-write"},
+	{ImpactNetwork, "network"},
+	{ImpactHostSink, "host-sink"},
+}
+
+func (self Impact) String() string {
+	if self == ImpactReadOnly {
+		return "read-only"
+	}
+
+	var names []string
+	for _, item := range impactNames {
+		if self&item.impact != 0 {
+			names = append(names, item.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// An ImpactPolicy decides if a plugin or function with side effects
+// may be called. It is only consulted for operations which are not
+// read-only. Returning an error blocks the call. A policy may also
+// ask the user for confirmation before returning.
+type ImpactPolicy interface {
+	Check(ctx context.Context, scope Scope, name string, impact Impact) error
+}
+
+// Adapts a plain function into an ImpactPolicy.
+type ImpactPolicyFunc func(ctx context.Context, scope Scope,
+	name string, impact Impact) error
+
+func (self ImpactPolicyFunc) Check(ctx context.Context, scope Scope,
+	name string, impact Impact) error {
+	return self(ctx, scope, name, impact)
+}
+
+// BlockImpact returns a policy which blocks any operation having one
+// of the impacts in the mask.
+func BlockImpact(mask Impact) ImpactPolicy {
+	return ImpactPolicyFunc(func(ctx context.Context, scope Scope,
+		name string, impact Impact) error {
+		if impact&mask != 0 {
+			return fmt.Errorf("%v operations are not allowed", impact&mask)
+		}
+		return nil
+	})
+}
+
+// The ImpactPolicy for the scope and its children.
+var ImpactPolicyOption = RegisterOption("impact_policy")
+
+func GetImpactPolicy(scope Scope) (ImpactPolicy, bool) {
+	value, _ := GetOption(scope, ImpactPolicyOption)
+	policy, ok := value.(ImpactPolicy)
+	return policy, ok && policy != nil
+}
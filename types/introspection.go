@@ -2,22 +2,24 @@ package types
 
 import (
 	"reflect"
-	"regexp"
 	"strings"
 
 	"github.com/Velocidex/ordereddict"
 	"www.velocidex.com/golang/vfilter/utils"
 )
 
-var (
-	field_regex = regexp.MustCompile("field=([a-zA-Z0-9_]+)")
-)
-
 type ScopeInformation struct {
 	Plugins   []*PluginInfo
 	Functions []*FunctionInfo
 }
 
+// The implementations of a protocol (as type names) in the order they
+// are tried.
+type ProtocolInformation struct {
+	Protocol        string
+	Implementations []string
+}
+
 func NewTypeMap() *TypeMap {
 	return &TypeMap{
 		desc: ordereddict.NewDict(),
@@ -103,25 +105,42 @@ func (self *TypeMap) addFields(scope Scope, a_type reflect.Type, desc *TypeDescr
 			Tag:    field_value.Tag.Get("vfilter"),
 		}
 
+		// The member filter only applies to this type - nested
+		// types are described with all their fields.
 		switch return_type.Kind() {
 		case reflect.Array, reflect.Slice:
 			element := return_type.Elem()
-			self.addType(scope, element, fields)
+			self.addType(scope, element, &[]string{})
 			return_type_descriptor.Target = canonicalTypeName(
 				return_type.Elem())
 			return_type_descriptor.Repeated = true
 
 		case reflect.Map, reflect.Ptr:
 			element := return_type.Elem()
-			self.addType(scope, element, fields)
+			self.addType(scope, element, &[]string{})
 			return_type_descriptor.Target = canonicalTypeName(
 				return_type.Elem())
+
+		case reflect.Struct:
+			self.addType(scope, return_type, &[]string{})
 		}
 
+		// Invalid tags are reported by the arg parser.
 		name := field_value.Name
-		m := field_regex.FindStringSubmatch(return_type_descriptor.Tag)
-		if len(m) > 1 {
-			name = m[1]
+		options, _ := ParseArgTag(return_type_descriptor.Tag)
+		field_name, pres := options["field"]
+		if pres {
+			name = field_name
+		}
+
+		choices, pres := options["choices"]
+		if pres {
+			return_type_descriptor.Choices = strings.Split(choices, "|")
+		}
+
+		default_str, pres := options["default"]
+		if pres {
+			return_type_descriptor.Default = default_str
 		}
 
 		desc.Fields.Set(name, &return_type_descriptor)
@@ -183,3 +202,19 @@ func (self *TypeMap) addMethods(scope Scope, a_type reflect.Type,
 		}
 	}
 }
+
+// Required is true if the field's vfilter tag marks it as required.
+func (self *TypeReference) Required() bool {
+	for _, directive := range strings.Split(self.Tag, ",") {
+		if directive == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// Doc returns the doc directive from the field's vfilter tag.
+func (self *TypeReference) Doc() string {
+	options, _ := ParseArgTag(self.Tag)
+	return options["doc"]
+}
@@ -0,0 +1,163 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+)
+
+// IPAddress is a parsed IPv4 or IPv6 address. Addresses compare
+// numerically, IPv4 addresses sort before IPv6 addresses.
+type IPAddress struct {
+	IP net.IP
+}
+
+func NewIPAddress(ip net.IP) IPAddress {
+	return IPAddress{IP: ip}
+}
+
+func (self IPAddress) String() string {
+	if self.IP == nil {
+		return ""
+	}
+	return self.IP.String()
+}
+
+func (self IPAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.String())
+}
+
+// Version is 4 for IPv4 (including IPv4 mapped IPv6) addresses and 6
+// otherwise.
+func (self IPAddress) Version() int64 {
+	if self.IP.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// IsPrivate is true for RFC 1918 IPv4 and RFC 4193 IPv6 addresses.
+func (self IPAddress) IsPrivate() bool {
+	for _, network := range privateNetworks {
+		if network.Contains(self.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self IPAddress) IsLoopback() bool {
+	return self.IP.IsLoopback()
+}
+
+func (self IPAddress) IsMulticast() bool {
+	return self.IP.IsMulticast()
+}
+
+func (self IPAddress) IsUnspecified() bool {
+	return self.IP.IsUnspecified()
+}
+
+var privateNetworks = func() []*net.IPNet {
+	var result []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		result = append(result, network)
+	}
+	return result
+}()
+
+// IPNetwork is a CIDR network like 10.0.0.0/8. An address is "in" a
+// network when the network contains it.
+type IPNetwork struct {
+	Network *net.IPNet
+}
+
+func NewIPNetwork(network *net.IPNet) IPNetwork {
+	return IPNetwork{Network: network}
+}
+
+func (self IPNetwork) String() string {
+	if self.Network == nil {
+		return ""
+	}
+	return self.Network.String()
+}
+
+func (self IPNetwork) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.String())
+}
+
+func (self IPNetwork) Contains(ip net.IP) bool {
+	return self.Network != nil && self.Network.Contains(ip)
+}
+
+// ToIP converts IPAddress, net.IP and address strings to a net.IP.
+func ToIP(a Any) (net.IP, bool) {
+	switch t := a.(type) {
+	case IPAddress:
+		return t.IP, t.IP != nil
+	case *IPAddress:
+		if t == nil {
+			return nil, false
+		}
+		return t.IP, t.IP != nil
+	case net.IP:
+		return t, t != nil
+	case string:
+		ip := net.ParseIP(strings.TrimSpace(t))
+		return ip, ip != nil
+	}
+	return nil, false
+}
+
+// ToIPNetwork converts IPNetwork, net.IPNet and CIDR strings to a
+// net.IPNet. A single address is a network containing only itself.
+func ToIPNetwork(a Any) (*net.IPNet, bool) {
+	switch t := a.(type) {
+	case IPNetwork:
+		return t.Network, t.Network != nil
+	case *IPNetwork:
+		if t == nil {
+			return nil, false
+		}
+		return t.Network, t.Network != nil
+	case *net.IPNet:
+		return t, t != nil
+	case string:
+		t = strings.TrimSpace(t)
+		if strings.Contains(t, "/") {
+			_, network, err := net.ParseCIDR(t)
+			return network, err == nil
+		}
+	}
+
+	ip, ok := ToIP(a)
+	if !ok {
+		return nil, false
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, true
+}
+
+// CompareIP orders addresses numerically with IPv4 addresses before
+// IPv6 addresses.
+func CompareIP(a, b net.IP) int {
+	a4, b4 := a.To4(), b.To4()
+	switch {
+	case a4 != nil && b4 != nil:
+		return bytes.Compare(a4, b4)
+	case a4 != nil:
+		return -1
+	case b4 != nil:
+		return 1
+	}
+	return bytes.Compare(a.To16(), b.To16())
+}
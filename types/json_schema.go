@@ -0,0 +1,197 @@
+package types
+
+import (
+	"strconv"
+
+	"github.com/Velocidex/ordereddict"
+)
+
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema exports a type collected in the type map (e.g. a
+// plugin's ArgType or RowType) as a JSON Schema. Struct types which
+// are referenced by the type's fields are placed in $defs.
+func (self *TypeMap) JSONSchema(type_name string) *ordereddict.Dict {
+	defs := ordereddict.NewDict()
+	result := ordereddict.NewDict().Set("$schema", JSONSchemaDialect)
+	mergeSchema(result, self.objectSchema(type_name, defs))
+
+	if defs.Len() > 0 {
+		result.Set("$defs", defs)
+	}
+	return result
+}
+
+// PluginJSONSchema describes the args of the plugin as a JSON Schema.
+func (self *TypeMap) PluginJSONSchema(info *PluginInfo) *ordereddict.Dict {
+	return self.callableSchema(info.Name, info.Doc, info.ArgType)
+}
+
+// FunctionJSONSchema describes the args of the function as a JSON
+// Schema.
+func (self *TypeMap) FunctionJSONSchema(info *FunctionInfo) *ordereddict.Dict {
+	return self.callableSchema(info.Name, info.Doc, info.ArgType)
+}
+
+func (self *TypeMap) callableSchema(name, doc, arg_type string) *ordereddict.Dict {
+	result := ordereddict.NewDict().
+		Set("$schema", JSONSchemaDialect).
+		Set("title", name)
+	if doc != "" {
+		result.Set("description", doc)
+	}
+
+	// Callables without args still take an empty object.
+	if arg_type == "" {
+		return result.Set("type", "object").
+			Set("properties", ordereddict.NewDict())
+	}
+
+	schema := self.JSONSchema(arg_type)
+	schema.Delete("$schema")
+	mergeSchema(result, schema)
+	return result
+}
+
+func (self *TypeMap) objectSchema(
+	type_name string, defs *ordereddict.Dict) *ordereddict.Dict {
+	properties := ordereddict.NewDict()
+	required := []string{}
+
+	result := ordereddict.NewDict().Set("type", "object")
+
+	desc, pres := self.Get(nil, type_name)
+	if !pres || desc == nil {
+		return result
+	}
+
+	for _, name := range desc.Fields.Keys() {
+		value, _ := desc.Fields.Get(name)
+		field, ok := value.(*TypeReference)
+		if !ok {
+			continue
+		}
+
+		properties.Set(name, self.fieldSchema(field, defs))
+		if field.Required() {
+			required = append(required, name)
+		}
+	}
+
+	result.Set("properties", properties)
+	if len(required) > 0 {
+		result.Set("required", required)
+	}
+	return result
+}
+
+func (self *TypeMap) fieldSchema(
+	field *TypeReference, defs *ordereddict.Dict) *ordereddict.Dict {
+	result := self.typeSchema(field.Target, defs)
+
+	if field.Repeated {
+		result = ordereddict.NewDict().
+			Set("type", "array").
+			Set("items", result)
+	}
+
+	doc := field.Doc()
+	if doc != "" {
+		result.Set("description", doc)
+	}
+
+	if len(field.Choices) > 0 {
+		result.Set("enum", field.Choices)
+	}
+
+	if field.Default != "" {
+		result.Set("default", schemaDefault(field.Target, field.Default))
+	}
+
+	return result
+}
+
+// Map a Go type name to its schema.
+func (self *TypeMap) typeSchema(
+	type_name string, defs *ordereddict.Dict) *ordereddict.Dict {
+	result := ordereddict.NewDict()
+
+	switch type_name {
+	case "string", "types.Bytes", "[]uint8":
+		return result.Set("type", "string")
+
+	case "bool":
+		return result.Set("type", "boolean")
+
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64":
+		return result.Set("type", "integer")
+
+	case "float32", "float64":
+		return result.Set("type", "number")
+
+	case "time.Time":
+		return result.Set("type", "string").Set("format", "date-time")
+
+	// Durations may be given in seconds or as a string like "1m".
+	case "time.Duration":
+		return result.Set("type", []string{"number", "string"})
+
+	// Queries produce a list of rows.
+	case "types.StoredQuery":
+		return result.Set("type", "array").
+			Set("items", ordereddict.NewDict().Set("type", "object"))
+
+	case "types.Any", "types.LazyExpr", "interface {}":
+		return result
+	}
+
+	// Struct types collected in the type map are referenced from
+	// $defs.
+	desc, pres := self.Get(nil, type_name)
+	if pres && desc != nil && desc.Fields.Len() > 0 {
+		_, pres := defs.Get(type_name)
+		if !pres {
+			// Add a placeholder first to stop recursive types
+			// from looping.
+			defs.Set(type_name, ordereddict.NewDict())
+			defs.Set(type_name, self.objectSchema(type_name, defs))
+		}
+		return result.Set("$ref", "#/$defs/"+type_name)
+	}
+
+	return result
+}
+
+// Defaults are given as strings in the tag so convert them to the
+// field's type where possible.
+func schemaDefault(type_name string, value string) Any {
+	switch type_name {
+	case "bool":
+		result, err := strconv.ParseBool(value)
+		if err == nil {
+			return result
+		}
+
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64":
+		result, err := strconv.ParseInt(value, 0, 64)
+		if err == nil {
+			return result
+		}
+
+	case "float32", "float64":
+		result, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return result
+		}
+	}
+	return value
+}
+
+func mergeSchema(result *ordereddict.Dict, other *ordereddict.Dict) {
+	for _, k := range other.Keys() {
+		v, _ := other.Get(k)
+		result.Set(k, v)
+	}
+}
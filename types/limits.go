@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+// QueryLimits bound the resources queries evaluated in a scope may
+// use. They are intended for running untrusted queries. A zero value
+// means no limit.
+type QueryLimits struct {
+	// The maximum number of rows each query (including its
+	// subqueries) may read from plugins. Queries stop reading rows
+	// once this is exceeded.
+	MaxRowsScanned uint64
+
+	// The maximum nesting depth of subqueries and stored
+	// expressions. It can only lower the builtin limit.
+	MaxStackDepth int
+
+	// The maximum time each query may run for.
+	Timeout time.Duration
+}
+
+// The *QueryLimits for the scope and its children.
+var QueryLimitsOption = RegisterOption("query_limits")
+
+// GetQueryLimits returns the limits set on the scope.
+func GetQueryLimits(scope Scope) (*QueryLimits, bool) {
+	value, _ := GetOption(scope, QueryLimitsOption)
+	limits, ok := value.(*QueryLimits)
+	return limits, ok && limits != nil
+}
@@ -0,0 +1,25 @@
+package types
+
+// How the IN operator tests membership of a dict.
+const (
+	// x IN dict(...) is true if x is one of the keys (the default).
+	DictMembershipKeys = "keys"
+
+	// x IN dict(...) is true if x equals one of the values.
+	DictMembershipValues = "values"
+)
+
+// Selects whether the IN operator tests the keys or the values of a
+// dict.
+var DictMembershipOption = RegisterOption("dict_membership")
+
+// GetDictMembership returns DictMembershipKeys or
+// DictMembershipValues.
+func GetDictMembership(scope Scope) string {
+	value, _ := GetOption(scope, DictMembershipOption)
+	mode, _ := value.(string)
+	if mode == DictMembershipValues {
+		return mode
+	}
+	return DictMembershipKeys
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"math"
+	"strconv"
+)
+
+// Integers with a larger magnitude than this can not be represented
+// exactly by JSON parsers which use doubles (e.g. Javascript).
+const MaxSafeJSONInteger = 1 << 53
+
+// NumberFormat controls how numbers are encoded when rows are
+// normalized for output (e.g. by RowToDict and OutputJSON).
+type NumberFormat struct {
+	// Encode integers outside +/- 2^53 as strings so they survive
+	// parsers which use doubles.
+	StringifyLargeInts bool
+
+	// Round floats to this many decimal places. A negative value
+	// leaves floats untouched.
+	FloatPrecision int
+}
+
+func NewNumberFormat() *NumberFormat {
+	return &NumberFormat{FloatPrecision: -1}
+}
+
+// The *NumberFormat used for the scope and all its children.
+var NumberFormatOption = RegisterOption("number_format")
+
+// GetNumberFormat returns the number format set on the scope or nil
+// if numbers should be left as they are.
+func GetNumberFormat(scope Scope) *NumberFormat {
+	value, _ := GetOption(scope, NumberFormatOption)
+	format, _ := value.(*NumberFormat)
+	return format
+}
+
+// FormatInt applies the format to a signed integer.
+func (self *NumberFormat) FormatInt(value int64) Any {
+	if self.StringifyLargeInts &&
+		(value > MaxSafeJSONInteger || value < -MaxSafeJSONInteger) {
+		return strconv.FormatInt(value, 10)
+	}
+	return value
+}
+
+// FormatUint applies the format to an unsigned integer.
+func (self *NumberFormat) FormatUint(value uint64) Any {
+	if self.StringifyLargeInts && value > MaxSafeJSONInteger {
+		return strconv.FormatUint(value, 10)
+	}
+	return value
+}
+
+// FormatFloat applies the format to a float.
+func (self *NumberFormat) FormatFloat(value float64) Any {
+	if self.FloatPrecision < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+
+	rounded, err := strconv.ParseFloat(
+		strconv.FormatFloat(value, 'f', self.FloatPrecision, 64), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"fmt"
+	"sync"
+)
+
+// An Option is a setting which the host stores in a scope to change
+// how queries evaluated in the scope and its children behave. Each
+// option is registered once under a unique name.
+type Option struct {
+	name string
+
+	// Options are stored in the scope's context under this key.
+	context_key string
+}
+
+var (
+	options_mu sync.Mutex
+	options    = make(map[string]bool)
+)
+
+// RegisterOption returns the option for the name. Registering the
+// same name twice is a programming error.
+func RegisterOption(name string) Option {
+	options_mu.Lock()
+	defer options_mu.Unlock()
+
+	if options[name] {
+		panic(fmt.Sprintf("Option %v is already registered", name))
+	}
+	options[name] = true
+	return Option{name: name, context_key: "$option:" + name}
+}
+
+func (self Option) String() string {
+	return self.name
+}
+
+func (self Option) key() string {
+	return self.context_key
+}
+
+// SetOption sets the option's value for the scope and its children.
+func SetOption(scope Scope, option Option, value Any) {
+	scope.SetContext(option.key(), value)
+}
+
+// GetOption returns the option's value if it was set.
+func GetOption(scope Scope, option Option) (Any, bool) {
+	return scope.GetContext(option.key())
+}
+
+// IsOptionEnabled returns the value of a boolean option. Options
+// which are not set are false.
+func IsOptionEnabled(scope Scope, option Option) bool {
+	value, _ := GetOption(scope, option)
+	enabled, _ := value.(bool)
+	return enabled
+}
+
+// Replaces the option's value with the one update() derives from
+// it. The old value may be shared with other scopes (e.g. forks of
+// the scope) so update() must return a new value rather than
+// modifying the old one.
+func updateOption(scope Scope, option Option, update func(old Any) Any) {
+	options_mu.Lock()
+	defer options_mu.Unlock()
+
+	value, _ := GetOption(scope, option)
+	SetOption(scope, option, update(value))
+}
+
+// Boolean options which are all off by default.
+var (
+	// How the WHERE clause is interpreted. By default the WHERE
+	// clause may evaluate to any value which is converted to a
+	// boolean using the Bool protocol (e.g. empty strings, arrays
+	// and dicts are false). In strict mode the WHERE clause must
+	// evaluate to an actual boolean. Other values reject the row and
+	// log an error.
+	StrictBoolOption = RegisterOption("strict_bool")
+
+	// How arithmetic treats operands it can not combine. By default
+	// an operation on mismatched types (e.g. 1 + 'foo') silently
+	// gives NULL. In strict mode this is an error which is logged
+	// and reported to the query error handler (see
+	// WithQueryErrorHandler). Operations on NULL still give NULL.
+	StrictArithmeticOption = RegisterOption("strict_arithmetic")
+
+	// How LET treats existing names. By default a LET silently
+	// replaces earlier variables of the same name and only warns
+	// when masking a builtin function. In strict mode redefining a
+	// variable or masking a function or plugin is an error and the
+	// LET is ignored. Variables can be removed with UNLET before
+	// being defined again.
+	StrictScopingOption = RegisterOption("strict_scoping")
+
+	// How the =~ operator treats dicts. By default dicts never
+	// match. With deep matching a dict matches if any of its values
+	// (including values of nested dicts and arrays) match, which is
+	// useful to search for a needle anywhere in a structured row.
+	DeepRegexOption = RegisterOption("deep_regex")
+
+	// How strings are indexed and sliced. By default strings are
+	// indexed by byte (so "Hello"[1] is 101). When rune indexing is
+	// enabled, indexes and ranges refer to unicode characters and
+	// indexing a string returns a single character string.
+	RuneIndexingOption = RegisterOption("rune_indexing")
+
+	// The level of the log messages emitted when a query refers to
+	// a symbol which is not in the scope. By default these are
+	// errors but some callers expect symbols to be missing (e.g.
+	// when columns are optional) and prefer them to be logged as
+	// warnings.
+	WarnOnMissingSymbolsOption = RegisterOption("warn_on_missing_symbols")
+
+	// Allows queries in the scope to see the values of columns the
+	// RedactionPolicyOption marks as sensitive.
+	RedactionPrivilegeOption = RegisterOption("redaction_privilege")
+
+	// Makes LET statements record where they defined each variable
+	// so tools (e.g. the vars() plugin) can explain where a variable
+	// came from.
+	TrackVarOriginsOption = RegisterOption("track_var_origins")
+)
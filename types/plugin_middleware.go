@@ -0,0 +1,27 @@
+package types
+
+import (
+	"context"
+
+	"github.com/Velocidex/ordereddict"
+)
+
+// PluginCall has the same signature as PluginGeneratorInterface.Call.
+type PluginCall func(
+	ctx context.Context, scope Scope, args *ordereddict.Dict) <-chan Row
+
+// A PluginMiddleware wraps every plugin call made by a query. It
+// receives the name the plugin was called by and the next call in the
+// chain. The middleware may inspect or alter the args, wrap the output
+// channel or not call next at all. Middleware registered first is the
+// outermost.
+type PluginMiddleware func(ctx context.Context, scope Scope, name string,
+	args *ordereddict.Dict, next PluginCall) <-chan Row
+
+// A PluginSemaphore limits the number of concurrent calls of a
+// plugin. See Scope.SetPluginConcurrency().
+type PluginSemaphore interface {
+	// Wait for a free slot or until the context is done.
+	Acquire(ctx context.Context) error
+	Release()
+}
@@ -0,0 +1,29 @@
+package types
+
+// A StringPredicate is a simple test of the string value of a
+// column, e.g. starts_with(string=Name, prefix='svc'). A plugin
+// which is able to evaluate such tests itself (for example using an
+// index) may use them to avoid producing rows which the WHERE clause
+// rejects anyway.
+type StringPredicate struct {
+	// The name of the predicate function, e.g. starts_with
+	Operator string
+
+	// The column being tested.
+	Column string
+
+	// The literal value it is compared with.
+	Value string
+
+	CaseSensitive bool
+}
+
+// Functions implementing StringPredicateFunction are pure string
+// tests which can be recognized in WHERE clauses. The tested string
+// is passed in the "string" arg and is compared with the arg named
+// by ValueArg(). An optional case_sensitive arg controls the case
+// sensitivity of the test.
+type StringPredicateFunction interface {
+	FunctionInterface
+	ValueArg() string
+}
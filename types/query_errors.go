@@ -0,0 +1,57 @@
+package types
+
+import (
+	"context"
+	"fmt"
+)
+
+// A QueryErrorHandler receives errors from a query that would
+// otherwise crash it (e.g. a panic in a VQL function).
+type QueryErrorHandler func(err error)
+
+type queryErrorHandlerKey int
+
+const queryErrorHandlerKeyValue queryErrorHandlerKey = 0
+
+// WithQueryErrorHandler asks queries evaluated in the returned context
+// to recover from panics and report them to the handler instead. The
+// query producing the error stops but its caller carries on. Without
+// a handler panics are not recovered.
+//
+// Go can only recover a panic in the goroutine which raised it. The
+// query recovers panics in its own goroutines and while calling a
+// plugin, but plugins which produce their rows in a goroutine must
+// defer RecoverQueryError() in it to have its panics reported.
+func WithQueryErrorHandler(
+	ctx context.Context, handler QueryErrorHandler) context.Context {
+	return context.WithValue(ctx, queryErrorHandlerKeyValue, handler)
+}
+
+func GetQueryErrorHandler(ctx context.Context) (QueryErrorHandler, bool) {
+	handler, ok := ctx.Value(queryErrorHandlerKeyValue).(QueryErrorHandler)
+	return handler, ok && handler != nil
+}
+
+// RecoverQueryError reports a panic to the query's error handler. It
+// must be deferred directly, e.g. at the top of the goroutine a
+// plugin sends its rows from:
+//
+//	go func() {
+//	    defer close(output_chan)
+//	    defer types.RecoverQueryError(ctx, scope)
+//	    ...
+//	}()
+//
+// Without a handler the panic propagates as usual.
+func RecoverQueryError(ctx context.Context, scope Scope) {
+	handler, ok := GetQueryErrorHandler(ctx)
+	if !ok {
+		return
+	}
+
+	r := recover()
+	if r != nil {
+		scope.Log("ERROR:PANIC: %v", r)
+		handler(fmt.Errorf("panic: %v", r))
+	}
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// A QueryReport summarizes the resources used by a query. The counts
+// only include the work done for the query (including the stored
+// queries it reads), not that of other queries in the same scope.
+type QueryReport struct {
+	// The query as formatted VQL.
+	Query string
+
+	RowsScanned     uint64
+	RowsEmitted     uint64
+	PluginsCalled   uint64
+	FunctionsCalled uint64
+	Duration        time.Duration
+
+	// The bytes allocated on the heap by the whole process when
+	// the query completed (runtime.MemStats.HeapAlloc). This is
+	// neither specific to the query nor its peak usage, but gives
+	// an idea of the memory in use when queries complete.
+	HeapAllocAtEnd uint64
+}
+
+// Only the reports of the most recent queries are kept.
+const MaxQueryReports = 100
+
+var queryReportsOption = RegisterOption("query_reports")
+
+// When enabled, the last item sent on the output channel of a query
+// is its *QueryReport rather than a row. Callers which read the
+// channel must check for it.
+var QueryReportTrailerOption = RegisterOption("query_report_trailer")
+
+type queryReports struct {
+	mu      sync.Mutex
+	reports []*QueryReport
+}
+
+// EnableQueryReports asks queries evaluated in the scope to record a
+// QueryReport when they complete. The report is recorded before the
+// query's output channel is closed.
+func EnableQueryReports(scope Scope) {
+	SetOption(scope, queryReportsOption, &queryReports{})
+}
+
+func IsQueryReportsEnabled(scope Scope) bool {
+	value, _ := GetOption(scope, queryReportsOption)
+	_, ok := value.(*queryReports)
+	return ok
+}
+
+// AddQueryReport records the report of a completed query. It does
+// nothing unless reports were enabled with EnableQueryReports().
+func AddQueryReport(scope Scope, report *QueryReport) {
+	value, _ := GetOption(scope, queryReportsOption)
+	reports, ok := value.(*queryReports)
+	if !ok {
+		return
+	}
+
+	reports.mu.Lock()
+	defer reports.mu.Unlock()
+
+	if len(reports.reports) >= MaxQueryReports {
+		reports.reports = append(reports.reports[:0:0],
+			reports.reports[len(reports.reports)-MaxQueryReports+1:]...)
+	}
+	reports.reports = append(reports.reports, report)
+}
+
+// GetQueryReports returns the reports of the last MaxQueryReports
+// queries completed in the scope in the order they completed.
+func GetQueryReports(scope Scope) []*QueryReport {
+	value, _ := GetOption(scope, queryReportsOption)
+	reports, ok := value.(*queryReports)
+	if !ok {
+		return nil
+	}
+
+	reports.mu.Lock()
+	defer reports.mu.Unlock()
+	return append([]*QueryReport{}, reports.reports...)
+}
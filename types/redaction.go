@@ -0,0 +1,218 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Velocidex/ordereddict"
+)
+
+// Sensitive values are replaced by this marker unless the policy
+// specifies another.
+const RedactedMarker = "<REDACTED>"
+
+// The *RedactionPolicy for the scope. A nil policy disables
+// redaction.
+var RedactionPolicyOption = RegisterOption("redaction_policy")
+
+// A RedactionPolicy marks columns as sensitive. Unless the scope has
+// the redaction privilege, sensitive values are replaced as they
+// enter the query: in the rows plugins produce and in the variables
+// the scope resolves, including dicts and arrays nested inside
+// them. Aliases, expressions and the WHERE clause therefore only see
+// the marker. Rows emitted by a SELECT are checked again so columns
+// named after a sensitive column are also redacted.
+//
+// Values the query builds itself (e.g. a dict() literal) are not
+// redacted until they are emitted, and struct values are only
+// redacted by type, not by their field names.
+type RedactionPolicy struct {
+	// Column names are matched case insensitively.
+	Columns []string
+
+	// Values of these types are redacted in any column.
+	Types []reflect.Type
+
+	// Replaces redacted values. If nil, RedactedMarker is used.
+	Marker Any
+}
+
+// IsSensitive returns true if the value of the column must be
+// redacted.
+func (self *RedactionPolicy) IsSensitive(column string, value Any) bool {
+	for _, name := range self.Columns {
+		if strings.EqualFold(name, column) {
+			return true
+		}
+	}
+
+	return self.isSensitiveType(value)
+}
+
+func (self *RedactionPolicy) isSensitiveType(value Any) bool {
+	if len(self.Types) == 0 || value == nil {
+		return false
+	}
+
+	value_type := reflect.TypeOf(value)
+	for _, sensitive := range self.Types {
+		if value_type == sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns the value with its sensitive parts replaced by the
+// marker. Dicts and arrays are searched recursively and copied when
+// they contain sensitive values since they may be shared.
+func (self *RedactionPolicy) Redact(value Any) Any {
+	if self.isSensitiveType(value) {
+		return self.GetMarker()
+	}
+
+	switch t := value.(type) {
+	case nil, string, []byte:
+		return value
+
+	case *ordereddict.Dict:
+		return self.RedactDict(t)
+	}
+
+	// Arrays of any type are returned as []Any if they need to be
+	// changed.
+	array := reflect.ValueOf(value)
+	if array.Kind() != reflect.Slice {
+		return value
+	}
+
+	var result []Any
+	for i := 0; i < array.Len(); i++ {
+		item := array.Index(i).Interface()
+		redacted := self.Redact(item)
+		if result == nil {
+			if isSame(redacted, item) {
+				continue
+			}
+
+			// Copy the items we have skipped so far.
+			result = make([]Any, 0, array.Len())
+			for j := 0; j < i; j++ {
+				result = append(result, array.Index(j).Interface())
+			}
+		}
+		result = append(result, redacted)
+	}
+
+	if result == nil {
+		return value
+	}
+	return result
+}
+
+// RedactColumn redacts the value of a column (or variable) with the
+// given name.
+func (self *RedactionPolicy) RedactColumn(column string, value Any) Any {
+	if self.IsSensitive(column, nil) {
+		return self.GetMarker()
+	}
+	return self.Redact(value)
+}
+
+// RedactDict returns the dict with its sensitive columns
+// redacted. The dict is copied if any column changes.
+func (self *RedactionPolicy) RedactDict(dict *ordereddict.Dict) *ordereddict.Dict {
+	var result *ordereddict.Dict
+	keys := dict.Keys()
+	for idx, column := range keys {
+		value, _ := dict.Get(column)
+		redacted := self.RedactColumn(column, value)
+		if result == nil {
+			if isSame(redacted, value) {
+				continue
+			}
+
+			// Copy the columns we have skipped so far.
+			result = ordereddict.NewDict()
+			for _, previous := range keys[:idx] {
+				previous_value, _ := dict.Get(previous)
+				result.Set(previous, previous_value)
+			}
+		}
+		result.Set(column, redacted)
+	}
+
+	if result == nil {
+		return dict
+	}
+	return result
+}
+
+// Values which are not comparable (e.g. slices) are only unchanged
+// if Redact returned them as they were.
+func isSame(a, b Any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	a_value := reflect.ValueOf(a)
+	b_value := reflect.ValueOf(b)
+	if a_value.Type() != b_value.Type() {
+		return false
+	}
+
+	switch a_value.Kind() {
+	case reflect.Slice:
+		return a_value.Pointer() == b_value.Pointer() &&
+			a_value.Len() == b_value.Len()
+	case reflect.Map, reflect.Func:
+		return a_value.Pointer() == b_value.Pointer()
+	}
+	if !a_value.Type().Comparable() {
+		return false
+	}
+	return a == b
+}
+
+func (self *RedactionPolicy) GetMarker() Any {
+	if self.Marker == nil {
+		return RedactedMarker
+	}
+	return self.Marker
+}
+
+func (self *RedactionPolicy) String() string {
+	parts := []string{}
+	if len(self.Columns) > 0 {
+		parts = append(parts, fmt.Sprintf("columns %v",
+			strings.Join(self.Columns, ", ")))
+	}
+	if len(self.Types) > 0 {
+		names := []string{}
+		for _, t := range self.Types {
+			names = append(names, t.String())
+		}
+		parts = append(parts, fmt.Sprintf("types %v",
+			strings.Join(names, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// GetActiveRedactionPolicy returns the policy to apply in the scope
+// or nil if there is none or the scope has the redaction privilege.
+func GetActiveRedactionPolicy(scope Scope) *RedactionPolicy {
+	policy := GetRedactionPolicy(scope)
+	if policy == nil || IsOptionEnabled(scope, RedactionPrivilegeOption) {
+		return nil
+	}
+	return policy
+}
+
+// GetRedactionPolicy returns the scope's redaction policy or nil if
+// there is none.
+func GetRedactionPolicy(scope Scope) *RedactionPolicy {
+	value, _ := GetOption(scope, RedactionPolicyOption)
+	policy, _ := value.(*RedactionPolicy)
+	return policy
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"runtime"
+
+	"github.com/Velocidex/ordereddict"
 )
 
 // A ScopeMaterializer handles VQL Let Materialize operators (<=). The
@@ -27,6 +29,11 @@ type Scope interface {
 	// Copy the scope and create a subscope child.
 	Copy() Scope
 
+	// Make a cheap read only scope sharing this scope's vars and
+	// definitions. Forks may be used by concurrent queries.
+	ForkReadOnly() Scope
+	IsReadOnly() bool
+
 	// The scope context is a global k/v store. It is inherited into
 	// subscopes so should be used to store global data. It is not
 	// accessible from VQL itself.
@@ -73,6 +80,17 @@ type Scope interface {
 	AppendVars(row Row) Scope
 	Resolve(field string) (interface{}, bool)
 
+	// Like AppendVars but the vars may not be changed after they
+	// are added, which allows them to be resolved quickly.
+	AppendDefinitions(vars *ordereddict.Dict) Scope
+
+	// Define variables which queries may not redefine with LET.
+	DefineConstants(vars *ordereddict.Dict) Scope
+
+	// The names of all the variables visible in the scope, in the
+	// order they were defined.
+	VarNames() []string
+
 	// Program a custom sorter
 	SetSorter(sorter Sorter)
 	SetGrouper(grouper Grouper)
@@ -85,9 +103,20 @@ type Scope interface {
 
 	// We can program the scope's protocols
 	AddProtocolImpl(implementations ...Any) Scope
+	AddProtocolImplBefore(anchor Any, implementations ...Any) Scope
+	AddProtocolImplAfter(anchor Any, implementations ...Any) Scope
+	DescribeProtocols() []*ProtocolInformation
 	AppendFunctions(functions ...FunctionInterface) Scope
 	AppendPlugins(plugins ...PluginGeneratorInterface) Scope
 
+	// Atomically add or replace functions and plugins while queries
+	// are running. Running queries keep the definitions pinned
+	// when they started.
+	ReplaceDefinitions(functions []FunctionInterface,
+		plugins []PluginGeneratorInterface)
+	PinDefinitions()
+	DefinitionsVersion() uint64
+
 	// Logging and performance monitoring.
 	SetLogger(logger *log.Logger)
 	SetTracer(logger *log.Logger)
@@ -108,6 +137,26 @@ type Scope interface {
 	Describe(type_map *TypeMap) *ScopeInformation
 	CheckForOverflow() bool
 
+	// Sinks are host provided destinations for rows. They are
+	// stored in the scope context so are visible to all subscopes.
+	RegisterSink(name string, sink RowSink)
+	GetSink(name string) (RowSink, bool)
+
+	// Middleware wraps all plugin calls. It is shared with
+	// subscopes made by Copy(). NewScope() starts the new scope
+	// with a copy of the middleware, so middleware added later to
+	// either scope does not affect the other.
+	AddPluginMiddleware(middleware PluginMiddleware)
+	GetPluginMiddleware() []PluginMiddleware
+
+	// Limit the number of concurrent calls of a plugin. This is
+	// shared by all subscopes. A limit of 0 removes the limit.
+	SetPluginConcurrency(name string, limit int)
+
+	// Returns the semaphore limiting the concurrent calls of the
+	// plugin or false if its calls are not limited.
+	GetPluginSemaphore(name string) (PluginSemaphore, bool)
+
 	// Charge an op to the throttler.
 	ChargeOp()
 	SetThrottler(t Throttler)
@@ -0,0 +1,17 @@
+package types
+
+import "context"
+
+// A RowSink is a host provided destination for rows. Sinks are
+// registered on the scope with RegisterSink() and may be written to
+// from VQL using plugins like write_to() and tee().
+type RowSink interface {
+	Write(ctx context.Context, scope Scope, row Row) error
+}
+
+// Adapts a plain function into a RowSink.
+type RowSinkFunc func(ctx context.Context, scope Scope, row Row) error
+
+func (self RowSinkFunc) Write(ctx context.Context, scope Scope, row Row) error {
+	return self(ctx, scope, row)
+}
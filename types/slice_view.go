@@ -0,0 +1,78 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// A SliceView is a window onto part of an array. Slicing an array
+// (e.g. X[2:100000]) returns a view rather than a copy so windows
+// over large arrays are cheap to index, slice again and iterate
+// over. Elements are converted as they are read so nil pointers
+// become NULL.
+//
+// A view is a LazyExpr: anything which needs a real array reduces
+// it to a []Any copy of the window.
+type SliceView struct {
+	array      reflect.Value
+	start, end int
+}
+
+// NewSliceView returns a view of array[start:end]. The array must be
+// a slice and the range must be within it.
+func NewSliceView(array Any, start, end int) *SliceView {
+	return &SliceView{
+		array: reflect.Indirect(reflect.ValueOf(array)),
+		start: start,
+		end:   end,
+	}
+}
+
+func (self *SliceView) Len() int {
+	return self.end - self.start
+}
+
+// Index returns the element at idx within the view.
+func (self *SliceView) Index(idx int) Any {
+	value := self.array.Index(self.start + idx)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return &Null{}
+	}
+	return value.Interface()
+}
+
+// Slice returns a view of self[start:end] which shares the same
+// array.
+func (self *SliceView) Slice(start, end int) *SliceView {
+	return &SliceView{
+		array: self.array,
+		start: self.start + start,
+		end:   self.start + end,
+	}
+}
+
+// ToArray copies the window into a new array.
+func (self *SliceView) ToArray() []Any {
+	result := make([]Any, 0, self.Len())
+	for i := 0; i < self.Len(); i++ {
+		result = append(result, self.Index(i))
+	}
+	return result
+}
+
+func (self *SliceView) Reduce(ctx context.Context) Any {
+	return self.ToArray()
+}
+
+func (self *SliceView) ReduceWithScope(ctx context.Context, scope Scope) Any {
+	return self.ToArray()
+}
+
+func (self *SliceView) Materialize(ctx context.Context, scope Scope) Any {
+	return self.ToArray()
+}
+
+func (self *SliceView) MarshalJSON() ([]byte, error) {
+	return json.Marshal(self.ToArray())
+}
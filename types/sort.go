@@ -10,3 +10,15 @@ type Sorter interface {
 		key string,
 		desc bool) <-chan Row
 }
+
+// A TopNSorter is a Sorter which can avoid holding all the rows in
+// memory when only the first limit rows of the sorted output are
+// needed.
+type TopNSorter interface {
+	SortTopN(ctx context.Context,
+		scope Scope,
+		input <-chan Row,
+		key string,
+		desc bool,
+		limit int) <-chan Row
+}
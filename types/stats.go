@@ -22,20 +22,35 @@ type Stats struct {
 
 	// Number of subscopes created.
 	_ScopeCopy uint64
+
+	// Number of stored query expansions served from the cache.
+	_StoredQueryCacheHit uint64
 }
 
 func (self *Stats) IncRowsScanned() {
 	atomic.AddUint64(&self._RowsScanned, uint64(1))
 }
 
+func (self *Stats) RowsScanned() uint64 {
+	return atomic.LoadUint64(&self._RowsScanned)
+}
+
 func (self *Stats) IncPluginsCalled() {
 	atomic.AddUint64(&self._PluginsCalled, uint64(1))
 }
 
+func (self *Stats) PluginsCalled() uint64 {
+	return atomic.LoadUint64(&self._PluginsCalled)
+}
+
 func (self *Stats) IncFunctionsCalled() {
 	atomic.AddUint64(&self._FunctionsCalled, uint64(1))
 }
 
+func (self *Stats) FunctionsCalled() uint64 {
+	return atomic.LoadUint64(&self._FunctionsCalled)
+}
+
 func (self *Stats) IncProtocolSearch(i int) {
 	atomic.AddUint64(&self._ProtocolSearch, uint64(i))
 }
@@ -44,11 +59,16 @@ func (self *Stats) IncScopeCopy() {
 	atomic.AddUint64(&self._ScopeCopy, uint64(1))
 }
 
+func (self *Stats) IncStoredQueryCacheHit() {
+	atomic.AddUint64(&self._StoredQueryCacheHit, uint64(1))
+}
+
 func (self *Stats) Snapshot() *ordereddict.Dict {
 	return ordereddict.NewDict().
 		Set("RowsScanned", atomic.LoadUint64(&self._RowsScanned)).
 		Set("PluginsCalled", atomic.LoadUint64(&self._PluginsCalled)).
 		Set("FunctionsCalled", atomic.LoadUint64(&self._FunctionsCalled)).
 		Set("ProtocolSearch", atomic.LoadUint64(&self._ProtocolSearch)).
-		Set("ScopeCopy", atomic.LoadUint64(&self._ScopeCopy))
+		Set("ScopeCopy", atomic.LoadUint64(&self._ScopeCopy)).
+		Set("StoredQueryCacheHit", atomic.LoadUint64(&self._StoredQueryCacheHit))
 }
@@ -44,6 +44,9 @@ func ToString(ctx context.Context,
 	case []byte:
 		return string(t)
 
+	case Bytes:
+		return string(t)
+
 	default:
 		return fmt.Sprintf("%v", t)
 	}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"time"
+)
+
+// TimeSerializationProtocol controls how time values are encoded
+// when rows are normalized for output (e.g. by RowToDict and
+// OutputJSON). By default times are left as they are, so the
+// encoder's formatting (including the local zone) is used.
+type TimeSerializationProtocol interface {
+	SerializeTime(value time.Time) Any
+}
+
+// RFC3339TimeSerializer renders times as RFC3339 strings in a fixed
+// location so output does not depend on the zone of the host.
+type RFC3339TimeSerializer struct {
+	// The location to render times in. If nil, times are rendered
+	// in UTC.
+	Location *time.Location
+}
+
+func NewRFC3339TimeSerializer(location *time.Location) *RFC3339TimeSerializer {
+	return &RFC3339TimeSerializer{Location: location}
+}
+
+func (self *RFC3339TimeSerializer) SerializeTime(value time.Time) Any {
+	location := self.Location
+	if location == nil {
+		location = time.UTC
+	}
+	return value.In(location).Format(time.RFC3339Nano)
+}
+
+// The TimeSerializationProtocol used for the scope and all its
+// children.
+var TimeSerializerOption = RegisterOption("time_serializer")
+
+// GetTimeSerializer returns the time serializer set on the scope or
+// nil if times should be left as they are.
+func GetTimeSerializer(scope Scope) TimeSerializationProtocol {
+	value, _ := GetOption(scope, TimeSerializerOption)
+	serializer, _ := value.(TimeSerializationProtocol)
+	return serializer
+}
@@ -0,0 +1,41 @@
+package types
+
+import "context"
+
+// A Span is a unit of traced work. It is the small subset of the
+// OpenTelemetry span API which VQL needs so adapting a real tracer is
+// trivial and vfilter does not depend on any tracing library.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+// A QueryTracer starts spans for VQL execution. A span is started for
+// each query, each plugin call and each materialization. The returned
+// context carries the new span so spans started while it is open
+// become its children.
+type QueryTracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Names of the spans and attributes reported to a QueryTracer.
+const (
+	QuerySpan       = "vql.query"
+	PluginSpan      = "vql.plugin"
+	MaterializeSpan = "vql.materialize"
+
+	QueryAttribute  = "vql.query"
+	PluginAttribute = "vql.plugin.name"
+	NameAttribute   = "vql.name"
+	RowsAttribute   = "vql.rows"
+)
+
+// Setting a QueryTracer enables tracing for the scope and its
+// children.
+var QueryTracerOption = RegisterOption("query_tracer")
+
+func GetQueryTracer(scope Scope) (QueryTracer, bool) {
+	value, _ := GetOption(scope, QueryTracerOption)
+	tracer, ok := value.(QueryTracer)
+	return tracer, ok && tracer != nil
+}
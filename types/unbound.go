@@ -0,0 +1,5 @@
+package types
+
+// Unbound is stored in the scope by UNLET to mask earlier bindings
+// of a variable. Resolving the variable then reports it as absent.
+type Unbound struct{}
@@ -0,0 +1,36 @@
+package types
+
+import "github.com/Velocidex/ordereddict"
+
+// Origins are kept in the same scope level as the variable under
+// this prefix so they go away with the variable. Names starting with
+// $ are not listed as variables.
+const varOriginPrefix = "$origin:"
+
+// The origin is only formatted when it is asked for.
+type varOrigin func() string
+
+// SetVarOrigin records the origin of a variable in the scope level
+// which defines it, if tracking is enabled.
+func SetVarOrigin(scope Scope, level *ordereddict.Dict,
+	name string, origin func() string) {
+	if IsOptionEnabled(scope, TrackVarOriginsOption) {
+		level.Set(varOriginPrefix+name, varOrigin(origin))
+	}
+}
+
+// GetVarOrigin returns the statement which defined the variable or
+// an empty string if it was not defined by a statement (e.g. it was
+// provided by the host application) or tracking was not enabled.
+func GetVarOrigin(scope Scope, name string) string {
+	value, pres := scope.Resolve(varOriginPrefix + name)
+	if !pres {
+		return ""
+	}
+
+	origin, ok := value.(varOrigin)
+	if !ok {
+		return ""
+	}
+	return origin()
+}
@@ -11,6 +11,22 @@ import (
 	"www.velocidex.com/golang/vfilter/types"
 )
 
+// Output options set on the scope which control how values are
+// encoded.
+type outputFormat struct {
+	numbers *types.NumberFormat
+	times   types.TimeSerializationProtocol
+}
+
+func getOutputFormat(scope types.Scope) *outputFormat {
+	numbers := types.GetNumberFormat(scope)
+	times := types.GetTimeSerializer(scope)
+	if numbers == nil && times == nil {
+		return nil
+	}
+	return &outputFormat{numbers: numbers, times: times}
+}
+
 // RowToDict reduces the row into a simple Dict. This materializes any
 // lazy queries that are stored in the row into a stable materialized
 // dict.
@@ -18,13 +34,15 @@ func RowToDict(
 	ctx context.Context,
 	scope types.Scope, row types.Row) *ordereddict.Dict {
 
+	format := getOutputFormat(scope)
+
 	// Even if it is already a dict we still need to iterate its
 	// values to make sure they are fully materialized.
 	result := ordereddict.NewDict()
 	for _, column := range scope.GetMembers(row) {
 		value, pres := scope.Associative(row, column)
 		if pres {
-			result.Set(column, normalize_value(ctx, scope, value, 0))
+			result.Set(column, normalize_value(ctx, scope, value, format, 0))
 		}
 	}
 
@@ -34,7 +52,8 @@ func RowToDict(
 // Recursively convert types in the rows to standard types to allow
 // for json encoding.
 func normalize_value(ctx context.Context,
-	scope types.Scope, value types.Any, depth int) types.Any {
+	scope types.Scope, value types.Any,
+	format *outputFormat, depth int) types.Any {
 	if depth > 10 {
 		return types.Null{}
 	}
@@ -43,6 +62,33 @@ func normalize_value(ctx context.Context,
 		value = types.Null{}
 	}
 
+	// Only pay for number and time formatting when it is asked for.
+	if format != nil {
+		if format.numbers != nil {
+			result, ok := format_number(value, format.numbers)
+			if ok {
+				return result
+			}
+		}
+
+		if format.times != nil {
+			result, ok := format_time(value, format.times)
+			if ok {
+				return result
+			}
+		}
+
+		dict, ok := value.(*ordereddict.Dict)
+		if ok {
+			result := ordereddict.NewDict()
+			for _, k := range dict.Keys() {
+				v, _ := dict.Get(k)
+				result.Set(k, normalize_value(ctx, scope, v, format, depth+1))
+			}
+			return result
+		}
+	}
+
 	switch t := value.(type) {
 
 	// All valid JSON types.
@@ -56,12 +102,12 @@ func normalize_value(ctx context.Context,
 	case fmt.Stringer:
 		return value
 
-	case []byte:
+	case []byte, types.Bytes:
 		return t
 
 		// Reduce any LazyExpr to materialized types
 	case types.LazyExpr:
-		return normalize_value(ctx, scope, t.Reduce(ctx), depth+1)
+		return normalize_value(ctx, scope, t.Reduce(ctx), format, depth+1)
 
 		// Materialize stored queries into an array.
 	case types.StoredQuery:
@@ -71,7 +117,7 @@ func normalize_value(ctx context.Context,
 		// A dict may expose a callable as a member - we just
 		// call it lazily if it is here.
 	case func() types.Any:
-		return normalize_value(ctx, scope, t(), depth+1)
+		return normalize_value(ctx, scope, t(), format, depth+1)
 
 	case types.Materializer:
 		return t.Materialize(ctx, scope)
@@ -84,7 +130,7 @@ func normalize_value(ctx context.Context,
 				value = types.Null{}
 			}
 			result.Set(member,
-				normalize_value(ctx, scope, value, depth+1))
+				normalize_value(ctx, scope, value, format, depth+1))
 		}
 		return result
 
@@ -100,7 +146,7 @@ func normalize_value(ctx context.Context,
 			result := make([]types.Any, 0, length)
 			for i := 0; i < length; i++ {
 				result = append(result, normalize_value(
-					ctx, scope, a_value.Index(i).Interface(), depth+1))
+					ctx, scope, a_value.Index(i).Interface(), format, depth+1))
 			}
 			return result
 
@@ -112,7 +158,7 @@ func normalize_value(ctx context.Context,
 				if ok {
 					result.Set(str_key, normalize_value(
 						ctx, scope, a_value.MapIndex(key).Interface(),
-						depth+1))
+						format, depth+1))
 				}
 			}
 
@@ -131,3 +177,34 @@ func normalize_value(ctx context.Context,
 		return value
 	}
 }
+
+func format_number(value types.Any, format *types.NumberFormat) (types.Any, bool) {
+	switch t := value.(type) {
+	case int:
+		return format.FormatInt(int64(t)), true
+	case int64:
+		return format.FormatInt(t), true
+	case uint:
+		return format.FormatUint(uint64(t)), true
+	case uint64:
+		return format.FormatUint(t), true
+	case float64:
+		return format.FormatFloat(t), true
+	case float32:
+		return format.FormatFloat(float64(t)), true
+	}
+	return nil, false
+}
+
+func format_time(value types.Any,
+	serializer types.TimeSerializationProtocol) (types.Any, bool) {
+	switch t := value.(type) {
+	case time.Time:
+		return serializer.SerializeTime(t), true
+	case *time.Time:
+		if t != nil {
+			return serializer.SerializeTime(*t), true
+		}
+	}
+	return nil, false
+}
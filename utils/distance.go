@@ -0,0 +1,68 @@
+package utils
+
+// EditDistance returns the optimal string alignment distance between
+// a and b (the Levenshtein distance counting a transposition of
+// adjacent characters as one edit). Stops early and returns a value
+// above max_distance once the distance is known to exceed it.
+func EditDistance(a, b string, max_distance int) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	if absInt(len(ra)-len(rb)) > max_distance {
+		return max_distance + 1
+	}
+
+	// Only three rows of the matrix are needed.
+	before := make([]int, len(rb)+1)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		row_min := current[0]
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1),
+				previous[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] &&
+				before[j-2]+1 < current[j] {
+				current[j] = before[j-2] + 1
+			}
+
+			if current[j] < row_min {
+				row_min = current[j]
+			}
+		}
+
+		if row_min > max_distance {
+			return max_distance + 1
+		}
+
+		before, previous, current = previous, current, before
+	}
+
+	return previous[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, EditDistance("hostname", "hostname", 2))
+	assert.Equal(t, 1, EditDistance("hostname", "hostnme", 2))
+
+	// A transposition is one edit.
+	assert.Equal(t, 1, EditDistance("hostname", "hsotname", 2))
+
+	// Distances above the maximum are reported as max + 1.
+	assert.Equal(t, 3, EditDistance("hostname", "h", 2))
+	assert.Equal(t, 3, EditDistance("abcdef", "uvwxyz", 2))
+}
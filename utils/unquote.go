@@ -2,7 +2,7 @@ package utils
 
 import (
 	"errors"
-	"strconv"
+	"regexp"
 	"strings"
 )
 
@@ -106,28 +106,51 @@ outer:
 	return string(out[:j])
 }
 
-// Unquote a ` delimited string.
+// Unquote a ` delimited identifier. The content is raw except that
+// a doubled backtick stands for a single backtick. Anything which is
+// not a single quoted identifier is returned as is.
 func Unquote_ident(s string) string {
-	if s == "" {
-		return ""
-	}
-
-	quote := s[0]
-	if quote != '`' {
+	if len(s) < 2 || s[0] != '`' || s[len(s)-1] != '`' {
 		return s
 	}
 
-	s = s[1 : len(s)-1]
-	out := ""
-	for s != "" {
-		value, _, tail, err := strconv.UnquoteChar(s, quote)
-		if err != nil {
-			return s
+	in := s[1 : len(s)-1]
+	out := make([]byte, 0, len(in))
+	for i := 0; i < len(in); i++ {
+		if in[i] == '`' {
+			// A lone backtick ends the quoted part early so this
+			// is not a single identifier.
+			if i+1 >= len(in) || in[i+1] != '`' {
+				return s
+			}
+			i++
 		}
-		s = tail
-		out += string(value)
+		out = append(out, in[i])
 	}
-	return out
+	return string(out)
+}
+
+var (
+	bareIdentRegex = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]*$`)
+
+	// Words the lexer treats as keywords can not be bare identifiers.
+	identKeywords = map[string]bool{
+		"EXPLAIN": true, "SELECT": true, "WHERE": true, "AND": true,
+		"OR": true, "FROM": true, "NOT": true, "AS": true, "IN": true,
+		"LIMIT": true, "NULL": true, "DESC": true, "TRUE": true,
+		"FALSE": true, "LET": true, "UNLET": true,
+	}
+)
+
+// QuoteIdent is the inverse of Unquote_ident: it returns the name
+// quoted with backticks if it can not be written as a bare
+// identifier.
+func QuoteIdent(name string) string {
+	if bareIdentRegex.MatchString(name) &&
+		!identKeywords[strings.ToUpper(name)] {
+		return name
+	}
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
 }
 
 // Split an identifier to a list of components taking into account
@@ -137,10 +160,18 @@ func SplitIdent(s string) []string {
 	current := make([]rune, 0, len(s))
 	state_escaped := false
 
-	for _, c := range s {
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
 		if state_escaped {
 			switch c {
 			case '`':
+				// A doubled backtick is a literal backtick.
+				if i+1 < len(runes) && runes[i+1] == '`' {
+					current = append(current, c)
+					i++
+					continue
+				}
 				state_escaped = false
 			default:
 				current = append(current, c)
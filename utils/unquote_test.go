@@ -50,6 +50,9 @@ var split_ident_cases = []string{
 
 	// Embedded .
 	"`X.Hello world`",
+
+	// Doubled backticks are literal backticks.
+	"X.`Back``tick`.Y",
 }
 
 func TestSplitIdent(t *testing.T) {
@@ -67,3 +70,32 @@ func TestSplitIdent(t *testing.T) {
 	)
 	g.AssertJson(t, "TestSplitIdent", res)
 }
+
+var quote_ident_cases = []string{
+	"Bare_name1",
+	"Größe",
+	"with space",
+	"with.dot",
+	"back`tick",
+	"select",
+	"1starts_with_digit",
+}
+
+func TestQuoteIdent(t *testing.T) {
+	res := make([]string, 0)
+	for _, testcase := range quote_ident_cases {
+		quoted := QuoteIdent(testcase)
+		if Unquote_ident(quoted) != testcase {
+			t.Fatalf("QuoteIdent(%q) = %q does not round trip", testcase, quoted)
+		}
+		res = append(res, quoted)
+	}
+
+	g := goldie.New(
+		t,
+		goldie.WithFixtureDir("fixtures"),
+		goldie.WithNameSuffix(".golden"),
+		goldie.WithDiffEngine(goldie.ColoredDiff),
+	)
+	g.AssertJson(t, "TestQuoteIdent", res)
+}
@@ -128,23 +128,25 @@ package vfilter
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/alecthomas/participle"
 	"github.com/alecthomas/participle/lexer"
-	errors "github.com/pkg/errors"
+	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/checkpoint"
 	"www.velocidex.com/golang/vfilter/scope"
-	scope_module "www.velocidex.com/golang/vfilter/scope"
 	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils"
 )
 
 var (
-	vqlLexer = lexer.Must(lexer.Regexp(
+	vqlLexer = newVQLLexer(
 		`(?ms)` +
 			`(\s+)` +
 			`|(?P<MLineComment>/[*].*?[*]/)` + // C Style comment.
@@ -155,6 +157,7 @@ var (
 			`|(?ims)(?P<WHERE>\bWHERE\b)` +
 			`|(?ims)(?P<AND>\bAND\b)` +
 			`|(?ims)(?P<OR>\bOR\b)` +
+			`|(?P<Pipe>\|>)` +
 			`|(?ims)(?P<AlternativeOR>\|+)` +
 			`|(?ims)(?P<AlternativeAND>&&)` +
 			`|(?ims)(?P<FROM>\bFROM\b)` +
@@ -165,15 +168,19 @@ var (
 			`|(?ims)(?P<NULL>\bNULL\b)` +
 			`|(?ims)(?P<DESC>\bDESC\b)` +
 			`|(?ims)(?P<GROUPBY>\bGROUP\s+BY\b)` +
+			`|(?ims)(?P<HAVING>\bHAVING\b)` +
 			`|(?ims)(?P<ORDERBY>\bORDER\s+BY\b)` +
 			`|(?ims)(?P<BOOL>\bTRUE\b|\bFALSE\b)` +
 			`|(?ims)(?P<LET>\bLET\b)` +
-			"|(?P<Ident>[a-zA-Z_][a-zA-Z0-9_]*|`[^`]+`)" +
+			`|(?ims)(?P<UNLET>\bUNLET\b)` +
+			`|(?P<InterpolatedString>f'''.*?''')` +
+			"|(?P<Ident>[\\p{L}_][\\p{L}\\p{N}_]*|`(?:[^`]|``)+`)" +
 			`|''(?P<MultilineString>'.*?')''` +
 			`|(?P<String>'([^'\\]*(\\.[^'\\]*)*)'|"([^"\\]*(\\.[^"\\]*)*)")` +
-			`|(?P<Number>[-+]?(0x[0-9a-f]+|\d*\.?\d+([eE][-+]?\d+)?))` +
-			`|(?P<Operators><>|!=|<=|>=|=>|=~|[-:+*/%,.()=<>{}\[\]])`,
-	))
+			`|(?P<Number>[-+]?(0x[0-9a-f](_?[0-9a-f])*|(\d(_?\d)*)?\.?\d(_?\d)*([eE][-+]?\d+)?))` +
+			`|(?P<Operators><>|!=|<=|>=|=>|=~|\?\.|[-:+*/%,.()=<>{}\[\]])` +
+			`|(?P<Terminator>;)`,
+	)
 
 	vqlParser = participle.MustBuild(
 		&VQL{},
@@ -198,42 +205,90 @@ var (
 	)
 )
 
-func reportError(err error, t *lexer.Error, expression string) error {
-	end := t.Tok.Pos.Offset + 10
-	if end >= len(expression) {
-		end = len(expression) - 1
-	}
-	if end < 0 {
-		end = 0
-	}
+// A parse error which shows where in the query the error occurred.
+type parseError struct {
+	err     error
+	context string
+}
 
-	start := t.Tok.Pos.Offset - 10
-	if start < 0 {
-		start = 0
-	}
+func (self *parseError) Error() string {
+	return self.err.Error() + "\n" + self.context
+}
 
-	pos := t.Tok.Pos.Offset
-	if pos >= len(expression) {
-		pos = len(expression) - 1
+func (self *parseError) Cause() error {
+	return self.err
+}
+
+func (self *parseError) Unwrap() error {
+	return self.err
+}
+
+// Render the line containing the error with a caret under the
+// offending column, e.g.:
+//
+//	3 | SELECT * FRM foo
+//	  |          ^
+func reportError(err error, tok lexer.Token, expression string) error {
+	pos := tok.Pos.Offset
+	if pos > len(expression) {
+		pos = len(expression)
 	}
 
 	if pos < 0 {
 		pos = 0
 	}
 
-	return errors.Wrap(
-		err,
-		expression[start:pos]+"|"+expression[pos:end])
+	line_start := strings.LastIndex(expression[:pos], "\n") + 1
+	line_end := strings.Index(expression[pos:], "\n")
+	if line_end < 0 {
+		line_end = len(expression)
+	} else {
+		line_end += pos
+	}
+	line := strings.TrimRight(expression[line_start:line_end], "\r")
+	line_number := strings.Count(expression[:line_start], "\n") + 1
+
+	// Keep tabs so the caret lines up with the offending token.
+	padding := []rune{}
+	for _, c := range expression[line_start:pos] {
+		if c == '\t' {
+			padding = append(padding, c)
+		} else {
+			padding = append(padding, ' ')
+		}
+	}
+
+	gutter := fmt.Sprintf("%d", line_number)
+	return &parseError{
+		err: err,
+		context: fmt.Sprintf("%s | %s\n%s | %s^",
+			gutter, line,
+			strings.Repeat(" ", len(gutter)), string(padding)),
+	}
 }
 
 // Parse the VQL expression. Returns a VQL object which may be
 // evaluated.
 func Parse(expression string) (*VQL, error) {
+	statements, custom, err := parseCustomStatements(
+		expression, multiVQLParser, false)
+	if custom {
+		if err != nil {
+			return nil, err
+		}
+		if len(statements) != 1 {
+			return nil, fmt.Errorf(
+				"Parse: expected a single statement but got %v",
+				len(statements))
+		}
+		return statements[0], nil
+	}
+
 	vql := &VQL{}
-	err := vqlParser.ParseString(expression, vql)
+	err = vqlParser.ParseString(expression, vql)
 	switch t := err.(type) {
-	case *lexer.Error:
-		return vql, reportError(err, t, expression)
+	case participle.Error:
+		return vql, reportError(err, t.Token(), expression)
 	default:
 		return vql, err
 	}
@@ -241,11 +296,17 @@ func Parse(expression string) (*VQL, error) {
 
 // Parse a string into multiple VQL statements.
 func MultiParse(expression string) ([]*VQL, error) {
+	statements, custom, err := parseCustomStatements(
+		expression, multiVQLParser, false)
+	if custom {
+		return statements, err
+	}
+
 	vql := &MultiVQL{}
-	err := multiVQLParser.ParseString(expression, vql)
+	err = multiVQLParser.ParseString(expression, vql)
 	switch t := err.(type) {
-	case *lexer.Error:
-		return nil, reportError(err, t, expression)
+	case participle.Error:
+		return nil, reportError(err, t.Token(), expression)
 
 	default:
 		return vql.GetStatements(), err
@@ -254,13 +315,20 @@ func MultiParse(expression string) ([]*VQL, error) {
 
 // Parse a string into multiple VQL statements.
 func MultiParseWithComments(expression string) ([]*VQL, error) {
+	statements, custom, err := parseCustomStatements(
+		expression, multiVQLParserWithComments, true)
+	if custom {
+		return statements, err
+	}
+
 	vql := &MultiVQL{}
-	err := multiVQLParserWithComments.ParseString(expression, vql)
+	err = multiVQLParserWithComments.ParseString(expression, vql)
 	switch t := err.(type) {
-	case *lexer.Error:
-		return nil, reportError(err, t, expression)
+	case participle.Error:
+		return nil, reportError(err, t.Token(), expression)
 
 	default:
+		vql.attachTrailingComments(expression)
 		return vql.GetStatements(), err
 	}
 }
@@ -290,9 +358,14 @@ func (self *MultiVQL) GetStatements() []*VQL {
 }
 
 type _Comment struct {
+	Pos        lexer.Position
 	VQLComment *string `( @VQLComment | `
 	Comment    *string `@Comment | `
 	MultiLine  *string `@MLineComment )`
+
+	// Set when the comment follows the previous statement on the
+	// same line.
+	trailing bool
 }
 
 // An opaque object representing the VQL expression.
@@ -302,8 +375,12 @@ type VQL struct {
 	LetOperator string          ` ( @"=" | @"<=" ) `
 	StoredQuery *_Select        ` ( @@ |  `
 	Expression  *_AndExpression ` @@ ) |`
+	Unlet       string          ` UNLET @Ident |`
 	Query       *_Select        ` @@  `
 	Comments    []*_Comment
+
+	// Comments following the statement on its last line.
+	trailing []*_Comment
 }
 
 type _ParameterList struct {
@@ -326,6 +403,8 @@ func (self *VQL) Type() string {
 		return "LAZY_LET"
 	} else if self.LetOperator == "<=" {
 		return "MATERIALIZED_LET"
+	} else if self.Unlet != "" {
+		return "UNLET"
 	} else if self.Query != nil && self.Query.Explain != nil {
 		return "EXPLAIN"
 	} else if self.Query != nil {
@@ -334,11 +413,67 @@ func (self *VQL) Type() string {
 	return ""
 }
 
+// In strict scoping mode a LET may not hide anything already
+// defined.
+func checkLetName(scope types.Scope, name string) error {
+	_, pres := scope.GetFunction(name)
+	if pres {
+		return fmt.Errorf("LET %v would mask a built in function", name)
+	}
+
+	_, pres = scope.GetPlugin(name)
+	if pres {
+		return fmt.Errorf("LET %v would mask a built in plugin", name)
+	}
+
+	_, pres = scope.Resolve(name)
+	if pres {
+		return fmt.Errorf("LET %v is already defined. Use UNLET to remove it first", name)
+	}
+	return nil
+}
+
+// Constants may not be redefined or masked by the parameters of a
+// LET.
+func checkConstants(scope types.Scope, name string, parameters []string) error {
+	if types.IsConstant(scope, name) {
+		return fmt.Errorf("LET %v: can not redefine a constant", name)
+	}
+
+	for _, parameter := range parameters {
+		if types.IsConstant(scope, parameter) {
+			return fmt.Errorf("LET %v: parameter %v would mask a constant",
+				name, parameter)
+		}
+	}
+	return nil
+}
+
 // Evaluate the expression. Returns a channel which emits a series of
 // rows.
+//
+// The same parsed VQL may be evaluated concurrently in different
+// scopes. Each evaluation uses the functions and plugins of its own
+// scope and keeps its own function state (e.g. for aggregates). See
+// also Compile().
 func (self *VQL) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 	output_chan := make(chan Row)
 
+	// UNLET masks the variable in the scope.
+	if self.Unlet != "" {
+		name := utils.Unquote_ident(self.Unlet)
+		if types.IsConstant(scope, name) {
+			scope.Log("ERROR:UNLET %v: can not remove a constant", name)
+			close(output_chan)
+			return output_chan
+		}
+
+		scope.AppendDefinitions(ordereddict.NewDict().
+			Set(name, types.Unbound{}))
+		close(output_chan)
+		return output_chan
+	}
+
 	// If this is a Let expression we need to create a stored
 	// query and assign to the scope.
 	if len(self.Let) > 0 {
@@ -347,12 +482,28 @@ func (self *VQL) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 				"materialized! Did you mean to use '='? ", self.Let)
 		}
 
-		_, pres := scope.GetFunction(self.Let)
-		if pres {
-			scope.Log("WARN:LET expression is masking a built in function %v", self.Let)
+		name := utils.Unquote_ident(self.Let)
+
+		err := checkConstants(scope, name, self.getParameters())
+		if err != nil {
+			scope.Log("ERROR:%v", err)
+			close(output_chan)
+			return output_chan
 		}
 
-		name := utils.Unquote_ident(self.Let)
+		if types.IsOptionEnabled(scope, types.StrictScopingOption) {
+			err := checkLetName(scope, name)
+			if err != nil {
+				scope.Log("ERROR:%v", err)
+				close(output_chan)
+				return output_chan
+			}
+		} else {
+			_, pres := scope.GetFunction(self.Let)
+			if pres {
+				scope.Log("WARN:LET expression is masking a built in function %v", self.Let)
+			}
+		}
 
 		// Let assigning an expression.
 		if self.Expression != nil {
@@ -368,8 +519,7 @@ func (self *VQL) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 			switch self.LetOperator {
 			// Store the expression in the scope for later.
 			case "=":
-				scope.AppendVars(ordereddict.NewDict().
-					Set(name, expr))
+				self.defineVar(scope, name, expr)
 
 				// If we are materializing here,
 				// reduce it now.
@@ -383,7 +533,7 @@ func (self *VQL) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 				if ok {
 					value = scope.Materialize(ctx, name, stored_query)
 				}
-				scope.AppendVars(ordereddict.NewDict().Set(name, value))
+				self.defineVar(scope, name, value)
 			}
 			close(output_chan)
 			return output_chan
@@ -397,41 +547,121 @@ func (self *VQL) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 				stored_query.parameters = self.getParameters()
 			}
 
-			scope.AppendVars(ordereddict.NewDict().Set(name, stored_query))
+			self.defineVar(scope, name, stored_query)
 		case "<=":
 			// Delegate to the scope's materializer to actually
 			// materialize this query.
-			scope.AppendVars(ordereddict.NewDict().Set(
-				name, scope.Materialize(ctx, name, self.StoredQuery)))
+			self.defineVar(scope, name,
+				scope.Materialize(ctx, name, self.StoredQuery))
 		}
 
 		close(output_chan)
 		return output_chan
 
 	} else {
+		query := FormatToString(scope, self)
 		subscope := scope.Copy()
 		subscope.AppendVars(
-			ordereddict.NewDict().Set("$Query", FormatToString(scope, self)))
+			ordereddict.NewDict().Set("$Query", query))
+
+		// Keep using the same functions and plugins even if they
+		// are replaced while the query runs.
+		subscope.PinDefinitions()
+
+		// Untrusted queries may be limited in how long they run.
+		// The limit is cancelled as soon as the query finishes,
+		// so delivering the rows already produced must only
+		// depend on the caller's context.
+		caller_ctx := ctx
+		var cancel func()
+		limits, ok := types.GetQueryLimits(scope)
+		if ok && limits.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		}
+
+		tracer, tracing := types.GetQueryTracer(scope)
+		var span types.Span
+		if tracing {
+			ctx, span = tracer.StartSpan(ctx, types.QuerySpan)
+			span.SetAttribute(types.QueryAttribute, query)
+		}
+
+		// Make the metadata of the columns available to the caller
+		// once the query is done.
+		columns := newColumnMetadataCollector()
+		missing_symbols := newMissingSymbols()
+		overflows := newOverflowReports(query)
+
+		var reporter *queryReporter
+		reports_enabled := types.IsQueryReportsEnabled(scope)
+		report_trailer := types.IsOptionEnabled(scope, types.QueryReportTrailerOption)
+		if reports_enabled || report_trailer {
+			reporter = newQueryReporter(query)
+			ctx = withQueryReporter(ctx, reporter)
+		}
 
 		go func() {
 			defer close(output_chan)
+			if reporter != nil {
+				defer func() {
+					report := reporter.report()
+					if reports_enabled {
+						types.AddQueryReport(scope, report)
+					}
+					if report_trailer {
+						select {
+						case <-caller_ctx.Done():
+						case output_chan <- report:
+						}
+					}
+				}()
+			}
 			defer subscope.Close()
-
-			row_chan := self.Query.Eval(ctx, subscope)
+			if cancel != nil {
+				defer cancel()
+			}
+			defer func() {
+				// Read only scopes can not record metadata.
+				// Callers evaluate in a subscope of the fork
+				// to collect it.
+				if !scope.IsReadOnly() {
+					for k, v := range columns.get() {
+						types.SetColumnMetadata(scope, k, v)
+					}
+				}
+				missing_symbols.report(scope)
+			}()
+
+			query_ctx := withColumnMetadata(ctx, columns)
+			query_ctx = withMissingSymbols(query_ctx, missing_symbols)
+			query_ctx = withOverflowReports(query_ctx, overflows)
+			query_ctx = withFunctionCopies(query_ctx)
+			query_ctx = withRowsScanned(query_ctx)
+			row_chan := self.Query.Eval(query_ctx, subscope)
 			for {
 				select {
 				case <-ctx.Done():
+					if cancel != nil && ctx.Err() == context.DeadlineExceeded {
+						scope.Log("ERROR:Query limit exceeded: timed out after %v",
+							limits.Timeout)
+					}
 					return
 
 				case row, ok := <-row_chan:
 					if !ok {
 						return
 					}
+					if reporter != nil {
+						reporter.incRowsEmitted()
+					}
 					output_chan <- row
 				}
 			}
 		}()
 
+		if tracing {
+			return traceRows(caller_ctx, span, output_chan)
+		}
 		return output_chan
 	}
 }
@@ -444,6 +674,16 @@ func visitor(parameters *_ParameterList, result *[]string) {
 	}
 }
 
+// Define the variable in a new scope level, recording the statement
+// as its origin.
+func (self *VQL) defineVar(scope types.Scope, name string, value types.Any) {
+	level := ordereddict.NewDict().Set(name, value)
+	types.SetVarOrigin(scope, level, name, func() string {
+		return FormatToString(scope, self)
+	})
+	scope.AppendDefinitions(level)
+}
+
 func (self *VQL) getParameters() []string {
 	result := []string{}
 
@@ -460,13 +700,21 @@ type _Select struct {
 	SelectExpression *_SelectExpression `SELECT @@`
 	From             *_From             `FROM @@`
 	Where            *_CommaExpression  `[ WHERE @@ ]`
-	GroupBy          *_CommaExpression  `[ GROUPBY @@ ]`
+	GroupBy          *_CommaExpression  `[ GROUPBY @@ `
+	GroupByCast      *_CastType         ` [ @@ ]`
+	Having           *_CommaExpression  ` [ HAVING @@ ] ]`
 	OrderBy          *string            `[ ORDERBY @Ident `
+	OrderByCast      *_CastType         ` [ @@ ]`
 	OrderByDesc      *bool              ` [ @DESC ] ]`
 	Limit            *int64             `[ LIMIT @Number ]`
+	Pipeline         []*Plugin          `{ "|>" @@ }`
 }
 
 func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
+	if len(self.Pipeline) > 0 {
+		return self.evalPipeline(ctx, scope)
+	}
+
 	// If the EXPLAIN keyword was used, enabled explaining for this
 	// scope and its children.
 	if self.Explain != nil {
@@ -475,9 +723,17 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 
 	// Start query evaluation
 	scope.Explainer().StartQuery(self)
+	explainRedaction(scope)
 
 	output_chan := make(chan Row)
 
+	// A limit hint from the caller applies to the rows we emit. It
+	// must not leak into the evaluation of anything else.
+	limit_hint := getRowLimit(ctx)
+	ctx = clearRowLimit(ctx)
+	offset_hint := getRowOffset(ctx)
+	ctx = clearRowOffset(ctx)
+
 	// Limits occur before the group by so we can cut the group by
 	// result short according to the limit clause.
 	if self.Limit != nil {
@@ -494,6 +750,15 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 			sub_ctx, cancel := context.WithCancel(ctx)
 			defer cancel()
 
+			// Push the limit down so an ORDER BY or a stored
+			// query can stop early.
+			if limit_hint > 0 && limit_hint < limit {
+				limit = limit_hint
+			}
+			if limit > 0 {
+				sub_ctx = withRowLimit(sub_ctx, limit)
+			}
+
 			for row := range self_copy.Eval(sub_ctx, scope) {
 				select {
 				case <-ctx.Done():
@@ -517,16 +782,10 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 	}
 
 	if self.OrderBy != nil {
-		desc := false
-		if self.OrderByDesc != nil {
-			desc = *self.OrderByDesc
-		}
-
-		// Sort the output groups
+		// Sort the output groups. If we only need the first few
+		// rows there is no need to keep all of them.
 		sorter_input_chan := make(chan Row)
-		sorted_chan := scope.(*scope_module.Scope).Sort(
-			ctx, scope, sorter_input_chan,
-			utils.Unquote_ident(*self.OrderBy), desc)
+		sorted_chan := self.sortRows(ctx, scope, sorter_input_chan, limit_hint)
 
 		// Feed all the aggregate rows into the sorter.
 		go func() {
@@ -537,7 +796,12 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 			self_copy := *self
 			self_copy.OrderBy = nil
 
+			// Sorted rows are not emitted in the order the
+			// plugins produced them so they can not move
+			// checkpoint cursors.
+			checkpointer := checkpoint.Get(scope)
 			for row := range self_copy.Eval(ctx, scope) {
+				checkpointer.Forget(row)
 				sorter_input_chan <- row
 			}
 		}()
@@ -550,10 +814,39 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 	// apply the WHERE clause to the row to determine if it should
 	// be relayed. NOTE: We need to transform the row first in
 	// order to assign aliases.
+	// Without a WHERE clause each row from the plugin produces one
+	// output row so the plugin only needs to produce as many rows as
+	// our caller wants.
+	output_columns := getColumnMetadata(ctx)
+	ctx = clearColumnMetadata(ctx)
+
+	counters := newSelectCounters(self)
+	checkpointer := checkpoint.Get(scope)
+	from_ctx := ctx
+	if limit_hint > 0 && self.Where == nil {
+		from_ctx = withRowLimit(ctx, limit_hint)
+	}
+	if offset_hint != nil && self.isOneRowPerInput(scope, counters) {
+		from_ctx = withRowOffset(from_ctx, offset_hint)
+	}
+
+	input_columns := newColumnMetadataCollector()
+	from_ctx = withColumnMetadata(from_ctx, input_columns)
+
 	go func() {
-		from_chan := self.From.Eval(ctx, scope)
+		from_chan := self.From.Eval(from_ctx, scope)
 
 		defer close(output_chan)
+		defer types.RecoverQueryError(ctx, scope)
+
+		// Once all the rows are read we know the metadata of
+		// the columns we emitted.
+		if output_columns != nil {
+			defer func() {
+				output_columns.update(self.SelectExpression.columnMetadata(
+					scope, input_columns.get()))
+			}()
+		}
 		for {
 			select {
 			// Are we cancelled?
@@ -567,7 +860,9 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 				}
 				scope.Explainer().PluginOutput(
 					&self.From.Plugin, row)
-				self.processSingleRow(ctx, scope, row, output_chan)
+				counters.row_number++
+				self.processSingleRow(ctx, scope, row, counters,
+					checkpointer, output_chan)
 			}
 		}
 	}()
@@ -575,24 +870,201 @@ func (self *_Select) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 	return output_chan
 }
 
+// Without a WHERE clause each row from the FROM clause produces one
+// row, so rows the caller skips need not be read at all unless the
+// columns depend on the rows before (e.g. aggregates or the row
+// number).
+func (self *_Select) isOneRowPerInput(
+	scope types.Scope, counters *selectCounters) bool {
+	if self.Where != nil || counters.uses_row_number ||
+		counters.uses_rows_emitted {
+		return false
+	}
+
+	for _, expression := range self.SelectExpression.Expressions {
+		if expression.Expression == nil && expression.SubSelect == nil {
+			continue
+		}
+		if expression.IsAggregate(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Variables describing the progress of the query which are available
+// to the column expressions and the WHERE clause. They are only set
+// on each row's scope when the query refers to them by name, where
+// they mask any user defined variables of the same name.
+const (
+	// The ordinal (starting at 1) of the row received from the FROM
+	// clause.
+	rowNumberVar = "_row_number"
+
+	// The number of rows this query emitted so far.
+	rowsEmittedVar = "_rows_emitted"
+
+	// Seconds since the query started.
+	elapsedVar = "_elapsed"
+)
+
+type selectCounters struct {
+	row_number   int64
+	rows_emitted int64
+	start        time.Time
+
+	// The progress variables the query refers to. Only these are
+	// set on the row's scope.
+	uses_row_number   bool
+	uses_rows_emitted bool
+	uses_elapsed      bool
+
+	// Only warn once per query about a non boolean WHERE clause.
+	warned_bool bool
+}
+
+func newSelectCounters(query *_Select) *selectCounters {
+	vars := query.progressVars()
+	result := &selectCounters{
+		uses_row_number:   vars.uses_row_number,
+		uses_rows_emitted: vars.uses_rows_emitted,
+		uses_elapsed:      vars.uses_elapsed,
+	}
+	if result.uses_elapsed {
+		result.start = time.Now()
+	}
+	return result
+}
+
+// The progress variables a query refers to.
+type progressVars struct {
+	uses_row_number   bool
+	uses_rows_emitted bool
+	uses_elapsed      bool
+}
+
+func findProgressVars(query *_Select) *progressVars {
+	result := &progressVars{}
+	for _, name := range collectSymbols(reflect.ValueOf(query), nil) {
+		switch name {
+		case rowNumberVar:
+			result.uses_row_number = true
+		case rowsEmittedVar:
+			result.uses_rows_emitted = true
+		case elapsedVar:
+			result.uses_elapsed = true
+		}
+	}
+	return result
+}
+
+// Finding the progress variables walks the entire query so the
+// result is cached on the select expression the first time the query
+// is evaluated. Copies of the _Select share the same expression and
+// therefore the cache.
+func (self *_Select) progressVars() *progressVars {
+	expression := self.SelectExpression
+	if expression == nil {
+		return findProgressVars(self)
+	}
+
+	if expression.compiled {
+		return expression.progress_vars
+	}
+
+	expression.mu.Lock()
+	defer expression.mu.Unlock()
+
+	if expression.progress_vars == nil {
+		expression.progress_vars = findProgressVars(self)
+	}
+	return expression.progress_vars
+}
+
+// Set the progress variables the query refers to on the row's scope.
+func (self *selectCounters) appendVars(scope types.Scope) {
+	if !self.uses_row_number && !self.uses_rows_emitted && !self.uses_elapsed {
+		return
+	}
+
+	vars := ordereddict.NewDict()
+	if self.uses_row_number {
+		vars.Set(rowNumberVar, self.row_number)
+	}
+	if self.uses_rows_emitted {
+		vars.Set(rowsEmittedVar, self.rows_emitted)
+	}
+	if self.uses_elapsed {
+		vars.Set(elapsedVar, time.Since(self.start).Seconds())
+	}
+	scope.AppendVars(vars)
+}
+
+// Decide if the WHERE clause accepts the row given the value it
+// evaluated to.
+func (self *_Select) whereAccepts(ctx context.Context, scope types.Scope,
+	expression types.Any, counters *selectCounters) bool {
+	return conditionAccepts(ctx, scope, "WHERE", self.Where,
+		expression, counters)
+}
+
+// Decide if a condition (e.g. the WHERE or HAVING clause) accepts
+// the row. In strict bool mode the condition must be a boolean.
+func conditionAccepts(ctx context.Context, scope types.Scope,
+	clause string, condition *_CommaExpression,
+	expression types.Any, counters *selectCounters) bool {
+	if !types.IsOptionEnabled(scope, types.StrictBoolOption) {
+		return expression != nil && scope.Bool(expression)
+	}
+
+	for {
+		lazy_expr, ok := expression.(types.LazyExpr)
+		if !ok {
+			break
+		}
+		expression = lazy_expr.ReduceWithScope(ctx, scope)
+	}
+
+	result, ok := expression.(bool)
+	if !ok {
+		if !counters.warned_bool {
+			counters.warned_bool = true
+			scope.Log("ERROR:%v clause %v evaluated to %T but must be a boolean. Rejecting rows.",
+				clause, FormatToString(scope, condition), expression)
+		}
+		return false
+	}
+	return result
+}
+
+// Rows the query emits take the checkpoint cursor of the row they
+// were made from.
 func (self *_Select) processSingleRow(
-	ctx context.Context, scope types.Scope, row Row, output_chan chan Row) {
+	ctx context.Context, scope types.Scope, row Row,
+	counters *selectCounters, checkpointer *checkpoint.Checkpointer,
+	output_chan chan Row) {
 	subscope := scope.Copy()
 	defer subscope.Close()
 
+	counters.appendVars(subscope)
+
+	timer := startRowTimer(scope)
 	transformed_row, closer := self.SelectExpression.Transform(
 		ctx, subscope, row)
 	defer closer()
 
 	if self.Where == nil {
-		materialized_row := MaterializedLazyRow(
-			ctx, transformed_row, subscope)
+		materialized_row := redactRow(scope, MaterializedLazyRow(
+			ctx, transformed_row, subscope))
+		checkpointer.Derive(row, materialized_row)
+		timer.done(self, true)
 
 		select {
 		case <-ctx.Done():
 			return
 
 		case output_chan <- materialized_row:
+			counters.rows_emitted++
 			scope.Explainer().SelectOutput(materialized_row)
 		}
 
@@ -613,22 +1085,49 @@ func (self *_Select) processSingleRow(
 
 		// If the filtered expression returns a bool true,
 		// then pass the row to the output.
-		if expression != nil && scope.Bool(expression) {
-			materialized_row := MaterializedLazyRow(
-				ctx, transformed_row, new_scope)
+		if self.whereAccepts(ctx, scope, expression, counters) {
+			materialized_row := redactRow(scope, MaterializedLazyRow(
+				ctx, transformed_row, new_scope))
+			checkpointer.Derive(row, materialized_row)
+			timer.done(self, true)
+
 			select {
 			case <-ctx.Done():
 				return
 
 			case output_chan <- materialized_row:
+				counters.rows_emitted++
 				scope.Explainer().SelectOutput(materialized_row)
 			}
 		} else {
+			timer.done(self, false)
 			scope.Explainer().RejectRow(self.Where)
 		}
 	}
 }
 
+// Times the processing of a row for explainers which summarize the
+// query's selectivity. It does nothing when not explaining.
+type rowTimer struct {
+	explainer types.SelectivityExplainer
+	start     time.Time
+}
+
+func startRowTimer(scope types.Scope) rowTimer {
+	explainer, ok := scope.Explainer().(types.SelectivityExplainer)
+	if !ok {
+		return rowTimer{}
+	}
+	return rowTimer{explainer: explainer, start: time.Now()}
+}
+
+func (self rowTimer) done(query *_Select, passed bool) {
+	if self.explainer != nil {
+		self.explainer.RowProcessed(query, &query.From.Plugin,
+			passed, time.Since(self.start))
+	}
+}
+
 type _From struct {
 	Plugin Plugin ` @@ `
 }
@@ -636,6 +1135,7 @@ type _From struct {
 type Plugin struct {
 	mu         sync.Mutex
 	split_name []string
+	compiled   bool
 
 	Name string `@Ident { @"." @Ident } `
 
@@ -645,7 +1145,7 @@ type Plugin struct {
 
 type _Args struct {
 	Comments        []*_Comment       `[ @@ ] `
-	Left            string            `@Ident "=" `
+	Left            string            `[ @Ident "=" ] `
 	SubSelect       *_Select          `( "{" @@ "}" | `
 	ArrayOpenBrace  string            ` @"[" `
 	Array           *_CommaExpression ` @@? `
@@ -653,9 +1153,41 @@ type _Args struct {
 	Right           *_AndExpression   ` @@ ) `
 }
 
+// Positional args (i.e. without a name) take the name of the
+// callee's parameter in the same position. Otherwise they are named
+// by their position as $0, $1 etc and the arg parser assigns them to
+// the function's fields in order.
+func (self *_Args) name(positional *int, names []string) string {
+	if self.Left != "" {
+		return utils.Unquote_ident(self.Left)
+	}
+
+	idx := *positional
+	*positional++
+	if idx < len(names) {
+		return names[idx]
+	}
+	return arg_parser.PositionalArg(idx)
+}
+
+// The names of the parameters a LET definition was declared with.
+func parameterNames(symbol types.Any) []string {
+	switch t := symbol.(type) {
+	case *StoredExpression:
+		return t.parameters
+	case *_StoredQuery:
+		return t.parameters
+	}
+	return nil
+}
+
 type _SelectExpression struct {
 	All         bool                  ` [ @"*" ","? ] `
 	Expressions []*_AliasedExpression ` [ @@ { "," @@ } ]`
+
+	mu            sync.Mutex
+	progress_vars *progressVars
+	compiled      bool
 }
 
 type _AliasedExpression struct {
@@ -668,10 +1200,15 @@ type _AliasedExpression struct {
 
 	mu                 sync.Mutex
 	cache, column_name *string
+	compiled           bool
 }
 
 // Cache the column name since each row needs it
 func (self *_AliasedExpression) GetName(scope types.Scope) string {
+	if self.compiled {
+		return *self.column_name
+	}
+
 	self.mu.Lock()
 	column_name := self.column_name
 	self.mu.Unlock()
@@ -680,19 +1217,20 @@ func (self *_AliasedExpression) GetName(scope types.Scope) string {
 		return *column_name
 	}
 
-	if self.As != "" {
-		name := utils.Unquote_ident(self.As)
-		column_name = &name
-	} else {
-		name := utils.Unquote_ident(FormatToString(scope, self))
-		column_name = &name
-	}
+	name := self.columnName(scope)
 
 	self.mu.Lock()
-	self.column_name = column_name
+	self.column_name = &name
 	self.mu.Unlock()
 
-	return *column_name
+	return name
+}
+
+func (self *_AliasedExpression) columnName(scope types.Scope) string {
+	if self.As != "" {
+		return utils.Unquote_ident(self.As)
+	}
+	return utils.Unquote_ident(FormatToString(scope, self))
 }
 
 func (self *_AliasedExpression) IsAggregate(scope types.Scope) bool {
@@ -777,7 +1315,8 @@ type _OpMembershipTerm struct {
 	Index    *_Value ` ( "[" {@@} `
 	Range    *string ` { @":" }`
 	RangeEnd *_Value ` { @@ } "]" |`
-	Term     *string `  "." @Ident )`
+	Optional bool    `  ( "." | @"?." ) `
+	Term     *string `  @Ident )`
 }
 
 type _SliceRange struct {
@@ -857,13 +1396,16 @@ type _Term struct {
 
 type _SymbolRef struct {
 	Comments   []*_Comment ` [ @@ ] `
-	Symbol     string      `@Ident { @"." @Ident }`
+	Symbol     string      `@Ident { ( @"." | @"?." ) @Ident }`
 	Called     bool        `{ @"(" `
 	Parameters []*_Args    ` [ @@ { "," @@ } ] ")" } `
 
-	mu           sync.Mutex
-	function     FunctionInterface
-	split_symbol []string
+	mu               sync.Mutex
+	function         FunctionInterface
+	function_version uint64
+	split_symbol     []string
+	optional         []bool
+	compiled         bool
 }
 
 type _Value struct {
@@ -872,7 +1414,7 @@ type _Value struct {
 	SymbolRef     *_SymbolRef       `( @@ `
 	Subexpression *_CommaExpression `| "(" @@ ")"`
 
-	String *string ` | @( MultilineString | String ) `
+	String *string ` | @( MultilineString | String | InterpolatedString | Heredoc ) `
 
 	// Figure out if this is an int or float.
 	StrNumber *string ` | @Number`
@@ -882,8 +1424,9 @@ type _Value struct {
 	Boolean *string ` | @BOOL `
 	Null    bool    ` | @NULL)`
 
-	mu    sync.Mutex
-	cache Any
+	mu       sync.Mutex
+	cache    Any
+	compiled bool
 }
 
 // A * expression means to merge the old row on top of the new row,
@@ -991,13 +1534,34 @@ func (self *_SelectExpression) Transform(
 func (self *_From) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 	output_chan := make(chan Row)
 
+	var max_rows uint64
+	limits, ok := types.GetQueryLimits(scope)
+	if ok {
+		max_rows = limits.MaxRowsScanned
+	}
+
+	// Sensitive values are redacted before the query sees them.
+	policy := types.GetActiveRedactionPolicy(scope)
+	checkpointer := checkpoint.Get(scope)
+
 	input_chan := self.Plugin.Eval(ctx, scope)
 	go func() {
 		defer close(output_chan)
 		for row := range input_chan {
-			scope.GetStats().IncRowsScanned()
+			rows_scanned := countRowScanned(ctx, scope)
+			if max_rows > 0 && rows_scanned > max_rows {
+				scope.Log("ERROR:Query limit exceeded: more than %v rows scanned",
+					max_rows)
+				return
+			}
 			scope.ChargeOp()
 
+			if policy != nil {
+				redacted := redactInputRow(scope, policy, row)
+				checkpointer.Derive(row, redacted)
+				row = redacted
+			}
+
 			select {
 			case <-ctx.Done():
 				return
@@ -1034,6 +1598,10 @@ func (self *Plugin) resolveSymbol(
 			// SELECT Foo.Bar FROM scope() -> warn
 			// if Foo is not found but not if Foo is found but Bar is not found
 			if idx == 0 {
+				if checkForOverflow(withSymbol(ctx, components[0]), scope) {
+					return nil, false
+				}
+
 				if len(components) > 1 {
 					scope.Log("ERROR:While resolving %v Plugin %v not found. Current Scope is %s",
 						self.Name, components[0], scope.PrintVars())
@@ -1053,18 +1621,40 @@ func (self *Plugin) resolveSymbol(
 }
 
 func (self *Plugin) Eval(ctx context.Context, scope types.Scope) <-chan Row {
+	return self.evalWithInput(ctx, scope, nil)
+}
 
-	self.mu.Lock()
-	components := self.split_name
-	if components == nil {
-		components = utils.SplitIdent(self.Name)
-		self.split_name = components
+// If input is set it is passed to the plugin as its query arg. This
+// is used for pipeline stages.
+func (self *Plugin) evalWithInput(ctx context.Context, scope types.Scope,
+	input types.StoredQuery) <-chan Row {
+	limit_hint := getRowLimit(ctx)
+	ctx = clearRowLimit(ctx)
+	offset_hint := getRowOffset(ctx)
+	ctx = clearRowOffset(ctx)
+
+	var components []string
+	if self.compiled {
+		components = self.split_name
+
+	} else {
+		self.mu.Lock()
+		if self.split_name == nil {
+			self.split_name = utils.SplitIdent(self.Name)
+		}
+		components = self.split_name
+		self.mu.Unlock()
 	}
-	self.mu.Unlock()
 
 	symbol, pres := self.resolveSymbol(ctx, scope, components)
 	// Symbol not found! alert the caller.
 	if !pres {
+		if checkForOverflow(withSymbol(ctx, components[0]), scope) {
+			output_chan := make(chan Row)
+			close(output_chan)
+			return output_chan
+		}
+
 		options := scope.GetSimilarPlugins(self.Name)
 		message := fmt.Sprintf("Plugin %v not found. ", self.Name)
 		if len(options) > 0 {
@@ -1087,12 +1677,160 @@ func (self *Plugin) Eval(ctx context.Context, scope types.Scope) <-chan Row {
 		return output_chan
 	}
 
-	if self.Call {
-		return self.evalSymbol(
-			ctx, scope,
-			symbol, self.Name, buildArgsFromParameters(ctx, scope, self.Args))
+	// Only stored queries can make use of the limit hint.
+	symbol_ctx := ctx
+	_, is_stored_query := symbol.(*_StoredQuery)
+	if limit_hint > 0 && is_stored_query {
+		symbol_ctx = withRowLimit(ctx, limit_hint)
+	}
+
+	// The offset hint applies to the rows of the symbol, not those
+	// of the pipeline stage before it.
+	if offset_hint != nil && input == nil {
+		symbol_ctx = withRowOffset(symbol_ctx, offset_hint)
+	}
+
+	// Track stored symbols to report recursive definitions.
+	switch symbol.(type) {
+	case types.StoredExpression, StoredQuery:
+		symbol_ctx = withSymbol(symbol_ctx, self.Name)
+	}
+
+	if self.Call || input != nil {
+		args := buildArgsFromParameters(ctx, scope, self.Args,
+			parameterNames(symbol))
+		if input != nil {
+			args.Set(pipelineArg, input)
+		}
+		return self.evalSymbol(symbol_ctx, scope, symbol, self.Name, args)
+	}
+	return self.evalSymbol(symbol_ctx, scope, symbol, self.Name, nil)
+}
+
+func hasPositionalArgs(args *ordereddict.Dict) bool {
+	for _, key := range args.Keys() {
+		if arg_parser.IsPositionalArg(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Call the plugin through the middleware registered on the scope.
+func callPlugin(ctx context.Context, scope types.Scope,
+	plugin PluginGeneratorInterface, name string,
+	args *ordereddict.Dict) <-chan Row {
+	if !allowImpact(ctx, scope, name, func() types.Impact {
+		return plugin.Info(scope, nil).Impact
+	}) {
+		output_chan := make(chan Row)
+		close(output_chan)
+		return output_chan
+	}
+
+	call := limitPluginConcurrency(name,
+		recoverPluginCall(offsetPluginCall(ctx, plugin)))
+	ctx = clearRowOffset(ctx)
+
+	middleware := scope.GetPluginMiddleware()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		wrapper := middleware[i]
+		next := call
+		call = func(ctx context.Context, scope types.Scope,
+			args *ordereddict.Dict) <-chan Row {
+			return wrapper(ctx, scope, name, args, next)
+		}
+	}
+
+	tracer, ok := types.GetQueryTracer(scope)
+	if ok {
+		ctx, span := tracer.StartSpan(ctx, types.PluginSpan)
+		span.SetAttribute(types.PluginAttribute, name)
+		return traceRows(ctx, span, call(ctx, scope, args))
+	}
+
+	return call(ctx, scope, args)
+}
+
+// If the caller installed a query error handler, a panic while
+// calling the plugin is reported to it and the plugin produces no
+// rows. Panics in the plugin's own goroutines can only be recovered
+// by the plugin (see types.RecoverQueryError).
+func recoverPluginCall(call types.PluginCall) types.PluginCall {
+	return func(ctx context.Context, scope types.Scope,
+		args *ordereddict.Dict) (output_chan <-chan Row) {
+		_, ok := types.GetQueryErrorHandler(ctx)
+		if !ok {
+			return call(ctx, scope, args)
+		}
+
+		defer func() {
+			if output_chan == nil {
+				closed_chan := make(chan Row)
+				close(closed_chan)
+				output_chan = closed_chan
+			}
+		}()
+		defer types.RecoverQueryError(ctx, scope)
+
+		return call(ctx, scope, args)
+	}
+}
+
+// Plugins which can skip rows take the offset hint. Other plugins
+// never see it.
+func offsetPluginCall(ctx context.Context,
+	plugin PluginGeneratorInterface) types.PluginCall {
+	offset_hint := getRowOffset(ctx)
+	offset_plugin, ok := plugin.(types.RowOffsetPlugin)
+	if offset_hint == nil || !ok {
+		return plugin.Call
+	}
+
+	offset := offset_hint.take()
+	return func(ctx context.Context, scope types.Scope,
+		args *ordereddict.Dict) <-chan Row {
+		return offset_plugin.CallWithOffset(ctx, scope, args, offset)
+	}
+}
+
+// A plugin call holding a slot of its concurrency limit marks the
+// context so calls of the same plugin made while evaluating its args
+// (e.g. its query) do not wait for a slot it holds itself.
+type pluginSlotKey string
+
+// Wait for a free slot if the plugin's concurrency is limited and
+// hold it until the plugin is done.
+func limitPluginConcurrency(name string, call types.PluginCall) types.PluginCall {
+	return func(ctx context.Context, scope types.Scope,
+		args *ordereddict.Dict) <-chan Row {
+		semaphore, pres := scope.GetPluginSemaphore(name)
+		if !pres || ctx.Value(pluginSlotKey(name)) != nil {
+			return call(ctx, scope, args)
+		}
+
+		output_chan := make(chan Row)
+		go func() {
+			defer close(output_chan)
+
+			err := semaphore.Acquire(ctx)
+			if err != nil {
+				return
+			}
+			defer semaphore.Release()
+
+			sub_ctx := context.WithValue(ctx, pluginSlotKey(name), true)
+			for row := range call(sub_ctx, scope, args) {
+				select {
+				case <-ctx.Done():
+					return
+				case output_chan <- row:
+				}
+			}
+		}()
+
+		return output_chan
 	}
-	return self.evalSymbol(ctx, scope, symbol, self.Name, nil)
 }
 
 func (self *Plugin) evalSymbol(
@@ -1101,7 +1839,7 @@ func (self *Plugin) evalSymbol(
 
 	output_chan := make(chan Row)
 
-	if scope.CheckForOverflow() {
+	if checkForOverflow(ctx, scope) {
 		close(output_chan)
 		return output_chan
 	}
@@ -1121,9 +1859,16 @@ func (self *Plugin) evalSymbol(
 
 			// A plugin like item
 		case PluginGeneratorInterface:
-			scope.GetStats().IncPluginsCalled()
+			if hasPositionalArgs(args) && t.Info(scope, nil).FreeFormArgs {
+				scope.Log("ERROR:%v does not accept positional args", name)
+				close(output_chan)
+				return output_chan
+			}
+
+			countPluginCall(ctx, scope)
+			collectPluginColumnMetadata(ctx, scope, t, args)
 
-			return t.Call(ctx, scope, args)
+			return callPlugin(types.WithCallName(ctx, name), scope, t, name, args)
 
 		default:
 			scope.Log("ERROR:Symbol %v is not callable", name)
@@ -1144,12 +1889,19 @@ func (self *Plugin) evalSymbol(
 		}
 	}
 
+	// Arrays can start after the rows the caller skips.
+	var start int64
+	offset_hint := getRowOffset(ctx)
+	if offset_hint != nil && utils.IsArray(symbol) {
+		start = offset_hint.take()
+	}
+
 	go func() {
 		defer close(output_chan)
 
 		if utils.IsArray(symbol) {
 			var_slice := reflect.ValueOf(symbol)
-			for i := 0; i < var_slice.Len(); i++ {
+			for i := int(start); i < var_slice.Len(); i++ {
 				select {
 				case <-ctx.Done():
 					return
@@ -1337,7 +2089,7 @@ func (self *_OrExpression) Reduce(ctx context.Context, scope types.Scope) Any {
 	return last
 }
 
-func (self _AdditionExpression) IsAggregate(scope types.Scope) bool {
+func (self *_AdditionExpression) IsAggregate(scope types.Scope) bool {
 	if self.Left != nil && self.Left.IsAggregate(scope) {
 		return true
 	}
@@ -1354,18 +2106,20 @@ func (self *_AdditionExpression) Reduce(ctx context.Context, scope types.Scope)
 	result := self.Left.Reduce(ctx, scope)
 	for _, term := range self.Right {
 		term_value := term.Term.Reduce(ctx, scope)
+		lhs := result
 		switch term.Operator {
 		case "+":
-			result = scope.Add(result, term_value)
+			result = scope.Add(lhs, term_value)
 		case "-":
-			result = scope.Sub(result, term_value)
+			result = scope.Sub(lhs, term_value)
 		}
+		checkArithmetic(ctx, scope, self, term.Operator, lhs, term_value, result)
 	}
 
 	return result
 }
 
-func (self _ConditionOperand) IsAggregate(scope types.Scope) bool {
+func (self *_ConditionOperand) IsAggregate(scope types.Scope) bool {
 	if self.Not != nil && self.Not.IsAggregate(scope) {
 		return true
 	}
@@ -1422,7 +2176,7 @@ func (self *_ConditionOperand) Reduce(ctx context.Context, scope types.Scope) An
 	return result
 }
 
-func (self _MultiplicationExpression) IsAggregate(scope types.Scope) bool {
+func (self *_MultiplicationExpression) IsAggregate(scope types.Scope) bool {
 	if self.Left != nil && self.Left.IsAggregate(scope) {
 		return true
 	}
@@ -1439,18 +2193,20 @@ func (self *_MultiplicationExpression) Reduce(ctx context.Context, scope types.S
 	result := self.Left.Reduce(ctx, scope)
 	for _, term := range self.Right {
 		term_value := term.Factor.Reduce(ctx, scope)
+		lhs := result
 		switch term.Operator {
 		case "*":
-			result = scope.Mul(result, term_value)
+			result = scope.Mul(lhs, term_value)
 		case "/":
-			result = scope.Div(result, term_value)
+			result = scope.Div(lhs, term_value)
 		}
+		checkArithmetic(ctx, scope, self, term.Operator, lhs, term_value, result)
 	}
 
 	return result
 }
 
-func (self _Value) IsAggregate(scope types.Scope) bool {
+func (self *_Value) IsAggregate(scope types.Scope) bool {
 	if self.SymbolRef != nil && self.SymbolRef.IsAggregate(scope) {
 		return true
 	}
@@ -1462,21 +2218,49 @@ func (self _Value) IsAggregate(scope types.Scope) bool {
 	return false
 }
 
+// Parse a number with an exponent if it is an exact integer which
+// fits in an int64.
+func parseScientificInt(number string) (int64, bool) {
+	if !strings.ContainsAny(number, "eE") ||
+		strings.HasPrefix(strings.TrimLeft(number, "-+"), "0x") {
+		return 0, false
+	}
+
+	value, ok := new(big.Rat).SetString(number)
+	if !ok || !value.IsInt() || !value.Num().IsInt64() {
+		return 0, false
+	}
+	return value.Num().Int64(), true
+}
+
 func (self *_Value) maybeParseStrNumber(scope types.Scope) {
 	if self.Int != nil || self.Float != nil {
 		return
 	}
 
 	if self.StrNumber != nil {
+		// Underscores may separate digits for readability
+		// (e.g. 1_000_000). The lexer ensures they are only
+		// between digits.
+		number := strings.Replace(*self.StrNumber, "_", "", -1)
+
 		// Try to parse it as an integer.
-		value, err := strconv.ParseInt(*self.StrNumber, 0, 64)
+		value, err := strconv.ParseInt(number, 0, 64)
 		if err == nil {
 			self.Int = &value
 			return
 		}
 
+		// Scientific notation is an integer if the value is
+		// exact (e.g. 1e6)
+		value, ok := parseScientificInt(number)
+		if ok {
+			self.Int = &value
+			return
+		}
+
 		// Try a float now.
-		float_value, err := strconv.ParseFloat(*self.StrNumber, 64)
+		float_value, err := strconv.ParseFloat(number, 64)
 		if err == nil {
 			self.Float = &float_value
 			return
@@ -1487,6 +2271,10 @@ func (self *_Value) maybeParseStrNumber(scope types.Scope) {
 }
 
 func (self *_Value) Reduce(ctx context.Context, scope types.Scope) Any {
+	if self.compiled {
+		return self.reduceCompiled(ctx, scope)
+	}
+
 	self.mu.Lock()
 	self.maybeParseStrNumber(scope)
 
@@ -1525,9 +2313,18 @@ func (self *_Value) Reduce(ctx context.Context, scope types.Scope) Any {
 	}
 
 	if self.String != nil {
-		self.cache = utils.Unquote(*self.String)
+		value, interpolate := decodeStringLiteral(*self.String)
+
+		// Interpolated strings depend on the scope so can not be
+		// cached.
+		if interpolate {
+			self.mu.Unlock()
+			return interpolateString(ctx, scope, value)
+		}
+		self.cache = value
+
 	} else if self.Boolean != nil {
-		self.cache = strings.ToLower(*self.Boolean) == "true"
+		self.cache = self.reduceBoolean()
 
 	} else {
 		self.cache = Null{}
@@ -1538,10 +2335,40 @@ func (self *_Value) Reduce(ctx context.Context, scope types.Scope) Any {
 	return res
 }
 
+func (self *_Value) reduceBoolean() bool {
+	return strings.ToLower(*self.Boolean) == "true"
+}
+
+// A compiled value is never modified so does not need locking.
+func (self *_Value) reduceCompiled(ctx context.Context, scope types.Scope) Any {
+	switch {
+	case self.Subexpression != nil:
+		return self.Subexpression.Reduce(ctx, scope)
+
+	case self.SymbolRef != nil:
+		return self.SymbolRef.Reduce(ctx, scope)
+
+	case self.Int != nil:
+		return *self.Int
+
+	case self.Float != nil:
+		return *self.Float
+
+	case self.cache != nil:
+		return self.cache
+
+	case self.String != nil:
+		value, _ := decodeStringLiteral(*self.String)
+		return interpolateString(ctx, scope, value)
+	}
+
+	return Null{}
+}
+
 func (self *_SymbolRef) IsAggregate(scope types.Scope) bool {
 	self.mu.Lock()
 	// If it is not a function then it can not be an aggregate.
-	if self.Parameters == nil {
+	if !self.Called {
 		self.mu.Unlock()
 		return false
 	}
@@ -1558,15 +2385,22 @@ func (self *_SymbolRef) IsAggregate(scope types.Scope) bool {
 	return value.Info(scope, types.NewTypeMap()).IsAggregate
 }
 
-func (self *_SymbolRef) getFunction(scope types.Scope) (types.Any, bool) {
+func (self *_SymbolRef) getFunction(
+	ctx context.Context, scope types.Scope) (types.Any, bool) {
 
-	self.mu.Lock()
-	components := self.split_symbol
-	if components == nil {
-		components = utils.SplitIdent(self.Symbol)
-		self.split_symbol = components
+	var components []string
+	var optional []bool
+	if self.compiled {
+		components, optional = self.split_symbol, self.optional
+
+	} else {
+		self.mu.Lock()
+		if self.split_symbol == nil {
+			self.split_symbol, self.optional = splitSymbol(self.Symbol)
+		}
+		components, optional = self.split_symbol, self.optional
+		self.mu.Unlock()
 	}
-	self.mu.Unlock()
 
 	// Single item reference and called - call built in function.
 	if len(components) == 1 && self.Called {
@@ -1585,13 +2419,21 @@ func (self *_SymbolRef) getFunction(scope types.Scope) (types.Any, bool) {
 			// SELECT Foobar FROM scope() -> warn if Foobar is not found
 			// SELECT Foo.Bar FROM scope() -> warn
 			// if Foo is not found but not if Foo is found but Bar is not found
-			if idx == 0 {
+			// SELECT Foo?.Bar FROM scope() -> never warn
+			if idx == 0 && !optional[idx] {
+				// Symbols can not be resolved once the
+				// stack overflows.
+				if checkForOverflow(withSymbol(ctx, components[0]), scope) {
+					return nil, false
+				}
+
 				if len(components) > 1 {
-					scope.Log("ERROR:While resolving %v Symbol %v not found. Current Scope is %s",
-						self.Symbol, components[0], scope.PrintVars())
+					logMissingSymbol(ctx, scope, fmt.Sprintf(
+						"While resolving %v Symbol %v not found",
+						self.Symbol, components[0]))
 				} else {
-					scope.Log("ERROR:Symbol %v not found. Current Scope is %s",
-						self.Symbol, scope.PrintVars())
+					logMissingSymbol(ctx, scope, fmt.Sprintf(
+						"Symbol %v not found", self.Symbol))
 				}
 			}
 
@@ -1604,12 +2446,49 @@ func (self *_SymbolRef) getFunction(scope types.Scope) (types.Any, bool) {
 	return result, true
 }
 
+// Split a symbol into its components. A component followed by the
+// safe navigation operator (?.) is optional - if it is missing the
+// symbol resolves to NULL without logging an error.
+func splitSymbol(symbol string) ([]string, []bool) {
+	components := []string{}
+	optional := []bool{}
+
+	// Split on ?. outside backtick quoted components first.
+	escaped := false
+	start := 0
+	runes := []rune(symbol)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '`':
+			escaped = !escaped
+
+		case '?':
+			if !escaped && i+1 < len(runes) && runes[i+1] == '.' {
+				for _, c := range utils.SplitIdent(string(runes[start:i])) {
+					components = append(components, c)
+					optional = append(optional, false)
+				}
+				optional[len(optional)-1] = true
+				start = i + 2
+				i++
+			}
+		}
+	}
+
+	for _, c := range utils.SplitIdent(string(runes[start:])) {
+		components = append(components, c)
+		optional = append(optional, false)
+	}
+
+	return components, optional
+}
+
 func (self *_SymbolRef) Reduce(ctx context.Context, scope types.Scope) Any {
 
 	// The symbol is just a constant in the scope. It may be a
 	// stored expression, a function or a stored query or just a
 	// plain value.
-	value, pres := self.getFunction(scope)
+	value, pres := self.getFunction(ctx, scope)
 	if value != nil && pres {
 		switch t := value.(type) {
 		case FunctionInterface:
@@ -1633,16 +2512,20 @@ func (self *_SymbolRef) Reduce(ctx context.Context, scope types.Scope) Any {
 			}
 			defer subscope.Close()
 
-			if subscope.CheckForOverflow() {
+			symbol_ctx := withSymbol(ctx, self.Symbol)
+			if checkForOverflow(symbol_ctx, subscope) {
 				return &Null{}
 			}
 
-			subscope.AppendVars(self.buildArgsFromParameters(
-				ctx, scope))
+			vars := self.buildArgsFromParameters(ctx, scope, t.parameters)
+			if self.Called {
+				t.checkCallingArgs(scope, vars)
+			}
+			subscope.AppendVars(vars)
 
-			scope.GetStats().IncFunctionsCalled()
+			countFunctionCall(ctx, scope)
 
-			return t.Reduce(ctx, subscope)
+			return t.Reduce(symbol_ctx, subscope)
 
 		case StoredQuery:
 			// If the call site specifies parameters then
@@ -1660,14 +2543,15 @@ func (self *_SymbolRef) Reduce(ctx context.Context, scope types.Scope) Any {
 
 				defer subscope.Close()
 
-				if subscope.CheckForOverflow() {
+				if checkForOverflow(withSymbol(ctx, self.Symbol), subscope) {
 					return &Null{}
 				}
 
-				vars := self.buildArgsFromParameters(ctx, scope)
+				vars := self.buildArgsFromParameters(
+					ctx, scope, parameterNames(t))
 				subscope.AppendVars(vars)
 
-				scope.GetStats().IncFunctionsCalled()
+				countFunctionCall(ctx, scope)
 
 				// Wrap the query with the captured scope.
 				return &StoredQueryCallSite{
@@ -1693,46 +2577,46 @@ func (self *_SymbolRef) Reduce(ctx context.Context, scope types.Scope) Any {
 // Interpolate the parameters into a subscope to get ready to call
 // into the VQL stored query with parameters
 func (self *_SymbolRef) buildArgsFromParameters(
-	ctx context.Context, scope types.Scope) *ordereddict.Dict {
+	ctx context.Context, scope types.Scope, names []string) *ordereddict.Dict {
 
 	// Not a function call - pass the scope as it is.
 	if !self.Called {
 		return ordereddict.NewDict()
 	}
 
-	self.mu.Lock()
-	parameters := self.Parameters
-	self.mu.Unlock()
-
-	return buildArgsFromParameters(ctx, scope, parameters)
+	// The parameters are never modified after parsing.
+	return buildArgsFromParameters(ctx, scope, self.Parameters, names)
 }
 
+// Positional args are given the names in order.
 func buildArgsFromParameters(
-	ctx context.Context,
-	scope types.Scope, parameters []*_Args) *ordereddict.Dict {
+	ctx context.Context, scope types.Scope,
+	parameters []*_Args, names []string) *ordereddict.Dict {
 
 	args := ordereddict.NewDict()
 
 	// When calling into a VQL stored function, we materialize all
 	// args.
+	positional := 0
 	for _, arg := range parameters {
+		name := arg.name(&positional, names)
+
 		// e.g. X=func(foo=Bar)
 		// This is evaluated at the point of definition.
 		if arg.Right != nil {
-			name := utils.Unquote_ident(arg.Left)
 			args.Set(name, arg.Right.Reduce(ctx, scope))
 
 			// e.g. X={ SELECT * FROM ... }
 		} else if arg.SubSelect != nil {
-			args.Set(arg.Left, arg.SubSelect)
+			args.Set(name, arg.SubSelect)
 
 			// e.g. X=[1,2,3,4]
 		} else if arg.Array != nil {
 			value := arg.Array.Reduce(ctx, scope)
-			args.Set(arg.Left, value)
+			args.Set(name, value)
 
 		} else if arg.ArrayOpenBrace != "" {
-			args.Set(arg.Left, []Row{})
+			args.Set(name, []Row{})
 		}
 	}
 
@@ -1744,35 +2628,66 @@ func (self *_SymbolRef) callFunction(
 	ctx context.Context, scope types.Scope,
 	func_obj FunctionInterface) Any {
 
-	self.mu.Lock()
+	if !allowImpact(ctx, scope, self.Symbol, func() types.Impact {
+		return func_obj.Info(scope, nil).Impact
+	}) {
+		return &Null{}
+	}
+
+	// The cached function copy is stale if the definitions were
+	// replaced since.
+	version := scope.DefinitionsVersion()
+
+	// Function copies are kept in the query if possible.
+	function_copies := getFunctionCopies(ctx)
+
 	parameters := self.Parameters
-	function := self.function
-	self.mu.Unlock()
+	var function FunctionInterface
+	if function_copies != nil {
+		function = function_copies.get(self, version)
+
+	} else {
+		self.mu.Lock()
+		function = self.function
+		if self.function_version != version {
+			function = nil
+		}
+		self.mu.Unlock()
+	}
 
 	// Build up the args to pass to the function.
 	args := ordereddict.NewDict()
+	positional := 0
 	for _, arg := range parameters {
+		name := arg.name(&positional, nil)
 		if arg.Right != nil {
 			// Lazily evaluate right hand side.
-			name := utils.Unquote_ident(arg.Left)
 			args.Set(name, NewLazyExpr(ctx, scope, arg.Right))
 
 		} else if arg.Array != nil {
 			value := arg.Array.Reduce(ctx, scope)
-			args.Set(utils.Unquote_ident(arg.Left), value)
+			args.Set(name, value)
 
 		} else if arg.ArrayOpenBrace != "" {
-			args.Set(utils.Unquote_ident(arg.Left), []Row{})
+			args.Set(name, []Row{})
 
 		} else if arg.SubSelect != nil {
-			args.Set(utils.Unquote_ident(arg.Left), arg.SubSelect)
+			args.Set(name, arg.SubSelect)
 		}
 	}
 
+	// Free form functions have no declared order for positional
+	// args.
+	if positional > 0 && func_obj.Info(scope, nil).FreeFormArgs {
+		scope.Log("ERROR:%v does not accept positional args", self.Symbol)
+		return &Null{}
+	}
+
 	// If this AST node previously called a function, we use the
 	// same function copy to ensure it may store internal state.
+	ctx = types.WithCallName(ctx, self.Symbol)
 	if function != nil {
-		scope.GetStats().IncFunctionsCalled()
+		countFunctionCall(ctx, scope)
 		result := function.Call(ctx, scope, args)
 		if result == nil {
 			return &Null{}
@@ -1785,12 +2700,18 @@ func (self *_SymbolRef) callFunction(
 	// reference in the AST is unique.
 	func_obj = CopyFunction(func_obj)
 
-	self.mu.Lock()
-	self.function = func_obj
-	self.mu.Unlock()
+	if function_copies != nil {
+		function_copies.set(self, func_obj, version)
+
+	} else {
+		self.mu.Lock()
+		self.function = func_obj
+		self.function_version = version
+		self.mu.Unlock()
+	}
 
 	// Call the function now.
-	scope.GetStats().IncFunctionsCalled()
+	countFunctionCall(ctx, scope)
 
 	result := func_obj.Call(ctx, scope, args)
 
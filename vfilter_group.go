@@ -5,14 +5,13 @@ import (
 	"io"
 
 	"github.com/Velocidex/ordereddict"
-	scope_module "www.velocidex.com/golang/vfilter/scope"
 	"www.velocidex.com/golang/vfilter/types"
-	"www.velocidex.com/golang/vfilter/utils"
 )
 
 type GroupbyActor struct {
 	delegate   *_Select
 	row_source <-chan types.Row
+	counters   *selectCounters
 }
 
 func (self *GroupbyActor) Transform(ctx context.Context,
@@ -32,6 +31,12 @@ func (self *GroupbyActor) GetNextRow(ctx context.Context, scope types.Scope) (
 		// row.
 		new_scope := scope.Copy()
 
+		// Rows are only emitted after grouping is complete.
+		self.counters.row_number++
+		self.counters.appendVars(new_scope)
+
+		timer := startRowTimer(scope)
+
 		// The transform captures the scope inside the LazyRow so when
 		// it gets evaluated it can see previous values.
 		transformed_row, closer := self.delegate.SelectExpression.Transform(
@@ -52,8 +57,10 @@ func (self *GroupbyActor) GetNextRow(ctx context.Context, scope types.Scope) (
 
 			// If the filtered expression returns a bool false, then
 			// skip the row.
-			if expression == nil || !scope.Bool(expression) {
+			if !self.delegate.whereAccepts(
+				ctx, scope, expression, self.counters) {
 				new_scope.Trace("During Groupby: Row rejected")
+				timer.done(self.delegate, false)
 
 				// Prepare the next row
 				new_scope.Close()
@@ -62,13 +69,12 @@ func (self *GroupbyActor) GetNextRow(ctx context.Context, scope types.Scope) (
 			}
 		}
 
-		// Materialize the group by value as much as possible - we
-		// dont want a lazy item here.
-		gb_element := types.ToString(ctx, new_scope,
-			self.delegate.GroupBy.Reduce(ctx, new_scope))
+		gb_element := self.delegate.groupByKey(ctx, new_scope)
 
 		closer()
 
+		timer.done(self.delegate, true)
+
 		// Emit a single row.
 		return transformed_row, row, gb_element, new_scope, nil
 	}
@@ -78,31 +84,67 @@ func (self *GroupbyActor) GetNextRow(ctx context.Context, scope types.Scope) (
 
 func (self *GroupbyActor) MaterializeRow(ctx context.Context,
 	row types.Row, scope types.Scope) *ordereddict.Dict {
-	return MaterializedLazyRow(ctx, row, scope)
+	return redactRow(scope, MaterializedLazyRow(ctx, row, scope))
+}
+
+// The HAVING clause filters the groups once they are complete. It
+// refers to the columns of the grouped rows so aggregates must be
+// aliased: SELECT count() AS C ... GROUP BY X HAVING C > 5
+func (self *_Select) filterGroups(ctx context.Context, scope types.Scope,
+	input <-chan Row) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		counters := newSelectCounters(self)
+		for row := range input {
+			new_scope := scope.Copy()
+			new_scope.AppendVars(row)
+
+			expression := self.Having.Reduce(ctx, new_scope)
+			accepted := conditionAccepts(ctx, new_scope, "HAVING",
+				self.Having, expression, counters)
+			new_scope.Close()
+
+			if !accepted {
+				scope.Trace("During Groupby: Group rejected by HAVING")
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case output_chan <- row:
+			}
+		}
+	}()
+
+	return output_chan
 }
 
 func (self *_Select) EvalGroupBy(ctx context.Context, scope types.Scope) <-chan Row {
 	// Build an actor to send to the grouper.
-	actor := &GroupbyActor{self, self.From.Eval(ctx, scope)}
+	actor := &GroupbyActor{
+		delegate:   self,
+		row_source: self.From.Eval(ctx, scope),
+		counters:   newSelectCounters(self),
+	}
 
 	// Get a grouper implementation
 	grouper_output_chan := GetIntScope(scope).Group(ctx, scope, actor)
+	if self.Having != nil {
+		grouper_output_chan = self.filterGroups(ctx, scope, grouper_output_chan)
+	}
 
 	// Do we need to sort it as well?
 	if self.OrderBy == nil {
 		return grouper_output_chan
 	}
 
-	desc := false
-	if self.OrderByDesc != nil {
-		desc = *self.OrderByDesc
-	}
-
 	// Sort the output groups
 	sorter_input_chan := make(chan Row)
-	sorted_chan := scope.(*scope_module.Scope).Sort(
-		ctx, scope, sorter_input_chan,
-		utils.Unquote_ident(*self.OrderBy), desc)
+	sorted_chan := self.sortRows(ctx, scope, sorter_input_chan, 0)
 
 	// Feed all the aggregate rows into the sorter.
 	go func() {
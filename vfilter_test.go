@@ -2,11 +2,18 @@ package vfilter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Velocidex/ordereddict"
 	"github.com/google/go-cmp/cmp"
@@ -14,8 +21,11 @@ import (
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/assert"
 	"www.velocidex.com/golang/vfilter/arg_parser"
+	"www.velocidex.com/golang/vfilter/grouper"
+	"www.velocidex.com/golang/vfilter/materializer"
 	"www.velocidex.com/golang/vfilter/plugins"
 	"www.velocidex.com/golang/vfilter/protocols"
+	"www.velocidex.com/golang/vfilter/sort"
 	"www.velocidex.com/golang/vfilter/types"
 	"www.velocidex.com/golang/vfilter/utils"
 	"www.velocidex.com/golang/vfilter/utils/dict"
@@ -31,7 +41,8 @@ type execTest struct {
 }
 
 var compareOptions = cmpopts.IgnoreUnexported(
-	_Value{}, Plugin{}, _SymbolRef{}, _AliasedExpression{})
+	_Value{}, Plugin{}, _SymbolRef{}, _AliasedExpression{}, _SelectExpression{},
+	VQL{})
 
 var execTestsSerialization = []execTest{
 	{"1 or sleep(a=100)", true},
@@ -283,7 +294,8 @@ var execTestsSerialization = []execTest{
 	{"('Hello', 'World') =~ 'he'", true},
 	{"('Hello', 'World') =~ 'xx'", false},
 
-	// For now dicts are not regexable
+	// Dicts only match when deep regex is enabled (see
+	// TestDeepRegex).
 	{"dict(x='Hello', y='World') =~ 'he'", false},
 }
 
@@ -452,6 +464,49 @@ func TestValue(t *testing.T) {
 	}
 }
 
+// Comparisons around the 2^63 boundary must not go through float64
+// or wrap uint64 values into negative int64.
+func TestLargeIntegerComparisons(t *testing.T) {
+	scope := makeScope()
+
+	big := uint64(math.MaxInt64) + 1
+	tests := []struct {
+		a, b       Any
+		eq, lt, gt bool
+	}{
+		{big, big, true, false, false},
+		{big, big + 1, false, true, false},
+		{big, int64(math.MaxInt64), false, false, true},
+		{int64(math.MaxInt64), big, false, true, false},
+		{big, int64(-1), false, false, true},
+		{int64(-1), uint64(math.MaxUint64), false, true, false},
+		{uint64(math.MaxUint64), int64(-1), false, false, true},
+		{int64(math.MaxInt64), float64(math.MaxInt64), false, true, false},
+		{float64(math.MaxInt64), int64(math.MaxInt64), false, false, true},
+		{big, float64(big), true, false, false},
+		{float64(big), big + 1, false, true, false},
+		{int64(1) << 53, float64(1<<53) + 1, true, false, false},
+		{int64(1)<<53 + 1, float64(1 << 53), false, false, true},
+		{big, math.NaN(), false, false, false},
+
+		// Floats and small integers are compared directly.
+		{1.5, 2.5, false, true, false},
+		{0.5, float32(0.5), true, false, false},
+		{int64(2), 2.5, false, true, false},
+		{-(int64(1) << 53), float64(-(1 << 53)), true, false, false},
+		{math.Inf(1), big, false, false, true},
+		{math.Inf(-1), int64(math.MinInt64), false, true, false},
+		{math.NaN(), math.NaN(), false, false, false},
+		{int64(1), math.NaN(), false, false, false},
+	}
+
+	for idx, test := range tests {
+		assert.Equal(t, test.eq, scope.Eq(test.a, test.b), "Eq %v", idx)
+		assert.Equal(t, test.lt, scope.Lt(test.a, test.b), "Lt %v", idx)
+		assert.Equal(t, test.gt, scope.Gt(test.a, test.b), "Gt %v", idx)
+	}
+}
+
 func TestEvalWhereClause(t *testing.T) {
 	scope := makeScope()
 	for idx, test := range execTests {
@@ -738,6 +793,28 @@ b={
 
 	{"Whitespace in the query",
 		"SELECT * FROM\ntest()"},
+
+	{"Positional args",
+		"SELECT coalesce(NULL, 2, [1, 2], b={ SELECT * FROM test() }) FROM scope()"},
+
+	{"Pipeline operator",
+		"SELECT foo FROM test() |> sort(key='foo', reverse=TRUE) |> head(n=2)"},
+
+	{"Raw and interpolated heredoc strings",
+		"SELECT <<EOF\nC:\\Windows\\ 'quoted' \"double\"\nEOF AS Raw, f<<END\nfoo is ${const_foo}, $${literal} ${foo.bar2}\n  END AS Interpolated, f'''${env_var}''' AS Short FROM scope()"},
+
+	{"Quoted identifiers",
+		"SELECT `a``b`, `c d`.e, 1 AS `back\\slash`, `a``b` + 1 AS `x.y` FROM foreach(row=dict(`a``b`=1, `c d`=dict(e=2)))"},
+	{"Unicode identifiers",
+		"SELECT Größe, 名前 AS Имя FROM foreach(row=dict(Größe=1, 名前='x'))"},
+
+	{"Number literals with underscores and exponents",
+		"SELECT 1_000_000 AS A, 0xff_ff AS B, 1e6 AS C, 1.5e3 AS D, -2E+2 AS E, 2.5e-1 AS F, 1_0.2_5 AS G, 1e100 AS H FROM scope()"},
+
+	{"Group by having",
+		"select bar, count(items=bar) AS C from groupbytest() WHERE foo != 1 GROUP BY bar HAVING C > 1"},
+	{"Group by having with order by",
+		"select bar, sum(item=foo) AS Total from groupbytest() GROUP BY bar HAVING Total > 1 ORDER BY Total DESC"},
 }
 
 var multiVQLTest = []vqlTest{
@@ -1332,6 +1409,358 @@ FROM scope()
 	{"Test struct associative", `
 SELECT StructValue.SrcIP, StructValue.src_ip, StructValue.SrcIp
 FROM scope()`},
+
+	{"Test read_csv", `
+SELECT * FROM read_csv(filename="test.csv")
+`},
+
+	{"Test read_csv with TSV and columns", `
+SELECT * FROM read_csv(filename="test.tsv", separator="\t", columns=["A", "B"])
+`},
+
+	{"Test read_jsonl", `
+SELECT * FROM read_jsonl(filename="test.jsonl")
+`},
+
+	{"Test tee with consumer", `
+SELECT * FROM tee(query={ SELECT * FROM test() },
+   consumer={ SELECT set_env(column="LastTee", value=foo) FROM scope() })
+SELECT RootEnv.LastTee FROM scope()
+`},
+
+	// Variadic functions accept positional and extra named args.
+	{"Test variadic args", `
+SELECT coalesce(NULL, Missing, 2, 3) AS Positional,
+       coalesce(a=NULL, b="x") AS Named,
+       coalesce(NULL) AS AllNull,
+       coalesce({ SELECT * FROM test() }) AS SubQuery
+FROM scope()
+`},
+
+	// Bytes are binary safe and are never decoded as UTF-8.
+	{"Test bytes", `
+LET Data = bytes(value=[255, 0, 65, 66, 254])
+SELECT len(list=Data) AS Len, Data[0] AS First, Data[-1] AS Last,
+       Data[2:4] AS Slice, str(value=Data[2:4]) AS SliceStr,
+       Data[2:4] = "AB" AS SliceEq, Data =~ "AB" AS Match,
+       bytes(value="AB") + bytes(value=[0, 67]) AS Concat,
+       bytes(value=[1, 256]) AS Invalid
+FROM scope()
+`},
+
+	// Deep equality ignores dict key order and optionally array order.
+	{"Test equals", `
+LET Rows = SELECT * FROM test()
+SELECT equals(a=dict(X=1, Y=(1, 2)), b=dict(Y=(1, 2), X=1)) AS DictOrder,
+       equals(a=dict(X=dict(Y=(1, 2))), b=dict(X=dict(Y=(2, 1)))) AS NestedUnordered,
+       equals(a=dict(X=dict(Y=(1, 2))), b=dict(X=dict(Y=(2, 1))), strict=TRUE) AS NestedStrict,
+       equals(a=(1, 1, 2), b=(1, 2, 2)) AS Multiset,
+       equals(a=(1, 2), b=(1, 2, 3)) AS Length,
+       equals(a=dict(X=1), b=dict(X=1, Y=NULL)) AS MissingKey,
+       equals(a=Rows, b={ SELECT * FROM test() }, strict=TRUE) AS Query,
+       equals(a="hello", b="hello") AS Scalar
+FROM scope()
+`},
+
+	// Set operations remove duplicates and keep the original order.
+	{"Test set operations", `
+LET A = ("a", "b", "b", "c")
+LET B = ("c", "d", "a")
+SELECT intersect(a=A, b=B) AS Intersect,
+       union(a=A, b=B) AS Union,
+       difference(a=A, b=B) AS Difference,
+       difference(a=B, b=A) AS Reverse,
+       union(a=(1, 2), b=(2.0, 3)) AS Numeric,
+       intersect(a="a", b=A) AS Scalar,
+       intersect(a={ SELECT foo FROM test() }, b=dict(foo=2)) AS Rows
+FROM scope()
+`},
+
+	// _row_number counts rows received from the FROM clause.
+	{"Test row number", `
+SELECT _row_number AS N, foo FROM test()
+SELECT foo, _row_number FROM test() WHERE _row_number > 1
+SELECT * FROM range(start=1, end=5) WHERE _row_number IN (1, 3)
+SELECT bar, count() AS Count, _row_number AS LastRow
+FROM test() GROUP BY bar > 0
+`},
+
+	// Queries may limit themselves based on their own progress.
+	{"Test query progress variables", `
+SELECT _row_number, _rows_emitted, _elapsed >= 0 AS HasElapsed
+FROM range(start=1, end=10) WHERE _rows_emitted < 3 AND _row_number > 2
+LET _rows_emitted = 100
+SELECT _rows_emitted FROM test()
+`},
+
+	// An outer LIMIT is pushed into the stored query's ORDER BY.
+	{"Test order by limit pushdown", `
+LET Sorted = SELECT foo FROM test() ORDER BY foo DESC
+LET Filtered = SELECT foo FROM test() WHERE foo > 0 ORDER BY foo
+SELECT * FROM Sorted LIMIT 2
+SELECT * FROM Sorted WHERE foo < 4 LIMIT 1
+SELECT * FROM Filtered LIMIT 1
+SELECT foo, { SELECT * FROM Sorted } AS All FROM Sorted LIMIT 1
+`},
+
+	// UNLET removes a variable so it no longer resolves.
+	{"Test UNLET", `
+LET X = 1
+LET Y = 2
+SELECT X, Y FROM scope()
+UNLET X
+SELECT X, Y FROM scope()
+LET X <= 3
+SELECT X, Y FROM scope()
+`},
+
+	// vars() describes the variables defined so far.
+	{"Test vars plugin", `
+LET VarX = 1
+LET VarQ = SELECT * FROM test()
+LET VarM <= SELECT * FROM test()
+LET VarF(A) = A + 1
+SELECT * FROM vars() WHERE Name =~ "^Var"
+SELECT Name, Kind FROM vars(builtins=TRUE) WHERE Name IN ("len", "range")
+`},
+
+	// Groups are emitted in the order they are first seen.
+	{"Test group by first seen order", `
+SELECT X, count() AS Count
+FROM foreach(row=(3, 1, 2, 1, 3), query={ SELECT _value AS X FROM scope() })
+GROUP BY X
+`},
+
+	// with_new_aggregates() isolates aggregate functions in the query.
+	{"Test with_new_aggregates", `
+LET Counted = SELECT count() AS Count FROM range(start=1, end=2)
+SELECT * FROM foreach(row=(1, 2), query={ SELECT * FROM Counted })
+SELECT * FROM foreach(row=(1, 2), query={
+   SELECT * FROM with_new_aggregates(query=Counted) })
+SELECT count() AS Outer, Inner
+FROM foreach(row=(1, 2), query={
+   SELECT * FROM with_new_aggregates(query={
+      SELECT count() AS Inner FROM scope() }) })
+`},
+
+	// on_error controls what happens when the query for one row
+	// panics.
+	{"Test foreach on_error", `
+LET Query = SELECT _value AS X, panic(column=_value, value=2) AS Y FROM scope()
+SELECT * FROM foreach(row=(1, 2, 3), query=Query, on_error="continue")
+SELECT * FROM foreach(row=(1, 2, 3), query=Query, on_error="collect")
+SELECT * FROM foreach(row=(1, 2, 3), query=Query, on_error="abort")
+`},
+
+	// Each pipeline stage receives the previous stage as its query
+	// arg.
+	{"Test pipeline operator", `
+SELECT value FROM range(start=1, end=5) |> sort(key="value", reverse=TRUE) |> head(n=2)
+LET Top = SELECT value FROM range(start=1, end=5) |> head(n=3)
+SELECT * FROM Top
+SELECT * FROM flatten(query={ SELECT value FROM Top |> head(n=1) })
+`},
+	{"Test big numbers", `
+SELECT bigint(value="9223372036854775807") + 1 AS Overflow,
+       bigint(value="18446744073709551615") * 2 AS Mul,
+       bigint(value=5) - 7.5 AS Sub,
+       bigint(value=10) / 4 AS Div,
+       bigint(value=1) / 3 AS Third,
+       bigint(value=1) / 0 AS DivZero,
+       decimal(value="0.1") + decimal(value="0.2") AS Dec,
+       decimal(value="0.1") + decimal(value="0.2") = decimal(value="0.3") AS DecEq,
+       bigint(value="9223372036854775808") > 9223372036854775807 AS Gt,
+       9223372036854775807 < bigint(value="9223372036854775808") AS Lt,
+       if(condition=bigint(value=0), then=1, else=2) AS Falsy,
+       bigint(value="abc") AS Bad
+FROM scope()
+`},
+	{"Test introspection plugins", `
+SELECT Name, Doc, Args, Impact FROM plugins() WHERE Name = 'head'
+SELECT Name, IsAggregate, Args FROM functions() WHERE Name IN ('count', 'str')
+`},
+	{"Test safe navigation", `
+LET X = dict(Foo=dict(Bar=1))
+SELECT X?.Foo?.Bar AS A, X?.Missing?.Bar AS B, Missing?.Foo AS C,
+       (X, )[0]?.Foo.Bar AS D, X?.` + "`Foo`" + `.Bar AS E
+FROM scope()
+`},
+	{"Test has_column and exists", `
+SELECT value, has_column(name='value') AS A, has_column(name='Missing') AS B,
+       has_column(row=dict(X=1), name='X') AS C,
+       has_column(row=dict(X=1), name='Y') AS D,
+       exists(query={ SELECT * FROM range(start=1, end=3) }) AS E,
+       exists(query={ SELECT * FROM range(start=1, end=3) WHERE value > 5 }) AS F
+FROM range(start=1, end=1)
+SELECT value AS Outer FROM range(start=1, end=5)
+WHERE exists(query={ SELECT * FROM range(start=3, end=4) WHERE value = Outer })
+`},
+	{"Test any and all", `
+SELECT any(items=[1, 2, 3], filter="x=>x > 2") AS AnyGt2,
+       any(items=[1, 2, 3], filter="x=>x > 3") AS AnyGt3,
+       all(items=[1, 2, 3], filter="x=>x > 0") AS AllGt0,
+       all(items=[1, 2, 3], filter="x=>x > 1") AS AllGt1,
+       any(items=[], filter="x=>TRUE") AS AnyEmpty,
+       all(items=[], filter="x=>FALSE") AS AllEmpty,
+       any(items={ SELECT * FROM range(start=1, end=5) }, filter="x=>x.value = 4") AS AnyQuery,
+       all(items={ SELECT * FROM range(start=1, end=5) }, filter="x=>x.value < 4") AS AllQuery,
+       any(items=[1, 2], filter="x=>") AS BadFilter
+FROM scope()
+`},
+	{"Test dict integer index", `
+LET D = dict(a=1, b=2, c=3)
+SELECT D[0] AS First, D[2] AS Last, D[-1] AS FromEnd, D[3] AS Missing,
+       D['b'] AS ByKey, dict()[0] AS Empty
+FROM scope()
+`},
+	// Edits include transpositions and case is ignored by default.
+	{"Test fuzzy_match", `
+SELECT fuzzy_match(string="svch0st.exe", pattern="svchost.exe") AS Substituted,
+       fuzzy_match(string="svhcost.exe", pattern="svchost.exe", distance=1) AS Transposed,
+       fuzzy_match(string="scvhst.exe", pattern="svchost.exe") AS TwoEdits,
+       fuzzy_match(string="scvhst.exe", pattern="svchost.exe", distance=1) AS TooFar,
+       fuzzy_match(string="SVCHOST.EXE", pattern="svchost.exe", distance=0) AS CaseIgnored,
+       fuzzy_match(string="SVCHOST.EXE", pattern="svchost.exe", case_sensitive=TRUE) AS CaseSensitive,
+       fuzzy_match(string="explorer.exe", pattern="svchost.exe") AS Different
+FROM scope()
+`},
+
+	// Addresses are in networks, compare numerically and compare
+	// with address strings.
+	{"Test IP addresses and networks", `
+LET Net = ip(cidr="10.0.0.0/8")
+SELECT Net, ip(string="10.1.2.3") AS Addr,
+       ip(string="10.1.2.3") in Net AS InNet,
+       "10.1.2.3" in Net AS StringInNet,
+       ip(string="11.0.0.1") in Net AS NotInNet,
+       ip(string="fd00::1") in ip(cidr="fc00::/7") AS IPv6In,
+       ip(string="10.0.0.9") < ip(string="10.0.0.10") AS Lt,
+       ip(string="10.0.0.9") > "10.0.0.10" AS Gt,
+       ip(string="10.0.0.1") = "10.0.0.1" AS Eq,
+       ip(string="::ffff:10.0.0.1") = ip(string="10.0.0.1") AS MappedEq,
+       ip(string="192.168.1.1").IsPrivate AS Private,
+       ip(string="fd00::1").Version AS Version,
+       ip(string="not an ip") AS Invalid,
+       cidr_contains(ip="172.16.5.4", cidr=["10.0.0.0/8", "172.16.0.0/12"]) AS Contains,
+       cidr_contains(ip="8.8.8.8", cidr="10.0.0.0/8") AS NotContains
+FROM scope()
+`},
+	{"Test filtering by network", `
+SELECT * FROM foreach(row=[dict(SrcIP="10.0.0.1"), dict(SrcIP="8.8.8.8"),
+                           dict(SrcIP="192.168.0.7")])
+WHERE SrcIP in ip(cidr="10.0.0.0/8") OR SrcIP in ip(cidr="192.168.0.0/16")
+`},
+
+	// * does not cross path separators but ** does.
+	{"Test glob_match", `
+SELECT glob_match(string="svchost.EXE", pattern="*.exe") AS Star,
+       glob_match(string="svchost.EXE", pattern="*.exe", case_sensitive=TRUE) AS CaseSensitive,
+       glob_match(string="C:/Windows/svchost.exe", pattern="*.exe") AS StarSeparator,
+       glob_match(string="C:/Windows/svchost.exe", pattern="C:/**.exe") AS DoubleStar,
+       glob_match(string="/usr/bin/ls", pattern="/usr/{bin,sbin}/?s") AS Alternatives,
+       glob_match(string="/usr/lib/ls", pattern="/usr/{bin,sbin}/?s") AS NoAlternative,
+       glob_match(string="file1.txt", pattern="file[0-9].txt") AS Class,
+       glob_match(string="fileA.txt", pattern="file[!0-9].txt") AS NegatedClass,
+       glob_match(string="a+b(1).log", pattern="a+b(?).log") AS Literals,
+       glob_match(string="notes.md", pattern=["*.txt", "*.md"]) AS AnyPattern
+FROM scope()
+`},
+	{"Test string predicates", `
+SELECT starts_with(string="svchost.exe", prefix="SVC") AS StartsWith,
+       starts_with(string="svchost.exe", prefix="SVC", case_sensitive=TRUE) AS StartsWithCase,
+       starts_with(string="sv", prefix="svc") AS PrefixTooLong,
+       ends_with(string="svchost.exe", suffix=".EXE") AS EndsWith,
+       ends_with(string="svchost.exe", suffix="host") AS NotEndsWith,
+       contains(string="svchost.exe", substring="HOST") AS Contains,
+       contains(string="svchost.exe", substring="HOST", case_sensitive=TRUE) AS ContainsCase,
+       contains(string="svchost.exe", substring="") AS EmptySubstring
+FROM scope()
+`},
+	// Pid 3 matches two connections and Pid 4 has no process.
+	{"Test join", `
+LET Procs = SELECT * FROM foreach(row=[dict(Pid=1, Name="init"),
+   dict(Pid=2, Name="bash"), dict(Pid=3, Name="sshd")])
+LET Conns = SELECT * FROM foreach(row=[dict(Pid=2, Port=22),
+   dict(Pid=3, Port=22), dict(Pid=3, Port=2222), dict(Pid=4, Port=80)])
+LET Owners = SELECT * FROM foreach(row=[dict(ProcessId=1, User="root", Name="x")])
+SELECT * FROM join(lhs=Procs, rhs=Conns, on="Pid")
+SELECT * FROM join(lhs=Procs, rhs=Conns, on="Pid", type="left")
+SELECT * FROM join(lhs=Procs, rhs=Owners, on="Pid", rhs_on="ProcessId")
+SELECT * FROM join(lhs=Procs, rhs=Conns, on="Pid", type="outer")
+`},
+	{"Test chain schemas", `
+LET A = SELECT * FROM foreach(row=[dict(Name="a", Size=1), dict(Size=2, Name="b")])
+LET B = SELECT * FROM foreach(row=[dict(Name="c", Mode="x")])
+SELECT * FROM chain(a=A, b=B)
+SELECT * FROM chain(a=A, b=B, unify_schema=TRUE)
+SELECT * FROM chain(a=A, b=A, strict_schema=TRUE)
+SELECT * FROM chain(a=A, b=B, strict_schema=TRUE)
+`},
+	{"Test chain with source", `
+LET A = SELECT * FROM foreach(row=[dict(Name="a"), dict(Name="b")])
+LET B = SELECT * FROM foreach(row=[dict(Name="c", _Source="masked")])
+SELECT * FROM chain(procs=A, files=B, include_source=TRUE)
+SELECT * FROM chain(procs=A, files=B, include_source=TRUE, source_column="Origin", unify_schema=TRUE)
+SELECT Origin, count() AS Count FROM chain(procs=A, files=B, include_source=TRUE, source_column="Origin") GROUP BY Origin
+`},
+	{"Test ORDER BY with a cast", `
+LET Mixed = SELECT * FROM foreach(row=[dict(X=10), dict(X="9"), dict(X=2.5),
+   dict(X="abc"), dict(X="0x10"), dict(X=NULL), dict(X=1)])
+SELECT X FROM Mixed ORDER BY X::int
+SELECT X FROM Mixed ORDER BY X::float DESC
+SELECT X FROM Mixed ORDER BY X::string
+SELECT X FROM Mixed ORDER BY X::int LIMIT 2
+SELECT X, count() AS Count FROM Mixed GROUP BY X ORDER BY X::int DESC
+`},
+	{"Test positional args", `
+LET F(X) = X * 2
+LET Q(X, Y) = SELECT X, Y FROM scope()
+SELECT F(3) AS Double,
+       format(format="%v %v", 1, 2) AS Format,
+       format("%v-%v", 1, 2) AS AllPositional,
+       format(format="%v-%v", args=[1, 2]) AS NamedArgs,
+       dict(1) AS Dict
+FROM scope()
+SELECT * FROM Q(1, 2)
+SELECT * FROM range(0, 3)
+`},
+	{"Test chain with unified columns", `
+LET A = SELECT * FROM foreach(row=[dict(Name="a", Size=1), dict(Name="b", Extra=2)])
+LET B = SELECT * FROM foreach(row=[dict(Name="c", Mode="x")])
+SELECT * FROM chain(a=A, b=B, unify_schema=TRUE)
+SELECT * FROM chain(a=A, b=B, columns=["Mode", "Name"])
+`},
+	{"Test GROUP BY with a cast", `
+LET Mixed = SELECT * FROM foreach(row=[dict(X=1), dict(X="1"), dict(X=1.0),
+   dict(X=" 01"), dict(X="abc"), dict(X=NULL), dict(X=2)])
+SELECT X, count() AS Count FROM Mixed GROUP BY X::int
+SELECT X, count() AS Count FROM Mixed GROUP BY X::float ORDER BY X::float
+`},
+	{"Test interpolating LET values", `
+LET N = 7
+LET D = dict(A=1 + 1, B=N)
+LET M <= 8
+SELECT f'''n=${N} a=${D.A} b=${D.B} m=${M}''' AS S FROM scope()
+`},
+}
+
+// Files available to plugins which read files in tests.
+var testFiles = map[string]string{
+	"test.csv": "Name,Value\nfoo,1\nbar,\"quoted, value\"\n",
+	"test.tsv": "foo\t1\nbar\t2\n",
+	"test.jsonl": `{"A": 1, "B": {"C": "hello"}}
+
+{"A": 2, "B": [1, 2]}
+`,
+}
+
+func testFileOpener(ctx context.Context, scope types.Scope,
+	accessor, filename string) (io.ReadCloser, error) {
+	data, pres := testFiles[filename]
+	if !pres {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
 }
 
 type _RangeArgs struct {
@@ -1419,7 +1848,9 @@ func makeTestScope() types.Scope {
 						&ObjectWithMethods{Value1: 1},
 						&ObjectWithMethods{Value1: 2},
 					}
-				}})
+				}},
+			plugins.ReadCSVPlugin{}, plugins.ReadJSONLPlugin{})
+	plugins.SetFileOpener(result, testFileOpener)
 	result.SetLogger(log.New(os.Stdout, "Log: ", log.Ldate|log.Ltime|log.Lshortfile))
 	return result
 }
@@ -1493,6 +1924,582 @@ func TestMaterializedStoredQuery(t *testing.T) {
 	assert.Equal(t, CounterFunctionCount, 3)
 }
 
+// The expiring materializer only keeps a window of recent rows.
+func TestExpiringMaterializer(t *testing.T) {
+	scope := makeTestScope()
+
+	run_query := func(query string) []Row {
+		vql, err := Parse(query)
+		assert.NoError(t, err)
+
+		var result []Row
+		for row := range vql.Eval(context.Background(), scope) {
+			value, _ := scope.Associative(row, "value")
+			result = append(result, value)
+		}
+		return result
+	}
+
+	wait := func(name string) {
+		value, _ := scope.Resolve(name)
+		rows, ok := value.(*materializer.ExpiringRows)
+		assert.True(t, ok)
+		<-rows.Done()
+	}
+
+	// Only keep the last 2 rows.
+	scope.SetMaterializer(materializer.NewExpiringMaterializer(2, 0))
+	run_query("LET last_rows <= SELECT value FROM range(start=1, end=5)")
+	wait("last_rows")
+	assert.Equal(t, []Row{float64(4), float64(5)},
+		run_query("SELECT value FROM last_rows"))
+
+	// Rows older than the TTL are dropped.
+	clock := types.NewDeterministicSource(0, time.Unix(1600000000, 0))
+	types.SetOption(scope, types.EntropySourceOption, clock)
+	scope.SetMaterializer(materializer.NewExpiringMaterializer(
+		0, time.Minute))
+	run_query("LET recent_rows <= SELECT value FROM range(start=1, end=5)")
+	wait("recent_rows")
+	assert.Equal(t, 5, len(run_query("SELECT value FROM recent_rows")))
+
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, 5, len(run_query("SELECT value FROM recent_rows")))
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, 0, len(run_query("SELECT value FROM recent_rows")))
+}
+
+func TestStreamingGrouper(t *testing.T) {
+	scope := makeTestScope()
+	scope.SetGrouper(grouper.NewStreamingGrouper(3, 0))
+
+	vql, err := Parse(`
+SELECT value = 1 OR value = 3 OR value = 5 OR value = 7 AS Odd,
+       count() AS Count
+FROM range(start=1, end=7) GROUP BY Odd`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	output := []string{}
+	for row := range vql.Eval(ctx, scope) {
+		odd, _ := scope.Associative(row, "Odd")
+		count, _ := scope.Associative(row, "Count")
+		output = append(output, fmt.Sprintf("%v:%v", odd, count))
+	}
+
+	// Changed groups are emitted every 3 rows and when the input
+	// ends.
+	assert.Equal(t, []string{
+		"true:2", "false:1",
+		"true:3", "false:3",
+		"true:4",
+	}, output)
+}
+
+func TestFileMaterializer(t *testing.T) {
+	temp_dir, err := ioutil.TempDir("", "vfilter_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(temp_dir)
+
+	file_size := func(compressor materializer.Compressor) int64 {
+		scope := makeTestScope()
+		scope.SetMaterializer(materializer.NewFileMaterializer(
+			temp_dir, compressor))
+
+		vql, err := MultiParse(`
+LET X <= SELECT value, format(format="row %v", args=value) AS Name,
+   dict(A=[1, 2.5, "x"]) AS Nested
+FROM range(start=0, end=999)
+
+SELECT * FROM X WHERE value = 10
+`)
+		assert.NoError(t, err)
+
+		ctx := context.Background()
+		result := []*ordereddict.Dict{}
+		for _, query := range vql {
+			for row := range query.Eval(ctx, scope) {
+				result = append(result, RowToDict(ctx, scope, row))
+			}
+		}
+
+		// Rows are read back from JSON.
+		assert.Equal(t, []*ordereddict.Dict{ordereddict.NewDict().
+			Set("value", uint64(10)).
+			Set("Name", "row 10").
+			Set("Nested", ordereddict.NewDict().
+				Set("A", []interface{}{uint64(1), 2.5, "x"}))}, result)
+
+		value, _ := scope.Resolve("X")
+		rows, ok := value.(*materializer.FileRows)
+		assert.True(t, ok)
+		assert.Equal(t, 1000, rows.Len())
+
+		files, err := ioutil.ReadDir(temp_dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(files))
+		size := files[0].Size()
+
+		// The file is removed with the scope.
+		scope.Close()
+		files, err = ioutil.ReadDir(temp_dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(files))
+
+		return size
+	}
+
+	uncompressed := file_size(nil)
+	compressed := file_size(materializer.GzipCompressor{})
+	assert.True(t, compressed < uncompressed/4)
+}
+
+func TestNumberFormat(t *testing.T) {
+	scope := makeTestScope()
+	vql, err := Parse(`SELECT 9007199254740993 AS Big, 5 AS Small,
+   1.23456 AS Float, dict(X=-9007199254740993, Y=[2.71828, 1]) AS Nested
+FROM scope()`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	encoder := func(rows []Row) ([]byte, error) {
+		return json.Marshal(rows)
+	}
+
+	// By default numbers are left alone.
+	output, err := OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Big":9007199254740993,"Small":5,"Float":1.23456,"Nested":{"X":-9007199254740993,"Y":[2.71828,1]}}]`,
+		string(output))
+
+	format := types.NewNumberFormat()
+	format.StringifyLargeInts = true
+	format.FloatPrecision = 2
+	types.SetOption(scope, types.NumberFormatOption, format)
+
+	output, err = OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Big":"9007199254740993","Small":5,"Float":1.23,"Nested":{"X":"-9007199254740993","Y":[2.72,1]}}]`,
+		string(output))
+}
+
+func TestTimeSerialization(t *testing.T) {
+	scope := makeTestScope()
+	vql, err := Parse(`SELECT T AS Time, dict(Nested=(T, T)) AS Nested FROM scope()`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	encoder := func(rows []Row) ([]byte, error) {
+		return json.Marshal(rows)
+	}
+
+	zone := time.FixedZone("AEST", 10*60*60)
+	value := time.Date(2021, 3, 4, 22, 30, 15, 500000000, zone)
+	scope.AppendVars(ordereddict.NewDict().Set("T", value))
+
+	// By default times are rendered in their own zone.
+	output, err := OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Time":"2021-03-04T22:30:15.5+10:00","Nested":{"Nested":["2021-03-04T22:30:15.5+10:00","2021-03-04T22:30:15.5+10:00"]}}]`,
+		string(output))
+
+	types.SetOption(scope, types.TimeSerializerOption, types.NewRFC3339TimeSerializer(nil))
+	output, err = OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Time":"2021-03-04T12:30:15.5Z","Nested":{"Nested":["2021-03-04T12:30:15.5Z","2021-03-04T12:30:15.5Z"]}}]`,
+		string(output))
+
+	types.SetOption(scope, types.TimeSerializerOption, types.NewRFC3339TimeSerializer(
+		time.FixedZone("PST", -8*60*60)))
+	output, err = OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Time":"2021-03-04T04:30:15.5-08:00","Nested":{"Nested":["2021-03-04T04:30:15.5-08:00","2021-03-04T04:30:15.5-08:00"]}}]`,
+		string(output))
+}
+
+func TestRuneIndexing(t *testing.T) {
+	scope := makeTestScope()
+	vql, err := Parse(`SELECT X[1] AS Index, X[-1] AS Last, X[0:2] AS Slice,
+   len(list=X) AS Len, runes(string=X) AS Runes
+FROM scope()`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	encoder := func(rows []Row) ([]byte, error) {
+		return json.Marshal(rows)
+	}
+
+	scope.AppendVars(ordereddict.NewDict().Set("X", "héllo"))
+
+	// By default strings are indexed by byte.
+	output, err := OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Index":195,"Last":111,"Slice":"h\ufffd","Len":6,"Runes":["h","é","l","l","o"]}]`,
+		string(output))
+
+	types.SetOption(scope, types.RuneIndexingOption, true)
+
+	output, err = OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"Index":"é","Last":"o","Slice":"hé","Len":5,"Runes":["h","é","l","l","o"]}]`,
+		string(output))
+}
+
+func TestArraySliceView(t *testing.T) {
+	array := make([]Any, 100000)
+	for i := range array {
+		array[i] = int64(i)
+	}
+
+	value := int64(7)
+	scope := NewScope().AppendVars(ordereddict.NewDict().
+		Set("X", array).Set("Y", []Any{int64(1)}).
+		Set("Z", []*int64{&value, nil}))
+
+	// Slicing returns a view which can be indexed, sliced and
+	// iterated over without copying the array.
+	window, _ := scope.Associative(array, []*int64{nil, nil})
+	window_view, ok := window.(*types.SliceView)
+	assert.True(t, ok)
+	assert.Equal(t, 100000, window_view.Len())
+
+	sub_window, _ := scope.Associative(window, []*int64{&value, nil})
+	assert.Equal(t, int64(8), sub_window.(*types.SliceView).Index(1))
+
+	count := 0
+	for range scope.Iterate(context.Background(), sub_window) {
+		count++
+	}
+	assert.Equal(t, 100000-7, count)
+
+	vql, err := Parse(`SELECT X[2:100000][1] AS Second,
+   X[2:100000][-1] AS Last, X[2:100000][10:20][0] AS SubSlice,
+   X[2:5] + Y AS Appended, len(list=X[10:20]) AS Len,
+   Z[0:2] AS Converted,
+   { SELECT * FROM foreach(row=X[3:5]) } AS Iterated
+FROM scope()`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var row Row
+	for row = range vql.Eval(ctx, scope) {
+	}
+
+	serialized, err := json.Marshal(dict.RowToDict(ctx, scope, row))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Second":3,"Last":99999,"SubSlice":12,`+
+		`"Appended":[2,3,4,1],"Len":10,"Converted":[7,null],`+
+		`"Iterated":[3,4]}`, string(serialized))
+
+	// Appending to a window does not modify the original array.
+	assert.Equal(t, int64(5), array[5])
+
+	// Columns hold a copy with nil pointers converted to NULL.
+	converted, _ := scope.Associative(row, "Converted")
+	assert.Equal(t, []Any{&value, &types.Null{}}, converted)
+}
+
+func TestCompiledConcurrentEval(t *testing.T) {
+	scope := makeTestScope()
+	vql, err := Parse(`
+SELECT value > 3 AS Big, count() AS Count, 1.5 AS Float, "x" AS String
+FROM range(start=1, end=10) GROUP BY Big`)
+	assert.NoError(t, err)
+	vql.Compile(scope)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := []string{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			subscope := scope.ForkReadOnly()
+			defer subscope.Close()
+
+			output := []Row{}
+			for row := range vql.Eval(ctx, subscope) {
+				output = append(output, dict.RowToDict(ctx, subscope, row))
+			}
+			serialized, _ := json.Marshal(output)
+
+			mu.Lock()
+			results = append(results, string(serialized))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Each query keeps its own aggregate state.
+	for _, result := range results {
+		assert.Equal(t, `[{"Big":false,"Count":3,"Float":1.5,"String":"x"},`+
+			`{"Big":true,"Count":7,"Float":1.5,"String":"x"}]`, result)
+	}
+}
+
+// One parsed query may be evaluated concurrently in different scopes
+// with their own definitions.
+func TestConcurrentEvalInScopes(t *testing.T) {
+	vql, err := Parse(`SELECT impl() AS Impl, count() AS Count FROM range(end=5)`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("scope %d", i)
+			scope := NewScope().AppendFunctions(GenericFunction{
+				FunctionName: "impl",
+				Function: func(ctx context.Context, scope types.Scope,
+					args *ordereddict.Dict) Any {
+					return name
+				},
+			})
+			defer scope.Close()
+
+			var last Row
+			for row := range vql.Eval(ctx, scope) {
+				impl, _ := scope.Associative(row, "Impl")
+				assert.Equal(t, name, impl)
+				last = row
+			}
+
+			count, _ := scope.Associative(last, "Count")
+			assert.Equal(t, uint64(5), count)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLazyFlatten(t *testing.T) {
+	array := make([]Any, 100000)
+	for i := range array {
+		array[i] = int64(i)
+	}
+
+	scope := makeTestScope().AppendVars(ordereddict.NewDict().
+		Set("X", array))
+
+	// The cartesian product has 10^10 rows so can only be
+	// generated on demand.
+	vql, err := Parse(`SELECT * FROM flatten(query={
+   SELECT X AS A, X AS B FROM scope()
+}) LIMIT 3`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	output := []Row{}
+	for row := range vql.Eval(ctx, scope) {
+		output = append(output, dict.RowToDict(ctx, scope, row))
+	}
+
+	assert.Equal(t, []Row{
+		ordereddict.NewDict().Set("A", int64(0)).Set("B", int64(0)),
+		ordereddict.NewDict().Set("A", int64(1)).Set("B", int64(0)),
+		ordereddict.NewDict().Set("A", int64(2)).Set("B", int64(0)),
+	}, output)
+}
+
+func TestStoredQueryCache(t *testing.T) {
+	calls := 0
+	scope := makeTestScope().AppendPlugins(plugins.GenericListPlugin{
+		PluginName: "expensive",
+		Function: func(ctx context.Context, scope types.Scope, args *ordereddict.Dict) []Row {
+			calls++
+			return []Row{ordereddict.NewDict().Set("Value", calls)}
+		},
+	})
+	EnableStoredQueryCache(scope)
+
+	vqls, err := MultiParse(`
+LET Threshold = 5
+LET Expensive = SELECT Value, Threshold FROM expensive()
+LET Wrapped(X) = SELECT * FROM Expensive WHERE X
+SELECT * FROM Expensive
+SELECT * FROM Wrapped(X=TRUE)
+LET Threshold = 5
+SELECT * FROM Expensive
+LET Threshold = 6
+SELECT * FROM Wrapped(X=TRUE)
+SELECT * FROM Wrapped(X=FALSE)
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			output = append(output, dict.RowToDict(ctx, scope, row))
+		}
+	}
+
+	// Expensive is only re-run after Threshold changes value.
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 4, len(output))
+	assert.Equal(t, []Row{
+		ordereddict.NewDict().Set("Value", 1).Set("Threshold", int64(5)),
+		ordereddict.NewDict().Set("Value", 1).Set("Threshold", int64(5)),
+		ordereddict.NewDict().Set("Value", 1).Set("Threshold", int64(5)),
+		ordereddict.NewDict().Set("Value", 2).Set("Threshold", int64(6)),
+	}, output)
+}
+
+// Only the first component of a symbol names the variable the cached
+// query depends on, including after ?. and inside backticks.
+func TestStoredQueryCacheDependencies(t *testing.T) {
+	scope := makeTestScope()
+	EnableStoredQueryCache(scope)
+
+	vqls, err := MultiParse("LET Env = dict(A=1)\n" +
+		"LET `X.Y` = 1\n" +
+		"LET Optional = SELECT Env?.A AS A FROM scope()\n" +
+		"LET Quoted = SELECT `X.Y` AS A FROM scope()\n" +
+		"SELECT * FROM Optional\n" +
+		"SELECT * FROM Quoted\n" +
+		"LET Env = dict(A=2)\n" +
+		"LET `X.Y` = 2\n" +
+		"SELECT * FROM Optional\n" +
+		"SELECT * FROM Quoted\n")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			output = append(output, dict.RowToDict(ctx, scope, row))
+		}
+	}
+
+	assert.Equal(t, []Row{
+		ordereddict.NewDict().Set("A", int64(1)),
+		ordereddict.NewDict().Set("A", int64(1)),
+		ordereddict.NewDict().Set("A", int64(2)),
+		ordereddict.NewDict().Set("A", int64(2)),
+	}, output)
+}
+
+// Records the limits the top N sorter was called with.
+type recordingSorter struct {
+	sort.DefaultSorter
+	limits []int
+}
+
+func (self *recordingSorter) SortTopN(ctx context.Context,
+	scope types.Scope, input <-chan Row,
+	key string, desc bool, limit int) <-chan Row {
+	self.limits = append(self.limits, limit)
+	return self.DefaultSorter.SortTopN(ctx, scope, input, key, desc, limit)
+}
+
+func TestOrderByLimitPushdown(t *testing.T) {
+	sorter := &recordingSorter{}
+	scope := makeTestScope()
+	scope.SetSorter(sorter)
+
+	vqls, err := MultiParse(`
+LET Sorted = SELECT foo FROM test() ORDER BY foo DESC
+SELECT * FROM Sorted LIMIT 2
+SELECT * FROM Sorted WHERE foo > 1 LIMIT 2
+SELECT foo FROM test() ORDER BY foo LIMIT 1
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for _, vql := range vqls {
+		for row := range vql.Eval(ctx, scope) {
+			foo, _ := scope.Associative(row, "foo")
+			output = append(output, foo)
+		}
+	}
+
+	// The query with a WHERE clause can not push its limit down.
+	assert.Equal(t, []int{2, 1}, sorter.limits)
+	assert.Equal(t, []Row{4, 2, 4, 2, 0}, output)
+}
+
+// Rows with the same key come out in arrival order whether or not the
+// limit is pushed down, so a LIMIT returns a prefix of the full
+// result.
+func TestOrderByLimitTies(t *testing.T) {
+	scope := makeTestScope()
+
+	vqls, err := MultiParse(`
+LET Y = SELECT V, K FROM foreach(row=[
+  dict(V=0, K=0), dict(V=1, K=1), dict(V=2, K=2), dict(V=3, K=0),
+  dict(V=4, K=1), dict(V=5, K=2), dict(V=6, K=0), dict(V=7, K=1),
+  dict(V=8, K=2), dict(V=9, K=0)]) ORDER BY K DESC
+SELECT V FROM Y
+SELECT V FROM Y LIMIT 4
+SELECT V FROM Y LIMIT 5
+`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output [][]Row
+	for _, vql := range vqls {
+		var values []Row
+		for row := range vql.Eval(ctx, scope) {
+			value, _ := scope.Associative(row, "V")
+			values = append(values, value)
+		}
+		if vql.Let == "" {
+			output = append(output, values)
+		}
+	}
+
+	all := []Row{int64(2), int64(5), int64(8),
+		int64(1), int64(4), int64(7),
+		int64(0), int64(3), int64(6), int64(9)}
+	assert.Equal(t, [][]Row{all, all[:4], all[:5]}, output)
+}
+
+// Rows may be routed to host provided sinks from VQL.
+func TestRowSink(t *testing.T) {
+	scope := makeTestScope()
+
+	var sunk []Row
+	scope.RegisterSink("results", types.RowSinkFunc(
+		func(ctx context.Context, scope types.Scope, row Row) error {
+			sunk = append(sunk, row)
+			return nil
+		}))
+
+	vql, err := Parse(`SELECT * FROM write_to(query={ SELECT * FROM test() }, sink="results")`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var output []Row
+	for row := range vql.Eval(ctx, scope) {
+		output = append(output, dict.RowToDict(ctx, scope, row))
+	}
+
+	assert.Equal(t, 3, len(sunk))
+	assert.Equal(t, 1, len(output))
+	rows, _ := output[0].(*ordereddict.Dict).Get("Rows")
+	assert.Equal(t, int64(3), rows)
+
+	// tee() relays the rows while also writing to the sink.
+	sunk = nil
+	vql, err = Parse(`SELECT * FROM tee(query={ SELECT * FROM test() }, sink="results")`)
+	assert.NoError(t, err)
+
+	output = nil
+	for row := range vql.Eval(ctx, scope) {
+		output = append(output, row)
+	}
+	assert.Equal(t, 3, len(sunk))
+	assert.Equal(t, sunk, output)
+}
+
 func TestVQLQueries(t *testing.T) {
 	// Store the result in ordered dict so we have a consistent golden file.
 	result := ordereddict.NewDict()
@@ -1528,6 +2535,15 @@ func TestVQLQueries(t *testing.T) {
 }
 
 func TestMultiVQLQueries(t *testing.T) {
+	checkMultiVQLQueries(t, false)
+}
+
+// Compiled queries give the same results.
+func TestCompiledMultiVQLQueries(t *testing.T) {
+	checkMultiVQLQueries(t, true)
+}
+
+func checkMultiVQLQueries(t *testing.T, compile bool) {
 	// Store the result in ordered dict so we have a consistent golden file.
 	result := ordereddict.NewDict()
 	for i, testCase := range multiVQLTest {
@@ -1544,6 +2560,10 @@ func TestMultiVQLQueries(t *testing.T) {
 		for idx, vql := range multi_vql {
 			var output []Row
 
+			if compile {
+				vql.Compile(scope)
+			}
+
 			for row := range vql.Eval(ctx, scope) {
 				output = append(output, dict.RowToDict(ctx, scope, row))
 			}
@@ -1593,3 +2613,706 @@ func TestVQLSerializaition(t *testing.T) {
 type structWithJson struct {
 	SrcIP string `json:"src_ip,omitempty"`
 }
+
+type schemaTestNested struct {
+	Path  string
+	Size  uint64
+	Mtime time.Time
+}
+
+type schemaTestArgs struct {
+	Name    string            `vfilter:"required,field=name,doc=The name to use"`
+	Count   int64             `vfilter:"optional,field=count,default=5"`
+	Mode    string            `vfilter:"optional,field=mode,choices=fast|slow"`
+	Tags    []string          `vfilter:"optional,field=tags"`
+	Query   types.StoredQuery `vfilter:"optional,field=query"`
+	Timeout time.Duration     `vfilter:"optional,field=timeout"`
+	Nested  *schemaTestNested `vfilter:"optional,field=nested"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	scope := makeTestScope()
+	type_map := types.NewTypeMap()
+
+	result := ordereddict.NewDict()
+	result.Set("custom", type_map.PluginJSONSchema(&types.PluginInfo{
+		Name:    "custom",
+		Doc:     "A custom plugin.",
+		ArgType: type_map.AddType(scope, &schemaTestArgs{}),
+	}))
+
+	result.Set("rows", type_map.JSONSchema(
+		type_map.AddType(scope, &schemaTestNested{})))
+
+	plugin, _ := scope.GetPlugin("foreach")
+	result.Set("foreach", type_map.PluginJSONSchema(
+		plugin.Info(scope, type_map)))
+
+	function, _ := scope.GetFunction("format")
+	result.Set("format", type_map.FunctionJSONSchema(
+		function.Info(scope, type_map)))
+
+	g := goldie.New(
+		t,
+		goldie.WithFixtureDir("fixtures"),
+		goldie.WithNameSuffix(".golden"),
+		goldie.WithDiffEngine(goldie.ColoredDiff),
+	)
+	g.AssertJson(t, "TestJSONSchema", result)
+}
+
+// A plugin which describes the columns of its rows.
+type annotatedPlugin struct{}
+
+func (self annotatedPlugin) Call(
+	ctx context.Context,
+	scope types.Scope,
+	args *ordereddict.Dict) <-chan Row {
+	output_chan := make(chan Row)
+
+	go func() {
+		defer close(output_chan)
+
+		output_chan <- ordereddict.NewDict().
+			Set("Name", "foo").
+			Set("Size", 10).
+			Set("Mtime", 1600000000)
+	}()
+
+	return output_chan
+}
+
+func (self annotatedPlugin) ColumnMetadata(
+	scope types.Scope, args *ordereddict.Dict) map[string]*types.ColumnMetadata {
+	return map[string]*types.ColumnMetadata{
+		"Size": {
+			Units:       "bytes",
+			Description: "The size of the file",
+		},
+		"Mtime": {
+			RenderHint: "timestamp",
+		},
+	}
+}
+
+func (self annotatedPlugin) Info(
+	scope types.Scope, type_map *types.TypeMap) *types.PluginInfo {
+	return &types.PluginInfo{
+		Name: "annotated",
+	}
+}
+
+func TestColumnMetadata(t *testing.T) {
+	ctx := context.Background()
+	metadata := func(query string) map[string]*types.ColumnMetadata {
+		scope := makeTestScope().AppendPlugins(annotatedPlugin{})
+		multi_vql, err := MultiParse(query)
+		assert.NoError(t, err)
+
+		for _, vql := range multi_vql {
+			for range vql.Eval(ctx, scope) {
+			}
+		}
+		return types.GetColumnMetadata(scope)
+	}
+
+	size := &types.ColumnMetadata{
+		Units:       "bytes",
+		Description: "The size of the file",
+	}
+	mtime := &types.ColumnMetadata{RenderHint: "timestamp"}
+
+	// Plain columns pass their metadata on, computed columns do
+	// not.
+	assert.Equal(t, map[string]*types.ColumnMetadata{
+		"Length": size,
+	}, metadata("SELECT Name, Size AS Length, Size * 2 AS Double FROM annotated()"))
+
+	assert.Equal(t, map[string]*types.ColumnMetadata{
+		"Size":  size,
+		"Mtime": mtime,
+	}, metadata("SELECT * FROM annotated()"))
+
+	// Metadata flows through stored queries and limits.
+	assert.Equal(t, map[string]*types.ColumnMetadata{
+		"Modified": mtime,
+	}, metadata(`
+LET files = SELECT Name, Mtime FROM annotated()
+SELECT Name, Mtime AS Modified FROM files LIMIT 1`))
+
+	// Subqueries in columns do not report their columns.
+	assert.Equal(t, map[string]*types.ColumnMetadata{}, metadata(
+		"SELECT { SELECT Size FROM annotated() } AS Sizes FROM scope()"))
+}
+
+func TestDictIntegerIndex(t *testing.T) {
+	scope := makeTestScope()
+
+	// Keys which match the index take precedence over the position.
+	scope.AppendVars(ordereddict.NewDict().Set("D", ordereddict.NewDict().
+		Set("1", "one").
+		Set("0", "zero").
+		Set("name", "Foo")))
+
+	vql, err := Parse(`SELECT D[0] AS A, D[1] AS B, D[2] AS C, D[-1] AS D FROM scope()`)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	encoder := func(rows []Row) ([]byte, error) {
+		return json.Marshal(rows)
+	}
+
+	output, err := OutputJSON(vql, ctx, scope, encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"A":"zero","B":"one","C":"Foo","D":"Foo"}]`, string(output))
+}
+
+func TestParseErrorContext(t *testing.T) {
+	_, err := MultiParse("LET X = 1\n\tSELECT * FROM X WHERE\n")
+	assert.EqualError(t, err,
+		"3:1: unexpected token \"<EOF>\" (expected <ident>)\n"+
+			"3 | \n"+
+			"  | ^")
+
+	_, err = MultiParse("LET X = 1\n\tSELECT * FROM X WHERE X = = 1\nSELECT * FROM X")
+	assert.EqualError(t, err,
+		"2:28: unexpected token \"=\" (expected <ident>)\n"+
+			"2 | \tSELECT * FROM X WHERE X = = 1\n"+
+			"  | \t                          ^")
+
+	// Unknown cast types are rejected.
+	_, err = Parse("SELECT * FROM X ORDER BY X::date")
+	assert.EqualError(t, err,
+		"1:29: unknown cast type date\n"+
+			"1 | SELECT * FROM X ORDER BY X::date\n"+
+			"  |                             ^")
+
+	_, err = Parse("SELECT * FROM X GROUP BY X::Foo")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown cast type Foo")
+
+	_, err = Parse("SELECT * FROM X GROUP BY X::INT ORDER BY X::Float")
+	assert.NoError(t, err)
+}
+
+func TestParsePartial(t *testing.T) {
+	result := ParsePartial("SELECT * FROM X")
+	assert.True(t, result.Complete)
+	assert.NoError(t, result.Error)
+	assert.Contains(t, result.Expected, "WHERE")
+	assert.Contains(t, result.Expected, "LIMIT")
+
+	result = ParsePartial("LET X = 1\nSELECT * FROM")
+	assert.False(t, result.Complete)
+	assert.Error(t, result.Error)
+	assert.Equal(t, 23, result.Offset)
+	assert.Equal(t, 2, result.Line)
+	assert.Equal(t, 14, result.Column)
+	assert.Equal(t, []string{"<ident>"}, result.Expected)
+
+	// The rest of the query after the error is ignored.
+	result = ParsePartial("SELECT * FROM X LIMIT foo WHERE")
+	assert.False(t, result.Complete)
+	assert.Equal(t, 22, result.Offset)
+	assert.Equal(t, []string{"<number>"}, result.Expected)
+}
+
+func TestStatementComments(t *testing.T) {
+	statements, err := MultiParseWithComments(`
+-- Lists the users.
+// Only local users are included.
+LET Users = SELECT * FROM scope() /* A trailing comment */
+
+/*
+   Counts the users.
+*/
+SELECT count() FROM Users /* The count */
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(statements))
+
+	assert.Equal(t, &StatementComments{
+		Doc:      []string{"Lists the users.", "Only local users are included."},
+		Trailing: []string{"A trailing comment"},
+	}, statements[0].GetComments())
+
+	assert.Equal(t, &StatementComments{
+		Doc:      []string{"Counts the users."},
+		Trailing: []string{"The count"},
+	}, statements[1].GetComments())
+}
+
+func TestMinify(t *testing.T) {
+	scope := makeTestScope()
+	query := `
+-- Count the items
+LET X = SELECT * FROM range(start=1, end=10) WHERE value > -1 /* Rows */
+
+SELECT count() AS Count, 'a b' + "c" AS Str,
+   value - -1 AS Minus
+FROM X
+GROUP BY value
+ORDER BY Count DESC
+LIMIT 5
+`
+	statements, err := MultiParseWithComments(query)
+	assert.NoError(t, err)
+
+	minified := Minify(scope, statements)
+	assert.Equal(t, "LET X=SELECT*FROM range(start=1,end=10)WHERE value>-1"+
+		"SELECT count()AS Count,'a b'+\"c\"AS Str,value- -1AS Minus "+
+		"FROM X GROUP BY value ORDER BY Count DESC LIMIT 5", minified)
+
+	// The minified query is equivalent to the original.
+	reparsed, err := MultiParse(minified)
+	assert.NoError(t, err)
+
+	original, err := MultiParse(query)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatToString(scope, original),
+		FormatToString(scope, reparsed))
+}
+
+func TestDiffQueries(t *testing.T) {
+	scope := makeTestScope()
+
+	old, err := MultiParse(`
+LET Files = SELECT * FROM glob(globs="/etc/*", accessor="file")
+LET Old = 1
+SELECT FullPath, Size, Mtime FROM Files WHERE Size > 10
+`)
+	assert.NoError(t, err)
+
+	new, err := MultiParse(`
+-- Comments and formatting do not matter.
+LET Files = SELECT *
+  FROM glob(globs="/etc/*", type="file")
+LET New = 2
+
+SELECT FullPath, Size / 2 AS Size, Name
+FROM chain(a=Files) WHERE Size > 20
+`)
+	assert.NoError(t, err)
+
+	changes := []string{}
+	for _, change := range DiffQueries(scope, old, new) {
+		changes = append(changes, change.String())
+	}
+
+	assert.Equal(t, []string{
+		"LET Old: statement_removed (LET Old = 1 -> )",
+		"LET Files: arg_renamed glob.type (accessor -> type)",
+		"LET New: statement_added ( -> LET New = 2)",
+		"query 1: column_removed Mtime (Mtime -> )",
+		"query 1: column_changed Size (Size -> Size / 2)",
+		"query 1: column_added Name ( -> Name)",
+		"query 1: condition_changed (Size > 10 -> Size > 20)",
+		"query 1: plugin_added chain",
+		"query 1: plugin_removed Files",
+	}, changes)
+}
+
+func TestDeterministicMode(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func(seed int64) []*ordereddict.Dict {
+		scope := NewScope()
+		defer scope.Close()
+		types.SetDeterministic(scope, seed, now)
+
+		vql, err := MultiParse(`
+LET Sampled = SELECT _value FROM sample(query={
+    SELECT _value FROM foreach(row=[1, 2, 3, 4, 5, 6, 7, 8])
+}, n=3)
+
+SELECT now() AS Now, rand(range=100) AS Rand, uuid() AS UUID,
+       Sampled._value AS Sample
+FROM range(end=2)
+`)
+		assert.NoError(t, err)
+
+		result := []*ordereddict.Dict{}
+		for _, query := range vql {
+			for row := range query.Eval(context.Background(), scope) {
+				result = append(result, RowToDict(context.Background(), scope, row))
+			}
+		}
+		return result
+	}
+
+	first := run(1)
+	assert.Equal(t, 2, len(first))
+	now_value, _ := first[0].Get("Now")
+	assert.Equal(t, now, now_value)
+
+	// The same seed gives the same results.
+	assert.Equal(t, first, run(1))
+	assert.NotEqual(t, first, run(2))
+}
+
+// Without an entropy source UUIDs come from crypto/rand.
+func TestUUID(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+
+	vql, err := Parse("SELECT uuid() AS UUID FROM range(end=3)")
+	assert.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for row := range vql.Eval(context.Background(), scope) {
+		value, _ := scope.Associative(row, "UUID")
+		uuid, _ := value.(string)
+		assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", uuid)
+		seen[uuid] = true
+	}
+	assert.Equal(t, 3, len(seen))
+}
+
+func TestQueryReports(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+	types.EnableQueryReports(scope)
+
+	vql, err := MultiParse(`
+LET X = SELECT * FROM range(end=10)
+SELECT _value, format(format='%v', args=_value) AS Formatted
+FROM X WHERE _value < 3
+`)
+	assert.NoError(t, err)
+
+	rows := 0
+	for _, query := range vql {
+		for _ = range query.Eval(context.Background(), scope) {
+			rows++
+		}
+	}
+	assert.Equal(t, 3, rows)
+
+	// Only the query records a report - not the LET.
+	reports := types.GetQueryReports(scope)
+	assert.Equal(t, 1, len(reports))
+
+	report := reports[0]
+	assert.Contains(t, report.Query, "SELECT _value")
+	// Rows are scanned by both the stored query and the query
+	// reading it.
+	assert.Equal(t, uint64(20), report.RowsScanned)
+	assert.Equal(t, uint64(3), report.RowsEmitted)
+	assert.Equal(t, uint64(1), report.PluginsCalled)
+	assert.Equal(t, uint64(3), report.FunctionsCalled)
+	assert.True(t, report.Duration > 0)
+	assert.True(t, report.HeapAllocAtEnd > 0)
+
+	// Only the most recent reports are kept.
+	for i := 0; i < types.MaxQueryReports+5; i++ {
+		for _ = range vql[1].Eval(context.Background(), scope) {
+		}
+	}
+	assert.Equal(t, types.MaxQueryReports, len(types.GetQueryReports(scope)))
+
+	// Reports are not recorded unless enabled.
+	scope = NewScope()
+	defer scope.Close()
+	for _ = range vql[1].Eval(context.Background(), scope) {
+	}
+	assert.Equal(t, 0, len(types.GetQueryReports(scope)))
+}
+
+// The report may be sent as the last item of the query's output.
+func TestQueryReportTrailer(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+	types.SetOption(scope, types.QueryReportTrailerOption, true)
+
+	vql, err := Parse("SELECT * FROM range(end=3)")
+	assert.NoError(t, err)
+
+	// Another query running in the same scope is not counted.
+	other, err := Parse("SELECT * FROM range(end=100)")
+	assert.NoError(t, err)
+	other_chan := other.Eval(context.Background(), scope)
+	<-other_chan
+
+	var rows []Row
+	for row := range vql.Eval(context.Background(), scope) {
+		rows = append(rows, row)
+		<-other_chan
+	}
+	for _ = range other_chan {
+	}
+	assert.Equal(t, 4, len(rows))
+
+	report, ok := rows[3].(*types.QueryReport)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), report.RowsScanned)
+	assert.Equal(t, uint64(3), report.RowsEmitted)
+	assert.Equal(t, uint64(1), report.PluginsCalled)
+
+	// The trailer does not record the report in the scope.
+	assert.Equal(t, 0, len(types.GetQueryReports(scope)))
+}
+
+// The trailer is still sent after the query's time limit is stopped.
+func TestQueryReportTrailerWithTimeout(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+	types.SetOption(scope, types.QueryReportTrailerOption, true)
+	types.SetOption(scope, types.QueryLimitsOption, &types.QueryLimits{
+		Timeout: 10 * time.Second})
+
+	vql, err := Parse("SELECT * FROM range(end=3)")
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		var rows []Row
+		for row := range vql.Eval(context.Background(), scope) {
+			rows = append(rows, row)
+		}
+		assert.Equal(t, 4, len(rows))
+		_, ok := rows[len(rows)-1].(*types.QueryReport)
+		assert.True(t, ok)
+	}
+}
+
+type secretKey string
+
+func TestRedaction(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+
+	scope.AppendVars(ordereddict.NewDict().
+		Set("Key", secretKey("hunter2")).
+		Set("Data", []*ordereddict.Dict{
+			ordereddict.NewDict().
+				Set("User", "alice").
+				Set("Password", "secret"),
+		}))
+	types.SetOption(scope, types.RedactionPolicyOption, &types.RedactionPolicy{
+		Columns: []string{"Password"},
+		Types:   []reflect.Type{reflect.TypeOf(secretKey(""))},
+	})
+
+	vql, err := MultiParse(`
+SELECT 'alice' AS User, Key AS K FROM scope()
+SELECT * FROM foreach(row=Data)
+SELECT Password AS P, Password + '' AS E, format(format='%v', args=Password) AS F
+FROM foreach(row=Data)
+SELECT Data[0].Password AS X, Data[0] AS Y FROM scope()
+SELECT User FROM foreach(row=Data) WHERE Password =~ '^sec'
+SELECT User, count() AS Count, Password
+FROM foreach(row=Data)
+GROUP BY User
+`)
+	assert.NoError(t, err)
+
+	run := func() []*ordereddict.Dict {
+		result := []*ordereddict.Dict{}
+		for _, query := range vql {
+			for row := range query.Eval(context.Background(), scope) {
+				result = append(result, dict.RowToDict(
+					context.Background(), scope, row))
+			}
+		}
+		return result
+	}
+
+	// Aliases, expressions and the WHERE clause only see the
+	// marker.
+	assert.Equal(t, []*ordereddict.Dict{
+		ordereddict.NewDict().
+			Set("User", "alice").
+			Set("K", types.RedactedMarker),
+		ordereddict.NewDict().
+			Set("User", "alice").
+			Set("Password", types.RedactedMarker),
+		ordereddict.NewDict().
+			Set("P", types.RedactedMarker).
+			Set("E", types.RedactedMarker).
+			Set("F", types.RedactedMarker),
+		ordereddict.NewDict().
+			Set("X", types.RedactedMarker).
+			Set("Y", ordereddict.NewDict().
+				Set("User", "alice").
+				Set("Password", types.RedactedMarker)),
+		ordereddict.NewDict().
+			Set("User", "alice").
+			Set("Count", uint64(1)).
+			Set("Password", types.RedactedMarker),
+	}, run())
+
+	// A privileged scope sees everything.
+	types.SetOption(scope, types.RedactionPrivilegeOption, true)
+	result := run()
+	assert.Equal(t, 6, len(result))
+	password, _ := result[1].Get("Password")
+	assert.Equal(t, "secret", password)
+	key, _ := result[0].Get("K")
+	assert.Equal(t, secretKey("hunter2"), key)
+	alias, _ := result[2].Get("P")
+	assert.Equal(t, "secret", alias)
+	user, _ := result[4].Get("User")
+	assert.Equal(t, "alice", user)
+}
+
+func TestMembership(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+
+	vql, err := MultiParse(`
+LET X = SELECT _value FROM range(end=1000)
+LET Y <= SELECT _value FROM range(end=3)
+LET Z = SELECT _value, 'x' AS Other FROM range(end=3)
+LET D = dict(a=1, b=2)
+SELECT 1 IN X AS Lazy, 1 IN Y AS Materialized, 7000 IN X AS Missing,
+       1 IN Z AS MultiColumn, dict(_value=1, Other='x') IN Z AS Row,
+       'a' IN D AS Key, 1 IN D AS Value
+FROM scope()
+`)
+	assert.NoError(t, err)
+
+	run := func() *ordereddict.Dict {
+		var result *ordereddict.Dict
+		for _, query := range vql {
+			for row := range query.Eval(context.Background(), scope) {
+				result = dict.RowToDict(context.Background(), scope, row)
+			}
+		}
+		return result
+	}
+
+	start := scope.GetStats().RowsScanned()
+	assert.Equal(t, ordereddict.NewDict().
+		Set("Lazy", true).
+		Set("Materialized", true).
+		Set("Missing", false).
+		Set("MultiColumn", false).
+		Set("Row", true).
+		Set("Key", true).
+		Set("Value", false), run())
+
+	// The stored query stops once a match is found so only the
+	// Missing column reads all of X.
+	assert.True(t, scope.GetStats().RowsScanned()-start < 1100)
+
+	types.SetOption(scope, types.DictMembershipOption, types.DictMembershipValues)
+	result := run()
+	key, _ := result.Get("Key")
+	assert.Equal(t, false, key)
+	value, _ := result.Get("Value")
+	assert.Equal(t, true, value)
+}
+
+func TestDeepRegex(t *testing.T) {
+	scope := NewScope()
+	defer scope.Close()
+
+	vql, err := Parse(`
+SELECT dict(x='Hello', y='World') =~ 'wor' AS Flat,
+       dict(x=dict(y=[1, dict(z='needle')])) =~ 'needle' AS Nested,
+       dict(x='Hello') =~ 'needle' AS Missing,
+       dict(needle='Hello') =~ 'needle' AS KeysIgnored
+FROM scope()`)
+	assert.NoError(t, err)
+
+	run := func() *ordereddict.Dict {
+		var result *ordereddict.Dict
+		for row := range vql.Eval(context.Background(), scope) {
+			result = dict.RowToDict(context.Background(), scope, row)
+		}
+		return result
+	}
+
+	// Dicts do not match by default.
+	assert.Equal(t, ordereddict.NewDict().
+		Set("Flat", false).
+		Set("Nested", false).
+		Set("Missing", false).
+		Set("KeysIgnored", false), run())
+
+	types.SetOption(scope, types.DeepRegexOption, true)
+	assert.Equal(t, ordereddict.NewDict().
+		Set("Flat", true).
+		Set("Nested", true).
+		Set("Missing", false).
+		Set("KeysIgnored", false), run())
+
+	// Maps are searched too.
+	assert.True(t, scope.Match("needle", map[string]interface{}{
+		"x": []interface{}{"a needle"},
+	}))
+}
+
+// Progress variables are only calculated when the query uses them.
+func TestSelectCountersOnlyWhenReferenced(t *testing.T) {
+	for _, test := range []struct {
+		query                             string
+		row_number, rows_emitted, elapsed bool
+	}{
+		{"SELECT * FROM test()", false, false, false},
+		{"SELECT _row_number FROM test()", true, false, false},
+		{"SELECT * FROM test() WHERE _rows_emitted < 2", false, true, false},
+		{"SELECT format(format='%v', args=_elapsed) FROM test()", false, false, true},
+	} {
+		vql, err := Parse(test.query)
+		assert.NoError(t, err)
+
+		counters := newSelectCounters(vql.Query)
+		assert.Equal(t, test.row_number, counters.uses_row_number, test.query)
+		assert.Equal(t, test.rows_emitted, counters.uses_rows_emitted, test.query)
+		assert.Equal(t, test.elapsed, counters.uses_elapsed, test.query)
+
+		// The query is only searched once.
+		cached := vql.Query.SelectExpression.progress_vars
+		assert.NotNil(t, cached, test.query)
+		newSelectCounters(vql.Query)
+		assert.True(t, cached == vql.Query.SelectExpression.progress_vars, test.query)
+
+		// Compiled queries find them up front.
+		vql, err = Parse(test.query)
+		assert.NoError(t, err)
+		vql.Compile(makeTestScope())
+		assert.Equal(t, test.row_number,
+			vql.Query.SelectExpression.progress_vars.uses_row_number, test.query)
+	}
+}
+
+// Variable origins are recorded on the scope level which defines
+// them when tracking is enabled.
+func TestVarOrigins(t *testing.T) {
+	scope := makeTestScope()
+	defer scope.Close()
+
+	ctx := context.Background()
+	run := func(scope types.Scope, query string) {
+		vqls, err := MultiParse(query)
+		assert.NoError(t, err)
+
+		for _, vql := range vqls {
+			for range vql.Eval(ctx, scope) {
+			}
+		}
+	}
+
+	// Not recorded by default.
+	run(scope, "LET Untracked = 1")
+	assert.Equal(t, "", types.GetVarOrigin(scope, "Untracked"))
+
+	types.SetOption(scope, types.TrackVarOriginsOption, true)
+	run(scope, `
+LET X = 1
+LET Y <= SELECT * FROM test()
+`)
+	assert.Equal(t, "LET X = 1", types.GetVarOrigin(scope, "X"))
+	assert.Equal(t, "LET Y <= SELECT * FROM test()",
+		types.GetVarOrigin(scope, "Y"))
+
+	// A redefinition in a subscope goes away with it.
+	subscope := scope.Copy()
+	run(subscope, "LET X = 2")
+	assert.Equal(t, "LET X = 2", types.GetVarOrigin(subscope, "X"))
+	subscope.Close()
+	assert.Equal(t, "LET X = 1", types.GetVarOrigin(scope, "X"))
+
+	run(scope, "LET X = 3")
+	assert.Equal(t, "LET X = 3", types.GetVarOrigin(scope, "X"))
+}
@@ -41,6 +41,9 @@ type FormatOptions struct {
 	ArgsOnNewLine    bool
 	BreakLines       bool
 	CollectCallSites bool
+
+	// Do not emit comments.
+	OmitComments bool
 }
 
 type CallSite struct {
@@ -270,9 +273,15 @@ func (self *Visitor) Visit(node interface{}) {
 	case *arg_parser.LazyExpressionWrapper:
 		self.Visit(t.Delegate())
 
-	case *materializer.InMemoryMatrializer:
+	case *materializer.InMemoryMatrializer, *materializer.ExpiringRows,
+		*materializer.FileRows:
 		return
 
+	case *_PipelineStage:
+		self.Visit(t.input)
+		self.push(" |> ")
+		self.Visit(t.plugin)
+
 	default:
 		self.scope.Log("FormatToString: Unable to visit %T", node)
 	}
@@ -283,6 +292,10 @@ func (self *Visitor) visitStoredExpression(node *StoredExpression) {
 }
 
 func (self *Visitor) visitComment(node *_Comment) {
+	if self.opts.OmitComments {
+		return
+	}
+
 	if node.Comment != nil {
 		self.push(*node.Comment)
 	}
@@ -536,6 +549,16 @@ func (self *Visitor) visitValue(node *_Value) {
 		return
 	}
 
+	// Keep number literals as written (e.g. 1_000_000).
+	if node.StrNumber != nil {
+		if node.Negated {
+			self.push("-")
+		}
+		self.push(*node.StrNumber)
+		node.mu.Unlock()
+		return
+	}
+
 	if node.Int != nil {
 		factor := int64(1)
 		if node.Negated {
@@ -612,7 +635,11 @@ func (self *Visitor) visitMemberExpression(node *_MemberExpression) {
 			self.push("]")
 
 		} else {
-			self.push(".")
+			if right.Optional {
+				self.push("?.")
+			} else {
+				self.push(".")
+			}
 			self.Visit(right.Term)
 		}
 	}
@@ -633,12 +660,20 @@ func (self *Visitor) visitArgs(node *_Args) {
 		}
 	}
 
+	// Positional args have no name.
+	prefix := ""
+	if node.Left != "" {
+		prefix = node.Left + "="
+	}
+
 	if node.Right != nil {
-		self.push(node.Left, "=")
+		if prefix != "" {
+			self.push(prefix)
+		}
 		self.Visit(node.Right)
 
 	} else if node.SubSelect != nil {
-		self.push(node.Left, "={")
+		self.push(prefix + "{")
 		self.indent_in()
 
 		self.line_break()
@@ -650,12 +685,12 @@ func (self *Visitor) visitArgs(node *_Args) {
 		self.push("}")
 
 	} else if node.Array != nil {
-		self.push(node.Left, "=[")
+		self.push(prefix + "[")
 		self.Visit(node.Array)
 		self.push("]")
 
 	} else if node.ArrayOpenBrace != "" {
-		self.push(node.Left, "=[]")
+		self.push(prefix + "[]")
 	}
 }
 
@@ -817,12 +852,24 @@ func (self *Visitor) visitSelect(node *_Select) {
 		self.push("GROUP BY ")
 		self.push_indent()
 		self.Visit(node.GroupBy)
+		if node.GroupByCast != nil {
+			self.push("::", string(*node.GroupByCast))
+		}
 		self.pop_indent()
 	}
 
+	if node.Having != nil {
+		self.line_break()
+		self.push("HAVING ")
+		self.Visit(node.Having)
+	}
+
 	if node.OrderBy != nil {
 		self.line_break()
 		self.push("ORDER BY ", *node.OrderBy)
+		if node.OrderByCast != nil {
+			self.push("::", string(*node.OrderByCast))
+		}
 
 		if node.OrderByDesc != nil && *node.OrderByDesc {
 			self.push(" DESC ")
@@ -833,6 +880,12 @@ func (self *Visitor) visitSelect(node *_Select) {
 		self.line_break()
 		self.push(fmt.Sprintf("LIMIT %d ", int(*node.Limit)))
 	}
+
+	for _, stage := range node.Pipeline {
+		self.line_break()
+		self.push("|> ")
+		self.Visit(stage)
+	}
 }
 
 func (self *Visitor) push(fragments ...string) {
@@ -890,6 +943,11 @@ func (self *Visitor) visitVQL(node *VQL) {
 		}
 	}
 
+	if node.Unlet != "" {
+		self.push("UNLET ", node.Unlet)
+		return
+	}
+
 	if node.Query != nil {
 		self.Visit(node.Query)
 	}